@@ -21,6 +21,7 @@ import (
 	_ "github.com/wader/fq/format/flac"
 	_ "github.com/wader/fq/format/gif"
 	_ "github.com/wader/fq/format/gzip"
+	_ "github.com/wader/fq/format/http"
 	_ "github.com/wader/fq/format/icc"
 	_ "github.com/wader/fq/format/id3"
 	_ "github.com/wader/fq/format/inet"
@@ -33,6 +34,7 @@ import (
 	_ "github.com/wader/fq/format/mp4"
 	_ "github.com/wader/fq/format/mpeg"
 	_ "github.com/wader/fq/format/msgpack"
+	_ "github.com/wader/fq/format/netflow"
 	_ "github.com/wader/fq/format/ogg"
 	_ "github.com/wader/fq/format/opus"
 	_ "github.com/wader/fq/format/pcap"
@@ -40,8 +42,10 @@ import (
 	_ "github.com/wader/fq/format/protobuf"
 	_ "github.com/wader/fq/format/raw"
 	_ "github.com/wader/fq/format/rtmp"
+	_ "github.com/wader/fq/format/smb"
 	_ "github.com/wader/fq/format/tar"
 	_ "github.com/wader/fq/format/text"
+	_ "github.com/wader/fq/format/textproto"
 	_ "github.com/wader/fq/format/tiff"
 	_ "github.com/wader/fq/format/toml"
 	_ "github.com/wader/fq/format/vorbis"
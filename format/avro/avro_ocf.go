@@ -4,12 +4,14 @@ import (
 	"bytes"
 	"compress/flate"
 	"embed"
+	"encoding/json"
 	"hash/crc32"
 
 	"github.com/golang/snappy"
 	"github.com/wader/fq/format"
 	"github.com/wader/fq/format/avro/decoders"
 	"github.com/wader/fq/format/avro/schema"
+	"github.com/wader/fq/internal/gojqextra"
 	"github.com/wader/fq/pkg/bitio"
 	"github.com/wader/fq/pkg/decode"
 	"github.com/wader/fq/pkg/interp"
@@ -25,9 +27,33 @@ func init() {
 		Description: "Avro object container file",
 		Groups:      []string{format.PROBE},
 		DecodeFn:    decodeAvroOCF,
-		Functions:   []string{"_help"},
+		DecodeInArg: format.AvroOCFIn{
+			Strict:        false,
+			FlattenUnions: false,
+			LenientSchema: false,
+			WireDetail:    false,
+		},
+		Functions: []string{"_help"},
 	})
 	interp.RegisterFS(avroOcfFS)
+	interp.RegisterFunc0("_avro_ocf_simplified_schema", simplifiedSchema)
+}
+
+// simplifiedSchema is the schema as used by the decoder, unknown attributes are properties
+func simplifiedSchema(_ *interp.Interp, c string) any {
+	var jsonSchema any
+	if err := json.Unmarshal([]byte(c), &jsonSchema); err != nil {
+		return err
+	}
+	b, err := json.Marshal(schema.FromLenient(jsonSchema))
+	if err != nil {
+		return err
+	}
+	var v any
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	return v
 }
 
 type HeaderData struct {
@@ -46,7 +72,23 @@ const headerSchemaSpec = `
   ]
 }`
 
-func decodeHeader(d *decode.D) HeaderData {
+// fieldSchemaErrors adds schema validation errors, returns true if there were any errors
+func fieldSchemaErrors(d *decode.D, errs []schema.ValidationError) bool {
+	if len(errs) == 0 {
+		return false
+	}
+	d.FieldArray("schema_errors", func(d *decode.D) {
+		for _, e := range errs {
+			d.FieldStruct("schema_error", func(d *decode.D) {
+				d.FieldValueStr("path", e.Path)
+				d.FieldValueStr("message", e.Message)
+			})
+		}
+	})
+	return true
+}
+
+func decodeHeader(d *decode.D, opts decoders.Options, lenientSchema bool) HeaderData {
 	d.FieldRawLen("magic", 4*8, d.AssertBitBuf([]byte{'O', 'b', 'j', 1}))
 
 	var headerData HeaderData
@@ -55,7 +97,7 @@ func decodeHeader(d *decode.D) HeaderData {
 	if err != nil {
 		d.Fatalf("Failed to parse header schema: %v", err)
 	}
-	decodeHeaderFn, err := decoders.DecodeFnForSchema(headerSchema)
+	decodeHeaderFn, err := decoders.DecodeFnForSchema(headerSchema, opts)
 	if err != nil {
 		d.Fatalf("failed to parse header: %v", err)
 	}
@@ -65,21 +107,34 @@ func decodeHeader(d *decode.D) HeaderData {
 	if !ok {
 		d.Fatalf("header is not a map")
 	}
-	meta, ok := headerRecord["meta"].(map[string]any)
+	meta, ok := headerRecord["meta"].(*gojqextra.OrderedObject)
 	if !ok {
 		d.Fatalf("header.meta is not a map")
 	}
 
-	metaSchema, ok := meta["avro.schema"].(string)
+	metaSchemaV, _ := meta.Get("avro.schema")
+	metaSchema, ok := metaSchemaV.(string)
 	if !ok {
 		d.Fatalf("missing meta avro.schema")
 	}
 
-	headerData.Schema, err = schema.FromSchemaString(metaSchema)
-	if err != nil {
-		d.Fatalf("failed to parse schema: %v", err)
+	var jsonSchema any
+	if err := json.Unmarshal([]byte(metaSchema), &jsonSchema); err != nil {
+		d.Fatalf("failed to parse schema: failed to unmarshal header schema: %v", err)
 	}
-	if codec, ok := meta["avro.codec"]; ok {
+	errs := schema.Validate(jsonSchema)
+	if fieldSchemaErrors(d, errs) && !lenientSchema {
+		d.Errorf("invalid schema: %s (%d errors)", errs[0], len(errs))
+	}
+	if lenientSchema {
+		headerData.Schema = schema.FromLenient(jsonSchema)
+	} else {
+		headerData.Schema, err = schema.From(jsonSchema)
+		if err != nil {
+			d.Fatalf("failed to parse schema: %v", err)
+		}
+	}
+	if codec, ok := meta.Get("avro.codec"); ok {
 		headerData.Codec, ok = codec.(string)
 		if !ok {
 			d.Fatalf("avro.codec is not a string")
@@ -129,20 +184,41 @@ func decodeBlockCodec(d *decode.D, dataSize int64, codec string) *bytes.Buffer {
 	return bb
 }
 
-func decodeAvroOCF(d *decode.D, _ any) any {
-	header := decodeHeader(d)
+// checks that block objects used exactly the block size, stray bytes can be
+// left behind by for example null values that should be zero bytes
+func checkBlockSize(d *decode.D, size int64, used int64, strict bool) {
+	if used == size {
+		return
+	}
+	if strict {
+		d.Errorf("block objects used %d bytes of block size %d", used, size)
+	}
+	if used < size {
+		d.FieldRawLen("unknown", (size-used)*8, scalar.Description("stray bytes after objects"))
+	}
+}
+
+func decodeAvroOCF(d *decode.D, in any) any {
+	ai, _ := in.(format.AvroOCFIn)
+	opts := decoders.Options{
+		Strict:        ai.Strict,
+		FlattenUnions: ai.FlattenUnions,
+		WireDetail:    ai.WireDetail,
+	}
+
+	header := decodeHeader(d, opts, ai.LenientSchema)
 
-	decodeFn, err := decoders.DecodeFnForSchema(header.Schema)
+	decodeFn, err := decoders.DecodeFnForSchema(header.Schema, opts)
 	if err != nil {
 		d.Fatalf("unable to create codec: %v", err)
 	}
 
 	d.FieldStructArrayLoop("blocks", "block", func() bool { return d.NotEnd() }, func(d *decode.D) {
-		count := d.FieldSFn("count", decoders.VarZigZag)
+		count := decoders.FieldVarZigZag(d, "count", ai.WireDetail)
 		if count <= 0 {
 			return
 		}
-		size := d.FieldSFn("size", decoders.VarZigZag)
+		size := decoders.FieldVarZigZag(d, "size", ai.WireDetail)
 		i := int64(0)
 
 		if header.Codec != "null" {
@@ -151,13 +227,16 @@ func decodeAvroOCF(d *decode.D, _ any) any {
 					for ; i < count; i++ {
 						decodeFn("data", d)
 					}
+					checkBlockSize(d, int64(bb.Len()), d.Pos()/8, ai.Strict)
 				})
 			}
 		} else {
+			dataStart := d.Pos()
 			d.FieldArrayLoop("data", func() bool { return i < count }, func(d *decode.D) {
 				decodeFn("datum", d)
 				i++
 			})
+			checkBlockSize(d, size, (d.Pos()-dataStart)/8, ai.Strict)
 		}
 		d.FieldRawLen("sync", 16*8, d.AssertBitBuf(header.Sync))
 	})
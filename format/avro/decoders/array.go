@@ -8,12 +8,12 @@ import (
 	"github.com/wader/fq/pkg/decode"
 )
 
-func decodeArrayFn(schema schema.SimplifiedSchema) (DecodeFn, error) {
+func decodeArrayFn(schema schema.SimplifiedSchema, opts Options) (DecodeFn, error) {
 	if schema.Items == nil {
 		return nil, errors.New("array schema must have items")
 	}
 
-	valueD, err := DecodeFnForSchema(*schema.Items)
+	valueD, err := DecodeFnForSchema(*schema.Items, opts)
 	if err != nil {
 		return nil, fmt.Errorf("failed getting decode fn for array item: %w", err)
 	}
@@ -34,9 +34,9 @@ func decodeArrayFn(schema schema.SimplifiedSchema) (DecodeFn, error) {
 			count := int64(-1)
 			for count != 0 {
 				d.FieldStruct("block", func(d *decode.D) {
-					count = d.FieldSFn("count", VarZigZag)
+					count = FieldVarZigZag(d, "count", opts.WireDetail)
 					if count < 0 {
-						d.FieldSFn("size", VarZigZag)
+						FieldVarZigZag(d, "size", opts.WireDetail)
 						count *= -1
 					}
 					d.FieldArray("data", func(d *decode.D) {
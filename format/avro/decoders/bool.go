@@ -1,15 +1,25 @@
 package decoders
 
 import (
+	"fmt"
+
 	"github.com/wader/fq/pkg/decode"
 	"github.com/wader/fq/pkg/scalar"
 )
 
-func decodeBoolFn(sms ...scalar.Mapper) (DecodeFn, error) {
+func decodeBoolFn(opts Options, sms ...scalar.Mapper) (DecodeFn, error) {
 	// A boolean is written as a single byte whose value is either 0 (false) or 1 (true).
 	return func(name string, d *decode.D) any {
-		return d.FieldBoolFn(name, func(d *decode.D) bool {
-			return d.U8() >= 1
+		return d.FieldBoolScalarFn(name, func(d *decode.D) scalar.S {
+			b := d.U8()
+			s := scalar.S{Actual: b != 0}
+			if b > 1 {
+				if opts.Strict {
+					d.Errorf("invalid boolean byte 0x%.2x", b)
+				}
+				s.Description = fmt.Sprintf("invalid boolean byte 0x%.2x", b)
+			}
+			return s
 		}, sms...)
 	}, nil
 }
@@ -10,42 +10,56 @@ import (
 
 type DecodeFn func(string, *decode.D) any
 
-func DecodeFnForSchema(s schema.SimplifiedSchema) (DecodeFn, error) {
+type Options struct {
+	// Strict fails decoding on invalid values instead of describing them
+	Strict bool
+	// FlattenUnions makes unions of null and one other type have the branch value as jq value
+	FlattenUnions bool
+	// WireDetail makes int, long, length and count fields structs with varint encoding details
+	WireDetail bool
+}
+
+func DecodeFnForSchema(s schema.SimplifiedSchema, opts Options) (DecodeFn, error) {
 	var sms []scalar.Mapper
-	mapper := logicalMapperForSchema(s)
+	mapper, err := logicalMapperForSchema(s)
+	if err != nil {
+		return nil, err
+	}
 	if mapper != nil {
 		sms = append(sms, mapper)
 	}
 
 	switch s.Type {
 	case schema.ARRAY:
-		return decodeArrayFn(s)
+		return decodeArrayFn(s, opts)
 	case schema.BOOLEAN:
-		return decodeBoolFn(sms...)
+		return decodeBoolFn(opts, sms...)
 	case schema.BYTES:
-		return decodeBytesFn(sms...)
+		return decodeBytesFn(opts, sms...)
 	case schema.DOUBLE:
 		return decodeDoubleFn(sms...)
 	case schema.ENUM:
-		return decodeEnumFn(s, sms...)
+		return decodeEnumFn(s, opts, sms...)
 	case schema.FIXED:
 		return decodeFixedFn(s, sms...)
 	case schema.FLOAT:
 		return decodeFloatFn(sms...)
 	case schema.INT:
-		return decodeIntFn(sms...)
+		return decodeIntFn(opts, sms...)
 	case schema.LONG:
-		return decodeLongFn(sms...)
+		return decodeLongFn(opts, sms...)
 	case schema.NULL:
 		return decodeNullFn(sms...)
 	case schema.RECORD:
-		return decodeRecordFn(s)
+		return decodeRecordFn(s, opts)
 	case schema.STRING:
-		return decodeStringFn(s, sms...)
+		return decodeStringFn(s, opts, sms...)
 	case schema.UNION:
-		return decodeUnionFn(s)
+		return decodeUnionFn(s, opts)
 	case schema.MAP:
-		return decodeMapFn(s)
+		return decodeMapFn(s, opts)
+	case schema.INVALID:
+		return decodeInvalidFn(s)
 	default:
 		return nil, fmt.Errorf("unknown type: %s", s.Type)
 	}
@@ -20,7 +20,7 @@ func (e EnumMapper) MapScalar(s scalar.S) (scalar.S, error) {
 	return s, nil
 }
 
-func decodeEnumFn(schema schema.SimplifiedSchema, sms ...scalar.Mapper) (DecodeFn, error) {
+func decodeEnumFn(schema schema.SimplifiedSchema, opts Options, sms ...scalar.Mapper) (DecodeFn, error) {
 	if len(schema.Symbols) == 0 {
 		return nil, errors.New("enum requires symbols")
 	}
@@ -30,5 +30,5 @@ func decodeEnumFn(schema schema.SimplifiedSchema, sms ...scalar.Mapper) (DecodeF
 	//	      {"type": "enum", "name": "Foo", "symbols": ["A", "B", "C", "D"] }
 	// This would be encoded by an int between zero and three, with zero indicating "A", and 3 indicating "D".
 	sms = append([]scalar.Mapper{EnumMapper{Symbols: schema.Symbols}}, sms...)
-	return decodeIntFn(sms...)
+	return decodeIntFn(opts, sms...)
 }
@@ -5,9 +5,9 @@ import (
 	"github.com/wader/fq/pkg/scalar"
 )
 
-func decodeIntFn(sms ...scalar.Mapper) (DecodeFn, error) {
+func decodeIntFn(opts Options, sms ...scalar.Mapper) (DecodeFn, error) {
 	// Int and long values are written using variable-length zig-zag coding.
 	return func(name string, d *decode.D) any {
-		return d.FieldSFn(name, VarZigZag, sms...)
+		return FieldVarZigZag(d, name, opts.WireDetail, sms...)
 	}, nil
 }
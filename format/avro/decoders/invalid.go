@@ -0,0 +1,16 @@
+package decoders
+
+import (
+	"github.com/wader/fq/format/avro/schema"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+// size of a value with invalid schema is unknown so rest of the data is raw and decoding stops
+func decodeInvalidFn(s schema.SimplifiedSchema) (DecodeFn, error) {
+	return func(name string, d *decode.D) any {
+		d.FieldRawLen(name, d.BitsLeft(), scalar.Description("invalid schema: "+s.Error))
+		d.Errorf("invalid schema for %s: %s", name, s.Error)
+		return nil
+	}, nil
+}
@@ -1,10 +1,15 @@
 package decoders
 
 import (
+	"bytes"
 	"errors"
+	"fmt"
+	"math/big"
 	"time"
 
 	"github.com/wader/fq/format/avro/schema"
+	"github.com/wader/fq/internal/bitioextra"
+	"github.com/wader/fq/pkg/bitio"
 	"github.com/wader/fq/pkg/scalar"
 )
 
@@ -17,28 +22,45 @@ const (
 	NANOSECOND
 )
 
-func logicalMapperForSchema(schema schema.SimplifiedSchema) scalar.Mapper {
-	switch schema.LogicalType {
+// logical type parameters are read from schema properties
+func logicalMapperForSchema(s schema.SimplifiedSchema) (scalar.Mapper, error) {
+	switch s.LogicalType {
 	case "timestamp":
-		return TimestampMapper{Precision: SECOND}
+		return TimestampMapper{Precision: SECOND}, nil
 	case "timestamp-millis":
-		return TimestampMapper{Precision: MILLISECOND}
+		return TimestampMapper{Precision: MILLISECOND}, nil
 	case "timestamp-micros":
-		return TimestampMapper{Precision: MICROSECOND}
+		return TimestampMapper{Precision: MICROSECOND}, nil
 	case "timestamp-nanos":
-		return TimestampMapper{Precision: NANOSECOND}
+		return TimestampMapper{Precision: NANOSECOND}, nil
 	case "time":
-		return TimeMapper{Precision: SECOND}
+		return TimeMapper{Precision: SECOND}, nil
 	case "time-millis":
-		return TimeMapper{Precision: MILLISECOND}
+		return TimeMapper{Precision: MILLISECOND}, nil
 	case "time-micros":
-		return TimeMapper{Precision: MICROSECOND}
+		return TimeMapper{Precision: MICROSECOND}, nil
 	case "time-nanos":
-		return TimeMapper{Precision: NANOSECOND}
+		return TimeMapper{Precision: NANOSECOND}, nil
 	case "date":
-		return DateMapper{}
+		return DateMapper{}, nil
+	case "decimal":
+		if s.Type != schema.BYTES && s.Type != schema.FIXED {
+			return nil, nil
+		}
+		precision, err := s.PropertyInt("precision")
+		if err != nil {
+			return nil, fmt.Errorf("decimal: %w", err)
+		}
+		scale, err := s.PropertyInt("scale")
+		if err != nil {
+			return nil, fmt.Errorf("decimal: %w", err)
+		}
+		if precision <= 0 || scale < 0 || scale > precision {
+			return nil, fmt.Errorf("decimal: invalid precision %d and scale %d", precision, scale)
+		}
+		return DecimalMapper{Scale: scale}, nil
 	default:
-		return nil
+		return nil, nil
 	}
 }
 
@@ -94,5 +116,28 @@ func (d DateMapper) MapScalar(s scalar.S) (scalar.S, error) {
 	return s, nil
 }
 
-// Todo Decimal: https://github.com/linkedin/goavro/blob/master/logical_type.go
+// DecimalMapper maps a big-endian two's-complement unscaled value to a decimal string
+type DecimalMapper struct {
+	Scale int
+}
+
+func (dm DecimalMapper) MapScalar(s scalar.S) (scalar.S, error) {
+	// clone as the value reader is also read by the decoder
+	br, err := bitio.CloneReader(s.ActualBitBuf())
+	if err != nil {
+		return s, err
+	}
+	b := &bytes.Buffer{}
+	if _, err := bitioextra.CopyBits(b, br); err != nil {
+		return s, err
+	}
+	bs := b.Bytes()
+	v := new(big.Int).SetBytes(bs)
+	if len(bs) > 0 && bs[0]&0x80 != 0 {
+		v.Sub(v, new(big.Int).Lsh(big.NewInt(1), uint(len(bs)*8)))
+	}
+	s.Sym = new(big.Rat).SetFrac(v, new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(dm.Scale)), nil)).FloatString(dm.Scale)
+	return s, nil
+}
+
 // Todo Duration
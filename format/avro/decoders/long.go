@@ -8,8 +8,8 @@ import (
 const intMask = 0b0111_1111
 const intFlag = 0b1000_0000
 
-// VarZigZag reads a variable length zigzag long from the current position in decoder
-func VarZigZag(d *decode.D) int64 {
+// varUint reads a variable length unsigned integer, returns value and number of bytes
+func varUint(d *decode.D) (uint64, int) {
 	var value uint64
 	var shift uint
 	size := 0
@@ -18,7 +18,7 @@ func VarZigZag(d *decode.D) int64 {
 		b := byte(d.U8())
 		value |= uint64(b&intMask) << shift
 		if b&intFlag == 0 {
-			return int64(value>>1) ^ -int64(value&1)
+			return value, size
 		}
 		shift += 7
 	}
@@ -26,12 +26,44 @@ func VarZigZag(d *decode.D) int64 {
 		d.Fatalf("long exceeds 8 bytes")
 	}
 	d.Fatalf("unexpected end of data")
-	return 0
+	return 0, 0
+}
+
+func zigZag(v uint64) int64 { return int64(v>>1) ^ -int64(v&1) }
+
+// VarZigZag reads a variable length zigzag long from the current position in decoder
+func VarZigZag(d *decode.D) int64 {
+	v, _ := varUint(d)
+	return zigZag(v)
 }
 
-func decodeLongFn(sms ...scalar.Mapper) (DecodeFn, error) {
+// FieldVarZigZag adds a zigzag long field. With wireDetail the field is a struct with value, zigzag
+// encoded value before decoding, number of varint bytes and if the encoding used as few bytes as
+// possible.
+func FieldVarZigZag(d *decode.D, name string, wireDetail bool, sms ...scalar.Mapper) int64 {
+	if !wireDetail {
+		return d.FieldSFn(name, VarZigZag, sms...)
+	}
+
+	var value int64
+	d.FieldStruct(name, func(d *decode.D) {
+		start := d.Pos()
+		raw, size := varUint(d)
+		// last byte zero means more bytes than needed, ex: 0x80 0x00 for zero
+		d.SeekRel(-8)
+		lastByte := d.U8()
+		d.SeekAbs(start)
+		value = d.FieldSFn("value", VarZigZag, sms...)
+		d.FieldValueU("zigzag_raw", raw)
+		d.FieldValueU("varint_bytes", uint64(size))
+		d.FieldValueBool("minimal", size == 1 || lastByte != 0)
+	})
+	return value
+}
+
+func decodeLongFn(opts Options, sms ...scalar.Mapper) (DecodeFn, error) {
 	// Int and long values are written using variable-length zig-zag coding.
 	return func(name string, d *decode.D) any {
-		return d.FieldSFn(name, VarZigZag, sms...)
+		return FieldVarZigZag(d, name, opts.WireDetail, sms...)
 	}, nil
 }
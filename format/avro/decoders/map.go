@@ -5,10 +5,11 @@ import (
 	"fmt"
 
 	"github.com/wader/fq/format/avro/schema"
+	"github.com/wader/fq/internal/gojqextra"
 	"github.com/wader/fq/pkg/decode"
 )
 
-func decodeMapFn(s schema.SimplifiedSchema) (DecodeFn, error) {
+func decodeMapFn(s schema.SimplifiedSchema, opts Options) (DecodeFn, error) {
 	if s.Values == nil {
 		return nil, errors.New("map schema must have values")
 	}
@@ -39,12 +40,13 @@ func decodeMapFn(s schema.SimplifiedSchema) (DecodeFn, error) {
 			},
 		},
 	}
-	subFn, err := DecodeFnForSchema(subSchema)
+	subFn, err := DecodeFnForSchema(subSchema, opts)
 	if err != nil {
 		return nil, fmt.Errorf("decode map: %w", err)
 	}
 	return func(s string, d *decode.D) any {
-		val := make(map[string]any)
+		// keep wire order of entries
+		val := gojqextra.NewOrderedObject()
 
 		rawV := subFn(s, d)
 		rawSlice, ok := rawV.([]any)
@@ -69,7 +71,7 @@ func decodeMapFn(s schema.SimplifiedSchema) (DecodeFn, error) {
 			if !ok {
 				d.Fatalf("decode map: expected string key in map %v", entry)
 			}
-			val[key] = value
+			val.Set(key, value)
 		}
 		return val
 	}, nil
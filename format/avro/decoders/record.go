@@ -7,7 +7,7 @@ import (
 	"github.com/wader/fq/pkg/decode"
 )
 
-func decodeRecordFn(schema schema.SimplifiedSchema) (DecodeFn, error) {
+func decodeRecordFn(schema schema.SimplifiedSchema, opts Options) (DecodeFn, error) {
 	if len(schema.Fields) == 0 {
 		return nil, fmt.Errorf("record must have fields")
 	}
@@ -16,7 +16,7 @@ func decodeRecordFn(schema schema.SimplifiedSchema) (DecodeFn, error) {
 
 	for _, f := range schema.Fields {
 		fieldNames = append(fieldNames, f.Name)
-		fc, err := DecodeFnForSchema(f.Type)
+		fc, err := DecodeFnForSchema(f.Type, opts)
 		if err != nil {
 			return nil, fmt.Errorf("failed parsing record field %s: %w", f.Name, err)
 		}
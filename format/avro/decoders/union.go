@@ -8,26 +8,37 @@ import (
 	"github.com/wader/fq/pkg/decode"
 )
 
-func decodeUnionFn(schema schema.SimplifiedSchema) (DecodeFn, error) {
-	if len(schema.UnionTypes) == 0 {
+func decodeUnionFn(s schema.SimplifiedSchema, opts Options) (DecodeFn, error) {
+	if len(s.UnionTypes) == 0 {
 		return nil, errors.New("union must have types")
 	}
 
 	var decoders []func(string, *decode.D) any
-	for i, t := range schema.UnionTypes {
-		decodeFn, err := DecodeFnForSchema(t)
+	for i, t := range s.UnionTypes {
+		decodeFn, err := DecodeFnForSchema(t, opts)
 		if err != nil {
 			return nil, fmt.Errorf("failed getting decodeFn for union type %d: %w", i, err)
 		}
 		decoders = append(decoders, decodeFn)
 	}
 
+	// ["null", T] or [T, "null"], type and value fields are kept for ranges
+	flatten := false
+	if opts.FlattenUnions && len(s.UnionTypes) == 2 {
+		for _, t := range s.UnionTypes {
+			flatten = flatten || t.Type == schema.NULL
+		}
+	}
+
 	// A union is encoded by first writing an int value indicating the zero-based position within the union of the
 	// schema of its value. The value is then encoded per the indicated schema within the union.
 	return func(name string, d *decode.D) any {
 		var val any
 		d.FieldStruct(name, func(d *decode.D) {
-			v := int(d.FieldSFn("type", VarZigZag))
+			if flatten {
+				d.SetValueChild("value")
+			}
+			v := int(FieldVarZigZag(d, "type", opts.WireDetail))
 			if v < 0 || v >= len(decoders) {
 				d.Fatalf("invalid union value: %d", v)
 			}
@@ -21,28 +21,83 @@ const (
 	RECORD  = "record"
 	STRING  = "string"
 	UNION   = "union" // avro spec doesn't treat unions like this, but makes it easier for us
+	// schema that could not be parsed, only used by FromLenient
+	INVALID = "invalid"
 )
 
 type SimplifiedSchema struct {
-	Type        string            `json:"type"`
-	Name        string            `json:"name"`
-	LogicalType string            `json:"logicalType,omitempty"`
-	Size        int               `json:"size,omitempty"`
-	Scale       int               `json:"scale,omitempty"`
-	Precision   int               `json:"precision,omitempty"`
-	Items       *SimplifiedSchema `json:"items,omitempty"`
-	Fields      []Field           `json:"fields,omitempty"`
-	Symbols     []string          `json:"symbols,omitempty"`
-	Values      *SimplifiedSchema `json:"values,omitempty"`
-	UnionTypes  []SimplifiedSchema
+	Type        string             `json:"type"`
+	Name        string             `json:"name,omitempty"`
+	LogicalType string             `json:"logicalType,omitempty"`
+	Size        int                `json:"size,omitempty"`
+	Items       *SimplifiedSchema  `json:"items,omitempty"`
+	Fields      []Field            `json:"fields,omitempty"`
+	Symbols     []string           `json:"symbols,omitempty"`
+	Values      *SimplifiedSchema  `json:"values,omitempty"`
+	UnionTypes  []SimplifiedSchema `json:"types,omitempty"`
+	// attributes not part of the spec, writer specific like avro.java.string and
+	// logical type parameters like precision and scale
+	Properties map[string]any `json:"properties,omitempty"`
+	// parse error for INVALID
+	Error string `json:"error,omitempty"`
 	// Choosing not to handle Default as it adds a lot of complexity and this is used for showing the binary
 	// representation of the data, not fully parsing it. See https://github.com/linkedin/goavro/blob/master/record.go
 	// for how it could be handled.
 }
 
 type Field struct {
-	Name string
-	Type SimplifiedSchema
+	Name       string           `json:"name"`
+	Type       SimplifiedSchema `json:"type"`
+	Properties map[string]any   `json:"properties,omitempty"`
+}
+
+// spec attributes, the rest are properties
+var schemaAttributes = map[string]bool{
+	"type":        true,
+	"name":        true,
+	"namespace":   true,
+	"doc":         true,
+	"aliases":     true,
+	"logicalType": true,
+	"size":        true,
+	"items":       true,
+	"fields":      true,
+	"symbols":     true,
+	"values":      true,
+	"default":     true,
+}
+
+var fieldAttributes = map[string]bool{
+	"name":    true,
+	"type":    true,
+	"doc":     true,
+	"default": true,
+	"order":   true,
+	"aliases": true,
+}
+
+// PropertyInt returns integer property, zero if not set
+func (s SimplifiedSchema) PropertyInt(key string) (int, error) {
+	return getInt(s.Properties, key, false)
+}
+
+// PropertyString returns string property, empty if not set
+func (s SimplifiedSchema) PropertyString(key string) (string, error) {
+	return getString(s.Properties, key, false)
+}
+
+func getProperties(m map[string]any, attributes map[string]bool) map[string]any {
+	var props map[string]any
+	for k, v := range m {
+		if attributes[k] {
+			continue
+		}
+		if props == nil {
+			props = map[string]any{}
+		}
+		props[k] = v
+	}
+	return props
 }
 
 func FromSchemaString(schemaString string) (SimplifiedSchema, error) {
@@ -55,6 +110,24 @@ func FromSchemaString(schemaString string) (SimplifiedSchema, error) {
 }
 
 func From(schema any) (SimplifiedSchema, error) {
+	return from(schema, false)
+}
+
+// FromLenient is like From but parts of the schema that can't be parsed are INVALID schemas
+func FromLenient(schema any) SimplifiedSchema {
+	s, _ := from(schema, true)
+	return s
+}
+
+func from(schema any, lenient bool) (SimplifiedSchema, error) {
+	s, err := fromStrict(schema, lenient)
+	if err != nil && lenient {
+		return SimplifiedSchema{Type: INVALID, Error: err.Error()}, nil
+	}
+	return s, err
+}
+
+func fromStrict(schema any, lenient bool) (SimplifiedSchema, error) {
 	if schema == nil {
 		return SimplifiedSchema{}, errors.New("schema cannot be nil")
 	}
@@ -62,8 +135,11 @@ func From(schema any) (SimplifiedSchema, error) {
 	switch v := schema.(type) {
 	case []any:
 		s.Type = UNION
+		if lenient && len(v) == 0 {
+			return s, errors.New("union must have types")
+		}
 		for _, i := range v {
-			unionType, err := From(i)
+			unionType, err := from(i, lenient)
 			if err != nil {
 				return s, fmt.Errorf("failed parsing union type: %w", err)
 			}
@@ -74,6 +150,9 @@ func From(schema any) (SimplifiedSchema, error) {
 		}
 	case string:
 		s.Type = v
+		if lenient && !primitiveTypes[v] {
+			return s, fmt.Errorf("unknown type %q", v)
+		}
 	case map[string]any:
 		var err error
 		if s.Type, err = getString(v, "type", true); err != nil {
@@ -85,29 +164,27 @@ func From(schema any) (SimplifiedSchema, error) {
 		if s.LogicalType, err = getString(v, "logicalType", false); err != nil {
 			return s, err
 		}
-		if s.Scale, err = getInt(v, "scale", false); err != nil {
-			return s, err
-		}
-		if s.Precision, err = getInt(v, "precision", false); err != nil {
-			return s, err
-		}
+		s.Properties = getProperties(v, schemaAttributes)
 		if s.Size, err = getInt(v, "size", false); err != nil {
 			return s, err
 		}
 		if s.Type == RECORD {
-			if s.Fields, err = getFields(v); err != nil {
+			if s.Fields, err = getFields(v, lenient); err != nil {
 				return s, fmt.Errorf("failed parsing fields: %w", err)
 			}
+			if lenient && len(s.Fields) == 0 {
+				return s, errors.New("record must have fields")
+			}
 		} else if s.Type == ENUM {
 			if s.Symbols, err = getSymbols(v); err != nil {
 				return s, fmt.Errorf("failed parsing symbols: %w", err)
 			}
 		} else if s.Type == ARRAY {
-			if s.Items, err = getSchema(v, "items"); err != nil {
+			if s.Items, err = getSchema(v, "items", lenient); err != nil {
 				return s, fmt.Errorf("failed parsing items: %w", err)
 			}
 		} else if s.Type == MAP {
-			if s.Values, err = getSchema(v, "values"); err != nil {
+			if s.Values, err = getSchema(v, "values", lenient); err != nil {
 				return s, fmt.Errorf("failed parsing values: %w", err)
 			}
 		}
@@ -117,12 +194,12 @@ func From(schema any) (SimplifiedSchema, error) {
 	return s, nil
 }
 
-func getSchema(m map[string]any, key string) (*SimplifiedSchema, error) {
+func getSchema(m map[string]any, key string, lenient bool) (*SimplifiedSchema, error) {
 	vI, ok := m[key]
 	if !ok {
 		return nil, fmt.Errorf("%s not found", key)
 	}
-	v, err := From(vI)
+	v, err := from(vI, lenient)
 	if err != nil {
 		return nil, fmt.Errorf("failed parsing %s: %w", key, err)
 	}
@@ -149,7 +226,7 @@ func getSymbols(m map[string]any) ([]string, error) {
 	return symbols, nil
 }
 
-func getFields(m map[string]any) ([]Field, error) {
+func getFields(m map[string]any, lenient bool) ([]Field, error) {
 	var fields []Field
 	var err error
 
@@ -162,22 +239,43 @@ func getFields(m map[string]any) ([]Field, error) {
 		return fields, errors.New("fields is not an array")
 	}
 
-	for _, fieldI := range fieldsAI {
+	names := map[string]bool{}
+	for i, fieldI := range fieldsAI {
 		field, ok := fieldI.(map[string]any)
 		if !ok {
+			if lenient {
+				fields = append(fields, Field{
+					Name: fmt.Sprintf("field%d", i),
+					Type: SimplifiedSchema{Type: INVALID, Error: "field is not a json object"},
+				})
+				continue
+			}
 			return fields, errors.New("field is not a json object")
 		}
 		var f Field
 		f.Name, err = getString(field, "name", true)
 		if err != nil {
-			return fields, fmt.Errorf("failed parsing field name: %w", err)
+			if !lenient {
+				return fields, fmt.Errorf("failed parsing field name: %w", err)
+			}
+			f.Name = fmt.Sprintf("field%d", i)
+		}
+		if lenient && names[f.Name] {
+			f.Name = fmt.Sprintf("field%d", i)
 		}
+		names[f.Name] = true
+		f.Properties = getProperties(field, fieldAttributes)
 		t, ok := field["type"]
 		if !ok {
+			if lenient {
+				f.Type = SimplifiedSchema{Type: INVALID, Error: "field type is required"}
+				fields = append(fields, f)
+				continue
+			}
 			return fields, errors.New("field type must be a object")
 		}
 
-		if f.Type, err = From(t); err != nil {
+		if f.Type, err = from(t, lenient); err != nil {
 			return fields, fmt.Errorf("failed parsing field %s type: %w", f.Name, err)
 		}
 		fields = append(fields, f)
@@ -0,0 +1,421 @@
+package schema
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// https://avro.apache.org/docs/1.11.1/specification/#names
+var nameRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+var primitiveTypes = map[string]bool{
+	NULL:    true,
+	BOOLEAN: true,
+	INT:     true,
+	LONG:    true,
+	FLOAT:   true,
+	DOUBLE:  true,
+	BYTES:   true,
+	STRING:  true,
+}
+
+// ValidationError is a schema error, path is JSON pointer like path to the invalid part of the schema
+type ValidationError struct {
+	Path    string
+	Message string
+}
+
+func (e ValidationError) Error() string {
+	return e.Path + ": " + e.Message
+}
+
+type validator struct {
+	errors []ValidationError
+	// fullname to type, named types can be referenced after definition
+	named map[string]string
+}
+
+func (v *validator) errorf(path string, format string, a ...any) {
+	if path == "" {
+		path = "/"
+	}
+	v.errors = append(v.errors, ValidationError{Path: path, Message: fmt.Sprintf(format, a...)})
+}
+
+// Validate checks a JSON decoded schema using the rules in the avro specification and returns all errors found
+func Validate(schema any) []ValidationError {
+	v := &validator{named: map[string]string{}}
+	v.schema("", schema, "")
+	return v.errors
+}
+
+func validName(name string) bool {
+	return nameRe.MatchString(name)
+}
+
+// namespace is empty or dot separated names
+func validNamespace(namespace string) bool {
+	if namespace == "" {
+		return true
+	}
+	for _, p := range strings.Split(namespace, ".") {
+		if !validName(p) {
+			return false
+		}
+	}
+	return true
+}
+
+// fullname returns fullname and namespace for name, a name with dots is a fullname and
+// namespace is ignored, otherwise namespace attribute or enclosing namespace is used
+func fullname(name string, namespace string, enclosing string) (string, string) {
+	if i := strings.LastIndex(name, "."); i != -1 {
+		return name, name[0:i]
+	}
+	if namespace == "" {
+		namespace = enclosing
+	}
+	if namespace == "" {
+		return name, ""
+	}
+	return namespace + "." + name, namespace
+}
+
+// resolve finds fullname and type of a named type reference, relative names are looked up in the
+// enclosing namespace and then in the null namespace
+func (v *validator) resolve(name string, enclosing string) (string, string, bool) {
+	if !strings.Contains(name, ".") && enclosing != "" {
+		if t, ok := v.named[enclosing+"."+name]; ok {
+			return enclosing + "." + name, t, true
+		}
+	}
+	t, ok := v.named[name]
+	return name, t, ok
+}
+
+// typeName is the type a schema resolves to or empty if unknown
+func (v *validator) typeName(schema any, enclosing string) string {
+	switch s := schema.(type) {
+	case string:
+		if primitiveTypes[s] {
+			return s
+		}
+		_, t, _ := v.resolve(s, enclosing)
+		if t == "error" {
+			return RECORD
+		}
+		return t
+	case []any:
+		return UNION
+	case map[string]any:
+		switch t := s["type"].(type) {
+		case string:
+			switch t {
+			case RECORD, "error":
+				return RECORD
+			case ENUM, FIXED, ARRAY, MAP:
+				return t
+			}
+		}
+		return v.typeName(s["type"], enclosing)
+	}
+	return ""
+}
+
+// unionBranchKey identifies a union branch, a union can't have more than one branch of each
+// unnamed type or more than one named type with the same fullname
+func (v *validator) unionBranchKey(schema any, enclosing string) string {
+	switch s := schema.(type) {
+	case string:
+		if primitiveTypes[s] {
+			return s
+		}
+		name, _, _ := v.resolve(s, enclosing)
+		return name
+	case map[string]any:
+		t := v.typeName(s, enclosing)
+		switch t {
+		case RECORD, ENUM, FIXED:
+			name, _ := s["name"].(string)
+			namespace, _ := s["namespace"].(string)
+			name, _ = fullname(name, namespace, enclosing)
+			return name
+		}
+		return t
+	}
+	return ""
+}
+
+func (v *validator) schema(path string, schema any, enclosing string) {
+	switch s := schema.(type) {
+	case string:
+		if primitiveTypes[s] {
+			return
+		}
+		if _, _, ok := v.resolve(s, enclosing); !ok {
+			v.errorf(path, "unknown type %q", s)
+		}
+	case []any:
+		v.union(path, s, enclosing)
+	case map[string]any:
+		v.object(path, s, enclosing)
+	case nil:
+		v.errorf(path, "schema can't be null")
+	default:
+		v.errorf(path, "schema must be a string, object or array")
+	}
+}
+
+func (v *validator) union(path string, s []any, enclosing string) {
+	if len(s) == 0 {
+		v.errorf(path, "union must have at least one type")
+		return
+	}
+	seen := map[string]int{}
+	for i, t := range s {
+		branchPath := path + "/" + strconv.Itoa(i)
+		if _, ok := t.([]any); ok {
+			v.errorf(branchPath, "union can't directly contain another union")
+			continue
+		}
+		v.schema(branchPath, t, enclosing)
+		key := v.unionBranchKey(t, enclosing)
+		if key == "" {
+			continue
+		}
+		if j, ok := seen[key]; ok {
+			v.errorf(branchPath, "duplicate type %q in union, same as %d", key, j)
+			continue
+		}
+		seen[key] = i
+	}
+}
+
+// name validates and defines a named type, returns namespace for nested types
+func (v *validator) name(path string, s map[string]any, typ string, enclosing string) string {
+	nameV, ok := s["name"]
+	if !ok {
+		v.errorf(path, "%s must have a name", typ)
+		return enclosing
+	}
+	name, ok := nameV.(string)
+	if !ok {
+		v.errorf(path+"/name", "name must be a string")
+		return enclosing
+	}
+	namespace := ""
+	if nsV, ok := s["namespace"]; ok {
+		if namespace, ok = nsV.(string); !ok {
+			v.errorf(path+"/namespace", "namespace must be a string")
+		} else if !validNamespace(namespace) {
+			v.errorf(path+"/namespace", "invalid namespace %q", namespace)
+		}
+	}
+
+	full, ns := fullname(name, namespace, enclosing)
+	// last part is the name, rest is namespace
+	if i := strings.LastIndex(name, "."); i != -1 {
+		if !validNamespace(name[0:i]) || !validName(name[i+1:]) {
+			v.errorf(path+"/name", "invalid fullname %q", name)
+		}
+	} else if !validName(name) {
+		v.errorf(path+"/name", "invalid name %q", name)
+	}
+	// primitive type names can't be defined in any namespace
+	if primitiveTypes[full[strings.LastIndex(full, ".")+1:]] {
+		v.errorf(path+"/name", "name %q can't be a primitive type name", name)
+	}
+	if _, ok := v.named[full]; ok {
+		v.errorf(path+"/name", "type %q already defined", full)
+	}
+	v.named[full] = typ
+
+	return ns
+}
+
+func (v *validator) object(path string, s map[string]any, enclosing string) {
+	typeV, ok := s["type"]
+	if !ok {
+		v.errorf(path, "type is required")
+		return
+	}
+	typ, ok := typeV.(string)
+	if !ok {
+		// {"type": {...}} or {"type": [...]} is same as the inner schema
+		v.schema(path+"/type", typeV, enclosing)
+		return
+	}
+
+	switch typ {
+	case RECORD, "error":
+		ns := v.name(path, s, typ, enclosing)
+		v.fields(path, s, ns)
+	case ENUM:
+		v.name(path, s, typ, enclosing)
+		v.enum(path, s)
+	case FIXED:
+		v.name(path, s, typ, enclosing)
+		size, ok := s["size"]
+		if !ok {
+			v.errorf(path, "fixed must have a size")
+		} else if n, ok := size.(float64); !ok || n < 0 || n != float64(int64(n)) {
+			v.errorf(path+"/size", "size must be a non-negative integer")
+		}
+	case ARRAY:
+		items, ok := s["items"]
+		if !ok {
+			v.errorf(path, "array must have items")
+			return
+		}
+		v.schema(path+"/items", items, enclosing)
+	case MAP:
+		values, ok := s["values"]
+		if !ok {
+			v.errorf(path, "map must have values")
+			return
+		}
+		v.schema(path+"/values", values, enclosing)
+	default:
+		v.schema(path+"/type", typ, enclosing)
+	}
+}
+
+func (v *validator) fields(path string, s map[string]any, enclosing string) {
+	fieldsV, ok := s["fields"]
+	if !ok {
+		v.errorf(path, "record must have fields")
+		return
+	}
+	fields, ok := fieldsV.([]any)
+	if !ok {
+		v.errorf(path+"/fields", "fields must be an array")
+		return
+	}
+
+	names := map[string]int{}
+	for i, fV := range fields {
+		fieldPath := path + "/fields/" + strconv.Itoa(i)
+		f, ok := fV.(map[string]any)
+		if !ok {
+			v.errorf(fieldPath, "field must be an object")
+			continue
+		}
+
+		if nameV, ok := f["name"]; !ok {
+			v.errorf(fieldPath, "field must have a name")
+		} else if name, ok := nameV.(string); !ok {
+			v.errorf(fieldPath+"/name", "name must be a string")
+		} else if !validName(name) {
+			v.errorf(fieldPath+"/name", "invalid name %q", name)
+		} else if j, ok := names[name]; ok {
+			v.errorf(fieldPath+"/name", "duplicate field name %q, same as field %d", name, j)
+		} else {
+			names[name] = i
+		}
+
+		t, ok := f["type"]
+		if !ok {
+			v.errorf(fieldPath, "field must have a type")
+			continue
+		}
+		v.schema(fieldPath+"/type", t, enclosing)
+
+		if d, ok := f["default"]; ok {
+			v.defaultValue(fieldPath+"/default", t, d, enclosing)
+		}
+	}
+}
+
+func (v *validator) enum(path string, s map[string]any) {
+	symbolsV, ok := s["symbols"]
+	if !ok {
+		v.errorf(path, "enum must have symbols")
+		return
+	}
+	symbolsA, ok := symbolsV.([]any)
+	if !ok {
+		v.errorf(path+"/symbols", "symbols must be an array")
+		return
+	}
+	symbols := map[string]int{}
+	for i, symV := range symbolsA {
+		symPath := path + "/symbols/" + strconv.Itoa(i)
+		sym, ok := symV.(string)
+		if !ok {
+			v.errorf(symPath, "symbol must be a string")
+			continue
+		}
+		if !validName(sym) {
+			v.errorf(symPath, "invalid symbol %q", sym)
+		}
+		if j, ok := symbols[sym]; ok {
+			v.errorf(symPath, "duplicate symbol %q, same as %d", sym, j)
+			continue
+		}
+		symbols[sym] = i
+	}
+	if d, ok := s["default"]; ok {
+		if sym, ok := d.(string); !ok {
+			v.errorf(path+"/default", "enum default must be a string")
+		} else if _, ok := symbols[sym]; !ok {
+			v.errorf(path+"/default", "enum default %q is not a symbol", sym)
+		}
+	}
+}
+
+// defaultValue checks that JSON type of default matches schema, for unions the default is
+// for the first type
+func (v *validator) defaultValue(path string, schema any, d any, enclosing string) {
+	if u, ok := schema.([]any); ok {
+		if len(u) == 0 {
+			return
+		}
+		schema = u[0]
+	}
+
+	typ := v.typeName(schema, enclosing)
+	var ok bool
+	switch typ {
+	case NULL:
+		ok = d == nil
+	case BOOLEAN:
+		_, ok = d.(bool)
+	case INT, LONG:
+		n, isNumber := d.(float64)
+		ok = isNumber && n == float64(int64(n))
+	case FLOAT, DOUBLE:
+		_, ok = d.(float64)
+	case BYTES, STRING, FIXED, ENUM:
+		_, ok = d.(string)
+	case ARRAY:
+		_, ok = d.([]any)
+	case MAP, RECORD:
+		_, ok = d.(map[string]any)
+	default:
+		// unknown or invalid type is reported by schema validation
+		return
+	}
+	if !ok {
+		v.errorf(path, "default %s is not a valid %s", jsonTypeName(d), typ)
+	}
+}
+
+func jsonTypeName(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case string:
+		return strconv.Quote(v)
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
@@ -0,0 +1,188 @@
+package schema
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	testCases := []struct {
+		name     string
+		schema   string
+		expected []ValidationError
+	}{
+		{
+			name: "valid",
+			schema: `{"type": "record", "name": "r", "namespace": "a.b", "fields": [
+				{"name": "e", "type": {"type": "enum", "name": "E", "symbols": ["A", "B"], "default": "A"}},
+				{"name": "f", "type": {"type": "fixed", "name": "c.F", "size": 4}},
+				{"name": "e2", "type": "E"},
+				{"name": "f2", "type": "c.F"},
+				{"name": "self", "type": ["null", "a.b.r"], "default": null},
+				{"name": "l", "type": "long", "default": 1},
+				{"name": "m", "type": {"type": "map", "values": {"type": "array", "items": "string"}}, "default": {}}
+			]}`,
+			expected: nil,
+		},
+		{
+			name:     "null schema",
+			schema:   `null`,
+			expected: []ValidationError{{Path: "/", Message: "schema can't be null"}},
+		},
+		{
+			name:     "missing type",
+			schema:   `{"name": "r"}`,
+			expected: []ValidationError{{Path: "/", Message: "type is required"}},
+		},
+		{
+			name:     "missing fields",
+			schema:   `{"type": "record", "name": "r"}`,
+			expected: []ValidationError{{Path: "/", Message: "record must have fields"}},
+		},
+		{
+			name:     "fields not array",
+			schema:   `{"type": "record", "name": "r", "fields": {}}`,
+			expected: []ValidationError{{Path: "/fields", Message: "fields must be an array"}},
+		},
+		{
+			name: "bad field name and missing type",
+			schema: `{"type": "record", "name": "r", "fields": [
+				{"name": "a-b", "type": "int"},
+				{"name": "c"},
+				"d"
+			]}`,
+			expected: []ValidationError{
+				{Path: "/fields/0/name", Message: `invalid name "a-b"`},
+				{Path: "/fields/1", Message: "field must have a type"},
+				{Path: "/fields/2", Message: "field must be an object"},
+			},
+		},
+		{
+			name: "duplicate field names",
+			schema: `{"type": "record", "name": "r", "fields": [
+				{"name": "a", "type": "int"},
+				{"name": "b", "type": "int"},
+				{"name": "a", "type": "long"}
+			]}`,
+			expected: []ValidationError{{Path: "/fields/2/name", Message: `duplicate field name "a", same as field 0`}},
+		},
+		{
+			name: "bad default types",
+			schema: `{"type": "record", "name": "r", "fields": [
+				{"name": "a", "type": "int", "default": "1"},
+				{"name": "b", "type": "int", "default": 1.5},
+				{"name": "c", "type": ["string", "null"], "default": null},
+				{"name": "d", "type": {"type": "array", "items": "int"}, "default": {}}
+			]}`,
+			expected: []ValidationError{
+				{Path: "/fields/0/default", Message: `default "1" is not a valid int`},
+				{Path: "/fields/1/default", Message: "default 1.5 is not a valid int"},
+				{Path: "/fields/2/default", Message: "default null is not a valid string"},
+				{Path: "/fields/3/default", Message: "default object is not a valid array"},
+			},
+		},
+		{
+			name: "invalid names and namespaces",
+			schema: `{"type": "record", "name": "1r", "namespace": "a..b", "fields": [
+				{"name": "f", "type": {"type": "fixed", "name": "a.-b", "size": 1}},
+				{"name": "g", "type": {"type": "enum", "name": "int", "symbols": ["A"]}}
+			]}`,
+			expected: []ValidationError{
+				{Path: "/namespace", Message: `invalid namespace "a..b"`},
+				{Path: "/name", Message: `invalid name "1r"`},
+				{Path: "/fields/0/type/name", Message: `invalid fullname "a.-b"`},
+				{Path: "/fields/1/type/name", Message: `name "int" can't be a primitive type name`},
+			},
+		},
+		{
+			name: "unknown and unresolved types",
+			schema: `{"type": "record", "name": "r", "namespace": "ns", "fields": [
+				{"name": "a", "type": "integer"},
+				{"name": "b", "type": {"type": "fixed", "name": "F", "namespace": "other", "size": 1}},
+				{"name": "c", "type": "F"},
+				{"name": "d", "type": "other.F"}
+			]}`,
+			expected: []ValidationError{
+				{Path: "/fields/0/type", Message: `unknown type "integer"`},
+				{Path: "/fields/2/type", Message: `unknown type "F"`},
+			},
+		},
+		{
+			name: "redefined type",
+			schema: `{"type": "record", "name": "r", "fields": [
+				{"name": "a", "type": {"type": "fixed", "name": "F", "size": 1}},
+				{"name": "b", "type": {"type": "enum", "name": "F", "symbols": ["A"]}}
+			]}`,
+			expected: []ValidationError{{Path: "/fields/1/type/name", Message: `type "F" already defined`}},
+		},
+		{
+			name:   "bad unions",
+			schema: `{"type": "record", "name": "r", "fields": [{"name": "a", "type": []}, {"name": "b", "type": ["null", ["int"], "string", "null"]}]}`,
+			expected: []ValidationError{
+				{Path: "/fields/0/type", Message: "union must have at least one type"},
+				{Path: "/fields/1/type/1", Message: "union can't directly contain another union"},
+				{Path: "/fields/1/type/3", Message: `duplicate type "null" in union, same as 0`},
+			},
+		},
+		{
+			name:   "bad enum",
+			schema: `{"type": "enum", "name": "E", "symbols": ["A", "B", "A", "c-d", 1], "default": "X"}`,
+			expected: []ValidationError{
+				{Path: "/symbols/2", Message: `duplicate symbol "A", same as 0`},
+				{Path: "/symbols/3", Message: `invalid symbol "c-d"`},
+				{Path: "/symbols/4", Message: "symbol must be a string"},
+				{Path: "/default", Message: `enum default "X" is not a symbol`},
+			},
+		},
+		{
+			name:   "bad fixed, array and map",
+			schema: `[{"type": "fixed", "name": "F", "size": -1}, {"type": "fixed", "name": "G"}, {"type": "array"}, {"type": "map", "values": "nope"}]`,
+			expected: []ValidationError{
+				{Path: "/0/size", Message: "size must be a non-negative integer"},
+				{Path: "/1", Message: "fixed must have a size"},
+				{Path: "/2", Message: "array must have items"},
+				{Path: "/3/values", Message: `unknown type "nope"`},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			var s any
+			if err := json.Unmarshal([]byte(tc.schema), &s); err != nil {
+				t.Fatal(err)
+			}
+			actual := Validate(s)
+			if !reflect.DeepEqual(tc.expected, actual) {
+				t.Errorf("expected:\n%v\ngot:\n%v", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestFromLenient(t *testing.T) {
+	var s any
+	if err := json.Unmarshal([]byte(`{"type": "record", "name": "r", "fields": [
+		{"name": "a", "type": "int"},
+		{"name": "b", "type": "integer"},
+		{"name": "c", "type": {"type": "record", "name": "n"}}
+	]}`), &s); err != nil {
+		t.Fatal(err)
+	}
+
+	actual := FromLenient(s)
+	var actualTypes []string
+	for _, f := range actual.Fields {
+		actualTypes = append(actualTypes, f.Type.Type+" "+f.Type.Error)
+	}
+	expectedTypes := []string{
+		"int ",
+		`invalid unknown type "integer"`,
+		"invalid failed parsing fields: no fields",
+	}
+	if !reflect.DeepEqual(expectedTypes, actualTypes) {
+		t.Errorf("expected %v got %v", expectedTypes, actualTypes)
+	}
+}
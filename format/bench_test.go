@@ -0,0 +1,69 @@
+package format_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+)
+
+func benchmarkDecodeFile(b *testing.B, formatName string, path string, inArg any) {
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		b.Fatal(err)
+	}
+	group := interp.DefaultRegistry.MustFormatGroup(formatName)
+	b.SetBytes(int64(len(bs)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := decode.Decode(context.Background(), bitio.NewBitReader(bs, -1), group, decode.Options{
+			IsRoot:      true,
+			FillGaps:    true,
+			FormatInArg: inArg,
+		}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkMacho(b *testing.B) {
+	const path = "macho/testdata/darwin_fat/a_dynamic"
+	b.Run("full", func(b *testing.B) {
+		benchmarkDecodeFile(b, format.MACHO, path, format.MachoIn{})
+	})
+	b.Run("headers_only", func(b *testing.B) {
+		benchmarkDecodeFile(b, format.MACHO, path, format.MachoIn{HeadersOnly: true})
+	})
+}
+
+// packets_limit should allocate less as no decode tree is built for most packets
+func BenchmarkPcap(b *testing.B) {
+	const path = "pcap/testdata/many_udp.pcap"
+	in := format.PcapIn{Flows: true, ChecksumOffload: "auto", ChecksumOffloadRatio: 0.5, DuplicateWindow: 32}
+	b.Run("full", func(b *testing.B) {
+		benchmarkDecodeFile(b, format.PCAP, path, in)
+	})
+	b.Run("packets_limit", func(b *testing.B) {
+		in := in
+		in.PacketsLimit = 10
+		benchmarkDecodeFile(b, format.PCAP, path, in)
+	})
+}
+
+func BenchmarkPcapng(b *testing.B) {
+	const path = "pcap/testdata/many_udp.pcapng"
+	in := format.PcapngIn{Flows: true, ChecksumOffload: "auto", ChecksumOffloadRatio: 0.5, DuplicateWindow: 32}
+	b.Run("full", func(b *testing.B) {
+		benchmarkDecodeFile(b, format.PCAPNG, path, in)
+	})
+	b.Run("packets_limit", func(b *testing.B) {
+		in := in
+		in.PacketsLimit = 10
+		benchmarkDecodeFile(b, format.PCAPNG, path, in)
+	})
+}
@@ -28,7 +28,7 @@ func init() {
 		Name:        format.CBOR,
 		Description: "Concise Binary Object Representation",
 		DecodeFn:    decodeCBOR,
-		Functions:   []string{"torepr", "_help"},
+		Functions:   []string{"torepr", "_from", "_help"},
 	})
 	interp.RegisterFS(cborFS)
 }
@@ -0,0 +1,503 @@
+package cbor
+
+// convert between CBOR and jq values
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"sort"
+	"strconv"
+
+	"github.com/wader/fq/internal/gojqextra"
+	"github.com/wader/fq/internal/mathextra"
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/gojq"
+)
+
+func init() {
+	interp.RegisterFunc0("_fromcbor", fromCBOR)
+	interp.RegisterFunc1("_tocbor", toCBOR)
+}
+
+type cborReader struct {
+	b []byte
+	i int
+}
+
+func (r *cborReader) byte() (byte, error) {
+	if r.i >= len(r.b) {
+		return 0, io.ErrUnexpectedEOF
+	}
+	b := r.b[r.i]
+	r.i++
+	return b, nil
+}
+
+// isBreak consumes next byte if it is a break marker, only used by indefinite length
+// containers so that a misplaced break inside a definite length container is an error
+func (r *cborReader) isBreak() bool {
+	if r.i < len(r.b) && r.b[r.i] == breakMarker {
+		r.i++
+		return true
+	}
+	return false
+}
+
+func (r *cborReader) bytes(n uint64) ([]byte, error) {
+	if n > uint64(len(r.b)-r.i) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	b := r.b[r.i : r.i+int(n)]
+	r.i += int(n)
+	return b, nil
+}
+
+func (r *cborReader) uint(n int) (uint64, error) {
+	b, err := r.bytes(uint64(n))
+	if err != nil {
+		return 0, err
+	}
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v, nil
+}
+
+func (r *cborReader) count(shortCount byte) (uint64, error) {
+	switch {
+	case shortCount < shortCountVariable8Bit:
+		return uint64(shortCount), nil
+	case shortCount == shortCountVariable8Bit:
+		return r.uint(1)
+	case shortCount == shortCountVariable16Bit:
+		return r.uint(2)
+	case shortCount == shortCountVariable32Bit:
+		return r.uint(4)
+	case shortCount == shortCountVariable64Bit:
+		return r.uint(8)
+	default:
+		return 0, fmt.Errorf("incorrect short count %d", shortCount)
+	}
+}
+
+func uintToValue(n uint64) any {
+	if n > math.MaxInt {
+		return new(big.Int).SetUint64(n)
+	}
+	return int(n)
+}
+
+func bigIntToValue(n *big.Int) any {
+	if n.IsInt64() && n.Int64() >= math.MinInt && n.Int64() <= math.MaxInt {
+		return int(n.Int64())
+	}
+	return n
+}
+
+// chunks reads indefinite length byte or text string chunks
+func (r *cborReader) chunks(majorType byte) ([]byte, error) {
+	bb := &bytes.Buffer{}
+	for {
+		b, err := r.byte()
+		if err != nil {
+			return nil, err
+		}
+		if b == breakMarker {
+			return bb.Bytes(), nil
+		}
+		if b>>5 != majorType || b&0x1f == shortCountIndefinite {
+			return nil, fmt.Errorf("invalid chunk in indefinite length string")
+		}
+		n, err := r.count(b & 0x1f)
+		if err != nil {
+			return nil, err
+		}
+		c, err := r.bytes(n)
+		if err != nil {
+			return nil, err
+		}
+		bb.Write(c)
+	}
+}
+
+func (r *cborReader) value() (any, error) {
+	b, err := r.byte()
+	if err != nil {
+		return nil, err
+	}
+	majorType := b >> 5
+	shortCount := b & 0x1f
+
+	if shortCount == shortCountIndefinite {
+		switch majorType {
+		case majorTypeBytes:
+			bs, err := r.chunks(majorType)
+			if err != nil {
+				return nil, err
+			}
+			return interp.NewBinaryFromBitReader(bitio.NewBitReader(bs, -1), 8, 0)
+		case majorTypeUTF8:
+			bs, err := r.chunks(majorType)
+			if err != nil {
+				return nil, err
+			}
+			return string(bs), nil
+		case majorTypeArray:
+			vs := []any{}
+			for !r.isBreak() {
+				v, err := r.value()
+				if err != nil {
+					return nil, err
+				}
+				vs = append(vs, v)
+			}
+			return vs, nil
+		case majorTypeMap:
+			m := map[string]any{}
+			for !r.isBreak() {
+				k, err := r.value()
+				if err != nil {
+					return nil, err
+				}
+				v, err := r.value()
+				if err != nil {
+					return nil, err
+				}
+				m[cborMapKey(k)] = v
+			}
+			return m, nil
+		case majorTypeSpecialFloat:
+			return nil, fmt.Errorf("unexpected break at byte %d", r.i-1)
+		default:
+			return nil, fmt.Errorf("major type %d can't be indefinite length", majorType)
+		}
+	}
+
+	if majorType == majorTypeSpecialFloat {
+		switch shortCount {
+		case shortCountSpecialFalse:
+			return false, nil
+		case shortCountSpecialTrue:
+			return true, nil
+		case shortCountSpecialNull, shortCountSpecialUndefined:
+			return nil, nil
+		case shortCountSpecialFloat16Bit:
+			n, err := r.uint(2)
+			if err != nil {
+				return nil, err
+			}
+			return float64(mathextra.Float16(n).Float32()), nil
+		case shortCountSpecialFloat32Bit:
+			n, err := r.uint(4)
+			if err != nil {
+				return nil, err
+			}
+			return float64(math.Float32frombits(uint32(n))), nil
+		case shortCountSpecialFloat64Bit:
+			n, err := r.uint(8)
+			if err != nil {
+				return nil, err
+			}
+			return math.Float64frombits(n), nil
+		default:
+			n, err := r.count(shortCount)
+			if err != nil {
+				return nil, err
+			}
+			return map[string]any{"simple": int(n)}, nil
+		}
+	}
+
+	count, err := r.count(shortCount)
+	if err != nil {
+		return nil, err
+	}
+
+	switch majorType {
+	case majorTypePositiveInt:
+		return uintToValue(count), nil
+	case majorTypeNegativeInt:
+		n := new(big.Int).SetUint64(count)
+		n.Neg(n).Sub(n, mathextra.BigIntOne)
+		return bigIntToValue(n), nil
+	case majorTypeBytes:
+		bs, err := r.bytes(count)
+		if err != nil {
+			return nil, err
+		}
+		return interp.NewBinaryFromBitReader(bitio.NewBitReader(bs, -1), 8, 0)
+	case majorTypeUTF8:
+		bs, err := r.bytes(count)
+		if err != nil {
+			return nil, err
+		}
+		return string(bs), nil
+	case majorTypeArray:
+		vs := make([]any, 0, count)
+		for i := uint64(0); i < count; i++ {
+			v, err := r.value()
+			if err != nil {
+				return nil, err
+			}
+			vs = append(vs, v)
+		}
+		return vs, nil
+	case majorTypeMap:
+		m := map[string]any{}
+		for i := uint64(0); i < count; i++ {
+			k, err := r.value()
+			if err != nil {
+				return nil, err
+			}
+			v, err := r.value()
+			if err != nil {
+				return nil, err
+			}
+			m[cborMapKey(k)] = v
+		}
+		return m, nil
+	case majorTypeSematic:
+		v, err := r.value()
+		if err != nil {
+			return nil, err
+		}
+		// bignums as numbers, other tags are kept as {tag, value}
+		if bv, ok := v.(interp.Binary); ok && (count == 2 || count == 3) {
+			bs, err := binaryBytes(bv)
+			if err != nil {
+				return nil, err
+			}
+			n := new(big.Int).SetBytes(bs)
+			if count == 3 {
+				n.Neg(n).Sub(n, mathextra.BigIntOne)
+			}
+			return bigIntToValue(n), nil
+		}
+		return map[string]any{"tag": uintToValue(count), "value": v}, nil
+	}
+
+	panic("unreachable")
+}
+
+// cborMapKey converts non-string keys to their JSON representation as jq object keys has to be strings
+func cborMapKey(k any) string {
+	switch k := k.(type) {
+	case string:
+		return k
+	case int:
+		return strconv.Itoa(k)
+	case interp.Binary:
+		bs, _ := binaryBytes(k)
+		return string(bs)
+	default:
+		b, _ := gojq.Marshal(gojqextra.Normalize(k))
+		return string(b)
+	}
+}
+
+func binaryBytes(b interp.Binary) ([]byte, error) {
+	br, err := interp.ToBitReader(b)
+	if err != nil {
+		return nil, err
+	}
+	bb := &bytes.Buffer{}
+	if _, err := io.Copy(bb, bitio.NewIOReader(br)); err != nil {
+		return nil, err
+	}
+	return bb.Bytes(), nil
+}
+
+func fromCBOR(_ *interp.Interp, c any) any {
+	br, err := interp.ToBitReader(c)
+	if err != nil {
+		return err
+	}
+	bb := &bytes.Buffer{}
+	if _, err := io.Copy(bb, bitio.NewIOReader(br)); err != nil {
+		return err
+	}
+	r := &cborReader{b: bb.Bytes()}
+	v, err := r.value()
+	if err != nil {
+		return err
+	}
+	if r.i != len(r.b) {
+		return fmt.Errorf("trailing data after CBOR value at byte %d", r.i)
+	}
+	return v
+}
+
+type toCBOROpts struct {
+	Canonical bool
+}
+
+type cborWriter struct {
+	bytes.Buffer
+	canonical bool
+}
+
+func (w *cborWriter) head(majorType byte, n uint64) {
+	switch {
+	case n < shortCountVariable8Bit:
+		w.WriteByte(majorType<<5 | byte(n))
+	case n <= math.MaxUint8:
+		w.WriteByte(majorType<<5 | shortCountVariable8Bit)
+		w.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		w.WriteByte(majorType<<5 | shortCountVariable16Bit)
+		_ = binary.Write(w, binary.BigEndian, uint16(n))
+	case n <= math.MaxUint32:
+		w.WriteByte(majorType<<5 | shortCountVariable32Bit)
+		_ = binary.Write(w, binary.BigEndian, uint32(n))
+	default:
+		w.WriteByte(majorType<<5 | shortCountVariable64Bit)
+		_ = binary.Write(w, binary.BigEndian, n)
+	}
+}
+
+func (w *cborWriter) bigInt(n *big.Int) {
+	if n.Sign() >= 0 {
+		if n.IsUint64() {
+			w.head(majorTypePositiveInt, n.Uint64())
+			return
+		}
+		w.head(majorTypeSematic, 2)
+		bs := n.Bytes()
+		w.head(majorTypeBytes, uint64(len(bs)))
+		w.Write(bs)
+		return
+	}
+	// -1 - n
+	m := new(big.Int).Neg(n)
+	m.Sub(m, mathextra.BigIntOne)
+	if m.IsUint64() {
+		w.head(majorTypeNegativeInt, m.Uint64())
+		return
+	}
+	w.head(majorTypeSematic, 3)
+	bs := m.Bytes()
+	w.head(majorTypeBytes, uint64(len(bs)))
+	w.Write(bs)
+}
+
+// float uses the shortest float encoding that represents the value exactly
+func (w *cborWriter) float(f float64) {
+	if f16 := mathextra.NewFloat16(float32(f)); float64(f16.Float32()) == f || math.IsNaN(f) {
+		w.WriteByte(majorTypeSpecialFloat<<5 | shortCountSpecialFloat16Bit)
+		_ = binary.Write(w, binary.BigEndian, uint16(f16))
+		return
+	}
+	if float64(float32(f)) == f {
+		w.WriteByte(majorTypeSpecialFloat<<5 | shortCountSpecialFloat32Bit)
+		_ = binary.Write(w, binary.BigEndian, math.Float32bits(float32(f)))
+		return
+	}
+	w.WriteByte(majorTypeSpecialFloat<<5 | shortCountSpecialFloat64Bit)
+	_ = binary.Write(w, binary.BigEndian, math.Float64bits(f))
+}
+
+func (w *cborWriter) value(v any) error {
+	switch v := v.(type) {
+	case interp.Binary:
+		bs, err := binaryBytes(v)
+		if err != nil {
+			return err
+		}
+		w.head(majorTypeBytes, uint64(len(bs)))
+		w.Write(bs)
+		return nil
+	case gojq.JQValue:
+		return w.value(v.JQValueToGoJQ())
+	}
+
+	switch v := v.(type) {
+	case nil:
+		w.WriteByte(majorTypeSpecialFloat<<5 | shortCountSpecialNull)
+	case bool:
+		if v {
+			w.WriteByte(majorTypeSpecialFloat<<5 | shortCountSpecialTrue)
+		} else {
+			w.WriteByte(majorTypeSpecialFloat<<5 | shortCountSpecialFalse)
+		}
+	case int:
+		w.bigInt(big.NewInt(int64(v)))
+	case *big.Int:
+		w.bigInt(v)
+	case float64:
+		if math.Trunc(v) == v && math.Abs(v) <= 1<<53 {
+			w.bigInt(big.NewInt(int64(v)))
+		} else {
+			w.float(v)
+		}
+	case string:
+		w.head(majorTypeUTF8, uint64(len(v)))
+		w.WriteString(v)
+	case []any:
+		w.head(majorTypeArray, uint64(len(v)))
+		for _, e := range v {
+			if err := w.value(e); err != nil {
+				return err
+			}
+		}
+	case map[string]any:
+		// {tag: number, value: any} is a tagged value
+		if t, ok := v["tag"]; ok && len(v) == 2 {
+			if e, ok := v["value"]; ok {
+				if n, ok := t.(int); ok && n >= 0 {
+					w.head(majorTypeSematic, uint64(n))
+					return w.value(e)
+				}
+			}
+		}
+
+		type pair struct {
+			s string
+			k []byte
+			v any
+		}
+		ps := make([]pair, 0, len(v))
+		for k, e := range v {
+			kw := &cborWriter{}
+			kw.head(majorTypeUTF8, uint64(len(k)))
+			kw.WriteString(k)
+			ps = append(ps, pair{s: k, k: kw.Bytes(), v: e})
+		}
+		if w.canonical {
+			// RFC 8949 4.2.1 bytewise lexicographic order of encoded keys
+			sort.Slice(ps, func(i, j int) bool { return bytes.Compare(ps[i].k, ps[j].k) < 0 })
+		} else {
+			// jq key order
+			sort.Slice(ps, func(i, j int) bool { return ps[i].s < ps[j].s })
+		}
+
+		w.head(majorTypeMap, uint64(len(ps)))
+		for _, p := range ps {
+			w.Write(p.k)
+			if err := w.value(p.v); err != nil {
+				return err
+			}
+		}
+	default:
+		return gojqextra.FuncTypeError{Name: "tocbor", V: v}
+	}
+
+	return nil
+}
+
+func toCBOR(_ *interp.Interp, c any, opts toCBOROpts) any {
+	w := &cborWriter{canonical: opts.Canonical}
+	if err := w.value(c); err != nil {
+		return err
+	}
+	bb, err := interp.NewBinaryFromBitReader(bitio.NewBitReader(w.Bytes(), -1), 8, 0)
+	if err != nil {
+		return err
+	}
+	return bb
+}
@@ -0,0 +1,64 @@
+package format_test
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	_ "github.com/wader/fq/format/all"
+	"github.com/wader/fq/internal/script"
+	"github.com/wader/fq/pkg/interp"
+)
+
+// determinismQuery renders the decode tree and iterates all keys a few times, iteration order of
+// objects is not visible in dv output and small maps often iterate in the same order
+const determinismQuery = `dv, if [range(4) as $_ | [.. | keys?]] | unique | length > 1 then error("` + nondeterministicKeys + `") else empty end`
+
+const nondeterministicKeys = "nondeterministic keys"
+
+func renderFile(t *testing.T, path string) string {
+	c := script.ParseCases(fmt.Sprintf("$ fq -d probe '%s' %s\n", determinismQuery, filepath.Base(path)))
+	c.Path = filepath.Join(filepath.Dir(path), "determinism.fqtest")
+	cr, ok := c.Parts[0].(*script.CaseRun)
+	if !ok {
+		t.Fatal("expected a run")
+	}
+	i, err := interp.New(cr, interp.DefaultRegistry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// decode errors are part of the rendered output
+	_ = i.Main(context.Background(), cr.Stdout(), "testversion")
+
+	return cr.ActualStdoutBuf.String() + cr.ActualStderrBuf.String()
+}
+
+// TestDeterministicRender decodes all fixtures and probe corpus files twice and fails if the
+// rendered output differs, ex if map iteration order leaks into fields, arrays or keys.
+func TestDeterministicRender(t *testing.T) {
+	for _, p := range probeCorpusFiles(t) {
+		p := p
+		t.Run(p, func(t *testing.T) {
+			t.Parallel()
+
+			first := renderFile(t, p)
+			if strings.Contains(first, nondeterministicKeys) {
+				t.Fatal(nondeterministicKeys)
+			}
+			second := renderFile(t, p)
+			if first == second {
+				return
+			}
+			firstLines := strings.Split(first, "\n")
+			secondLines := strings.Split(second, "\n")
+			for i := 0; i < len(firstLines) && i < len(secondLines); i++ {
+				if firstLines[i] != secondLines[i] {
+					t.Fatalf("output differs at line %d:\n%s\n%s", i+1, firstLines[i], secondLines[i])
+				}
+			}
+			t.Fatalf("output differs in number of lines %d != %d", len(firstLines), len(secondLines))
+		})
+	}
+}
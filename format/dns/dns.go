@@ -2,6 +2,8 @@ package dns
 
 // https://datatracker.ietf.org/doc/html/rfc1035
 // https://github.com/Forescout/namewreck/blob/main/rfc/draft-dashevskyi-dnsrr-antipatterns-00.txt
+// https://datatracker.ietf.org/doc/html/rfc6762 mDNS
+// https://datatracker.ietf.org/doc/html/rfc6763 DNS-SD
 
 import (
 	"net"
@@ -18,8 +20,8 @@ func init() {
 		Name:        format.DNS,
 		Description: "DNS packet",
 		Groups: []string{
-			format.TCP_STREAM,
 			format.UDP_PAYLOAD,
+			format.UDP_STREAM,
 		},
 		DecodeFn: dnsUDPDecode,
 	})
@@ -51,6 +53,7 @@ const (
 	typePTR   = 12
 	typeTXT   = 16
 	typeAAAA  = 28
+	typeSRV   = 33
 )
 
 var typeNames = scalar.UToSymStr{
@@ -90,12 +93,14 @@ var typeNames = scalar.UToSymStr{
 	24:        "sig",
 	53:        "smimea",
 	typeSOA:   "soa",
-	33:        "srv",
+	typeSRV:   "srv",
 	44:        "sshfp",
 	32768:     "ta",
 	249:       "tkey",
 	52:        "tlsa",
 	250:       "tsig",
+	251:       "ixfr",
+	252:       "axfr",
 	typeTXT:   "txt",
 	256:       "uri",
 	63:        "zonemd",
@@ -174,13 +179,25 @@ func fieldDecodeLabel(d *decode.D, pointerOffset int64, name string) {
 	}
 }
 
-func dnsDecodeRR(d *decode.D, pointerOffset int64, resp bool, count uint64, name string, structName string) {
+func dnsDecodeRR(d *decode.D, pointerOffset int64, isMDNS bool, resp bool, count uint64, name string, structName string) {
 	d.FieldArray(name, func(d *decode.D) {
 		for i := uint64(0); i < count; i++ {
 			d.FieldStruct(structName, func(d *decode.D) {
 				fieldDecodeLabel(d, pointerOffset, "name")
 				typ := d.FieldU16("type", typeNames)
-				class := d.FieldU16("class", classNames)
+				var class uint64
+				if isMDNS {
+					// mDNS uses top bit of class as QU (unicast response) bit for questions
+					// and cache flush bit for resource records
+					if resp {
+						d.FieldBool("cache_flush")
+					} else {
+						d.FieldBool("unicast_response")
+					}
+					class = d.FieldU15("class", classNames)
+				} else {
+					class = d.FieldU16("class", classNames)
+				}
 				if resp {
 					d.FieldU32("ttl")
 					rdLength := d.FieldU16("rdlength")
@@ -215,6 +232,11 @@ func dnsDecodeRR(d *decode.D, pointerOffset int64, resp bool, count uint64, name
 							})
 						case class == classIN && typ == typeAAAA:
 							d.FieldStrFn("address", decodeAAAAStr)
+						case typ == typeSRV:
+							d.FieldU16("priority")
+							d.FieldU16("weight")
+							d.FieldU16("port")
+							fieldDecodeLabel(d, pointerOffset, "target")
 						default:
 							d.FieldUTF8("rdata", int(rdLength))
 						}
@@ -225,11 +247,12 @@ func dnsDecodeRR(d *decode.D, pointerOffset int64, resp bool, count uint64, name
 	})
 }
 
-func dnsDecode(d *decode.D, isTCP bool) any {
-	pointerOffset := int64(0)
+func dnsDecode(d *decode.D, isTCP bool, isMDNS bool) any {
+	// compression pointers are relative to start of message
+	pointerOffset := d.Pos()
 	d.FieldStruct("header", func(d *decode.D) {
 		if isTCP {
-			pointerOffset = 16
+			pointerOffset += 16
 			d.FieldU16("length")
 		}
 		d.FieldU16("id")
@@ -256,17 +279,34 @@ func dnsDecode(d *decode.D, isTCP bool) any {
 	anCount := d.FieldU16("an_count")
 	nsCount := d.FieldU16("ns_count")
 	arCount := d.FieldU16("ar_count")
-	dnsDecodeRR(d, pointerOffset, false, qdCount, "questions", "question")
-	dnsDecodeRR(d, pointerOffset, true, anCount, "answers", "answer")
-	dnsDecodeRR(d, pointerOffset, true, nsCount, "nameservers", "nameserver")
-	dnsDecodeRR(d, pointerOffset, true, arCount, "additionals", "additional")
+	dnsDecodeRR(d, pointerOffset, isMDNS, false, qdCount, "questions", "question")
+	dnsDecodeRR(d, pointerOffset, isMDNS, true, anCount, "answers", "answer")
+	dnsDecodeRR(d, pointerOffset, isMDNS, true, nsCount, "nameservers", "nameserver")
+	dnsDecodeRR(d, pointerOffset, isMDNS, true, arCount, "additionals", "additional")
 
 	return nil
 }
 
 func dnsUDPDecode(d *decode.D, in any) any {
-	if upi, ok := in.(format.UDPPayloadIn); ok {
-		upi.MustIsPort(d.Fatalf, format.UDPPortDomain, format.UDPPortMDNS)
+	isMDNS := false
+	switch in := in.(type) {
+	case format.DNSIn:
+		return dnsDecode(d, in.IsTCP, false)
+	case format.UDPPayloadIn:
+		in.MustIsPort(d.Fatalf, format.UDPPortDomain, format.UDPPortMDNS)
+		isMDNS = in.IsPort(format.UDPPortMDNS)
+	case format.UDPStreamIn:
+		// one message per datagram
+		in.MustIsPort(d.Fatalf, format.UDPPortDomain, format.UDPPortMDNS)
+		isMDNS = in.IsPort(format.UDPPortMDNS)
+		d.FieldArray("messages", func(d *decode.D) {
+			for _, size := range in.DatagramSizes {
+				d.FieldStruct("message", func(d *decode.D) {
+					d.FramedFn(size*8, func(d *decode.D) { dnsDecode(d, false, isMDNS) })
+				})
+			}
+		})
+		return nil
 	}
-	return dnsDecode(d, false)
+	return dnsDecode(d, false, isMDNS)
 }
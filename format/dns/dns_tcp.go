@@ -1,22 +1,48 @@
 package dns
 
+// https://datatracker.ietf.org/doc/html/rfc1035#section-4.2.2
+// https://datatracker.ietf.org/doc/html/rfc7766
+
 import (
 	"github.com/wader/fq/format"
 	"github.com/wader/fq/pkg/decode"
 	"github.com/wader/fq/pkg/interp"
 )
 
+var dnsFormat decode.Group
+
 func init() {
 	interp.RegisterFormat(decode.Format{
 		Name:        format.DNS_TCP,
 		Description: "DNS packet (TCP)",
+		Groups:      []string{format.TCP_STREAM},
 		DecodeFn:    dnsTCPDecode,
+		Dependencies: []decode.Dependency{
+			{Names: []string{format.DNS}, Group: &dnsFormat},
+		},
 	})
 }
 
+// stream of messages each prefixed with a two byte length, ex: a zone transfer response
 func dnsTCPDecode(d *decode.D, in any) any {
 	if tsi, ok := in.(format.TCPStreamIn); ok {
 		tsi.MustIsPort(d.Fatalf, format.TCPPortDomain, format.TCPPortDomain)
 	}
-	return dnsDecode(d, true)
+
+	d.FieldArray("messages", func(d *decode.D) {
+		for d.BitsLeft() >= 16 {
+			length := int64(d.PeekBits(16))
+			// last message truncated, ex: capture ended before end of stream
+			if 16+length*8 > d.BitsLeft() {
+				break
+			}
+			// malformed message is added as raw so rest of the stream still decodes
+			d.FieldFormatOrRawLen("message", 16+length*8, dnsFormat, format.DNSIn{IsTCP: true})
+		}
+	})
+	if d.BitsLeft() > 0 {
+		d.FieldRawLen("remainder", d.BitsLeft())
+	}
+
+	return nil
 }
@@ -521,6 +521,9 @@ type sectionHeader struct {
 const maxStrTabSize = 100_000_000
 
 func readStrTab(d *decode.D, firstBit int64, nBytes int64) string {
+	if nBytes < 0 {
+		d.Errorf("negative string table size %d", nBytes)
+	}
 	if nBytes > maxStrTabSize {
 		d.Errorf("string table too large %d > %d", nBytes, maxStrTabSize)
 	}
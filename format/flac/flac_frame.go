@@ -2,6 +2,7 @@ package flac
 
 import (
 	"encoding/binary"
+	"fmt"
 	"math/bits"
 
 	"github.com/wader/fq/format"
@@ -242,6 +243,7 @@ func frameDecode(d *decode.D, in any) any {
 		}
 		if sideChannelIndex != -1 {
 			d.FieldValueU("side_channel_index", uint64(sideChannelIndex))
+			d.FieldRef("side_channel", fmt.Sprintf(".subframes[%d]", sideChannelIndex))
 		}
 
 		// <3> Sample size in bits:
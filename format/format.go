@@ -19,12 +19,14 @@ const (
 	IP_PACKET   = "ip_packet"   // ex: tcp
 	TCP_STREAM  = "tcp_stream"  // ex: http
 	UDP_PAYLOAD = "udp_payload" // ex: dns
+	UDP_STREAM  = "udp_stream"  // ex: dns conversation
 
 	AAC_FRAME           = "aac_frame"
 	ADTS                = "adts"
 	ADTS_FRAME          = "adts_frame"
 	AMF0                = "amf0"
 	APEV2               = "apev2"
+	ARP                 = "arp"
 	AR                  = "ar"
 	ASN1_BER            = "asn1_ber"
 	AV1_CCR             = "av1_ccr"
@@ -51,6 +53,7 @@ const (
 	DNS                 = "dns"
 	DNS_TCP             = "dns_tcp"
 	ELF                 = "elf"
+	ERSPAN              = "erspan"
 	ETHER8023_FRAME     = "ether8023_frame"
 	EXIF                = "exif"
 	FAIRPLAY_SPC        = "fairplay_spc"
@@ -62,6 +65,7 @@ const (
 	FLAC_STREAMINFO     = "flac_streaminfo"
 	FLV                 = "flv" // TODO:
 	GIF                 = "gif"
+	GRE_PACKET          = "gre_packet"
 	GZIP                = "gzip"
 	HEVC_ANNEXB         = "hevc_annexb"
 	HEVC_AU             = "hevc_au"
@@ -71,12 +75,14 @@ const (
 	HEVC_SPS            = "hevc_sps"
 	HEVC_VPS            = "hevc_vps"
 	HTML                = "html"
+	HTTP                = "http"
 	ICC_PROFILE         = "icc_profile"
 	ICMP                = "icmp"
 	ICMPV6              = "icmpv6"
 	ID3V1               = "id3v1"
 	ID3V11              = "id3v11"
 	ID3V2               = "id3v2"
+	IEEE80211_FRAME     = "ieee80211_frame"
 	IPV4_PACKET         = "ipv4_packet"
 	IPV6_PACKET         = "ipv6_packet"
 	JPEG                = "jpeg"
@@ -92,24 +98,31 @@ const (
 	MPEG_PES_PACKET     = "mpeg_pes_packet"
 	MPEG_SPU            = "mpeg_spu"
 	MPEG_TS             = "mpeg_ts"
+	MPLS_PACKET         = "mpls_packet"
 	MSGPACK             = "msgpack"
+	NETFLOW             = "netflow"
 	OGG                 = "ogg"
 	OGG_PAGE            = "ogg_page"
 	OPUS_PACKET         = "opus_packet"
 	PCAP                = "pcap"
 	PCAPNG              = "pcapng"
 	PNG                 = "png"
+	PPP_FRAME           = "ppp_frame"
 	PROTOBUF            = "protobuf"
 	PROTOBUF_WIDEVINE   = "protobuf_widevine"
 	PSSH_PLAYREADY      = "pssh_playready"
+	RADIOTAP_FRAME      = "radiotap_frame"
 	RAW                 = "raw"
 	RTMP                = "rtmp"
 	SLL_PACKET          = "sll_packet"
 	SLL2_PACKET         = "sll2_packet"
+	SMB2                = "smb2"
 	TAR                 = "tar"
 	TCP_SEGMENT         = "tcp_segment"
+	TEXT_PROTOCOL       = "text_protocol"
 	TIFF                = "tiff"
 	TOML                = "toml"
+	TZSP                = "tzsp"
 	UDP_DATAGRAM        = "udp_datagram"
 	VORBIS_COMMENT      = "vorbis_comment"
 	VORBIS_PACKET       = "vorbis_packet"
@@ -170,6 +183,18 @@ type OggPageOut struct {
 	Segments           [][]byte
 }
 
+type AvroOCFIn struct {
+	Strict        bool `doc:"Fail on invalid boolean bytes and block size mismatch"`
+	FlattenUnions bool `doc:"Use value of unions of null and one other type directly as value"`
+	LenientSchema bool `doc:"Decode even if schema has errors, values with invalid schema and values after them are raw"`
+	WireDetail    bool `doc:"Decode int, long, length and count fields as structs with varint encoding details"`
+}
+
+type MachoIn struct {
+	ImageOffset int64 `doc:"Decode image at byte offset, file offsets are then relative to start of input as in a dyld shared cache"`
+	HeadersOnly bool  `doc:"Only decode header and load commands, skip section data, symbols and other data at offsets"`
+}
+
 type AvcAuIn struct {
 	LengthSize uint64 `doc:"Length value size"`
 }
@@ -178,6 +203,44 @@ type AvcDcrOut struct {
 	LengthSize uint64
 }
 
+// VideoInfo is stream properties derived from a AVC or HEVC sequence parameter set
+type VideoInfo struct {
+	SeqParameterSetID uint64
+	Profile           string
+	Level             string
+	Tier              string // only HEVC
+	ChromaFormat      string
+	BitDepthLuma      uint64
+	BitDepthChroma    uint64
+	CodedWidth        uint64
+	CodedHeight       uint64
+	DisplayWidth      uint64
+	DisplayHeight     uint64
+	Interlaced        bool
+	HasTiming         bool
+	FrameRate         float64
+}
+
+type AvcSpsOut struct {
+	VideoInfo VideoInfo
+}
+
+type AvcNaluOut struct {
+	IsSlice bool
+	// set if NALU is a sequence parameter set
+	VideoInfo *VideoInfo
+}
+
+type HevcSpsOut struct {
+	VideoInfo VideoInfo
+}
+
+type HevcNaluOut struct {
+	IsSlice bool
+	// set if NALU is a sequence parameter set
+	VideoInfo *VideoInfo
+}
+
 type HevcAuIn struct {
 	LengthSize uint64 `doc:"Length value size"`
 }
@@ -221,9 +284,38 @@ type MP3FrameOut struct {
 	ChannelModeIndex int
 }
 
+type PcapIn struct {
+	PacketStart          int64   `doc:"Index of first packet to decode, negative counts from end"`
+	PacketCount          int64   `doc:"Number of packets from packet_start to decode, zero means all"`
+	MaxPackets           int64   `doc:"Max number of packets to decode, zero means all"`
+	TimeStart            float64 `doc:"Decode packets with timestamp at or after epoch seconds"`
+	TimeEnd              float64 `doc:"Decode packets with timestamp at or before epoch seconds, zero means no end"`
+	Flows                bool    `doc:"Reassemble flows and add protocol summary, disable to save memory for large captures"`
+	PacketsLimit         int64   `doc:"Max number of entries in packets array, rest are only used for flows to save memory, zero means all"`
+	ChecksumOffload      string  `doc:"Checksum failures from hosts with likely checksum offload, auto marks them, strict treats all as mismatch and ignore skips checks"`
+	ChecksumOffloadRatio float64 `doc:"Fraction of sent packets failing checksums for auto to assume offload"`
+	DuplicateWindow      int64   `doc:"Number of previous packets to compare with to find duplicates, zero disables"`
+	Dedup                bool    `doc:"Exclude duplicate packets from flows"`
+}
+
+type PcapngIn struct {
+	PacketStart          int64   `doc:"Index of first packet block in capture to decode, negative counts from end"`
+	PacketCount          int64   `doc:"Number of packets from packet_start to decode, zero means all"`
+	MaxPackets           int64   `doc:"Max number of packets to decode, zero means all"`
+	TimeStart            float64 `doc:"Decode packets with timestamp at or after epoch seconds, simple packets have no timestamp and are zero"`
+	TimeEnd              float64 `doc:"Decode packets with timestamp at or before epoch seconds, zero means no end"`
+	Flows                bool    `doc:"Reassemble flows and add protocol summary, disable to save memory for large captures"`
+	PacketsLimit         int64   `doc:"Max number of packet blocks in blocks arrays, rest are only used for flows to save memory, zero means all"`
+	ChecksumOffload      string  `doc:"Checksum failures from hosts with likely checksum offload, auto marks them, strict treats all as mismatch and ignore skips checks"`
+	ChecksumOffloadRatio float64 `doc:"Fraction of sent packets failing checksums for auto to assume offload"`
+	DuplicateWindow      int64   `doc:"Number of previous packets in section to compare with to find duplicates, zero disables"`
+	Dedup                bool    `doc:"Exclude duplicate packets from flows"`
+}
+
 type LinkFrameIn struct {
 	Type           int
 	IsLittleEndian bool // pcap endian etc
+	FCSLen         int  // bytes of frame check sequence at end of frame, zero if none or unknown
 }
 
 type InetPacketIn struct {
@@ -231,10 +323,15 @@ type InetPacketIn struct {
 }
 
 type IPPacketIn struct {
-	Protocol int
+	Protocol      int
+	SourceIP      string // ex: 10.0.0.1
+	DestinationIP string // ex: 10.0.0.2, empty if unknown
+	IPv6          bool
+	Truncated     bool // payload is incomplete, ex: snaplen or quoted in icmp error
 }
 
 type UDPPayloadIn struct {
+	SourceIP        string // empty if unknown
 	SourcePort      int
 	DestinationPort int
 }
@@ -254,6 +351,29 @@ func (u UDPPayloadIn) MustIsPort(fn func(format string, a ...any), ports ...int)
 	}
 }
 
+// UDPStreamIn is datagram payloads of one direction of a flow concatenated
+type UDPStreamIn struct {
+	IsClient        bool
+	SourcePort      int
+	DestinationPort int
+	DatagramSizes   []int64 // size in bytes of each datagram in order
+}
+
+func (u UDPStreamIn) IsPort(ports ...int) bool {
+	for _, p := range ports {
+		if u.DestinationPort == p || u.SourcePort == p {
+			return true
+		}
+	}
+	return false
+}
+
+func (u UDPStreamIn) MustIsPort(fn func(format string, a ...any), ports ...int) {
+	if !u.IsPort(ports...) {
+		fn("incorrect udp port client %t src:%d dst:%d", u.IsClient, u.SourcePort, u.DestinationPort)
+	}
+}
+
 type TCPStreamIn struct {
 	IsClient        bool
 	HasStart        bool
@@ -279,6 +399,14 @@ func (t TCPStreamIn) MustIsPort(fn func(format string, a ...any), ports ...int)
 	}
 }
 
+type DNSIn struct {
+	IsTCP bool // message is prefixed with a two byte length
+}
+
+type TextProtocolIn struct {
+	Protocol string `doc:"Protocol when not decoded as TCP stream, smtp, ftp, pop3, imap or irc"`
+}
+
 type Mp4In struct {
 	DecodeSamples  bool `doc:"Decode supported media samples"`
 	AllowTruncated bool `doc:"Allow box to be truncated"`
@@ -294,8 +422,10 @@ type XMLIn struct {
 }
 
 type HTMLIn struct {
-	Seq   bool `doc:"Use seq attribute to preserve element order"`
-	Array bool `doc:"Decode as nested arrays"`
+	Seq       bool `doc:"Use seq attribute to preserve element order"`
+	Array     bool `doc:"Decode as nested arrays"`
+	HeadOnly  bool `doc:"Stop after head element"`
+	Truncated bool `doc:"Input is known to be truncated"`
 }
 
 type CSVLIn struct {
@@ -0,0 +1,209 @@
+package http
+
+// https://www.rfc-editor.org/rfc/rfc9112 HTTP/1.1
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+func init() {
+	interp.RegisterFormat(decode.Format{
+		Name:        format.HTTP,
+		Description: "Hypertext Transfer Protocol 1.x",
+		Groups: []string{
+			format.TCP_STREAM,
+		},
+		DecodeFn: httpDecode,
+	})
+}
+
+// note that content-encoding deflate is zlib
+var contentEncodings = map[string]decode.Compression{
+	"gzip":    decode.CompressionGzip,
+	"x-gzip":  decode.CompressionGzip,
+	"deflate": decode.CompressionZlib,
+}
+
+// peekLine returns next line without line ending and its length in bytes including line ending
+func peekLine(d *decode.D) (string, int64) {
+	n, _, err := d.TryPeekFind(8, 8, -1, func(v uint64) bool { return v == '\n' })
+	l := d.BitsLeft() / 8
+	if err == nil && n/8+1 <= l {
+		l = n/8 + 1
+	}
+	b := d.PeekBytes(int(l))
+	if !utf8.Valid(b) {
+		d.Fatalf("invalid UTF-8 line")
+	}
+	return strings.TrimRight(string(b), "\r\n"), l
+}
+
+// value range includes colon, whitespace and line ending
+var headerValueMapper = scalar.ActualStrFn(func(a string) string {
+	return strings.TrimSpace(strings.TrimPrefix(a, ":"))
+})
+
+// fieldBody adds body of n bytes and decoded_body if content encoding is known and data is valid
+func fieldBody(d *decode.D, n int64, contentEncoding string) {
+	d.FieldRawLen("body", n*8)
+	c, ok := contentEncodings[strings.ToLower(strings.TrimSpace(contentEncoding))]
+	if !ok {
+		return
+	}
+	d.SeekRel(-n * 8)
+	if dv, _, _ := d.TryFieldCompressedLen("decoded_body", n*8, c, nil, nil); dv == nil {
+		d.SeekRel(n * 8)
+	}
+}
+
+func decodeChunks(d *decode.D) {
+	d.FieldArray("chunks", func(d *decode.D) {
+		for !d.End() {
+			last := false
+			d.FieldStruct("chunk", func(d *decode.D) {
+				line, l := peekLine(d)
+				sizeStr, _, _ := strings.Cut(line, ";")
+				size, err := strconv.ParseUint(strings.TrimSpace(sizeStr), 16, 63)
+				if err != nil {
+					d.Fatalf("invalid chunk size %q", line)
+				}
+				d.FieldUTF8("size_line", int(l), scalar.ActualTrim("\r\n"))
+				d.FieldValueU("size", size)
+				if size == 0 {
+					last = true
+					// optional trailer fields ends with empty line
+					d.FieldArray("trailers", func(d *decode.D) {
+						for !d.End() {
+							line, l := peekLine(d)
+							d.FieldUTF8("line", int(l), scalar.ActualTrim("\r\n"))
+							if line == "" {
+								break
+							}
+						}
+					})
+					return
+				}
+				n := int64(size)
+				if n > d.BitsLeft()/8 {
+					n = d.BitsLeft() / 8
+				}
+				d.FieldRawLen("data", n*8)
+				if !d.End() {
+					_, l := peekLine(d)
+					d.FieldUTF8("data_end", int(l), scalar.ActualTrim("\r\n"))
+				}
+			})
+			if last {
+				break
+			}
+		}
+	})
+}
+
+func decodeMessage(d *decode.D) {
+	line, l := peekLine(d)
+
+	isResponse := false
+	var statusCode uint64
+	switch {
+	case strings.HasPrefix(line, "HTTP/"):
+		version, rest, _ := strings.Cut(line, " ")
+		code, reason, _ := strings.Cut(rest, " ")
+		var err error
+		statusCode, err = strconv.ParseUint(code, 10, 16)
+		if err != nil || len(code) != 3 {
+			d.Fatalf("invalid status line %q", line)
+		}
+		isResponse = true
+		d.FieldUTF8("start_line", int(l), scalar.ActualTrim("\r\n"))
+		d.FieldValueStr("type", "response")
+		d.FieldValueStr("version", version)
+		d.FieldValueU("status_code", statusCode)
+		d.FieldValueStr("reason", reason)
+	default:
+		parts := strings.Split(line, " ")
+		if len(parts) != 3 || parts[0] == "" || !strings.HasPrefix(parts[2], "HTTP/") {
+			d.Fatalf("invalid request line %q", line)
+		}
+		d.FieldUTF8("start_line", int(l), scalar.ActualTrim("\r\n"))
+		d.FieldValueStr("type", "request")
+		d.FieldValueStr("method", parts[0])
+		d.FieldValueStr("target", parts[1])
+		d.FieldValueStr("version", parts[2])
+	}
+
+	// header names are case-insensitive
+	headers := map[string]string{}
+	d.FieldArray("headers", func(d *decode.D) {
+		for !d.End() {
+			line, l := peekLine(d)
+			if line == "" {
+				break
+			}
+			name, value, ok := strings.Cut(line, ":")
+			if !ok {
+				d.Fatalf("invalid header line %q", line)
+			}
+			headers[strings.ToLower(name)] = strings.TrimSpace(value)
+			d.FieldStruct("header", func(d *decode.D) {
+				d.FieldUTF8("name", len(name))
+				d.FieldUTF8("value", int(l)-len(name), headerValueMapper)
+			})
+		}
+	})
+	if d.End() {
+		return
+	}
+	_, l = peekLine(d)
+	d.FieldUTF8("header_end", int(l), scalar.ActualTrim("\r\n"))
+
+	contentEncoding := headers["content-encoding"]
+	contentLength, hasContentLength := headers["content-length"]
+	noBody := isResponse && (statusCode/100 == 1 || statusCode == 204 || statusCode == 304)
+	switch {
+	case noBody:
+	case strings.Contains(strings.ToLower(headers["transfer-encoding"]), "chunked"):
+		// content encoding is applied before chunking so data of chunks is not decompressed
+		decodeChunks(d)
+	case hasContentLength:
+		n, err := strconv.ParseInt(contentLength, 10, 64)
+		if err != nil || n < 0 {
+			d.Fatalf("invalid content-length %q", contentLength)
+		}
+		if n > d.BitsLeft()/8 {
+			n = d.BitsLeft() / 8
+		}
+		if n > 0 {
+			fieldBody(d, n, contentEncoding)
+		}
+	case isResponse:
+		// no length, body ends when connection is closed
+		if !d.End() {
+			fieldBody(d, d.BitsLeft()/8, contentEncoding)
+		}
+	}
+}
+
+func httpDecode(d *decode.D, in any) any {
+	if tsi, ok := in.(format.TCPStreamIn); ok {
+		tsi.MustIsPort(d.Fatalf, format.TCPPortHTTP, format.TCPPortHTTPAlt)
+	}
+	if d.End() {
+		d.Fatalf("no messages")
+	}
+
+	d.FieldArray("messages", func(d *decode.D) {
+		for !d.End() {
+			d.FieldStruct("message", decodeMessage)
+		}
+	})
+
+	return nil
+}
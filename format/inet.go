@@ -274,26 +274,47 @@ var LinkTypeMap = scalar.UToScalar{
 }
 
 const (
-	EtherTypeIPv4 = 0x0800
-	EtherTypeIPv6 = 0x86dd
+	EtherTypeIPv4                        = 0x0800
+	EtherTypeIPv6                        = 0x86dd
+	EtherTypeARP                         = 0x0806
+	EtherTypeRARP                        = 0x8035
+	EtherTypeVLAN                        = 0x8100
+	EtherTypeQinQ                        = 0x88a8
+	EtherTypeTransparentEthernetBridging = 0x6558
+	EtherTypeERSPAN                      = 0x88be
+	EtherTypeERSPANTypeIII               = 0x22eb
+	EtherTypeMPLSUnicast                 = 0x8847
+	EtherTypeMPLSMulticast               = 0x8848
+	EtherTypePPP                         = 0x880b
 )
 
+// linux sk_buff packet types, used by sll and modified pcap
+var LinuxPacketTypeMap = scalar.UToScalar{
+	0: {Sym: "to_us", Description: "Sent to us"},
+	1: {Sym: "broadcast", Description: "Broadcast by somebody else"},
+	2: {Sym: "multicast", Description: "Multicast by somebody else"},
+	3: {Sym: "to_other", Description: "Sent to somebody else by somebody else"},
+	4: {Sym: "from_us", Description: "Sent by us"},
+}
+
 // from https://en.wikipedia.org/wiki/EtherType
 // TODO: cleanup
 var EtherTypeMap = scalar.UToScalar{
 	EtherTypeIPv4: {Sym: "ipv4", Description: `Internet Protocol version 4`},
-	0x0806:        {Sym: "arp", Description: `Address Resolution Protocol`},
+	EtherTypeARP:  {Sym: "arp", Description: `Address Resolution Protocol`},
 	0x0842:        {Sym: "wake", Description: `Wake-on-LAN[9]`},
 	0x22f0:        {Sym: "audio", Description: `Audio Video Transport Protocol`},
 	0x22f3:        {Sym: "trill", Description: `IETF TRILL Protocol`},
 	0x22ea:        {Sym: "srp", Description: `Stream Reservation Protocol`},
+	0x22eb:        {Sym: "erspan_type_iii", Description: `Encapsulated Remote SPAN Type III`},
 	0x6002:        {Sym: "dec", Description: `DEC MOP RC`},
 	0x6003:        {Sym: "decnet", Description: `DECnet Phase IV, DNA Routing`},
 	0x6004:        {Sym: "declat", Description: `DEC LAT`},
-	0x8035:        {Sym: "reverse", Description: `Reverse Address Resolution Protocol`},
+	0x6558:        {Sym: "transparent_ethernet_bridging", Description: `Transparent Ethernet Bridging`},
+	EtherTypeRARP: {Sym: "reverse", Description: `Reverse Address Resolution Protocol`},
 	0x809b:        {Sym: "appletalk", Description: `AppleTalk`},
 	0x80f3:        {Sym: "appletalk_arp", Description: `AppleTalk Address Resolution Protocol`},
-	0x8100:        {Sym: "vlan", Description: `VLAN-tagged (IEEE 802.1Q)`},
+	EtherTypeVLAN: {Sym: "vlan", Description: `VLAN-tagged (IEEE 802.1Q)`},
 	0x8102:        {Sym: "slpp", Description: `Simple Loop Prevention Protocol`},
 	0x8103:        {Sym: "vlacp", Description: `Virtual Link Aggregation Control Protocol`},
 	0x8137:        {Sym: "ipx", Description: `IPX`},
@@ -301,6 +322,7 @@ var EtherTypeMap = scalar.UToScalar{
 	EtherTypeIPv6: {Sym: "ipv6", Description: `Internet Protocol Version 6`},
 	0x8808:        {Sym: "flow_control", Description: `Ethernet flow control`},
 	0x8809:        {Sym: "lacp", Description: `Ethernet Slow Protocols] such as the Link Aggregation Control Protocol`},
+	EtherTypePPP:  {Sym: "ppp", Description: `Point-to-Point Protocol`},
 	0x8819:        {Sym: "cobranet", Description: `CobraNet`},
 	0x8847:        {Sym: "mpls", Description: `MPLS unicast`},
 	0x8848:        {Sym: "mpls", Description: `MPLS multicast`},
@@ -312,11 +334,12 @@ var EtherTypeMap = scalar.UToScalar{
 	0x889a:        {Sym: "hyperscsi", Description: `HyperSCSI (SCSI over Ethernet)`},
 	0x88a2:        {Sym: "ata", Description: `ATA over Ethernet`},
 	0x88a4:        {Sym: "ethercat", Description: `EtherCAT Protocol`},
-	0x88a8:        {Sym: "service", Description: `Service VLAN tag identifier (S-Tag) on Q-in-Q tunnel`},
+	EtherTypeQinQ: {Sym: "service", Description: `Service VLAN tag identifier (S-Tag) on Q-in-Q tunnel`},
 	0x88ab:        {Sym: "ethernet", Description: `Ethernet Powerlink`},
 	0x88b8:        {Sym: "goose", Description: `GOOSE (Generic Object Oriented Substation event)`},
 	0x88b9:        {Sym: "gse", Description: `GSE (Generic Substation Events) Management Services`},
 	0x88ba:        {Sym: "sv", Description: `SV (Sampled Value Transmission)`},
+	0x88be:        {Sym: "erspan", Description: `Encapsulated Remote SPAN Type I and II`},
 	0x88bf:        {Sym: "mikrotik", Description: `MikroTik RoMON (unofficial)`},
 	0x88cc:        {Sym: "link", Description: `Link Layer Discovery Protocol (LLDP)`},
 	0x88cd:        {Sym: "sercos", Description: `SERCOS III`},
@@ -338,6 +361,42 @@ var EtherTypeMap = scalar.UToScalar{
 	0xf1c1:        {Sym: "redundancy", Description: `Redundancy Tag (IEEE 802.1CB Frame Replication and Elimination for Reliability)`},
 }
 
+// differentiated services code points, used by IPv4 and IPv6 traffic class
+// from https://www.iana.org/assignments/dscp-registry/dscp-registry.xhtml
+var IPDSCPMap = scalar.UToScalar{
+	0:  {Sym: "cs0", Description: "Class selector 0, default"},
+	8:  {Sym: "cs1", Description: "Class selector 1"},
+	10: {Sym: "af11", Description: "Assured forwarding class 1 low drop"},
+	12: {Sym: "af12", Description: "Assured forwarding class 1 medium drop"},
+	14: {Sym: "af13", Description: "Assured forwarding class 1 high drop"},
+	16: {Sym: "cs2", Description: "Class selector 2"},
+	18: {Sym: "af21", Description: "Assured forwarding class 2 low drop"},
+	20: {Sym: "af22", Description: "Assured forwarding class 2 medium drop"},
+	22: {Sym: "af23", Description: "Assured forwarding class 2 high drop"},
+	24: {Sym: "cs3", Description: "Class selector 3"},
+	26: {Sym: "af31", Description: "Assured forwarding class 3 low drop"},
+	28: {Sym: "af32", Description: "Assured forwarding class 3 medium drop"},
+	30: {Sym: "af33", Description: "Assured forwarding class 3 high drop"},
+	32: {Sym: "cs4", Description: "Class selector 4"},
+	34: {Sym: "af41", Description: "Assured forwarding class 4 low drop"},
+	36: {Sym: "af42", Description: "Assured forwarding class 4 medium drop"},
+	38: {Sym: "af43", Description: "Assured forwarding class 4 high drop"},
+	40: {Sym: "cs5", Description: "Class selector 5"},
+	44: {Sym: "voice_admit", Description: "Capacity-admitted traffic"},
+	46: {Sym: "ef", Description: "Expedited forwarding"},
+	48: {Sym: "cs6", Description: "Class selector 6"},
+	56: {Sym: "cs7", Description: "Class selector 7"},
+}
+
+// explicit congestion notification, used by IPv4 and IPv6 traffic class
+// from https://www.rfc-editor.org/rfc/rfc3168
+var IPECNMap = scalar.UToScalar{
+	0: {Sym: "not_ect", Description: "Not ECN-capable transport"},
+	1: {Sym: "ect1", Description: "ECN-capable transport ECT(1)"},
+	2: {Sym: "ect0", Description: "ECN-capable transport ECT(0)"},
+	3: {Sym: "ce", Description: "Congestion experienced"},
+}
+
 // based on etc/protocols from Darwin/FreeBSD
 // cat /etc/protocols | grep -v '^#'  | jq -rR 'capture("(?<name>[\\w\\d-]+)\\s+(?<nr>\\d+)\\s+.*#\\s+(?<desc>.*)") | "\(.nr): {Sym: \(.name|tojson), Description: \(.desc|tojson)},"'
 
@@ -346,6 +405,7 @@ const (
 	IPv4ProtocolIGMP   = 2
 	IPv4ProtocolTCP    = 6
 	IPv4ProtocolUDP    = 17
+	IPv4ProtocolGRE    = 47
 	IPv4ProtocolICMPv6 = 58
 )
 
@@ -396,7 +456,7 @@ var IPv4ProtocolMap = scalar.UToScalar{
 	44:                 {Sym: "ipv6-frag", Description: "fragment header for ipv6"},
 	45:                 {Sym: "idrp", Description: "Inter-Domain Routing Protocol"},
 	46:                 {Sym: "rsvp", Description: "Resource ReSerVation Protocol"},
-	47:                 {Sym: "gre", Description: "Generic Routing Encapsulation"},
+	IPv4ProtocolGRE:    {Sym: "gre", Description: "Generic Routing Encapsulation"},
 	48:                 {Sym: "dsr", Description: "Dynamic Source Routing Protocol"},
 	49:                 {Sym: "bna", Description: "BNA"},
 	50:                 {Sym: "esp", Description: "encapsulating security payload"},
@@ -493,8 +553,11 @@ var IPv4ProtocolMap = scalar.UToScalar{
 // current truncated to < 1024
 
 const (
-	UDPPortDomain = 53
-	UDPPortMDNS   = 5353
+	UDPPortDomain  = 53
+	UDPPortNetFlow = 2055
+	UDPPortIPFIX   = 4739
+	UDPPortMDNS    = 5353
+	UDPPortTZSP    = 37008
 )
 
 var UDPPortMap = scalar.UToScalar{
@@ -1177,12 +1240,24 @@ var UDPPortMap = scalar.UToScalar{
 	1000:          {Sym: "cadlock2"},
 	1010:          {Sym: "surf", Description: "surf"},
 
-	UDPPortMDNS: {Sym: "mdns", Description: "Multicast DNS"},
+	UDPPortNetFlow: {Sym: "netflow", Description: "Cisco NetFlow"},
+	UDPPortIPFIX:   {Sym: "ipfix", Description: "IP Flow Information Export"},
+	UDPPortMDNS:    {Sym: "mdns", Description: "Multicast DNS"},
+	UDPPortTZSP:    {Sym: "tzsp", Description: "TaZmen Sniffer Protocol"},
 }
 
 const (
-	TCPPortDomain = 53
-	TCPPortRTMP   = 1935
+	TCPPortFTP         = 21
+	TCPPortSMTP        = 25
+	TCPPortDomain      = 53
+	TCPPortHTTP        = 80
+	TCPPortPOP3        = 110
+	TCPPortNetBIOSSSN  = 139
+	TCPPortIMAP        = 143
+	TCPPortMicrosoftDS = 445
+	TCPPortRTMP        = 1935
+	TCPPortIRC         = 6667
+	TCPPortHTTPAlt     = 8080
 )
 
 var TCPPortMap = scalar.UToScalar{
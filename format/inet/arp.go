@@ -0,0 +1,95 @@
+package inet
+
+// https://datatracker.ietf.org/doc/html/rfc826
+// https://datatracker.ietf.org/doc/html/rfc903
+
+import (
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+func init() {
+	interp.RegisterFormat(decode.Format{
+		Name:        format.ARP,
+		Description: "Address resolution protocol",
+		Groups:      []string{format.INET_PACKET},
+		DecodeFn:    decodeARP,
+	})
+}
+
+const (
+	arpHardwareTypeEthernet = 1
+
+	arpOperationRequest = 1
+	arpOperationReply   = 2
+)
+
+var arpHardwareTypeMap = scalar.UToScalar{
+	arpHardwareTypeEthernet: {Sym: "ethernet", Description: "Ethernet (10Mb)"},
+	6:                       {Sym: "ieee802", Description: "IEEE 802 Networks"},
+	15:                      {Sym: "frame_relay", Description: "Frame Relay"},
+	16:                      {Sym: "atm", Description: "Asynchronous Transmission Mode"},
+	20:                      {Sym: "serial", Description: "Serial Line"},
+	32:                      {Sym: "infiniband", Description: "InfiniBand"},
+}
+
+var arpOperationMap = scalar.UToScalar{
+	arpOperationRequest: {Sym: "request", Description: "Request"},
+	arpOperationReply:   {Sym: "reply", Description: "Reply"},
+	3:                   {Sym: "rarp_request", Description: "Reverse request"},
+	4:                   {Sym: "rarp_reply", Description: "Reverse reply"},
+}
+
+func decodeARP(d *decode.D, in any) any {
+	if ipi, ok := in.(format.InetPacketIn); ok &&
+		ipi.EtherType != format.EtherTypeARP && ipi.EtherType != format.EtherTypeRARP {
+		d.Fatalf("incorrect ethertype %d", ipi.EtherType)
+	}
+
+	hardwareType := d.FieldU16("hardware_type", arpHardwareTypeMap)
+	protocolType := d.FieldU16("protocol_type", format.EtherTypeMap, scalar.ActualHex)
+	hardwareLength := d.FieldU8("hardware_length")
+	protocolLength := d.FieldU8("protocol_length")
+	operation := d.FieldU16("operation", arpOperationMap)
+
+	if hardwareLength == 0 || protocolLength == 0 {
+		d.Fatalf("zero address length")
+	}
+
+	isEtherAddress := hardwareType == arpHardwareTypeEthernet && hardwareLength == 6
+	isIPv4Address := protocolType == format.EtherTypeIPv4 && protocolLength == 4
+
+	fieldHardwareAddress := func(name string) {
+		if isEtherAddress {
+			d.FieldU48(name, mapUToEtherSym, scalar.ActualHex)
+		} else {
+			d.FieldRawLen(name, int64(hardwareLength)*8)
+		}
+	}
+	fieldProtocolAddress := func(name string) uint64 {
+		if isIPv4Address {
+			return d.FieldU32(name, mapUToIPv4Sym, scalar.ActualHex)
+		}
+		d.FieldRawLen(name, int64(protocolLength)*8)
+		return 0
+	}
+
+	fieldHardwareAddress("sender_hardware_address")
+	senderIP := fieldProtocolAddress("sender_protocol_address")
+	fieldHardwareAddress("target_hardware_address")
+	targetIP := fieldProtocolAddress("target_protocol_address")
+	// announcement or probe for own address
+	if isIPv4Address && (operation == arpOperationRequest || operation == arpOperationReply) &&
+		senderIP != 0 && senderIP == targetIP {
+		d.FieldMustGet("target_protocol_address").TryScalarFn(scalar.Description("gratuitous"))
+	}
+
+	// ethernet frames are padded to a minimum of 60 bytes
+	if d.BitsLeft() > 0 {
+		d.FieldRawLen("padding", d.BitsLeft())
+	}
+
+	return nil
+}
@@ -3,6 +3,8 @@ package inet
 // TODO: rename NetworkLayer? wireshark calls it "Family", pcap-linktype(7) calls it "network-layer protocol"
 
 import (
+	"math/bits"
+
 	"github.com/wader/fq/format"
 	"github.com/wader/fq/pkg/decode"
 	"github.com/wader/fq/pkg/interp"
@@ -23,19 +25,31 @@ func init() {
 	})
 }
 
+// address family values, ipv6 differs between BSD flavors
+// https://www.tcpdump.org/linktypes/LINKTYPE_NULL.html
 const (
-	bsdLoopbackNetworkLayerIPv4 = 0x2
-	bsdLoopbackNetworkLayerIPv6 = 0x1e
+	bsdLoopbackNetworkLayerIPv4        = 0x2
+	bsdLoopbackNetworkLayerOSI         = 0x7
+	bsdLoopbackNetworkLayerIPX         = 0x17
+	bsdLoopbackNetworkLayerIPv6NetBSD  = 0x18
+	bsdLoopbackNetworkLayerIPv6FreeBSD = 0x1c
+	bsdLoopbackNetworkLayerIPv6        = 0x1e
 )
 
 var bsdLoopbackFrameNetworkLayerEtherType = map[uint64]int{
-	bsdLoopbackNetworkLayerIPv4: format.EtherTypeIPv4,
-	bsdLoopbackNetworkLayerIPv6: format.EtherTypeIPv6,
+	bsdLoopbackNetworkLayerIPv4:        format.EtherTypeIPv4,
+	bsdLoopbackNetworkLayerIPv6NetBSD:  format.EtherTypeIPv6,
+	bsdLoopbackNetworkLayerIPv6FreeBSD: format.EtherTypeIPv6,
+	bsdLoopbackNetworkLayerIPv6:        format.EtherTypeIPv6,
 }
 
 var bsdLookbackNetworkLayerMap = scalar.UToScalar{
-	bsdLoopbackNetworkLayerIPv4: {Sym: "ipv4", Description: `Internet protocol v4`},
-	bsdLoopbackNetworkLayerIPv6: {Sym: "ipv6", Description: `Internet protocol v6`},
+	bsdLoopbackNetworkLayerIPv4:        {Sym: "ipv4", Description: `Internet protocol v4`},
+	bsdLoopbackNetworkLayerOSI:         {Sym: "osi", Description: `OSI protocols`},
+	bsdLoopbackNetworkLayerIPX:         {Sym: "ipx", Description: `Novell IPX`},
+	bsdLoopbackNetworkLayerIPv6NetBSD:  {Sym: "ipv6", Description: `Internet protocol v6 (NetBSD, OpenBSD, BSD/OS)`},
+	bsdLoopbackNetworkLayerIPv6FreeBSD: {Sym: "ipv6", Description: `Internet protocol v6 (FreeBSD, DragonFly BSD)`},
+	bsdLoopbackNetworkLayerIPv6:        {Sym: "ipv6", Description: `Internet protocol v6`},
 }
 
 func decodeLoopbackFrame(d *decode.D, in any) any {
@@ -48,7 +62,20 @@ func decodeLoopbackFrame(d *decode.D, in any) any {
 			d.Endian = decode.LittleEndian
 		}
 	}
-	// if no LinkFrameIn assume big endian for now
+	// if no LinkFrameIn assume big endian. family is in host endian of the capturing
+	// host so can differ from capture file endian, values are small so use the endian
+	// that makes it fit
+	v := uint32(d.PeekBits(32))
+	if d.Endian == decode.LittleEndian {
+		v = bits.ReverseBytes32(v)
+	}
+	if v > 0xffff && bits.ReverseBytes32(v) <= 0xffff {
+		if d.Endian == decode.LittleEndian {
+			d.Endian = decode.BigEndian
+		} else {
+			d.Endian = decode.LittleEndian
+		}
+	}
 
 	networkLayer := d.FieldU32("network_layer", bsdLookbackNetworkLayerMap, scalar.ActualHex)
 
@@ -0,0 +1,28 @@
+package inet
+
+import (
+	"context"
+
+	"github.com/wader/fq/pkg/decode"
+)
+
+// max number of nested encapsulations to decode, ex: mirrored traffic that is mirrored again
+const encapsulationMaxDepth = 4
+
+type encapsulationDepthKey struct{}
+
+// encapsulatedFn calls fn with encapsulation depth increased, returns false if max depth
+// was reached and fn was not called. Nested decoders share context so it is used to keep
+// track of depth.
+func encapsulatedFn(d *decode.D, fn func(d *decode.D)) bool {
+	depth, _ := d.Ctx.Value(encapsulationDepthKey{}).(int)
+	if depth >= encapsulationMaxDepth {
+		return false
+	}
+	ctx := d.Ctx
+	d.Ctx = context.WithValue(ctx, encapsulationDepthKey{}, depth+1)
+	defer func() { d.Ctx = ctx }()
+	fn(d)
+
+	return true
+}
@@ -0,0 +1,118 @@
+package inet
+
+// https://datatracker.ietf.org/doc/html/draft-foschiano-erspan-03
+
+import (
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+var erspanEther8023FrameGroup decode.Group
+
+func init() {
+	interp.RegisterFormat(decode.Format{
+		Name:        format.ERSPAN,
+		Description: "Encapsulated remote switch port analyzer",
+		Dependencies: []decode.Dependency{
+			{Names: []string{format.ETHER8023_FRAME}, Group: &erspanEther8023FrameGroup},
+		},
+		DecodeFn: decodeERSPAN,
+	})
+}
+
+const (
+	erspanVersionTypeII  = 1
+	erspanVersionTypeIII = 2
+)
+
+var erspanVersionMap = scalar.UToSymStr{
+	erspanVersionTypeII:  "type_ii",
+	erspanVersionTypeIII: "type_iii",
+}
+
+var erspanEncapsulationTypeMap = scalar.UToScalar{
+	0: {Sym: "untagged", Description: "Originally without VLAN tag"},
+	1: {Sym: "isl", Description: "ISL encapsulated"},
+	2: {Sym: "vlan", Description: "802.1Q encapsulated"},
+	3: {Sym: "preserved", Description: "VLAN tag preserved in frame"},
+}
+
+var erspanBSOMap = scalar.UToScalar{
+	0: {Sym: "good", Description: "Good frame with no error, or unknown integrity"},
+	1: {Sym: "short", Description: "Payload is a short frame"},
+	2: {Sym: "oversized", Description: "Payload is an oversized frame"},
+	3: {Sym: "bad", Description: "Payload is a bad frame with CRC or alignment error"},
+}
+
+const erspanFrameTypeEthernet = 0
+
+var erspanFrameTypeMap = scalar.UToSymStr{
+	erspanFrameTypeEthernet: "ethernet",
+	2:                       "ip",
+}
+
+var erspanDirectionMap = scalar.UToSymStr{
+	0: "ingress",
+	1: "egress",
+}
+
+var erspanTimestampGranularityMap = scalar.UToScalar{
+	0: {Sym: "100_microseconds"},
+	1: {Sym: "100_nanoseconds"},
+	2: {Sym: "ieee_1588", Description: "Seconds and nanoseconds"},
+	3: {Sym: "user_configurable"},
+}
+
+func decodeERSPAN(d *decode.D, _ any) any {
+	version := d.FieldU4("version", erspanVersionMap)
+	d.FieldU12("vlan")
+	d.FieldU3("cos")
+
+	frameType := uint64(erspanFrameTypeEthernet)
+	switch version {
+	case erspanVersionTypeII:
+		d.FieldU2("encapsulation_type", erspanEncapsulationTypeMap)
+		d.FieldBool("truncated")
+		d.FieldU10("session_id")
+		d.FieldU12("reserved")
+		d.FieldU20("index")
+	case erspanVersionTypeIII:
+		d.FieldU2("bso", erspanBSOMap)
+		d.FieldBool("truncated")
+		d.FieldU10("session_id")
+		d.FieldU32("timestamp")
+		d.FieldU16("security_group_tag")
+		d.FieldBool("pdu_frame")
+		frameType = d.FieldU5("frame_type", erspanFrameTypeMap)
+		d.FieldU6("hardware_id")
+		d.FieldU1("direction", erspanDirectionMap)
+		d.FieldU2("timestamp_granularity", erspanTimestampGranularityMap)
+		optionalSubHeader := d.FieldBool("optional_sub_header")
+		if optionalSubHeader {
+			d.FieldStruct("platform_sub_header", func(d *decode.D) {
+				platformID := d.FieldU6("platform_id")
+				switch platformID {
+				case 0x5, 0x6:
+					d.FieldU10("switch_id")
+					d.FieldU16("port_id")
+					// upper 32 bits of timestamp, seconds for ieee 1588 granularity
+					d.FieldU32("timestamp")
+				default:
+					d.FieldU58("platform_specific", scalar.ActualHex)
+				}
+			})
+		}
+	default:
+		d.Fatalf("unknown version %d", version)
+	}
+
+	if frameType == erspanFrameTypeEthernet {
+		d.FieldFormatOrRawLen("payload", d.BitsLeft(), erspanEther8023FrameGroup, nil)
+	} else {
+		d.FieldRawLen("payload", d.BitsLeft())
+	}
+
+	return nil
+}
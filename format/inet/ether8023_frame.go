@@ -5,8 +5,10 @@ package inet
 import (
 	"encoding/binary"
 	"fmt"
+	"hash/crc32"
 
 	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/bitio"
 	"github.com/wader/fq/pkg/decode"
 	"github.com/wader/fq/pkg/interp"
 	"github.com/wader/fq/pkg/scalar"
@@ -34,23 +36,192 @@ var mapUToEtherSym = scalar.Fn(func(s scalar.S) (scalar.S, error) {
 	return s, nil
 })
 
+// fieldEtherAddressFlags adds derived fields for a 48 bit MAC address
+func fieldEtherAddressFlags(d *decode.D, name string, v uint64) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], v)
+	a := b[2:]
+
+	isMulticast := a[0]&0b01 != 0
+	d.FieldValueBool(name+"_is_broadcast", v == 0xffff_ffff_ffff)
+	var multicastSms []scalar.Mapper
+	switch {
+	case a[0] == 0x01 && a[1] == 0x00 && a[2] == 0x5e && a[3]&0x80 == 0:
+		// rfc1112 only lower 23 bits of group address are mapped
+		multicastSms = append(multicastSms, scalar.Description(fmt.Sprintf("ipv4 group 224.%d.%d.%d (lower 23 bits)", a[3], a[4], a[5])))
+	case a[0] == 0x33 && a[1] == 0x33:
+		// rfc2464 lower 32 bits of group address are mapped
+		multicastSms = append(multicastSms, scalar.Description(fmt.Sprintf("ipv6 group ::%x:%x (lower 32 bits)", uint16(a[2])<<8|uint16(a[3]), uint16(a[4])<<8|uint16(a[5]))))
+	}
+	d.FieldValueBool(name+"_is_multicast", isMulticast, multicastSms...)
+	d.FieldValueBool(name+"_is_locally_administered", a[0]&0b10 != 0)
+}
+
+// fieldEtherTypeOrLength decodes the type field after addresses or a vlan tag, small
+// values are a 802.3 length instead of an ether type
+func fieldEtherTypeOrLength(d *decode.D) uint64 {
+	if d.PeekBits(16) <= ether8023MaxLength {
+		return d.FieldU16("length")
+	}
+	return d.FieldU16("ether_type", format.EtherTypeMap, scalar.ActualHex)
+}
+
+func isVLANEtherType(etherType uint64) bool {
+	return etherType == format.EtherTypeVLAN || etherType == format.EtherTypeQinQ
+}
+
+// IEEE 802.1Q priority code points
+var vlanPCPMap = scalar.UToSymStr{
+	0: "best_effort",
+	1: "background",
+	2: "excellent_effort",
+	3: "critical_applications",
+	4: "video",
+	5: "voice",
+	6: "internetwork_control",
+	7: "network_control",
+}
+
+var vlanVIDMap = scalar.UToDescription{
+	0:     "Priority tag, no VLAN",
+	0xfff: "Reserved",
+}
+
+// ether_type values up to this are a 802.3 payload length followed by a llc header
+const ether8023MaxLength = 1500
+
+// IEEE 802.2 service access points, lowest bit is individual/group for dsap and
+// command/response for ssap
+var llcSAPMap = scalar.UToScalar{
+	0x00:       {Sym: "null", Description: "Null SAP"},
+	0x06:       {Sym: "ip", Description: "Internet Protocol"},
+	0x42:       {Sym: "stp", Description: "Spanning Tree Protocol"},
+	0xe0:       {Sym: "ipx", Description: "Novell IPX"},
+	0xf0:       {Sym: "netbios", Description: "NetBIOS"},
+	0xfe:       {Sym: "osi", Description: "ISO Network Layer"},
+	llcSAPSNAP: {Sym: "snap", Description: "Subnetwork Access Protocol"},
+}
+
+var mapLLCSAP = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	if m, ok := llcSAPMap[s.ActualU()&^1]; ok {
+		s.Sym = m.Sym
+		s.Description = m.Description
+	}
+	return s, nil
+})
+
+// decodeLLC decodes a 802.2 llc header, with snap extension if present, and returns
+// the ether type to use for the payload if it is known
+func decodeLLC(d *decode.D) (uint64, bool) {
+	var etherType uint64
+	var isEtherType bool
+	d.FieldStruct("llc", func(d *decode.D) {
+		dsap := d.FieldU8("dsap", mapLLCSAP, scalar.ActualHex)
+		ssap := d.FieldU8("ssap", mapLLCSAP, scalar.ActualHex)
+		// unnumbered format is one byte, information and supervisory are two
+		if d.PeekBits(8)&0b11 == 0b11 {
+			d.FieldU8("control", scalar.ActualHex)
+		} else {
+			d.FieldU16("control", scalar.ActualHex)
+		}
+		if dsap != llcSAPSNAP || ssap != llcSAPSNAP {
+			return
+		}
+		oui := d.FieldU24("oui", scalar.ActualHex)
+		// oui zero is rfc1042 encapsulated ether types, 00:00:f8 is 802.1H bridge tunnel
+		if oui == 0x00_00_00 || oui == 0x00_00_f8 {
+			etherType = d.FieldU16("protocol_id", format.EtherTypeMap, scalar.ActualHex)
+			isEtherType = true
+		} else {
+			d.FieldU16("protocol_id", scalar.ActualHex)
+		}
+	})
+	return etherType, isEtherType
+}
+
 func decodeEthernetFrame(d *decode.D, in any) any {
+	var fcsLen int64
 	if lfi, ok := in.(format.LinkFrameIn); ok {
 		if lfi.Type != format.LinkTypeETHERNET {
 			d.Fatalf("wrong link type %d", lfi.Type)
 		}
+		fcsLen = int64(lfi.FCSLen) * 8
 	}
+	frameStart := d.Pos()
 
-	d.FieldU("destination", 48, mapUToEtherSym, scalar.ActualHex)
-	d.FieldU("source", 48, mapUToEtherSym, scalar.ActualHex)
-	etherType := d.FieldU16("ether_type", format.EtherTypeMap, scalar.ActualHex)
+	destination := d.FieldU("destination", 48, mapUToEtherSym, scalar.ActualHex)
+	fieldEtherAddressFlags(d, "destination", destination)
+	source := d.FieldU("source", 48, mapUToEtherSym, scalar.ActualHex)
+	fieldEtherAddressFlags(d, "source", source)
+	etherType := fieldEtherTypeOrLength(d)
+	if isVLANEtherType(etherType) {
+		// stacked tags for QinQ, outermost first
+		d.FieldArray("vlan_tags", func(d *decode.D) {
+			for isVLANEtherType(etherType) {
+				d.FieldStruct("vlan_tag", func(d *decode.D) {
+					d.FieldU3("pcp", vlanPCPMap)
+					d.FieldBool("dei")
+					d.FieldU12("vid", vlanVIDMap)
+					etherType = fieldEtherTypeOrLength(d)
+				})
+			}
+		})
+	}
+
+	// frame check sequence is only split if capture says it is present, otherwise it
+	// ends up in the payload
+	payloadLen := d.BitsLeft()
+	hasFCS := fcsLen > 0 && payloadLen >= fcsLen
+	if hasFCS {
+		payloadLen -= fcsLen
+	}
 
-	d.FieldFormatOrRawLen(
-		"payload",
-		d.BitsLeft(),
-		ether8023FrameInetPacketGroup,
-		format.InetPacketIn{EtherType: int(etherType)},
-	)
+	if etherType <= ether8023MaxLength {
+		// length covers llc header and data, rest is padding up to minimum frame size
+		llcStart := d.Pos()
+		dataLen := int64(etherType) * 8
+		if dataLen > payloadLen {
+			dataLen = payloadLen
+		}
+		d.FramedFn(dataLen, func(d *decode.D) {
+			if d.BitsLeft() < 3*8 {
+				d.FieldRawLen("payload", d.BitsLeft())
+				return
+			}
+			llcEtherType, ok := decodeLLC(d)
+			if ok {
+				d.FieldFormatOrRawLen(
+					"payload",
+					d.BitsLeft(),
+					ether8023FrameInetPacketGroup,
+					format.InetPacketIn{EtherType: int(llcEtherType)},
+				)
+			} else if d.BitsLeft() > 0 {
+				d.FieldRawLen("payload", d.BitsLeft())
+			}
+		})
+		if paddingLen := payloadLen - (d.Pos() - llcStart); paddingLen > 0 {
+			d.FieldRawLen("padding", paddingLen)
+		}
+	} else {
+		d.FieldFormatOrRawLen(
+			"payload",
+			payloadLen,
+			ether8023FrameInetPacketGroup,
+			format.InetPacketIn{EtherType: int(etherType)},
+		)
+	}
+
+	if hasFCS {
+		if fcsLen == 32 {
+			// CRC-32 over the whole frame, transmitted least significant byte first
+			fcs := crc32.NewIEEE()
+			d.Copy(fcs, bitio.NewIOReader(d.BitBufRange(frameStart, d.Pos()-frameStart)))
+			d.FieldU32LE("fcs", d.ValidateUBytes(fcs.Sum(nil)), scalar.ActualHex)
+		} else {
+			d.FieldRawLen("fcs", fcsLen)
+		}
+	}
 
 	return nil
 }
@@ -0,0 +1,185 @@
+package flowsdecoder
+
+import (
+	"encoding/binary"
+	"net"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/wader/fq/pkg/checksum"
+)
+
+// ChecksumError is a ip header, tcp or udp checksum that does not match
+type ChecksumError struct {
+	PacketIndex   int64
+	Layer         string
+	SourceIP      net.IP
+	DestinationIP net.IP
+	Expected      uint16
+	Actual        uint16
+	// source seems to have checksum offload, set by ClassifyOffload
+	LikelyOffload bool
+}
+
+// ChecksumHost is number of packets with checked checksums sent and received by a host
+type ChecksumHost struct {
+	IP              net.IP
+	SentPackets     uint64
+	SentFailed      uint64
+	ReceivedPackets uint64
+	ReceivedFailed  uint64
+	LikelyOffload   bool
+}
+
+type Checksums struct {
+	// packets with at least one checked checksum
+	Packets uint64
+	Failed  uint64
+	Errors  []ChecksumError
+	// in order of first seen
+	Hosts []*ChecksumHost
+
+	hosts map[string]*ChecksumHost
+}
+
+func (c *Checksums) host(ip net.IP) *ChecksumHost {
+	if h, ok := c.hosts[string(ip)]; ok {
+		return h
+	}
+	if c.hosts == nil {
+		c.hosts = map[string]*ChecksumHost{}
+	}
+	h := &ChecksumHost{IP: append(net.IP(nil), ip...)}
+	c.hosts[string(ip)] = h
+	c.Hosts = append(c.Hosts, h)
+	return h
+}
+
+// ClassifyOffload marks hosts where more than ratio of sent packets fail checksums while at most
+// 1-ratio of packets sent by other hosts fail. This is usually a capture done on the sending host
+// where the network card calculates checksums after the packet was captured.
+func (c *Checksums) ClassifyOffload(ratio float64) {
+	for _, h := range c.Hosts {
+		otherPackets := c.Packets - h.SentPackets
+		otherFailed := c.Failed - h.SentFailed
+		h.LikelyOffload = h.SentFailed > 0 &&
+			otherPackets > 0 &&
+			float64(h.SentFailed)/float64(h.SentPackets) > ratio &&
+			float64(otherFailed)/float64(otherPackets) <= 1-ratio
+	}
+	for i := range c.Errors {
+		c.Errors[i].LikelyOffload = c.host(c.Errors[i].SourceIP).LikelyOffload
+	}
+}
+
+// internetChecksum is the ones' complement checksum of parts
+func internetChecksum(parts ...[]byte) uint16 {
+	c := &checksum.IPv4{}
+	for _, p := range parts {
+		_, _ = c.Write(p)
+	}
+	return binary.BigEndian.Uint16(c.Sum(nil))
+}
+
+func pseudoHeader(src net.IP, dst net.IP, protocol layers.IPProtocol, length int) []byte {
+	if src4, dst4 := src.To4(), dst.To4(); src4 != nil && dst4 != nil {
+		b := make([]byte, 12)
+		copy(b[0:4], src4)
+		copy(b[4:8], dst4)
+		b[9] = byte(protocol)
+		binary.BigEndian.PutUint16(b[10:12], uint16(length))
+		return b
+	}
+	b := make([]byte, 40)
+	copy(b[0:16], src.To16())
+	copy(b[16:32], dst.To16())
+	binary.BigEndian.PutUint32(b[32:36], uint32(length))
+	b[39] = byte(protocol)
+	return b
+}
+
+// checkChecksums checks ip header and tcp/udp checksums of a packet. Transport checksums are only
+// checked if the ip packet is complete and not a fragment, for tunnels the innermost ip layer is used.
+func (fd *Decoder) checkChecksums(p gopacket.Packet) {
+	var src, dst net.IP
+	var transportOk bool
+	var checked bool
+	var failed bool
+
+	check := func(layer string, expected uint16, actual uint16) {
+		checked = true
+		if expected == actual {
+			return
+		}
+		failed = true
+		fd.Checksums.Errors = append(fd.Checksums.Errors, ChecksumError{
+			PacketIndex:   fd.PacketIndex,
+			Layer:         layer,
+			SourceIP:      src,
+			DestinationIP: dst,
+			Expected:      expected,
+			Actual:        actual,
+		})
+	}
+
+	for _, l := range p.Layers() {
+		switch l := l.(type) {
+		case *layers.IPv4:
+			src, dst = l.SrcIP, l.DstIP
+			transportOk = false
+			if len(l.Contents) < 20 {
+				continue
+			}
+			check("ipv4", internetChecksum(l.Contents[0:10], l.Contents[12:]), l.Checksum)
+			transportOk = l.Flags&layers.IPv4MoreFragments == 0 &&
+				l.FragOffset == 0 &&
+				int(l.Length) == len(l.Contents)+len(l.Payload)
+		case *layers.IPv6:
+			src, dst = l.SrcIP, l.DstIP
+			transportOk = int(l.Length) == len(l.Payload)
+		case *layers.IPv6Fragment:
+			transportOk = false
+		case *layers.TCP:
+			if !transportOk || len(l.Contents) < 20 {
+				continue
+			}
+			length := len(l.Contents) + len(l.Payload)
+			check("tcp", internetChecksum(
+				pseudoHeader(src, dst, layers.IPProtocolTCP, length),
+				l.Contents[0:16], []byte{0, 0}, l.Contents[18:], l.Payload,
+			), l.Checksum)
+		case *layers.UDP:
+			length := len(l.Contents) + len(l.Payload)
+			if !transportOk || len(l.Contents) < 8 || int(l.Length) != length {
+				continue
+			}
+			// zero means no checksum for ipv4
+			if l.Checksum == 0 && src.To4() != nil {
+				continue
+			}
+			expected := internetChecksum(
+				pseudoHeader(src, dst, layers.IPProtocolUDP, length),
+				l.Contents[0:6], []byte{0, 0}, l.Payload,
+			)
+			// zero is sent as all ones
+			if expected == 0 {
+				expected = 0xffff
+			}
+			check("udp", expected, l.Checksum)
+		}
+	}
+
+	if !checked {
+		return
+	}
+	sh := fd.Checksums.host(src)
+	dh := fd.Checksums.host(dst)
+	fd.Checksums.Packets++
+	sh.SentPackets++
+	dh.ReceivedPackets++
+	if failed {
+		fd.Checksums.Failed++
+		sh.SentFailed++
+		dh.ReceivedFailed++
+	}
+}
@@ -5,7 +5,9 @@ package flowsdecoder
 import (
 	"bytes"
 	"encoding/binary"
+	"fmt"
 	"net"
+	"time"
 
 	"github.com/google/gopacket"
 	"github.com/google/gopacket/ip4defrag"
@@ -13,34 +15,233 @@ import (
 	"github.com/google/gopacket/reassembly"
 )
 
+// ethernet type of erspan type iii, not known by gopacket
+const erspanTypeIII layers.EthernetType = 0x22eb
+
+const (
+	mplsLabelIPv4ExplicitNull = 0
+	mplsLabelIPv6ExplicitNull = 2
+)
+
+// udp port of tzsp, not known by gopacket
+const tzspPort layers.UDPPort = 37008
+
 type TCPEndpoint struct {
 	IP   net.IP
 	Port int
 }
 
+// SourceRange is a range of stream bytes and where they are in the capture
+type SourceRange struct {
+	StreamOffset int64
+	Offset       int64
+	Length       int64
+}
+
+// TCPFlags is a set of tcp flags
+type TCPFlags uint16
+
+const (
+	TCPFlagFIN TCPFlags = 1 << iota
+	TCPFlagSYN
+	TCPFlagRST
+	TCPFlagPSH
+	TCPFlagACK
+	TCPFlagURG
+	TCPFlagECE
+	TCPFlagCWR
+	TCPFlagNS
+)
+
+var tcpFlagNames = []string{"fin", "syn", "rst", "psh", "ack", "urg", "ece", "cwr", "ns"}
+
+// Names returns names of flags in the set in header bit order, ex: ["fin", "ack"]
+func (f TCPFlags) Names() []string {
+	var names []string
+	for i, n := range tcpFlagNames {
+		if f&(1<<i) != 0 {
+			names = append(names, n)
+		}
+	}
+	return names
+}
+
+func tcpFlags(tcp *layers.TCP) TCPFlags {
+	var f TCPFlags
+	for i, b := range []bool{tcp.FIN, tcp.SYN, tcp.RST, tcp.PSH, tcp.ACK, tcp.URG, tcp.ECE, tcp.CWR, tcp.NS} {
+		if b {
+			f |= 1 << i
+		}
+	}
+	return f
+}
+
+// https://www.rfc-editor.org/rfc/rfc2385 and https://www.rfc-editor.org/rfc/rfc5925
+const (
+	tcpOptionKindMD5Signature   layers.TCPOptionKind = 19
+	tcpOptionKindAuthentication layers.TCPOptionKind = 29
+)
+
 type TCPDirection struct {
 	Endpoint     TCPEndpoint
 	HasStart     bool
 	HasEnd       bool
 	Buffer       *bytes.Buffer
 	SkippedBytes uint64
+	SourceRanges []SourceRange
+
+	// capture time of first and last segment, zero if unknown
+	FirstTimestamp time.Time
+	LastTimestamp  time.Time
+	// payload bytes of all segments including retransmissions
+	Bytes                 uint64
+	Segments              uint64
+	RetransmittedSegments uint64
+	OutOfOrderSegments    uint64
+	// flags seen in any segment
+	Flags TCPFlags
+	// MD5 signature or authentication option seen in any segment
+	MD5Signature         bool
+	AuthenticationOption bool
+}
+
+// addSegment updates statistics, nextSeq is the next expected in order sequence number
+// or negative if not known yet
+func (d *TCPDirection) addSegment(tcp *layers.TCP, ci gopacket.CaptureInfo, nextSeq reassembly.Sequence) {
+	if !ci.Timestamp.IsZero() {
+		if d.FirstTimestamp.IsZero() || ci.Timestamp.Before(d.FirstTimestamp) {
+			d.FirstTimestamp = ci.Timestamp
+		}
+		if ci.Timestamp.After(d.LastTimestamp) {
+			d.LastTimestamp = ci.Timestamp
+		}
+	}
+	d.Segments++
+	d.Bytes += uint64(len(tcp.Payload))
+	d.Flags |= tcpFlags(tcp)
+	for _, o := range tcp.Options {
+		switch o.OptionType {
+		case tcpOptionKindMD5Signature:
+			d.MD5Signature = true
+		case tcpOptionKindAuthentication:
+			d.AuthenticationOption = true
+		}
+	}
+
+	if len(tcp.Payload) == 0 || nextSeq < 0 {
+		return
+	}
+	switch diff := nextSeq.Difference(reassembly.Sequence(tcp.Seq)); {
+	case diff < 0:
+		// starts before next expected byte, all or some of it has been seen before
+		d.RetransmittedSegments++
+	case diff > 0:
+		d.OutOfOrderSegments++
+	}
+}
+
+// payloadSource is the position of a tcp segment payload in the capture, passed
+// thru the assembler using capture info ancillary data
+type payloadSource struct {
+	offset int64
+	length int64
+}
+
+type assemblerContext gopacket.CaptureInfo
+
+func (ac *assemblerContext) GetCaptureInfo() gopacket.CaptureInfo {
+	return gopacket.CaptureInfo(*ac)
+}
+
+func sgPayloadSource(sg reassembly.ScatterGather, offset int) (*payloadSource, bool) {
+	ci := sg.CaptureInfo(offset)
+	if len(ci.AncillaryData) == 0 {
+		return nil, false
+	}
+	ps, ok := ci.AncillaryData[0].(*payloadSource)
+	return ps, ok
+}
+
+// addSourceRanges maps reassembled bytes back to segment payloads, sg is made
+// of chunks from one or more segments so find where each segments bytes ends
+func (d *TCPDirection) addSourceRanges(sg reassembly.ScatterGather, length int, used map[*payloadSource]int64) {
+	streamOffset := int64(d.Buffer.Len())
+	for o := 0; o < length; {
+		ps, ok := sgPayloadSource(sg, o)
+		end := o + 1
+		// binary search for end of bytes from same segment
+		lo, hi := o+1, length
+		for lo <= hi {
+			m := (lo + hi) / 2
+			if mps, _ := sgPayloadSource(sg, m-1); mps == ps {
+				end = m
+				lo = m + 1
+			} else {
+				hi = m - 1
+			}
+		}
+		n := int64(end - o)
+
+		if ok {
+			// retransmitted overlapping bytes are trimmed from the start of a segment
+			start, seen := used[ps]
+			if !seen {
+				start = ps.length - n
+				if start < 0 {
+					start = 0
+				}
+			}
+			used[ps] = start + n
+			d.SourceRanges = append(d.SourceRanges, SourceRange{
+				StreamOffset: streamOffset + int64(o),
+				Offset:       ps.offset + start,
+				Length:       n,
+			})
+		}
+
+		o = end
+	}
 }
 
 type TCPConnection struct {
 	Client     TCPDirection
 	Server     TCPDirection
+	used       map[*payloadSource]int64
 	tcpState   *reassembly.TCPSimpleFSM
 	optChecker reassembly.TCPOptionCheck
 	net        gopacket.Flow
 	transport  gopacket.Flow
 }
 
+// CloseReason is "reset" if any direction sent rst, "fin" if both directions sent fin,
+// "half_closed" if only one did and "open" otherwise
+func (t *TCPConnection) CloseReason() string {
+	switch {
+	case (t.Client.Flags|t.Server.Flags)&TCPFlagRST != 0:
+		return "reset"
+	case t.Client.Flags&t.Server.Flags&TCPFlagFIN != 0:
+		return "fin"
+	case (t.Client.Flags|t.Server.Flags)&TCPFlagFIN != 0:
+		return "half_closed"
+	default:
+		return "open"
+	}
+}
+
 func (t *TCPConnection) Accept(tcp *layers.TCP, ci gopacket.CaptureInfo, dir reassembly.TCPFlowDirection, nextSeq reassembly.Sequence, start *bool, ac reassembly.AssemblerContext) bool {
 	// has ok state?
 	if !t.tcpState.CheckState(tcp, dir) {
 		// TODO: handle err?
 		return false
 	}
+	// count before option check as it rejects retransmissions
+	switch dir {
+	case reassembly.TCPDirClientToServer:
+		t.Client.addSegment(tcp, ci, nextSeq)
+	case reassembly.TCPDirServerToClient:
+		t.Server.addSegment(tcp, ci, nextSeq)
+	}
+
 	// has ok options?
 	if err := t.optChecker.Accept(tcp, ci, dir, nextSeq, start); err != nil {
 		// TODO: handle err?
@@ -80,6 +281,7 @@ func (t *TCPConnection) ReassembledSG(sg reassembly.ScatterGather, ac reassembly
 
 	data := sg.Fetch(length)
 
+	d.addSourceRanges(sg, length, t.used)
 	d.Buffer.Write(data)
 }
 
@@ -88,6 +290,86 @@ func (t *TCPConnection) ReassemblyComplete(ac reassembly.AssemblerContext) bool
 	return false
 }
 
+type UDPEndpoint struct {
+	IP   net.IP
+	Port int
+}
+
+// UDPDirection is datagram payloads concatenated, Datagrams has the boundaries
+type UDPDirection struct {
+	Endpoint  UDPEndpoint
+	Buffer    *bytes.Buffer
+	Datagrams []SourceRange
+
+	// capture time of first and last datagram, zero if unknown
+	FirstTimestamp time.Time
+	LastTimestamp  time.Time
+}
+
+// UDPFlow is datagrams grouped by address and port pairs, client is the sender of the first datagram
+type UDPFlow struct {
+	Client UDPDirection
+	Server UDPDirection
+}
+
+type udpFlowKey struct {
+	sourceIP        string
+	sourcePort      int
+	destinationIP   string
+	destinationPort int
+}
+
+func (fd *Decoder) udpDatagram(net gopacket.Flow, udp *layers.UDP, offset int64) {
+	key := udpFlowKey{
+		sourceIP:        string(net.Src().Raw()),
+		sourcePort:      int(udp.SrcPort),
+		destinationIP:   string(net.Dst().Raw()),
+		destinationPort: int(udp.DstPort),
+	}
+	reverseKey := udpFlowKey{
+		sourceIP:        key.destinationIP,
+		sourcePort:      key.destinationPort,
+		destinationIP:   key.sourceIP,
+		destinationPort: key.sourcePort,
+	}
+
+	var d *UDPDirection
+	if f, ok := fd.udpFlows[key]; ok {
+		d = &f.Client
+	} else if f, ok := fd.udpFlows[reverseKey]; ok {
+		d = &f.Server
+	} else {
+		f := &UDPFlow{
+			Client: UDPDirection{
+				Endpoint: UDPEndpoint{IP: append([]byte(nil), net.Src().Raw()...), Port: key.sourcePort},
+				Buffer:   &bytes.Buffer{},
+			},
+			Server: UDPDirection{
+				Endpoint: UDPEndpoint{IP: append([]byte(nil), net.Dst().Raw()...), Port: key.destinationPort},
+				Buffer:   &bytes.Buffer{},
+			},
+		}
+		fd.udpFlows[key] = f
+		fd.UDPFlows = append(fd.UDPFlows, f)
+		d = &f.Client
+	}
+
+	if ts := fd.FrameTimestamp; !ts.IsZero() {
+		if d.FirstTimestamp.IsZero() || ts.Before(d.FirstTimestamp) {
+			d.FirstTimestamp = ts
+		}
+		if ts.After(d.LastTimestamp) {
+			d.LastTimestamp = ts
+		}
+	}
+	d.Datagrams = append(d.Datagrams, SourceRange{
+		StreamOffset: int64(d.Buffer.Len()),
+		Offset:       offset,
+		Length:       int64(len(udp.Payload)),
+	})
+	d.Buffer.Write(udp.Payload)
+}
+
 type IPV4Reassembled struct {
 	SourceIP      net.IP
 	DestinationIP net.IP
@@ -127,6 +409,7 @@ func (fd *Decoder) New(net, transport gopacket.Flow, tcp *layers.TCP, ac reassem
 			Buffer: &bytes.Buffer{},
 		},
 
+		used:       map[*payloadSource]int64{},
 		net:        net,
 		transport:  transport,
 		tcpState:   reassembly.NewTCPSimpleFSM(fsmOptions),
@@ -138,41 +421,317 @@ func (fd *Decoder) New(net, transport gopacket.Flow, tcp *layers.TCP, ac reassem
 	return stream
 }
 
+// PacketError is an error decoding a packet for flows
+type PacketError struct {
+	PacketIndex int64
+	Err         error
+}
+
 type Decoder struct {
 	TCPConnections  []*TCPConnection
+	UDPFlows        []*UDPFlow
 	IPV4Reassembled []IPV4Reassembled
+	ICMPExchanges   []*ICMPExchange
+	OtherPackets    []OtherPacket
+	ProtocolSummary ProtocolSummary
+	PacketErrors    []PacketError
+	Checksums       Checksums
+	// check ip, tcp and udp checksums
+	CheckChecksums bool
+	// index of current frame in the capture
+	PacketIndex int64
+	// link type of current frame
+	LinkType int
+	// byte offset of current frame in the capture, -1 if unknown
+	FrameOffset int64
+	// capture time of current frame, zero if unknown
+	FrameTimestamp time.Time
 
 	ipv4Defrag   *ip4defrag.IPv4Defragmenter
+	ipv6Defrag   *ipv6Defragmenter
 	tcpAssembler *reassembly.Assembler
+	udpFlows     map[udpFlowKey]*UDPFlow
+	icmpEchos    map[icmpEchoKey]*ICMPExchange
 }
 
 func New() *Decoder {
-	flowDecoder := &Decoder{}
+	flowDecoder := &Decoder{
+		ProtocolSummary: newProtocolSummary(),
+		FrameOffset:     -1,
+		udpFlows:        map[udpFlowKey]*UDPFlow{},
+		icmpEchos:       map[icmpEchoKey]*ICMPExchange{},
+	}
 	streamPool := reassembly.NewStreamPool(flowDecoder)
 	tcpAssembler := reassembly.NewAssembler(streamPool)
 	flowDecoder.tcpAssembler = tcpAssembler
 	flowDecoder.ipv4Defrag = ip4defrag.NewIPv4Defragmenter()
+	flowDecoder.ipv6Defrag = newIPv6Defragmenter()
 
 	return flowDecoder
 }
 
 func (fd *Decoder) SLLPacket(bs []byte) error {
-	return fd.packet(gopacket.NewPacket(bs, layers.LayerTypeLinuxSLL, gopacket.Lazy))
+	return fd.packet(bs, gopacket.NewPacket(bs, layers.LayerTypeLinuxSLL, gopacket.DecodeOptions{Lazy: true, NoCopy: true}), 0)
+}
+
+// SLL2Packet decodes linux cooked capture v2, not supported by gopacket
+// https://www.tcpdump.org/linktypes/LINKTYPE_LINUX_SLL2.html
+func (fd *Decoder) SLL2Packet(bs []byte) error {
+	if len(bs) < 20 {
+		return fmt.Errorf("sll2 packet too short %d", len(bs))
+	}
+	etherType := layers.EthernetType(binary.BigEndian.Uint16(bs[0:2]))
+	return fd.packet(bs, gopacket.NewPacket(bs[20:], etherType.LayerType(), gopacket.DecodeOptions{Lazy: true, NoCopy: true}), 0)
 }
 
 func (fd *Decoder) EthernetFrame(bs []byte) error {
-	return fd.packet(gopacket.NewPacket(bs, layers.LayerTypeEthernet, gopacket.Lazy))
+	return fd.packet(bs, gopacket.NewPacket(bs, layers.LayerTypeEthernet, gopacket.DecodeOptions{Lazy: true, NoCopy: true}), 0)
 }
 
 func (fd *Decoder) LoopbackFrame(bs []byte) error {
-	return fd.packet(gopacket.NewPacket(bs, layers.LayerTypeLoopback, gopacket.Lazy))
+	return fd.packet(bs, gopacket.NewPacket(bs, layers.LayerTypeLoopback, gopacket.DecodeOptions{Lazy: true, NoCopy: true}), 0)
+}
+
+// PPPFrame decodes ppp frame with or without hdlc-like framing
+func (fd *Decoder) PPPFrame(bs []byte) error {
+	frame := bs
+	if len(frame) >= 2 && frame[0] == 0xff && frame[1] == 0x03 {
+		frame = frame[2:]
+	}
+	return fd.packet(bs, gopacket.NewPacket(frame, layers.LayerTypePPP, gopacket.DecodeOptions{Lazy: true, NoCopy: true}), 0)
+}
+
+// CiscoHDLCFrame decodes cisco hdlc frame, address, control and ether type
+func (fd *Decoder) CiscoHDLCFrame(bs []byte) error {
+	if len(bs) < 4 {
+		return fmt.Errorf("cisco hdlc frame too short %d", len(bs))
+	}
+	etherType := layers.EthernetType(binary.BigEndian.Uint16(bs[2:4]))
+	return fd.packet(bs, gopacket.NewPacket(bs[4:], etherType.LayerType(), gopacket.DecodeOptions{Lazy: true, NoCopy: true}), 0)
+}
+
+// RadiotapFrame decodes radiotap header followed by 802.11 frame
+func (fd *Decoder) RadiotapFrame(bs []byte) error {
+	// gopacket radiotap decoder can panic if header length is larger than frame
+	if len(bs) < 8 {
+		return fmt.Errorf("radiotap frame too short %d", len(bs))
+	}
+	if l := int(binary.LittleEndian.Uint16(bs[2:4])); l > len(bs) {
+		return fmt.Errorf("radiotap length %d larger than frame", l)
+	}
+	var rt layers.RadioTap
+	if err := rt.DecodeFromBytes(bs, gopacket.NilDecodeFeedback); err != nil {
+		return err
+	}
+	frame := bs[rt.Length:]
+	if rt.Flags.FCS() && len(frame) >= 4 {
+		frame = frame[:len(frame)-4]
+	}
+	return fd.ieee80211Frame(bs, frame)
+}
+
+// IEEE80211Frame decodes 802.11 frame without fcs
+func (fd *Decoder) IEEE80211Frame(bs []byte) error {
+	return fd.ieee80211Frame(bs, bs)
+}
+
+// gopacket's dot11 decoder assumes there is a fcs and copies the payload if not so
+// instead find the llc snap payload to keep payloads as slices of the frame
+func (fd *Decoder) ieee80211Frame(bs []byte, frame []byte) error {
+	etherType, payload := ieee80211Payload(frame)
+	if payload == nil {
+		// not a data frame with a known payload, only count it
+		return fd.packet(bs, gopacket.NewPacket(frame, gopacket.LayerTypePayload, gopacket.DecodeOptions{Lazy: true, NoCopy: true}), 0)
+	}
+	return fd.packet(bs, gopacket.NewPacket(payload, etherType.LayerType(), gopacket.DecodeOptions{Lazy: true, NoCopy: true}), 0)
+}
+
+// ieee80211Payload returns ether type and payload of unprotected data frame with llc snap header
+func ieee80211Payload(b []byte) (layers.EthernetType, []byte) {
+	if len(b) < 24 {
+		return 0, nil
+	}
+	typ := b[0] >> 2 & 0b11
+	subtype := b[0] >> 4
+	toFromDS := b[1] & 0b11
+	order := b[1]&0x80 != 0
+	protected := b[1]&0x40 != 0
+	// data type without the no data subtype bit
+	if typ != 2 || subtype&0b0100 != 0 || protected {
+		return 0, nil
+	}
+
+	headerLen := 24
+	if toFromDS == 0b11 {
+		headerLen += 6
+	}
+	if subtype&0b1000 != 0 {
+		// qos control
+		headerLen += 2
+		if len(b) < headerLen {
+			return 0, nil
+		}
+		// a-msdu present
+		if b[headerLen-2]&0x80 != 0 {
+			return 0, nil
+		}
+		if order {
+			// ht control
+			headerLen += 4
+		}
+	}
+	if len(b) < headerLen+8 {
+		return 0, nil
+	}
+	llc := b[headerLen:]
+	if llc[0] != 0xaa || llc[1] != 0xaa || llc[2] != 0x03 {
+		return 0, nil
+	}
+
+	return layers.EthernetType(binary.BigEndian.Uint16(llc[6:8])), llc[8:]
+}
+
+// max number of nested encapsulated frames to unwrap, ex: mirrored traffic that is mirrored again
+const maxEncapsulationDepth = 4
+
+// encapsulatedFrame returns ethernet frame encapsulated in gre as erspan or transparent
+// ethernet bridging, in a mpls pseudowire or in tzsp
+func encapsulatedFrame(p gopacket.Packet) []byte {
+	// gre first as gopacket decodes into the gre payload so the udp layer can be an inner one
+	if gre, ok := p.Layer(layers.LayerTypeGRE).(*layers.GRE); ok {
+		return greFrame(gre)
+	}
+	if frame := mplsPseudowireFrame(p); frame != nil {
+		return frame
+	}
+	if udp, ok := p.Layer(layers.LayerTypeUDP).(*layers.UDP); ok &&
+		(udp.SrcPort == tzspPort || udp.DstPort == tzspPort) {
+		return tzspFrame(udp.Payload)
+	}
+	return nil
+}
+
+// mplsPseudowireFrame returns ethernet frame after bottom of mpls label stack, ip payloads
+// are decoded by gopacket
+// https://www.rfc-editor.org/rfc/rfc4448
+func mplsPseudowireFrame(p gopacket.Packet) []byte {
+	var bottom *layers.MPLS
+	for _, l := range p.Layers() {
+		if mpls, ok := l.(*layers.MPLS); ok && mpls.StackBottom {
+			bottom = mpls
+			break
+		}
+	}
+	if bottom == nil || len(bottom.Payload) == 0 {
+		return nil
+	}
+	b := bottom.Payload
+
+	switch {
+	case bottom.Label == mplsLabelIPv4ExplicitNull || bottom.Label == mplsLabelIPv6ExplicitNull:
+		return nil
+	case b[0]>>4 == 4 || b[0]>>4 == 6:
+		return nil
+	case b[0]>>4 == 0:
+		// control word
+		if len(b) < 4 {
+			return nil
+		}
+		return b[4:]
+	default:
+		return b
+	}
 }
 
-func (fd *Decoder) packet(p gopacket.Packet) error {
-	// TODO: linkType
+// tzspFrame returns ethernet frame after tzsp header and tags
+// https://en.wikipedia.org/wiki/TZSP
+func tzspFrame(b []byte) []byte {
+	// version 1, received or transmitted packet with ethernet encapsulation
+	if len(b) < 4 || b[0] != 1 || b[1] > 1 || b[2] != 0 || b[3] != 1 {
+		return nil
+	}
+	i := 4
+	for i < len(b) {
+		switch b[i] {
+		case 0:
+			// padding
+			i++
+		case 1:
+			// end
+			return b[i+1:]
+		default:
+			if i+1 >= len(b) {
+				return nil
+			}
+			i += 2 + int(b[i+1])
+		}
+	}
+	return nil
+}
+
+// https://datatracker.ietf.org/doc/html/draft-foschiano-erspan-03
+func greFrame(gre *layers.GRE) []byte {
+	b := gre.Payload
+
+	headerLen := 0
+	switch gre.Protocol {
+	case layers.EthernetTypeERSPAN:
+		// type i has no header and no gre sequence number
+		if gre.SeqPresent {
+			headerLen = 8
+		}
+	case erspanTypeIII:
+		headerLen = 12
+		if len(b) < headerLen {
+			return nil
+		}
+		// only ethernet frame type
+		if b[10]>>2&0x1f != 0 {
+			return nil
+		}
+		// optional platform specific sub header
+		if b[11]&1 != 0 {
+			headerLen += 8
+		}
+	case layers.EthernetTypeTransparentEthernetBridging:
+	default:
+		return nil
+	}
+	if len(b) < headerLen {
+		return nil
+	}
+
+	return b[headerLen:]
+}
+
+// bs is the frame and is not copied so layer payloads are slices of it, depth is
+// number of encapsulations unwrapped and p is the innermost frame
+func (fd *Decoder) packet(bs []byte, p gopacket.Packet, depth int) error {
+	if depth == 0 {
+		// count before defragmentation adds reassembled layers to the packet
+		fd.ProtocolSummary.packet(p)
+		if fd.CheckChecksums {
+			fd.checkChecksums(p)
+		}
+	}
+
+	if frame := encapsulatedFrame(p); len(frame) > 0 {
+		if depth >= maxEncapsulationDepth {
+			return fmt.Errorf("max encapsulation depth %d reached", maxEncapsulationDepth)
+		}
+		// gopacket might have decoded some inner layers but use only the inner frame
+		return fd.packet(bs, gopacket.NewPacket(frame, layers.LayerTypeEthernet, gopacket.DecodeOptions{Lazy: true, NoCopy: true}), depth+1)
+	}
+
+	fd.otherPacket(bs, p)
+
+	defragmented := false
+	// fragment not yet reassembled, transport layer is partial
+	fragment := false
 	ip4Layer := p.Layer(layers.LayerTypeIPv4)
 	if ip4Layer != nil {
 		ip4, _ := ip4Layer.(*layers.IPv4)
+		fragment = ip4.Flags&layers.IPv4MoreFragments != 0 || ip4.FragOffset != 0
 		l := ip4.Length
 		newIPv4, err := fd.ipv4Defrag.DefragIPv4(ip4)
 		if err != nil {
@@ -205,6 +764,25 @@ func (fd *Decoder) packet(p gopacket.Packet) error {
 				if err := nextDecoder.Decode(newIPv4.Payload, pb); err != nil {
 					return err
 				}
+				defragmented = true
+			}
+		}
+	}
+
+	ip6FragLayer := p.Layer(layers.LayerTypeIPv6Fragment)
+	if ip6FragLayer != nil {
+		ip6Frag, _ := ip6FragLayer.(*layers.IPv6Fragment)
+		fragment = true
+		if ip6, ok := p.Layer(layers.LayerTypeIPv6).(*layers.IPv6); ok {
+			if payload := fd.ipv6Defrag.defrag(ip6, ip6Frag); payload != nil {
+				pb, ok := p.(gopacket.PacketBuilder)
+				if !ok {
+					panic("not a PacketBuilder")
+				}
+				if err := ip6Frag.NextHeader.LayerType().Decode(payload, pb); err != nil {
+					return err
+				}
+				defragmented = true
 			}
 		}
 	}
@@ -212,7 +790,34 @@ func (fd *Decoder) packet(p gopacket.Packet) error {
 	tcp := p.Layer(layers.LayerTypeTCP)
 	if tcp != nil {
 		tcp, _ := tcp.(*layers.TCP)
-		fd.tcpAssembler.Assemble(p.NetworkLayer().NetworkFlow(), tcp)
+		ac := &assemblerContext{Timestamp: fd.FrameTimestamp}
+		// payload of a defragmented packet is not one range in the capture
+		if fd.FrameOffset >= 0 && !defragmented {
+			ac.AncillaryData = []any{&payloadSource{
+				offset: fd.FrameOffset + int64(cap(bs)-cap(tcp.Payload)),
+				length: int64(len(tcp.Payload)),
+			}}
+		}
+		fd.tcpAssembler.AssembleWithContext(p.NetworkLayer().NetworkFlow(), tcp, ac)
+	}
+
+	udp := p.Layer(layers.LayerTypeUDP)
+	if udp != nil && (!fragment || defragmented) {
+		udp, _ := udp.(*layers.UDP)
+		offset := int64(-1)
+		if fd.FrameOffset >= 0 && !defragmented {
+			offset = fd.FrameOffset + int64(cap(bs)-cap(udp.Payload))
+		}
+		fd.udpDatagram(p.NetworkLayer().NetworkFlow(), udp, offset)
+	}
+
+	if !fragment || defragmented {
+		fd.icmp(p)
+	}
+
+	// truncated or invalid layer, layers before it are still used
+	if el := p.ErrorLayer(); el != nil {
+		return el.Error()
 	}
 
 	return nil
@@ -0,0 +1,154 @@
+package flowsdecoder
+
+import (
+	"encoding/binary"
+	"net"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+const (
+	ICMPExchangeEcho  = "echo"
+	ICMPExchangeError = "error"
+)
+
+// ICMPMessage is one icmp message in an exchange
+type ICMPMessage struct {
+	PacketIndex int64
+	// zero if unknown
+	Timestamp time.Time
+}
+
+// ICMPExchange is an echo request and its reply or an error message quoting the datagram that
+// caused it. For echo source is the sender of the request, for errors source is the sender of
+// the error and destination the sender of the quoted datagram.
+type ICMPExchange struct {
+	Kind          string
+	Version       int
+	SourceIP      net.IP
+	DestinationIP net.IP
+	Type          uint8
+	Code          uint8
+	// echo identifier and sequence number
+	ID  uint16
+	Seq uint16
+	// echo request or error message, nil if echo reply without seen request
+	Request *ICMPMessage
+	// nil if error or echo request without seen reply
+	Reply *ICMPMessage
+	// start of datagram that caused the error, usually header and first 8 bytes of payload
+	Quoted []byte
+}
+
+type icmpEchoKey struct {
+	version       int
+	sourceIP      string
+	destinationIP string
+	id            uint16
+	seq           uint16
+}
+
+func (fd *Decoder) icmpMessage() *ICMPMessage {
+	return &ICMPMessage{PacketIndex: fd.PacketIndex, Timestamp: fd.FrameTimestamp}
+}
+
+// icmpEcho pairs echo requests with replies, a reply is matched with the latest unanswered
+// request with same addresses, identifier and sequence number
+func (fd *Decoder) icmpEcho(version int, src net.IP, dst net.IP, typ uint8, code uint8, id uint16, seq uint16, isRequest bool) {
+	if isRequest {
+		e := &ICMPExchange{
+			Kind:          ICMPExchangeEcho,
+			Version:       version,
+			SourceIP:      append(net.IP(nil), src...),
+			DestinationIP: append(net.IP(nil), dst...),
+			Type:          typ,
+			Code:          code,
+			ID:            id,
+			Seq:           seq,
+			Request:       fd.icmpMessage(),
+		}
+		fd.icmpEchos[icmpEchoKey{version, string(src), string(dst), id, seq}] = e
+		fd.ICMPExchanges = append(fd.ICMPExchanges, e)
+		return
+	}
+
+	key := icmpEchoKey{version, string(dst), string(src), id, seq}
+	if e, ok := fd.icmpEchos[key]; ok {
+		e.Reply = fd.icmpMessage()
+		delete(fd.icmpEchos, key)
+		return
+	}
+	fd.ICMPExchanges = append(fd.ICMPExchanges, &ICMPExchange{
+		Kind:          ICMPExchangeEcho,
+		Version:       version,
+		SourceIP:      append(net.IP(nil), dst...),
+		DestinationIP: append(net.IP(nil), src...),
+		Type:          typ,
+		Code:          code,
+		ID:            id,
+		Seq:           seq,
+		Reply:         fd.icmpMessage(),
+	})
+}
+
+func (fd *Decoder) icmpError(version int, src net.IP, dst net.IP, typ uint8, code uint8, quoted []byte) {
+	fd.ICMPExchanges = append(fd.ICMPExchanges, &ICMPExchange{
+		Kind:          ICMPExchangeError,
+		Version:       version,
+		SourceIP:      append(net.IP(nil), src...),
+		DestinationIP: append(net.IP(nil), dst...),
+		Type:          typ,
+		Code:          code,
+		Request:       fd.icmpMessage(),
+		Quoted:        append([]byte(nil), quoted...),
+	})
+}
+
+// icmp collects echo and error messages, other messages like router and neighbor discovery are ignored
+func (fd *Decoder) icmp(p gopacket.Packet) {
+	var src, dst net.IP
+	switch l := p.NetworkLayer().(type) {
+	case *layers.IPv4:
+		src, dst = l.SrcIP, l.DstIP
+	case *layers.IPv6:
+		src, dst = l.SrcIP, l.DstIP
+	default:
+		return
+	}
+
+	if l, ok := p.Layer(layers.LayerTypeICMPv4).(*layers.ICMPv4); ok {
+		typ, code := l.TypeCode.Type(), l.TypeCode.Code()
+		switch typ {
+		case layers.ICMPv4TypeEchoRequest, layers.ICMPv4TypeEchoReply:
+			fd.icmpEcho(4, src, dst, typ, code, l.Id, l.Seq, typ == layers.ICMPv4TypeEchoRequest)
+		case layers.ICMPv4TypeDestinationUnreachable,
+			layers.ICMPv4TypeSourceQuench,
+			layers.ICMPv4TypeRedirect,
+			layers.ICMPv4TypeTimeExceeded,
+			layers.ICMPv4TypeParameterProblem:
+			fd.icmpError(4, src, dst, typ, code, l.Payload)
+		}
+		return
+	}
+
+	if l, ok := p.Layer(layers.LayerTypeICMPv6).(*layers.ICMPv6); ok {
+		typ, code := l.TypeCode.Type(), l.TypeCode.Code()
+		// 4 bytes of identifier and sequence number or unused/mtu/pointer before quoted datagram
+		if len(l.Payload) < 4 {
+			return
+		}
+		switch typ {
+		case layers.ICMPv6TypeEchoRequest, layers.ICMPv6TypeEchoReply:
+			id := binary.BigEndian.Uint16(l.Payload[0:2])
+			seq := binary.BigEndian.Uint16(l.Payload[2:4])
+			fd.icmpEcho(6, src, dst, typ, code, id, seq, typ == layers.ICMPv6TypeEchoRequest)
+		case layers.ICMPv6TypeDestinationUnreachable,
+			layers.ICMPv6TypePacketTooBig,
+			layers.ICMPv6TypeTimeExceeded,
+			layers.ICMPv6TypeParameterProblem:
+			fd.icmpError(6, src, dst, typ, code, l.Payload[4:])
+		}
+	}
+}
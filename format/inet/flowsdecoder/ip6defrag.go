@@ -0,0 +1,97 @@
+package flowsdecoder
+
+// IPv6 fragment extension header reassembly
+// https://www.rfc-editor.org/rfc/rfc8200#section-4.5
+
+import (
+	"sort"
+
+	"github.com/google/gopacket/layers"
+)
+
+// max size of a reassembled packet payload, payload length is 16 bit
+const ipv6MaxReassembledLength = 65535
+
+type ipv6FragmentKey struct {
+	sourceIP       string
+	destinationIP  string
+	identification uint32
+}
+
+type ipv6FragmentData struct {
+	offset int
+	data   []byte
+}
+
+type ipv6FragmentList struct {
+	fragments []ipv6FragmentData
+	// length of reassembled payload, -1 until last fragment has been seen
+	length int
+}
+
+type ipv6Defragmenter struct {
+	lists map[ipv6FragmentKey]*ipv6FragmentList
+}
+
+func newIPv6Defragmenter() *ipv6Defragmenter {
+	return &ipv6Defragmenter{lists: map[ipv6FragmentKey]*ipv6FragmentList{}}
+}
+
+// defrag returns reassembled payload after the fragment header when all fragments have been seen
+func (d *ipv6Defragmenter) defrag(ip6 *layers.IPv6, frag *layers.IPv6Fragment) []byte {
+	key := ipv6FragmentKey{
+		sourceIP:       string(ip6.SrcIP),
+		destinationIP:  string(ip6.DstIP),
+		identification: frag.Identification,
+	}
+	l, ok := d.lists[key]
+	if !ok {
+		l = &ipv6FragmentList{length: -1}
+		d.lists[key] = l
+	}
+
+	offset := int(frag.FragmentOffset) * 8
+	end := offset + len(frag.Payload)
+	if end > ipv6MaxReassembledLength {
+		delete(d.lists, key)
+		return nil
+	}
+	// packet data is not copied when decoding so copy fragment payload
+	l.fragments = append(l.fragments, ipv6FragmentData{
+		offset: offset,
+		data:   append([]byte(nil), frag.Payload...),
+	})
+	if !frag.MoreFragments {
+		l.length = end
+	}
+	if l.length == -1 {
+		return nil
+	}
+
+	sort.SliceStable(l.fragments, func(i, j int) bool {
+		return l.fragments[i].offset < l.fragments[j].offset
+	})
+	// all bytes up to end must be covered, overlapping bytes are taken from the fragment with highest offset
+	covered := 0
+	for _, f := range l.fragments {
+		if f.offset > covered {
+			return nil
+		}
+		if e := f.offset + len(f.data); e > covered {
+			covered = e
+		}
+	}
+	if covered < l.length {
+		return nil
+	}
+
+	b := make([]byte, l.length)
+	for _, f := range l.fragments {
+		if f.offset < l.length {
+			copy(b[f.offset:], f.data)
+		}
+	}
+	delete(d.lists, key)
+
+	return b
+}
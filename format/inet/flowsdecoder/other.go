@@ -0,0 +1,29 @@
+package flowsdecoder
+
+import (
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// OtherPacket is a frame without an IPv4 or IPv6 network layer, ARP, LLDP, STP etc
+type OtherPacket struct {
+	PacketIndex int64
+	LinkType    int
+	// ProtocolOther if unknown
+	EtherType int
+	// whole captured frame including link layer
+	Frame []byte
+}
+
+func (fd *Decoder) otherPacket(bs []byte, p gopacket.Packet) {
+	switch p.NetworkLayer().(type) {
+	case *layers.IPv4, *layers.IPv6:
+		return
+	}
+	fd.OtherPackets = append(fd.OtherPackets, OtherPacket{
+		PacketIndex: fd.PacketIndex,
+		LinkType:    fd.LinkType,
+		EtherType:   packetEtherType(p),
+		Frame:       append([]byte(nil), bs...),
+	})
+}
@@ -0,0 +1,165 @@
+package flowsdecoder
+
+import (
+	"sort"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// ProtocolOther is used as key for packets that could not be classified on a level
+const ProtocolOther = -1
+
+type ProtocolCount struct {
+	Key     int
+	Packets uint64
+	Bytes   uint64
+}
+
+type ProtocolCounts map[int]*ProtocolCount
+
+func (pc ProtocolCounts) add(key int, n int) {
+	c, ok := pc[key]
+	if !ok {
+		c = &ProtocolCount{Key: key}
+		pc[key] = c
+	}
+	c.Packets++
+	c.Bytes += uint64(n)
+}
+
+// Sorted returns counts sorted by packets in descending order, if limit is > 0 counts not
+// in the top limit are summed into the other bucket
+func (pc ProtocolCounts) Sorted(limit int) []ProtocolCount {
+	var other *ProtocolCount
+	var cs []ProtocolCount
+	for _, c := range pc {
+		if c.Key == ProtocolOther {
+			oc := *c
+			other = &oc
+			continue
+		}
+		cs = append(cs, *c)
+	}
+	sort.Slice(cs, func(i, j int) bool {
+		if cs[i].Packets != cs[j].Packets {
+			return cs[i].Packets > cs[j].Packets
+		}
+		return cs[i].Key < cs[j].Key
+	})
+	if limit > 0 && len(cs) > limit {
+		if other == nil {
+			other = &ProtocolCount{Key: ProtocolOther}
+		}
+		for _, c := range cs[limit:] {
+			other.Packets += c.Packets
+			other.Bytes += c.Bytes
+		}
+		cs = cs[:limit]
+	}
+	if other != nil {
+		cs = append(cs, *other)
+	}
+	return cs
+}
+
+// ProtocolSummary counts packets and bytes per protocol on each level. Each level only
+// counts packets that were counted on the level above.
+type ProtocolSummary struct {
+	LinkTypes   ProtocolCounts
+	EtherTypes  ProtocolCounts
+	IPProtocols ProtocolCounts
+	TCPPorts    ProtocolCounts
+	UDPPorts    ProtocolCounts
+
+	// captured length of current frame, packet data might have been converted
+	frameLen int
+}
+
+func newProtocolSummary() ProtocolSummary {
+	return ProtocolSummary{
+		LinkTypes:   ProtocolCounts{},
+		EtherTypes:  ProtocolCounts{},
+		IPProtocols: ProtocolCounts{},
+		TCPPorts:    ProtocolCounts{},
+		UDPPorts:    ProtocolCounts{},
+	}
+}
+
+// LinkFrame counts a captured frame, should be called for all frames including ones
+// with a link type not supported by the decoder
+func (s *ProtocolSummary) LinkFrame(linkType int, n int) {
+	s.LinkTypes.add(linkType, n)
+	s.frameLen = n
+}
+
+// packetEtherType is ether type of link layer or ProtocolOther if unknown
+func packetEtherType(p gopacket.Packet) int {
+	switch l := p.LinkLayer().(type) {
+	case *layers.Ethernet:
+		// 802.3 length frame, use snap protocol id if encapsulated
+		if snap, ok := p.Layer(layers.LayerTypeSNAP).(*layers.SNAP); ok && l.EthernetType == layers.EthernetTypeLLC {
+			return int(snap.Type)
+		}
+		return int(l.EthernetType)
+	case *layers.LinuxSLL:
+		return int(l.EthernetType)
+	}
+	// no ethertype in link layer (loopback etc), use network layer
+	switch p.NetworkLayer().(type) {
+	case *layers.IPv4:
+		return int(layers.EthernetTypeIPv4)
+	case *layers.IPv6:
+		return int(layers.EthernetTypeIPv6)
+	}
+	return ProtocolOther
+}
+
+func (s *ProtocolSummary) packet(p gopacket.Packet) {
+	n := s.frameLen
+
+	s.EtherTypes.add(packetEtherType(p), n)
+
+	var ipProtocol int
+	switch l := p.NetworkLayer().(type) {
+	case *layers.IPv4:
+		if l.Flags&layers.IPv4MoreFragments != 0 || l.FragOffset != 0 {
+			ipProtocol = ProtocolOther
+		} else {
+			ipProtocol = int(l.Protocol)
+		}
+	case *layers.IPv6:
+		ipProtocol = int(l.NextHeader)
+		// skip extension headers to get the upper layer protocol
+		for _, el := range p.Layers() {
+			switch el := el.(type) {
+			case *layers.IPv6HopByHop:
+				ipProtocol = int(el.NextHeader)
+			case *layers.IPv6Destination:
+				ipProtocol = int(el.NextHeader)
+			case *layers.IPv6Routing:
+				ipProtocol = int(el.NextHeader)
+			case *layers.IPv6Fragment:
+				ipProtocol = ProtocolOther
+			}
+		}
+	default:
+		return
+	}
+	s.IPProtocols.add(ipProtocol, n)
+
+	switch layers.IPProtocol(ipProtocol) {
+	case layers.IPProtocolTCP:
+		if tcp, ok := p.Layer(layers.LayerTypeTCP).(*layers.TCP); ok {
+			s.TCPPorts.add(int(tcp.DstPort), n)
+		} else {
+			s.TCPPorts.add(ProtocolOther, n)
+		}
+	case layers.IPProtocolUDP:
+		if udp, ok := p.Layer(layers.LayerTypeUDP).(*layers.UDP); ok {
+			s.UDPPorts.add(int(udp.DstPort), n)
+		} else {
+			s.UDPPorts.add(ProtocolOther, n)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package inet
+
+// https://www.rfc-editor.org/rfc/rfc2784
+// https://www.rfc-editor.org/rfc/rfc2890
+// https://www.rfc-editor.org/rfc/rfc1701
+// https://www.rfc-editor.org/rfc/rfc2637 enhanced gre used by pptp
+
+import (
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/checksum"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+var greInetPacketGroup decode.Group
+var greERSPANGroup decode.Group
+var greEther8023FrameGroup decode.Group
+var grePPPFrameGroup decode.Group
+
+func init() {
+	interp.RegisterFormat(decode.Format{
+		Name:        format.GRE_PACKET,
+		Description: "Generic routing encapsulation packet",
+		Groups:      []string{format.IP_PACKET},
+		Dependencies: []decode.Dependency{
+			{Names: []string{format.INET_PACKET}, Group: &greInetPacketGroup},
+			{Names: []string{format.ERSPAN}, Group: &greERSPANGroup},
+			{Names: []string{format.ETHER8023_FRAME}, Group: &greEther8023FrameGroup},
+			{Names: []string{format.PPP_FRAME}, Group: &grePPPFrameGroup},
+		},
+		DecodeFn: decodeGRE,
+	})
+}
+
+func decodeGRE(d *decode.D, in any) any {
+	if ipi, ok := in.(format.IPPacketIn); ok && ipi.Protocol != format.IPv4ProtocolGRE {
+		d.Fatalf("incorrect protocol %d", ipi.Protocol)
+	}
+
+	checksumPresent := d.FieldBool("checksum_present")
+	routingPresent := d.FieldBool("routing_present")
+	keyPresent := d.FieldBool("key_present")
+	sequencePresent := d.FieldBool("sequence_present")
+	d.FieldBool("strict_source_route")
+	d.FieldU3("recursion_control")
+	ackPresent := d.FieldBool("ack_present")
+	d.FieldU4("flags")
+	version := d.FieldU3("version")
+	protocolType := d.FieldU16("protocol_type", format.EtherTypeMap, scalar.ActualHex)
+
+	checksumStart := d.Pos()
+	if checksumPresent || routingPresent {
+		d.FieldU16("checksum", scalar.ActualHex)
+		d.FieldU16("offset")
+	}
+	if keyPresent {
+		if version == 1 {
+			// pptp uses key for payload length and call id
+			d.FieldU16("payload_length")
+			d.FieldU16("call_id")
+		} else {
+			d.FieldU32("key", scalar.ActualHex)
+		}
+	}
+	if sequencePresent {
+		d.FieldU32("sequence_number")
+	}
+	// enhanced gre used by pptp
+	if version == 1 && ackPresent {
+		d.FieldU32("acknowledgment_number")
+	}
+	if routingPresent {
+		d.FieldArray("routing", func(d *decode.D) {
+			for {
+				var sreLength uint64
+				var addressFamily uint64
+				d.FieldStruct("sre", func(d *decode.D) {
+					addressFamily = d.FieldU16("address_family")
+					d.FieldU8("sre_offset")
+					sreLength = d.FieldU8("sre_length")
+					d.FieldRawLen("routing_information", int64(sreLength)*8)
+				})
+				// null sre ends list
+				if addressFamily == 0 && sreLength == 0 {
+					break
+				}
+			}
+		})
+	}
+
+	// checksum covers header and payload with checksum field as zero
+	if checksumPresent {
+		greChecksum := &checksum.IPv4{}
+		d.Copy(greChecksum, bitio.NewIOReader(d.BitBufRange(0, checksumStart)))
+		d.Copy(greChecksum, bitio.NewIOReader(d.BitBufRange(checksumStart+16, d.Len()-checksumStart-16)))
+		_ = d.FieldMustGet("checksum").TryScalarFn(d.ValidateUBytes(greChecksum.Sum(nil)), scalar.ActualHex)
+	}
+
+	if d.BitsLeft() == 0 {
+		// pptp ack only packet
+		return nil
+	}
+
+	if !encapsulatedFn(d, func(d *decode.D) {
+		switch {
+		case protocolType == format.EtherTypePPP:
+			d.FieldFormatOrRawLen(
+				"payload",
+				d.BitsLeft(),
+				grePPPFrameGroup,
+				format.LinkFrameIn{Type: format.LinkTypePPP},
+			)
+		case protocolType == format.EtherTypeERSPAN && !sequencePresent:
+			// erspan type i has no header
+			d.FieldFormatOrRawLen("payload", d.BitsLeft(), greEther8023FrameGroup, nil)
+		case protocolType == format.EtherTypeERSPAN,
+			protocolType == format.EtherTypeERSPANTypeIII:
+			d.FieldFormatOrRawLen("payload", d.BitsLeft(), greERSPANGroup, nil)
+		case protocolType == format.EtherTypeTransparentEthernetBridging:
+			d.FieldFormatOrRawLen("payload", d.BitsLeft(), greEther8023FrameGroup, nil)
+		default:
+			d.FieldFormatOrRawLen(
+				"payload",
+				d.BitsLeft(),
+				greInetPacketGroup,
+				format.InetPacketIn{EtherType: int(protocolType)},
+			)
+		}
+	}) {
+		d.FieldRawLen("payload", d.BitsLeft())
+	}
+
+	return nil
+}
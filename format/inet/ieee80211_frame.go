@@ -0,0 +1,388 @@
+package inet
+
+// IEEE 802.11 wireless LAN MAC frame
+// https://standards.ieee.org/ieee/802.11/7028/
+// https://gitlab.com/wireshark/wireshark/-/blob/master/epan/dissectors/packet-ieee80211.c
+
+import (
+	"fmt"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+var ieee80211FrameInetPacketGroup decode.Group
+
+func init() {
+	interp.RegisterFormat(decode.Format{
+		Name:        format.IEEE80211_FRAME,
+		Description: "IEEE 802.11 wireless LAN frame",
+		Groups:      []string{format.LINK_FRAME},
+		Dependencies: []decode.Dependency{
+			{Names: []string{format.INET_PACKET}, Group: &ieee80211FrameInetPacketGroup},
+		},
+		DecodeFn: decodeIEEE80211Frame,
+	})
+}
+
+const (
+	ieee80211TypeManagement = 0
+	ieee80211TypeControl    = 1
+	ieee80211TypeData       = 2
+	ieee80211TypeExtension  = 3
+)
+
+var ieee80211TypeMap = scalar.UToSymStr{
+	ieee80211TypeManagement: "management",
+	ieee80211TypeControl:    "control",
+	ieee80211TypeData:       "data",
+	ieee80211TypeExtension:  "extension",
+}
+
+const (
+	ieee80211ManagementAssociationRequest    = 0
+	ieee80211ManagementAssociationResponse   = 1
+	ieee80211ManagementReassociationRequest  = 2
+	ieee80211ManagementReassociationResponse = 3
+	ieee80211ManagementProbeRequest          = 4
+	ieee80211ManagementProbeResponse         = 5
+	ieee80211ManagementBeacon                = 8
+	ieee80211ManagementDisassociation        = 10
+	ieee80211ManagementAuthentication        = 11
+	ieee80211ManagementDeauthentication      = 12
+	ieee80211ManagementAction                = 13
+	ieee80211ManagementActionNoAck           = 14
+)
+
+const (
+	ieee80211ControlCTS = 12
+	ieee80211ControlACK = 13
+)
+
+var ieee80211SubtypeMaps = map[uint64]scalar.UToSymStr{
+	ieee80211TypeManagement: {
+		ieee80211ManagementAssociationRequest:    "association_request",
+		ieee80211ManagementAssociationResponse:   "association_response",
+		ieee80211ManagementReassociationRequest:  "reassociation_request",
+		ieee80211ManagementReassociationResponse: "reassociation_response",
+		ieee80211ManagementProbeRequest:          "probe_request",
+		ieee80211ManagementProbeResponse:         "probe_response",
+		6:                                        "timing_advertisement",
+		ieee80211ManagementBeacon:                "beacon",
+		9:                                        "atim",
+		ieee80211ManagementDisassociation:        "disassociation",
+		ieee80211ManagementAuthentication:        "authentication",
+		ieee80211ManagementDeauthentication:      "deauthentication",
+		ieee80211ManagementAction:                "action",
+		ieee80211ManagementActionNoAck:           "action_no_ack",
+	},
+	ieee80211TypeControl: {
+		2:                   "trigger",
+		3:                   "tack",
+		4:                   "beamforming_report_poll",
+		5:                   "vht_ndp_announcement",
+		6:                   "control_frame_extension",
+		7:                   "control_wrapper",
+		8:                   "block_ack_request",
+		9:                   "block_ack",
+		10:                  "ps_poll",
+		11:                  "rts",
+		ieee80211ControlCTS: "cts",
+		ieee80211ControlACK: "ack",
+		14:                  "cf_end",
+		15:                  "cf_end_cf_ack",
+	},
+	ieee80211TypeData: {
+		0:  "data",
+		1:  "data_cf_ack",
+		2:  "data_cf_poll",
+		3:  "data_cf_ack_cf_poll",
+		4:  "null",
+		5:  "cf_ack",
+		6:  "cf_poll",
+		7:  "cf_ack_cf_poll",
+		8:  "qos_data",
+		9:  "qos_data_cf_ack",
+		10: "qos_data_cf_poll",
+		11: "qos_data_cf_ack_cf_poll",
+		12: "qos_null",
+		14: "qos_cf_poll",
+		15: "qos_cf_ack_cf_poll",
+	},
+	ieee80211TypeExtension: {
+		0: "dmg_beacon",
+		1: "s1g_beacon",
+	},
+}
+
+// data subtype bits
+const (
+	ieee80211DataSubtypeQoS    = 0b1000
+	ieee80211DataSubtypeNoData = 0b0100
+)
+
+var ieee80211AckPolicyMap = scalar.UToSymStr{
+	0: "normal_ack",
+	1: "no_ack",
+	2: "no_explicit_ack",
+	3: "block_ack",
+}
+
+const (
+	ieee80211ElementSSID                   = 0
+	ieee80211ElementSupportedRates         = 1
+	ieee80211ElementDSParameterSet         = 3
+	ieee80211ElementExtendedSupportedRates = 50
+	ieee80211ElementVendorSpecific         = 221
+)
+
+var ieee80211ElementMap = scalar.UToSymStr{
+	ieee80211ElementSSID:                   "ssid",
+	ieee80211ElementSupportedRates:         "supported_rates",
+	ieee80211ElementDSParameterSet:         "ds_parameter_set",
+	5:                                      "tim",
+	7:                                      "country",
+	42:                                     "erp",
+	45:                                     "ht_capabilities",
+	48:                                     "rsn",
+	ieee80211ElementExtendedSupportedRates: "extended_supported_rates",
+	61:                                     "ht_operation",
+	127:                                    "extended_capabilities",
+	191:                                    "vht_capabilities",
+	192:                                    "vht_operation",
+	ieee80211ElementVendorSpecific:         "vendor_specific",
+	255:                                    "extension",
+}
+
+// rate in units of 500 kbit/s, top bit marks basic rate
+var ieee80211RateMap = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	u := s.ActualU()
+	s.Description = fmt.Sprintf("%g Mbit/s", float64(u&0x7f)/2)
+	if u&0x80 != 0 {
+		s.Description += ", basic"
+	}
+	return s, nil
+})
+
+// llc header with snap extension
+// https://en.wikipedia.org/wiki/Subnetwork_Access_Protocol
+const (
+	llcSAPSNAP       = 0xaa
+	llcControlUI     = 0x03
+	llcSNAPHeaderLen = 8
+)
+
+// address roles for data frames based on to/from distribution system flags
+var ieee80211DataAddressRoles = map[[2]bool][4]string{
+	{false, false}: {"Destination", "Source", "BSSID", ""},
+	{false, true}:  {"Destination", "BSSID", "Source", ""},
+	{true, false}:  {"BSSID", "Source", "Destination", ""},
+	{true, true}:   {"Receiver", "Transmitter", "Destination", "Source"},
+}
+
+func ieee80211FieldAddress(d *decode.D, name string, role string) {
+	sms := []scalar.Mapper{mapUToEtherSym, scalar.ActualHex}
+	if role != "" {
+		sms = append(sms, scalar.Description(role))
+	}
+	d.FieldU48BE(name, sms...)
+}
+
+func ieee80211DecodeElements(d *decode.D) {
+	d.FieldArray("elements", func(d *decode.D) {
+		for d.BitsLeft() >= 16 {
+			d.FieldStruct("element", func(d *decode.D) {
+				id := d.FieldU8("id", ieee80211ElementMap)
+				length := d.FieldU8("length")
+				d.FramedFn(int64(length)*8, func(d *decode.D) {
+					switch id {
+					case ieee80211ElementSSID:
+						d.FieldUTF8("ssid", int(length))
+					case ieee80211ElementSupportedRates,
+						ieee80211ElementExtendedSupportedRates:
+						d.FieldArray("rates", func(d *decode.D) {
+							for d.BitsLeft() > 0 {
+								d.FieldU8("rate", ieee80211RateMap)
+							}
+						})
+					case ieee80211ElementDSParameterSet:
+						d.FieldU8("channel")
+					case ieee80211ElementVendorSpecific:
+						d.FieldU24BE("oui", scalar.ActualHex)
+						if d.BitsLeft() > 0 {
+							d.FieldRawLen("data", d.BitsLeft())
+						}
+					default:
+						d.FieldRawLen("data", d.BitsLeft())
+					}
+				})
+			})
+		}
+	})
+}
+
+func ieee80211DecodeManagementBody(d *decode.D, subtype uint64) {
+	switch subtype {
+	case ieee80211ManagementBeacon,
+		ieee80211ManagementProbeResponse:
+		d.FieldU64("timestamp")
+		d.FieldU16("beacon_interval", scalar.Description("Time units of 1024 microseconds"))
+		d.FieldU16("capability", scalar.ActualHex)
+	case ieee80211ManagementAssociationRequest:
+		d.FieldU16("capability", scalar.ActualHex)
+		d.FieldU16("listen_interval")
+	case ieee80211ManagementReassociationRequest:
+		d.FieldU16("capability", scalar.ActualHex)
+		d.FieldU16("listen_interval")
+		ieee80211FieldAddress(d, "current_ap", "")
+	case ieee80211ManagementAssociationResponse,
+		ieee80211ManagementReassociationResponse:
+		d.FieldU16("capability", scalar.ActualHex)
+		d.FieldU16("status_code")
+		d.FieldU16("association_id")
+	case ieee80211ManagementAuthentication:
+		d.FieldU16("algorithm")
+		d.FieldU16("transaction_sequence")
+		d.FieldU16("status_code")
+	case ieee80211ManagementDisassociation,
+		ieee80211ManagementDeauthentication:
+		d.FieldU16("reason_code")
+	case ieee80211ManagementAction,
+		ieee80211ManagementActionNoAck:
+		d.FieldU8("category")
+		if d.BitsLeft() > 0 {
+			d.FieldRawLen("action", d.BitsLeft())
+		}
+		return
+	case ieee80211ManagementProbeRequest:
+	default:
+		if d.BitsLeft() > 0 {
+			d.FieldRawLen("data", d.BitsLeft())
+		}
+		return
+	}
+
+	ieee80211DecodeElements(d)
+	if d.BitsLeft() > 0 {
+		d.FieldRawLen("data", d.BitsLeft())
+	}
+}
+
+func ieee80211DecodeDataBody(d *decode.D, amsdu bool) {
+	if amsdu || d.BitsLeft() < llcSNAPHeaderLen*8 {
+		d.FieldRawLen("payload", d.BitsLeft())
+		return
+	}
+	llc := d.PeekBytes(3)
+	if llc[0] != llcSAPSNAP || llc[1] != llcSAPSNAP || llc[2] != llcControlUI {
+		d.FieldRawLen("payload", d.BitsLeft())
+		return
+	}
+
+	var etherType uint64
+	d.FieldStruct("llc", func(d *decode.D) {
+		d.FieldU8("dsap", scalar.ActualHex)
+		d.FieldU8("ssap", scalar.ActualHex)
+		d.FieldU8("control", scalar.ActualHex)
+		d.FieldU24BE("oui", scalar.ActualHex)
+		etherType = d.FieldU16BE("ether_type", format.EtherTypeMap, scalar.ActualHex)
+	})
+	d.FieldFormatOrRawLen(
+		"payload",
+		d.BitsLeft(),
+		ieee80211FrameInetPacketGroup,
+		format.InetPacketIn{EtherType: int(etherType)},
+	)
+}
+
+func decodeIEEE80211Frame(d *decode.D, in any) any {
+	if lfi, ok := in.(format.LinkFrameIn); ok {
+		if lfi.Type != format.LinkTypeIEEE802_11 {
+			d.Fatalf("wrong link type %d", lfi.Type)
+		}
+	}
+
+	d.Endian = decode.LittleEndian
+
+	// type is needed to map subtype which comes before it
+	typ := d.PeekBits(8) >> 2 & 0b11
+	var subtype uint64
+	var toDS, fromDS, protected, order bool
+	d.FieldStruct("frame_control", func(d *decode.D) {
+		subtype = d.FieldU4("subtype", ieee80211SubtypeMaps[typ])
+		d.FieldU2("type", ieee80211TypeMap)
+		d.FieldU2("protocol_version", d.AssertU(0))
+		order = d.FieldBool("order")
+		protected = d.FieldBool("protected")
+		d.FieldBool("more_data")
+		d.FieldBool("power_management")
+		d.FieldBool("retry")
+		d.FieldBool("more_fragments")
+		fromDS = d.FieldBool("from_ds")
+		toDS = d.FieldBool("to_ds")
+	})
+	d.FieldU16("duration")
+
+	if typ == ieee80211TypeControl {
+		ieee80211FieldAddress(d, "address1", "Receiver")
+		if subtype != ieee80211ControlCTS && subtype != ieee80211ControlACK {
+			ieee80211FieldAddress(d, "address2", "Transmitter")
+		}
+		if d.BitsLeft() > 0 {
+			d.FieldRawLen("data", d.BitsLeft())
+		}
+		return nil
+	}
+
+	roles := [4]string{"Destination", "Source", "BSSID", ""}
+	if typ == ieee80211TypeData {
+		roles = ieee80211DataAddressRoles[[2]bool{toDS, fromDS}]
+	}
+	ieee80211FieldAddress(d, "address1", roles[0])
+	ieee80211FieldAddress(d, "address2", roles[1])
+	ieee80211FieldAddress(d, "address3", roles[2])
+	sequenceControl := d.FieldU16("sequence_control", scalar.ActualHex)
+	d.FieldValueU("sequence_number", sequenceControl>>4)
+	d.FieldValueU("fragment_number", sequenceControl&0xf)
+
+	isQoS := typ == ieee80211TypeData && subtype&ieee80211DataSubtypeQoS != 0
+	var amsdu bool
+	if typ == ieee80211TypeData {
+		if toDS && fromDS {
+			ieee80211FieldAddress(d, "address4", roles[3])
+		}
+		if isQoS {
+			d.FieldStruct("qos_control", func(d *decode.D) {
+				amsdu = d.FieldBool("amsdu_present")
+				d.FieldU2("ack_policy", ieee80211AckPolicyMap)
+				d.FieldBool("eosp")
+				d.FieldU4("tid")
+				d.FieldU8("txop")
+			})
+		}
+	}
+	if order && (isQoS || typ == ieee80211TypeManagement) {
+		d.FieldU32("ht_control", scalar.ActualHex)
+	}
+
+	if d.BitsLeft() == 0 {
+		return nil
+	}
+
+	switch {
+	case protected:
+		d.FieldRawLen("payload", d.BitsLeft())
+	case typ == ieee80211TypeManagement:
+		d.FieldStruct("body", func(d *decode.D) {
+			ieee80211DecodeManagementBody(d, subtype)
+		})
+	case typ == ieee80211TypeData && subtype&ieee80211DataSubtypeNoData == 0:
+		ieee80211DecodeDataBody(d, amsdu)
+	default:
+		d.FieldRawLen("data", d.BitsLeft())
+	}
+
+	return nil
+}
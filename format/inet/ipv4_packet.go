@@ -2,6 +2,7 @@ package inet
 
 import (
 	"encoding/binary"
+	"fmt"
 	"net"
 
 	"github.com/wader/fq/format"
@@ -27,19 +28,115 @@ func init() {
 }
 
 const (
-	ipv4OptionEnd = 0
-	ipv4OptionNop = 1
+	ipv4OptionEnd                = 0
+	ipv4OptionNop                = 1
+	ipv4OptionLooseSourceRouting = 3
+	ipv4OptionTimestamp          = 4
+	ipv4OptionRecordRoute        = 7
+	ipv4OptionStrictSourceRoute  = 9
+	ipv4OptionRouterAlert        = 20
 )
 
 var ipv4OptionsMap = scalar.UToScalar{
-	ipv4OptionEnd: {Sym: "end", Description: "End of options list"},
-	ipv4OptionNop: {Sym: "nop", Description: "No operation"},
-	2:             {Description: "Security"},
-	3:             {Description: "Loose Source Routing"},
-	9:             {Description: "Strict Source Routing"},
-	7:             {Description: "Record Route"},
-	8:             {Description: "Stream ID"},
-	4:             {Description: "Internet Timestamp"},
+	ipv4OptionEnd:                {Sym: "end", Description: "End of options list"},
+	ipv4OptionNop:                {Sym: "nop", Description: "No operation"},
+	2:                            {Description: "Security"},
+	ipv4OptionLooseSourceRouting: {Description: "Loose Source Routing"},
+	ipv4OptionStrictSourceRoute:  {Description: "Strict Source Routing"},
+	ipv4OptionRecordRoute:        {Description: "Record Route"},
+	8:                            {Description: "Stream ID"},
+	ipv4OptionTimestamp:          {Description: "Internet Timestamp"},
+	ipv4OptionRouterAlert:        {Description: "Router Alert"},
+}
+
+// https://www.rfc-editor.org/rfc/rfc791 page 22
+const (
+	ipv4TimestampOnly                  = 0
+	ipv4TimestampWithAddress           = 1
+	ipv4TimestampPrespecifiedAddresses = 3
+)
+
+var ipv4TimestampFlagMap = scalar.UToScalar{
+	ipv4TimestampOnly:                  {Sym: "timestamps", Description: "Timestamps only"},
+	ipv4TimestampWithAddress:           {Sym: "addresses_and_timestamps", Description: "Address and timestamp of each hop"},
+	ipv4TimestampPrespecifiedAddresses: {Sym: "prespecified_addresses", Description: "Timestamps for prespecified addresses"},
+}
+
+// https://www.rfc-editor.org/rfc/rfc2113
+var ipv4RouterAlertMap = scalar.UToScalar{
+	0: {Description: "Router shall examine packet"},
+}
+
+// ms since midnight UT, high bit set means non-standard value
+var ipv4TimestampMap = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	if s.ActualU()&0x8000_0000 != 0 {
+		s.Description = "Non-standard"
+	}
+	return s, nil
+})
+
+// decodeIPv4Option decodes an option, returns an error if length is malformed and rest of the
+// options area should not be decoded
+func decodeIPv4Option(d *decode.D) error {
+	d.FieldBool("copied")
+	d.FieldU2("class")
+	kind := d.FieldU5("number", ipv4OptionsMap)
+	switch kind {
+	case ipv4OptionEnd, ipv4OptionNop:
+		return nil
+	}
+
+	if d.BitsLeft() < 8 {
+		return fmt.Errorf("option %d: missing length", kind)
+	}
+	l := d.FieldU8("length")
+	if l < 2 {
+		return fmt.Errorf("option %d: length %d smaller than 2", kind, l)
+	}
+	dataLen := int64(l-2) * 8
+	if dataLen > d.BitsLeft() {
+		return fmt.Errorf("option %d: length %d outside options", kind, l)
+	}
+
+	d.FramedFn(dataLen, func(d *decode.D) {
+		switch {
+		case (kind == ipv4OptionLooseSourceRouting ||
+			kind == ipv4OptionStrictSourceRoute ||
+			kind == ipv4OptionRecordRoute) && l >= 3:
+			d.FieldU8("pointer")
+			d.FieldArray("addresses", func(d *decode.D) {
+				for d.BitsLeft() >= 32 {
+					d.FieldU32("address", mapUToIPv4Sym, scalar.ActualHex)
+				}
+			})
+		case kind == ipv4OptionTimestamp && l >= 4:
+			d.FieldU8("pointer")
+			d.FieldU4("overflow")
+			flag := d.FieldU4("flag", ipv4TimestampFlagMap)
+			d.FieldArray("entries", func(d *decode.D) {
+				switch flag {
+				case ipv4TimestampOnly:
+					for d.BitsLeft() >= 32 {
+						d.FieldU32("timestamp", ipv4TimestampMap)
+					}
+				case ipv4TimestampWithAddress, ipv4TimestampPrespecifiedAddresses:
+					for d.BitsLeft() >= 64 {
+						d.FieldStruct("entry", func(d *decode.D) {
+							d.FieldU32("address", mapUToIPv4Sym, scalar.ActualHex)
+							d.FieldU32("timestamp", ipv4TimestampMap)
+						})
+					}
+				}
+			})
+		case kind == ipv4OptionRouterAlert && l == 4:
+			d.FieldU16("value", ipv4RouterAlertMap)
+		}
+		if !d.End() {
+			d.FieldRawLen("data", d.BitsLeft())
+		}
+	})
+
+	return nil
 }
 
 var mapUToIPv4Sym = scalar.Fn(func(s scalar.S) (scalar.S, error) {
@@ -56,8 +153,10 @@ func decodeIPv4(d *decode.D, in any) any {
 
 	d.FieldU4("version")
 	ihl := d.FieldU4("ihl")
-	d.FieldU6("dscp")
-	d.FieldU2("ecn")
+	dscp := d.FieldU6("dscp", format.IPDSCPMap)
+	ecn := d.FieldU2("ecn", format.IPECNMap)
+	// legacy type of service byte
+	d.FieldValueU("tos", dscp<<2|ecn, scalar.ActualHex)
 	totalLength := d.FieldU16("total_length")
 	d.FieldU16("identification")
 	d.FieldU1("reserved")
@@ -69,22 +168,18 @@ func decodeIPv4(d *decode.D, in any) any {
 	checksumStart := d.Pos()
 	d.FieldU16("header_checksum", scalar.ActualHex)
 	checksumEnd := d.Pos()
-	d.FieldU32("source_ip", mapUToIPv4Sym, scalar.ActualHex)
-	d.FieldU32("destination_ip", mapUToIPv4Sym, scalar.ActualHex)
+	sourceIP := d.FieldScalarU32("source_ip", mapUToIPv4Sym, scalar.ActualHex).SymStr()
+	destinationIP := d.FieldScalarU32("destination_ip", mapUToIPv4Sym, scalar.ActualHex).SymStr()
 	optionsLen := (int64(ihl) - 5) * 8 * 4
 	if optionsLen > 0 {
 		d.FramedFn(optionsLen, func(d *decode.D) {
 			d.FieldArray("options", func(d *decode.D) {
 				for !d.End() {
 					d.FieldStruct("option", func(d *decode.D) {
-						d.FieldBool("copied")
-						d.FieldU2("class")
-						kind := d.FieldU5("number", ipv4OptionsMap)
-						switch kind {
-						case ipv4OptionEnd, ipv4OptionNop:
-						default:
-							l := d.FieldU8("length")
-							d.FieldRawLen("data", (int64(l-2))*8)
+						if err := decodeIPv4Option(d); err != nil {
+							// malformed option, rest of options area is unknown
+							d.FieldValueStr("error", err.Error())
+							d.FieldRawLen("data", d.BitsLeft())
 						}
 					})
 				}
@@ -99,6 +194,13 @@ func decodeIPv4(d *decode.D, in any) any {
 	_ = d.FieldMustGet("header_checksum").TryScalarFn(d.ValidateUBytes(ipv4Checksum.Sum(nil)), scalar.ActualHex)
 
 	dataLen := int64(totalLength-(ihl*4)) * 8
+	// icmp errors quote only start of datagram and captures can be truncated by snaplen
+	truncated := false
+	if dataLen > d.BitsLeft() {
+		dataLen = d.BitsLeft()
+		truncated = true
+		d.FieldValueBool("truncated", true)
+	}
 
 	if moreFragments || fragmentOffset > 0 {
 		d.FieldRawLen("payload", dataLen)
@@ -107,7 +209,7 @@ func decodeIPv4(d *decode.D, in any) any {
 			"payload",
 			dataLen,
 			ipv4IpPacketGroup,
-			format.IPPacketIn{Protocol: int(protocol)},
+			format.IPPacketIn{Protocol: int(protocol), SourceIP: sourceIP, DestinationIP: destinationIP, Truncated: truncated},
 		)
 	}
 
@@ -0,0 +1,156 @@
+package inet
+
+// https://www.iana.org/assignments/iana-ipv6-special-registry/
+// https://datatracker.ietf.org/doc/html/rfc4291 addressing architecture and multicast scopes
+// https://datatracker.ietf.org/doc/html/rfc3056 6to4
+// https://datatracker.ietf.org/doc/html/rfc4380 Teredo
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/wader/fq/internal/bitioextra"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+func init() {
+	interp.RegisterFunc0("ipv6_classify", func(_ *interp.Interp, c string) any {
+		ip := net.ParseIP(c)
+		if ip == nil || !strings.Contains(c, ":") {
+			return fmt.Errorf("%q: not an IPv6 address", c)
+		}
+		ic := classifyIPv6(ip)
+		m := map[string]any{
+			"address":     ipv6String(ip),
+			"class":       ic.class,
+			"description": ic.description,
+		}
+		if ic.scope != "" {
+			m["scope"] = ic.scope
+		}
+		if ic.ipv4 != nil {
+			m["ipv4"] = ic.ipv4.String()
+		}
+		return m
+	})
+}
+
+var ipv6MulticastScopeNames = map[byte]string{
+	0x1: "interface_local",
+	0x2: "link_local",
+	0x3: "realm_local",
+	0x4: "admin_local",
+	0x5: "site_local",
+	0x8: "organization_local",
+	0xe: "global",
+}
+
+type ipv6Class struct {
+	class       string
+	description string
+	// multicast scope
+	scope string
+	// embedded ipv4 address, for teredo the client address
+	ipv4 net.IP
+}
+
+// ipv6String is like net.IP.String but keeps IPv4-mapped addresses in IPv6 form
+func ipv6String(ip net.IP) string {
+	if v4 := ip.To4(); v4 != nil && len(ip) == net.IPv6len {
+		return "::ffff:" + v4.String()
+	}
+	return ip.String()
+}
+
+func ipv6HasPrefix(ip net.IP, prefix []byte, bits int) bool {
+	for i := 0; bits > 0; i++ {
+		mask := byte(0xff)
+		if bits < 8 {
+			mask = ^byte(0xff >> bits)
+		}
+		if ip[i]&mask != prefix[i]&mask {
+			return false
+		}
+		bits -= 8
+	}
+	return true
+}
+
+// classifyIPv6 classifies a 16 byte address using the special-purpose address registry, more
+// specific prefixes are checked first, ex 2001:db8::/32 before 2000::/3
+func classifyIPv6(ip net.IP) ipv6Class {
+	ip = ip.To16()
+	if ip == nil {
+		return ipv6Class{class: "invalid", description: "Invalid address"}
+	}
+
+	switch {
+	case ip.Equal(net.IPv6unspecified):
+		return ipv6Class{class: "unspecified", description: "Unspecified"}
+	case ip.Equal(net.IPv6loopback):
+		return ipv6Class{class: "loopback", description: "Loopback"}
+	case ipv6HasPrefix(ip, []byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0xff, 0xff}, 96):
+		v4 := net.IP(ip[12:16])
+		return ipv6Class{class: "ipv4_mapped", description: "IPv4-mapped " + v4.String(), ipv4: v4}
+	case ipv6HasPrefix(ip, []byte{0x00, 0x64, 0xff, 0x9b, 0, 0, 0, 0, 0, 0, 0, 0}, 96):
+		v4 := net.IP(ip[12:16])
+		return ipv6Class{class: "nat64", description: "NAT64 " + v4.String(), ipv4: v4}
+	case ipv6HasPrefix(ip, make([]byte, 12), 96):
+		v4 := net.IP(ip[12:16])
+		return ipv6Class{class: "ipv4_compatible", description: "IPv4-compatible (deprecated) " + v4.String(), ipv4: v4}
+	case ipv6HasPrefix(ip, []byte{0x20, 0x01, 0x0d, 0xb8}, 32):
+		return ipv6Class{class: "documentation", description: "Documentation"}
+	case ipv6HasPrefix(ip, []byte{0x20, 0x01, 0x00, 0x00}, 32):
+		server := net.IP(ip[4:8])
+		// client address and port are obfuscated by inverting all bits
+		client := net.IPv4(^ip[12], ^ip[13], ^ip[14], ^ip[15]).To4()
+		return ipv6Class{
+			class:       "teredo",
+			description: fmt.Sprintf("Teredo server %s client %s", server, client),
+			ipv4:        client,
+		}
+	case ipv6HasPrefix(ip, []byte{0x20, 0x02}, 16):
+		v4 := net.IP(ip[2:6])
+		return ipv6Class{class: "6to4", description: "6to4 " + v4.String(), ipv4: v4}
+	case ipv6HasPrefix(ip, []byte{0xfe, 0x80}, 10):
+		return ipv6Class{class: "link_local", description: "Link-local unicast"}
+	case ipv6HasPrefix(ip, []byte{0xfe, 0xc0}, 10):
+		return ipv6Class{class: "site_local", description: "Site-local unicast (deprecated)"}
+	case ipv6HasPrefix(ip, []byte{0xfc}, 7):
+		return ipv6Class{class: "unique_local", description: "Unique local unicast"}
+	case ipv6HasPrefix(ip, []byte{0xff}, 8):
+		scopeNibble := ip[1] & 0x0f
+		scope, ok := ipv6MulticastScopeNames[scopeNibble]
+		if !ok {
+			scope = fmt.Sprintf("reserved_%x", scopeNibble)
+			if scopeNibble != 0 && scopeNibble != 0xf {
+				scope = fmt.Sprintf("unassigned_%x", scopeNibble)
+			}
+		}
+		return ipv6Class{class: "multicast", description: "Multicast " + scope + " scope", scope: scope}
+	case ipv6HasPrefix(ip, []byte{0x20}, 3):
+		return ipv6Class{class: "global", description: "Global unicast"}
+	default:
+		return ipv6Class{class: "reserved", description: "Reserved"}
+	}
+}
+
+var mapIPv6ClassDescription = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	// new range reader as previous mappers might have read from the actual reader
+	br, err := bitioextra.Range(s.ActualBitBuf(), 0, net.IPv6len*8)
+	if err != nil {
+		return s, nil
+	}
+	b := &bytes.Buffer{}
+	if _, err := bitioextra.CopyBits(b, br); err != nil {
+		return s, err
+	}
+	if b.Len() != net.IPv6len {
+		return s, nil
+	}
+	s.Description = classifyIPv6(net.IP(b.Bytes())).description
+	return s, nil
+})
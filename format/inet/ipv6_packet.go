@@ -104,7 +104,7 @@ var mapUToIPv6Sym = scalar.Fn(func(s scalar.S) (scalar.S, error) {
 	if _, err := bitioextra.CopyBits(b, s.ActualBitBuf()); err != nil {
 		return s, err
 	}
-	s.Sym = net.IP(b.Bytes()).String()
+	s.Sym = ipv6String(net.IP(b.Bytes()))
 	return s, nil
 })
 
@@ -120,8 +120,8 @@ func decodeIPv6(d *decode.D, in any) any {
 	dataLength := d.FieldU16("payload_length")
 	nextHeader := d.FieldU8("next_header", nextHeaderMap)
 	d.FieldU8("hop_limit")
-	d.FieldRawLen("source_address", 128, mapUToIPv6Sym)
-	d.FieldRawLen("destination_address", 128, mapUToIPv6Sym)
+	sourceIP := d.FieldScalarRawLen("source_address", 128, mapUToIPv6Sym, mapIPv6ClassDescription).SymStr()
+	destinationIP := d.FieldScalarRawLen("destination_address", 128, mapUToIPv6Sym, mapIPv6ClassDescription).SymStr()
 
 	extStart := d.Pos()
 	if isIpv6Option(nextHeader) {
@@ -166,7 +166,7 @@ func decodeIPv6(d *decode.D, in any) any {
 		"payload",
 		payloadLen,
 		ipv4IpPacketGroup,
-		format.IPPacketIn{Protocol: int(nextHeader)},
+		format.IPPacketIn{Protocol: int(nextHeader), SourceIP: sourceIP, DestinationIP: destinationIP, IPv6: true},
 	)
 
 	return nil
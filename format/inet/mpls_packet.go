@@ -0,0 +1,124 @@
+package inet
+
+// https://www.rfc-editor.org/rfc/rfc3032
+// https://www.rfc-editor.org/rfc/rfc4385 pseudowire control word
+// https://www.iana.org/assignments/mpls-label-values/mpls-label-values.xhtml
+
+import (
+	"fmt"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+var mplsInetPacketGroup decode.Group
+var mplsEther8023FrameGroup decode.Group
+
+func init() {
+	interp.RegisterFormat(decode.Format{
+		Name:        format.MPLS_PACKET,
+		Description: "Multiprotocol label switching packet",
+		Groups:      []string{format.INET_PACKET},
+		Dependencies: []decode.Dependency{
+			{Names: []string{format.INET_PACKET}, Group: &mplsInetPacketGroup},
+			{Names: []string{format.ETHER8023_FRAME}, Group: &mplsEther8023FrameGroup},
+		},
+		DecodeFn: decodeMPLS,
+	})
+}
+
+// stacks deeper than this is most likely malformed or crafted
+const mplsMaxStackDepth = 16
+
+const (
+	mplsLabelIPv4ExplicitNull = 0
+	mplsLabelIPv6ExplicitNull = 2
+)
+
+var mplsLabelMap = scalar.UToScalar{
+	mplsLabelIPv4ExplicitNull: {Sym: "ipv4_explicit_null"},
+	1:                         {Sym: "router_alert"},
+	mplsLabelIPv6ExplicitNull: {Sym: "ipv6_explicit_null"},
+	3:                         {Sym: "implicit_null"},
+	7:                         {Sym: "entropy_label_indicator"},
+	13:                        {Sym: "gal", Description: "Generic associated channel label"},
+	14:                        {Sym: "oam_alert"},
+	15:                        {Sym: "extension"},
+}
+
+func decodeMPLS(d *decode.D, in any) any {
+	if ipi, ok := in.(format.InetPacketIn); ok &&
+		ipi.EtherType != format.EtherTypeMPLSUnicast &&
+		ipi.EtherType != format.EtherTypeMPLSMulticast {
+		d.Fatalf("incorrect ethertype %d", ipi.EtherType)
+	}
+
+	var depth uint64
+	var bottomLabel uint64
+	d.FieldArray("labels", func(d *decode.D) {
+		for {
+			var bottomOfStack bool
+			d.FieldStruct("label", func(d *decode.D) {
+				bottomLabel = d.FieldU20("label", mplsLabelMap)
+				d.FieldU3("traffic_class")
+				bottomOfStack = d.FieldBool("bottom_of_stack")
+				d.FieldU8("ttl")
+			})
+			depth++
+			if bottomOfStack {
+				break
+			}
+		}
+	})
+	var depthSms []scalar.Mapper
+	if depth > mplsMaxStackDepth {
+		depthSms = append(depthSms, scalar.Description(fmt.Sprintf("Suspicious, deeper than %d labels", mplsMaxStackDepth)))
+	}
+	d.FieldValueU("stack_depth", depth, depthSms...)
+
+	if d.BitsLeft() == 0 {
+		return nil
+	}
+
+	// payload protocol is not signaled so guess based on explicit null label or first nibble
+	firstNibble := d.PeekBits(4)
+	inetPayload := func(d *decode.D, etherType int) {
+		d.FieldFormatOrRawLen(
+			"payload",
+			d.BitsLeft(),
+			mplsInetPacketGroup,
+			format.InetPacketIn{EtherType: etherType},
+		)
+	}
+	if !encapsulatedFn(d, func(d *decode.D) {
+		switch {
+		case bottomLabel == mplsLabelIPv4ExplicitNull:
+			inetPayload(d, format.EtherTypeIPv4)
+		case bottomLabel == mplsLabelIPv6ExplicitNull:
+			inetPayload(d, format.EtherTypeIPv6)
+		case firstNibble == 4:
+			inetPayload(d, format.EtherTypeIPv4)
+		case firstNibble == 6:
+			inetPayload(d, format.EtherTypeIPv6)
+		case firstNibble == 0 && d.BitsLeft() >= 32:
+			// ethernet pseudowire with control word
+			d.FieldStruct("control_word", func(d *decode.D) {
+				d.FieldU4("zero")
+				d.FieldU4("flags")
+				d.FieldU2("fragment")
+				d.FieldU6("length")
+				d.FieldU16("sequence_number")
+			})
+			d.FieldFormatOrRawLen("payload", d.BitsLeft(), mplsEther8023FrameGroup, nil)
+		default:
+			// ethernet pseudowire without control word
+			d.FieldFormatOrRawLen("payload", d.BitsLeft(), mplsEther8023FrameGroup, nil)
+		}
+	}) {
+		d.FieldRawLen("payload", d.BitsLeft())
+	}
+
+	return nil
+}
@@ -0,0 +1,136 @@
+package inet
+
+// https://www.rfc-editor.org/rfc/rfc1661
+// https://www.rfc-editor.org/rfc/rfc1662 HDLC-like framing
+// https://www.tcpdump.org/linktypes/LINKTYPE_PPP_HDLC.html
+// https://www.tcpdump.org/linktypes/LINKTYPE_C_HDLC.html
+// https://www.iana.org/assignments/ppp-numbers/ppp-numbers.xhtml
+
+import (
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+var pppFrameInetPacketGroup decode.Group
+
+func init() {
+	interp.RegisterFormat(decode.Format{
+		Name:        format.PPP_FRAME,
+		Description: "Point-to-point protocol and Cisco HDLC frame",
+		Groups:      []string{format.LINK_FRAME},
+		Dependencies: []decode.Dependency{
+			{Names: []string{format.INET_PACKET}, Group: &pppFrameInetPacketGroup},
+		},
+		DecodeFn: decodePPPFrame,
+	})
+}
+
+const (
+	pppAddressAllStations = 0xff
+	cHDLCAddressUnicast   = 0x0f
+	cHDLCAddressMulticast = 0x8f
+)
+
+const (
+	pppProtocolIPv4          = 0x0021
+	pppProtocolIPv6          = 0x0057
+	pppProtocolMPLSUnicast   = 0x0281
+	pppProtocolMPLSMulticast = 0x0283
+)
+
+var pppProtocolEtherType = map[uint64]int{
+	pppProtocolIPv4:          format.EtherTypeIPv4,
+	pppProtocolIPv6:          format.EtherTypeIPv6,
+	pppProtocolMPLSUnicast:   format.EtherTypeMPLSUnicast,
+	pppProtocolMPLSMulticast: format.EtherTypeMPLSMulticast,
+}
+
+var pppProtocolMap = scalar.UToScalar{
+	pppProtocolIPv4:          {Sym: "ipv4", Description: `Internet Protocol version 4`},
+	0x002b:                   {Sym: "ipx", Description: `Novell IPX`},
+	0x002d:                   {Sym: "vj_compressed_tcp", Description: `Van Jacobson compressed TCP/IP`},
+	0x002f:                   {Sym: "vj_uncompressed_tcp", Description: `Van Jacobson uncompressed TCP/IP`},
+	0x0031:                   {Sym: "bridging_pdu", Description: `Bridging PDU`},
+	0x003d:                   {Sym: "multilink", Description: `Multi-link protocol`},
+	pppProtocolIPv6:          {Sym: "ipv6", Description: `Internet Protocol version 6`},
+	0x00fd:                   {Sym: "compressed_datagram", Description: `First choice compression`},
+	pppProtocolMPLSUnicast:   {Sym: "mpls_unicast", Description: `MPLS unicast`},
+	pppProtocolMPLSMulticast: {Sym: "mpls_multicast", Description: `MPLS multicast`},
+	0x8021:                   {Sym: "ipcp", Description: `Internet Protocol control protocol`},
+	0x802b:                   {Sym: "ipxcp", Description: `Novell IPX control protocol`},
+	0x8031:                   {Sym: "bcp", Description: `Bridging control protocol`},
+	0x8057:                   {Sym: "ipv6cp", Description: `IPv6 control protocol`},
+	0x80fd:                   {Sym: "ccp", Description: `Compression control protocol`},
+	0x8281:                   {Sym: "mplscp", Description: `MPLS control protocol`},
+	0xc021:                   {Sym: "lcp", Description: `Link control protocol`},
+	0xc023:                   {Sym: "pap", Description: `Password authentication protocol`},
+	0xc025:                   {Sym: "lqr", Description: `Link quality report`},
+	0xc223:                   {Sym: "chap", Description: `Challenge handshake authentication protocol`},
+	0xc227:                   {Sym: "eap", Description: `Extensible authentication protocol`},
+}
+
+var cHDLCAddressMap = scalar.UToScalar{
+	cHDLCAddressUnicast:   {Sym: "unicast"},
+	cHDLCAddressMulticast: {Sym: "multicast"},
+}
+
+func decodePPPFrame(d *decode.D, in any) any {
+	linkType := format.LinkTypePPP
+	if lfi, ok := in.(format.LinkFrameIn); ok {
+		switch lfi.Type {
+		case format.LinkTypePPP,
+			format.LinkTypePPP_HDLC,
+			format.LinkTypeC_HDLC:
+			linkType = lfi.Type
+		default:
+			d.Fatalf("wrong link type %d", lfi.Type)
+		}
+	}
+
+	address := d.PeekBits(8)
+	// PPP_HDLC can also be cisco hdlc, has a different address
+	if linkType == format.LinkTypeC_HDLC ||
+		(linkType == format.LinkTypePPP_HDLC && (address == cHDLCAddressUnicast || address == cHDLCAddressMulticast)) {
+		d.FieldU8("address", cHDLCAddressMap, scalar.ActualHex)
+		d.FieldU8("control", scalar.ActualHex)
+		protocol := d.FieldU16("protocol", format.EtherTypeMap, scalar.ActualHex)
+
+		d.FieldFormatOrRawLen(
+			"payload",
+			d.BitsLeft(),
+			pppFrameInetPacketGroup,
+			format.InetPacketIn{EtherType: int(protocol)},
+		)
+
+		return nil
+	}
+
+	// PPP link type has address and control only if hdlc-like framing is used
+	if linkType == format.LinkTypePPP_HDLC || address == pppAddressAllStations {
+		d.FieldU8("address", d.AssertU(pppAddressAllStations), scalar.ActualHex)
+		d.FieldU8("control", scalar.ActualHex)
+	}
+	// protocol field compression, protocol numbers have odd low byte so one byte
+	// protocol is used if the first byte is odd
+	protocolBits := 16
+	if d.PeekBits(8)&1 == 1 {
+		protocolBits = 8
+	}
+	protocol := d.FieldU("protocol", protocolBits, pppProtocolMap, scalar.ActualHex)
+
+	etherType, ok := pppProtocolEtherType[protocol]
+	if !ok {
+		d.FieldRawLen("payload", d.BitsLeft())
+		return nil
+	}
+	d.FieldFormatOrRawLen(
+		"payload",
+		d.BitsLeft(),
+		pppFrameInetPacketGroup,
+		format.InetPacketIn{EtherType: etherType},
+	)
+
+	return nil
+}
@@ -0,0 +1,372 @@
+package inet
+
+// Radiotap header followed by 802.11 frame
+// https://www.radiotap.org
+// https://github.com/torvalds/linux/blob/master/include/net/ieee80211_radiotap.h
+
+import (
+	"fmt"
+	"hash/crc32"
+	"strings"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+var radiotapIEEE80211FrameGroup decode.Group
+
+func init() {
+	interp.RegisterFormat(decode.Format{
+		Name:        format.RADIOTAP_FRAME,
+		Description: "Radiotap header and 802.11 frame",
+		Groups:      []string{format.LINK_FRAME},
+		Dependencies: []decode.Dependency{
+			{Names: []string{format.IEEE80211_FRAME}, Group: &radiotapIEEE80211FrameGroup},
+		},
+		DecodeFn: decodeRadiotapFrame,
+	})
+}
+
+// present word bits that are not fields
+const (
+	radiotapPresentFlags             = 1
+	radiotapPresentRadiotapNamespace = 29
+	radiotapPresentVendorNamespace   = 30
+	radiotapPresentExt               = 31
+)
+
+type radiotapField struct {
+	name  string
+	align int64 // in bytes, also relative to start of header
+	fn    func(d *decode.D)
+}
+
+// radiotapFieldFlags returns true if frame has fcs at end
+func radiotapFieldFlags(d *decode.D) bool {
+	d.FieldBool("short_gi")
+	d.FieldBool("bad_fcs")
+	d.FieldBool("data_pad")
+	hasFCS := d.FieldBool("fcs")
+	d.FieldBool("fragmentation")
+	d.FieldBool("wep")
+	d.FieldBool("short_preamble")
+	d.FieldBool("cfp")
+	return hasFCS
+}
+
+var radiotapFrequencyToChannel = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	f := int(s.ActualU())
+	var channel int
+	switch {
+	case f == 2484:
+		channel = 14
+	case f >= 2412 && f < 2484:
+		channel = (f - 2407) / 5
+	case f >= 5000 && f < 5950:
+		channel = (f - 5000) / 5
+	case f > 5950 && f <= 7125:
+		channel = (f - 5950) / 5
+	default:
+		return s, nil
+	}
+	s.Description = fmt.Sprintf("Channel %d", channel)
+	return s, nil
+})
+
+var radiotapRateMap = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	s.Description = fmt.Sprintf("%g Mbit/s", float64(s.ActualU())/2)
+	return s, nil
+})
+
+// indexed by present bit, nil for unknown
+var radiotapFields = []*radiotapField{
+	0: {name: "tsft", align: 8, fn: func(d *decode.D) { d.FieldU64("tsft") }},
+	// fn is nil as flags is decoded by decodeRadiotapFields to know if there is a fcs
+	radiotapPresentFlags: {name: "flags", align: 1},
+	2:                    {name: "rate", align: 1, fn: func(d *decode.D) { d.FieldU8("rate", radiotapRateMap) }},
+	3: {name: "channel", align: 2, fn: func(d *decode.D) {
+		d.FieldStruct("channel", func(d *decode.D) {
+			d.FieldU16("frequency", radiotapFrequencyToChannel)
+			d.FieldStruct("flags", func(d *decode.D) {
+				// little endian so low byte first
+				d.FieldBool("2ghz")
+				d.FieldBool("ofdm")
+				d.FieldBool("cck")
+				d.FieldBool("turbo")
+				d.FieldU4("unused")
+				d.FieldBool("quarter_rate")
+				d.FieldBool("half_rate")
+				d.FieldBool("static_turbo")
+				d.FieldBool("gsm")
+				d.FieldBool("gfsk")
+				d.FieldBool("dynamic_cck_ofdm")
+				d.FieldBool("passive")
+				d.FieldBool("5ghz")
+			})
+		})
+	}},
+	4: {name: "fhss", align: 1, fn: func(d *decode.D) {
+		d.FieldStruct("fhss", func(d *decode.D) {
+			d.FieldU8("hop_set")
+			d.FieldU8("hop_pattern")
+		})
+	}},
+	5:  {name: "antenna_signal", align: 1, fn: func(d *decode.D) { d.FieldS8("antenna_signal", scalar.Description("dBm")) }},
+	6:  {name: "antenna_noise", align: 1, fn: func(d *decode.D) { d.FieldS8("antenna_noise", scalar.Description("dBm")) }},
+	7:  {name: "lock_quality", align: 2, fn: func(d *decode.D) { d.FieldU16("lock_quality") }},
+	8:  {name: "tx_attenuation", align: 2, fn: func(d *decode.D) { d.FieldU16("tx_attenuation") }},
+	9:  {name: "db_tx_attenuation", align: 2, fn: func(d *decode.D) { d.FieldU16("db_tx_attenuation") }},
+	10: {name: "dbm_tx_power", align: 1, fn: func(d *decode.D) { d.FieldS8("dbm_tx_power", scalar.Description("dBm")) }},
+	11: {name: "antenna", align: 1, fn: func(d *decode.D) { d.FieldU8("antenna") }},
+	12: {name: "db_antenna_signal", align: 1, fn: func(d *decode.D) { d.FieldU8("db_antenna_signal", scalar.Description("dB")) }},
+	13: {name: "db_antenna_noise", align: 1, fn: func(d *decode.D) { d.FieldU8("db_antenna_noise", scalar.Description("dB")) }},
+	14: {name: "rx_flags", align: 2, fn: func(d *decode.D) { d.FieldU16("rx_flags", scalar.ActualHex) }},
+	15: {name: "tx_flags", align: 2, fn: func(d *decode.D) { d.FieldU16("tx_flags", scalar.ActualHex) }},
+	16: {name: "rts_retries", align: 1, fn: func(d *decode.D) { d.FieldU8("rts_retries") }},
+	17: {name: "data_retries", align: 1, fn: func(d *decode.D) { d.FieldU8("data_retries") }},
+	18: {name: "xchannel", align: 4, fn: func(d *decode.D) {
+		d.FieldStruct("xchannel", func(d *decode.D) {
+			d.FieldU32("flags", scalar.ActualHex)
+			d.FieldU16("frequency", radiotapFrequencyToChannel)
+			d.FieldU8("channel")
+			d.FieldU8("max_power")
+		})
+	}},
+	19: {name: "mcs", align: 1, fn: func(d *decode.D) {
+		d.FieldStruct("mcs", func(d *decode.D) {
+			d.FieldU8("known", scalar.ActualHex)
+			d.FieldU8("flags", scalar.ActualHex)
+			d.FieldU8("mcs")
+		})
+	}},
+	20: {name: "ampdu_status", align: 4, fn: func(d *decode.D) {
+		d.FieldStruct("ampdu_status", func(d *decode.D) {
+			d.FieldU32("reference")
+			d.FieldU16("flags", scalar.ActualHex)
+			d.FieldU8("delimiter_crc", scalar.ActualHex)
+			d.FieldU8("reserved")
+		})
+	}},
+	21: {name: "vht", align: 2, fn: func(d *decode.D) {
+		d.FieldStruct("vht", func(d *decode.D) {
+			d.FieldU16("known", scalar.ActualHex)
+			d.FieldU8("flags", scalar.ActualHex)
+			d.FieldU8("bandwidth")
+			d.FieldArray("mcs_nss", func(d *decode.D) {
+				for i := 0; i < 4; i++ {
+					d.FieldU8("user", scalar.ActualHex)
+				}
+			})
+			d.FieldU8("coding", scalar.ActualHex)
+			d.FieldU8("group_id")
+			d.FieldU16("partial_aid")
+		})
+	}},
+	22: {name: "timestamp", align: 8, fn: func(d *decode.D) {
+		d.FieldStruct("timestamp", func(d *decode.D) {
+			d.FieldU64("timestamp")
+			d.FieldU16("accuracy")
+			d.FieldU8("unit_position", scalar.ActualHex)
+			d.FieldU8("flags", scalar.ActualHex)
+		})
+	}},
+	23: {name: "he", align: 2, fn: func(d *decode.D) {
+		d.FieldStruct("he", func(d *decode.D) {
+			for i := 1; i <= 6; i++ {
+				d.FieldU16(fmt.Sprintf("data%d", i), scalar.ActualHex)
+			}
+		})
+	}},
+	24: {name: "he_mu", align: 2, fn: func(d *decode.D) {
+		d.FieldStruct("he_mu", func(d *decode.D) {
+			d.FieldU16("flags1", scalar.ActualHex)
+			d.FieldU16("flags2", scalar.ActualHex)
+			d.FieldRawLen("ru_channel1", 32)
+			d.FieldRawLen("ru_channel2", 32)
+		})
+	}},
+	25: {name: "he_mu_other_user", align: 2, fn: func(d *decode.D) {
+		d.FieldStruct("he_mu_other_user", func(d *decode.D) {
+			d.FieldU16("per_user_1", scalar.ActualHex)
+			d.FieldU16("per_user_2", scalar.ActualHex)
+			d.FieldU8("per_user_position")
+			d.FieldU8("per_user_known", scalar.ActualHex)
+		})
+	}},
+	26: {name: "zero_length_psdu", align: 1, fn: func(d *decode.D) { d.FieldU8("zero_length_psdu") }},
+	27: {name: "lsig", align: 2, fn: func(d *decode.D) {
+		d.FieldStruct("lsig", func(d *decode.D) {
+			d.FieldU16("data1", scalar.ActualHex)
+			d.FieldU16("data2", scalar.ActualHex)
+		})
+	}},
+	28: nil, // tlvs, unsupported
+}
+
+type radiotapPresentWord struct {
+	vendor bool // in vendor namespace
+	index  int  // word index in namespace
+	word   uint64
+}
+
+// radiotapPresentDescription lists fields or namespace for present word
+func radiotapPresentDescription(p radiotapPresentWord) string {
+	if p.vendor {
+		return "Vendor namespace"
+	}
+	var names []string
+	for bit := 0; bit < radiotapPresentRadiotapNamespace; bit++ {
+		if p.word&(1<<bit) == 0 {
+			continue
+		}
+		if p.index == 0 && bit < len(radiotapFields) && radiotapFields[bit] != nil {
+			names = append(names, radiotapFields[bit].name)
+		} else {
+			names = append(names, fmt.Sprintf("unknown%d", p.index*32+bit))
+		}
+	}
+	if p.word&(1<<radiotapPresentVendorNamespace) != 0 {
+		names = append(names, "vendor_namespace")
+	}
+	return strings.Join(names, ",")
+}
+
+func radiotapAlign(d *decode.D, start int64, name string, align int64) {
+	offset := (d.Pos() - start) / 8
+	if pad := (align - offset%align) % align; pad > 0 {
+		d.FieldRawLen(name+"_padding", pad*8)
+	}
+}
+
+// decodeRadiotapNamespace decodes fields for present words of one namespace, ok is false if an
+// unknown field was found and rest of header can't be decoded
+func decodeRadiotapNamespace(d *decode.D, start int64, presents []radiotapPresentWord, vendorSkipLength *int64, hasFCS *bool) bool {
+	for _, p := range presents {
+		if p.vendor {
+			if p.index == 0 {
+				radiotapAlign(d, start, "data", 2)
+				d.FieldRawLen("data", *vendorSkipLength*8)
+			}
+		} else {
+			for bit := 0; bit < radiotapPresentRadiotapNamespace; bit++ {
+				if p.word&(1<<bit) == 0 {
+					continue
+				}
+				if p.index != 0 || bit >= len(radiotapFields) || radiotapFields[bit] == nil {
+					return false
+				}
+				f := radiotapFields[bit]
+				radiotapAlign(d, start, f.name, f.align)
+				if bit == radiotapPresentFlags {
+					d.FieldStruct("flags", func(d *decode.D) { *hasFCS = radiotapFieldFlags(d) })
+				} else {
+					f.fn(d)
+				}
+			}
+		}
+		if p.word&(1<<radiotapPresentVendorNamespace) != 0 {
+			radiotapAlign(d, start, "vendor_namespace", 2)
+			d.FieldStruct("vendor_namespace", func(d *decode.D) {
+				d.FieldU24BE("oui", scalar.ActualHex)
+				d.FieldU8("sub_namespace")
+				*vendorSkipLength = int64(d.FieldU16("skip_length"))
+			})
+		}
+	}
+	return true
+}
+
+func decodeRadiotapFrame(d *decode.D, in any) any {
+	if lfi, ok := in.(format.LinkFrameIn); ok {
+		if lfi.Type != format.LinkTypeIEEE802_11_RADIOTAP {
+			d.Fatalf("wrong link type %d", lfi.Type)
+		}
+	}
+
+	d.Endian = decode.LittleEndian
+
+	start := d.Pos()
+	d.FieldU8("version", d.AssertU(0))
+	d.FieldU8("pad")
+	length := d.FieldU16("length")
+	if length < 8 {
+		d.Fatalf("length %d too small", length)
+	}
+
+	var presents []radiotapPresentWord
+	d.FieldArray("present", func(d *decode.D) {
+		vendor := false
+		index := 0
+		for {
+			p := radiotapPresentWord{vendor: vendor, index: index}
+			w := d.FieldU32("word", scalar.ActualHex, scalar.Fn(func(s scalar.S) (scalar.S, error) {
+				p.word = s.ActualU()
+				s.Description = radiotapPresentDescription(p)
+				return s, nil
+			}))
+			presents = append(presents, p)
+			if w&(1<<radiotapPresentExt) == 0 {
+				break
+			}
+			switch {
+			case w&(1<<radiotapPresentRadiotapNamespace) != 0:
+				vendor = false
+				index = 0
+			case w&(1<<radiotapPresentVendorNamespace) != 0:
+				vendor = true
+				index = 0
+			default:
+				index++
+			}
+		}
+	})
+
+	var hasFCS bool
+	fieldsLen := int64(length)*8 - (d.Pos() - start)
+	if fieldsLen < 0 {
+		d.Fatalf("length %d smaller than present words", length)
+	}
+	// group present words by namespace, each namespace has its own set of fields
+	var namespaces [][]radiotapPresentWord
+	for _, p := range presents {
+		if p.index == 0 {
+			namespaces = append(namespaces, nil)
+		}
+		namespaces[len(namespaces)-1] = append(namespaces[len(namespaces)-1], p)
+	}
+	d.FramedFn(fieldsLen, func(d *decode.D) {
+		var vendorSkipLength int64
+		d.FieldArray("namespaces", func(d *decode.D) {
+			for _, ns := range namespaces {
+				ok := true
+				d.FieldStruct("namespace", func(d *decode.D) {
+					// alignment is relative to start of header
+					ok = decodeRadiotapNamespace(d, start, ns, &vendorSkipLength, &hasFCS)
+					if !ok {
+						d.FieldRawLen("unknown", d.BitsLeft())
+					}
+				})
+				if !ok {
+					break
+				}
+			}
+		})
+	})
+
+	payloadLen := d.BitsLeft()
+	if hasFCS && payloadLen >= 32 {
+		payloadLen -= 32
+	}
+	payloadStart := d.Pos()
+	d.FieldFormatOrRawLen("payload", payloadLen, radiotapIEEE80211FrameGroup, format.LinkFrameIn{Type: format.LinkTypeIEEE802_11})
+	if hasFCS && d.BitsLeft() == 32 {
+		fcs := crc32.NewIEEE()
+		d.Copy(fcs, bitio.NewIOReader(d.BitBufRange(payloadStart, payloadLen)))
+		d.FieldU32("fcs", d.ValidateUBytes(fcs.Sum(nil)), scalar.ActualHex)
+	}
+
+	return nil
+}
@@ -35,14 +35,14 @@ func decodeSLL2(d *decode.D, in any) any {
 	d.FieldU16("reserved")
 	d.FieldU32("interface_index")
 	arpHdrType := d.FieldU16("arphdr_type", arpHdrTypeMAp)
-	d.FieldU8("packet_type", sllPacketTypeMap)
+	d.FieldU8("packet_type", format.LinuxPacketTypeMap)
 	addressLength := d.FieldU8("link_address_length", d.ValidateURange(0, 8))
 	// "If there are more than 8 bytes, only the first 8 bytes are present"
 	if addressLength > 8 {
 		addressLength = 8
 	}
 	// TODO: maybe skip padding and always read 8 bytes?
-	d.FieldU("link_address", int(addressLength)*8)
+	linkAddress := d.FieldU("link_address", int(addressLength)*8)
 	addressDiff := 8 - addressLength
 	if addressDiff > 0 {
 		d.FieldRawLen("padding", int64(addressDiff)*8)
@@ -52,11 +52,14 @@ func decodeSLL2(d *decode.D, in any) any {
 	switch arpHdrType {
 	case arpHdrTypeLoopback, arpHdrTypeEther:
 		_ = d.FieldMustGet("link_address").TryScalarFn(mapUToEtherSym, scalar.ActualHex)
+		if addressLength == 6 {
+			fieldEtherAddressFlags(d, "link_address", linkAddress)
+		}
 		d.FieldFormatOrRawLen(
 			"payload",
 			d.BitsLeft(),
 			sllPacket2InetPacketGroup,
-			format.LinkFrameIn{Type: int(protcolType)},
+			format.InetPacketIn{EtherType: int(protcolType)},
 		)
 	default:
 		d.FieldRawLen("payload", d.BitsLeft())
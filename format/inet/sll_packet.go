@@ -24,14 +24,6 @@ func init() {
 	})
 }
 
-var sllPacketTypeMap = scalar.UToScalar{
-	0: {Sym: "to_us", Description: "Sent to us"},
-	1: {Sym: "broadcast", Description: "Broadcast by somebody else"},
-	2: {Sym: "multicast", Description: "Multicast by somebody else"},
-	3: {Sym: "to_other", Description: "Sent to somebody else by somebody else"},
-	4: {Sym: "from_us", Description: "Sent by us"},
-}
-
 const (
 	arpHdrTypeEther    = 1
 	arpHdrTypeLoopback = 772
@@ -115,10 +107,10 @@ func decodeSLL(d *decode.D, in any) any {
 		}
 	}
 
-	d.FieldU16("packet_type", sllPacketTypeMap)
+	d.FieldU16("packet_type", format.LinuxPacketTypeMap)
 	arpHdrType := d.FieldU16("arphdr_type", arpHdrTypeMAp)
 	addressLength := d.FieldU16("link_address_length")
-	d.FieldU("link_address", int(addressLength)*8)
+	linkAddress := d.FieldU("link_address", int(addressLength)*8)
 	addressDiff := 8 - addressLength
 	if addressDiff > 0 {
 		d.FieldRawLen("padding", int64(addressDiff)*8)
@@ -128,6 +120,9 @@ func decodeSLL(d *decode.D, in any) any {
 	switch arpHdrType {
 	case arpHdrTypeLoopback, arpHdrTypeEther:
 		_ = d.FieldMustGet("link_address").TryScalarFn(mapUToEtherSym, scalar.ActualHex)
+		if addressLength == 6 {
+			fieldEtherAddressFlags(d, "link_address", linkAddress)
+		}
 		protcolType := d.FieldU16("protocol_type", format.EtherTypeMap, scalar.ActualHex)
 		d.FieldFormatOrRawLen(
 			"payload",
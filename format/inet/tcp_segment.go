@@ -3,7 +3,11 @@ package inet
 // https://en.wikipedia.org/wiki/Transmission_Control_Protocol
 
 import (
+	"encoding/binary"
+
 	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/checksum"
 	"github.com/wader/fq/pkg/decode"
 	"github.com/wader/fq/pkg/interp"
 	"github.com/wader/fq/pkg/scalar"
@@ -19,22 +23,116 @@ func init() {
 }
 
 const (
-	tcpOptionEnd = 0
-	tcpOptionNop = 1
+	tcpOptionEnd            = 0
+	tcpOptionNop            = 1
+	tcpOptionMaxSeg         = 2
+	tcpOptionWinScale       = 3
+	tcpOptionSACKPermitted  = 4
+	tcpOptionSACK           = 5
+	tcpOptionTimestamp      = 8
+	tcpOptionMD5Signature   = 19
+	tcpOptionAuthentication = 29
+	tcpOptionFastOpen       = 34
 )
 
 var tcpOptionsMap = scalar.UToScalar{
-	tcpOptionEnd: {Sym: "end", Description: "End of options list"},
-	tcpOptionNop: {Sym: "nop", Description: "No operation"},
-	2:            {Sym: "maxseg", Description: "Maximum segment size"},
-	3:            {Sym: "winscale", Description: "Window scale"},
-	4:            {Sym: "sack_permitted", Description: "Selective Acknowledgement permitted"},
-	5:            {Sym: "sack", Description: "Selective ACKnowledgement"},
-	8:            {Sym: "timestamp", Description: "Timestamp and echo of previous timestamp"},
+	tcpOptionEnd:            {Sym: "end", Description: "End of options list"},
+	tcpOptionNop:            {Sym: "nop", Description: "No operation"},
+	tcpOptionMaxSeg:         {Sym: "maxseg", Description: "Maximum segment size"},
+	tcpOptionWinScale:       {Sym: "winscale", Description: "Window scale"},
+	tcpOptionSACKPermitted:  {Sym: "sack_permitted", Description: "Selective Acknowledgement permitted"},
+	tcpOptionSACK:           {Sym: "sack", Description: "Selective ACKnowledgement"},
+	tcpOptionTimestamp:      {Sym: "timestamp", Description: "Timestamp and echo of previous timestamp"},
+	tcpOptionMD5Signature:   {Sym: "md5_signature", Description: "MD5 signature"},
+	tcpOptionAuthentication: {Sym: "authentication", Description: "TCP Authentication Option"},
+	tcpOptionFastOpen:       {Sym: "fast_open", Description: "TCP Fast Open cookie"},
+}
+
+// option lengths including kind and length bytes
+var tcpOptionLengths = map[uint64]uint64{
+	tcpOptionMaxSeg:        4,
+	tcpOptionWinScale:      3,
+	tcpOptionSACKPermitted: 2,
+	tcpOptionTimestamp:     10,
+	tcpOptionMD5Signature:  18,
+}
+
+// https://www.rfc-editor.org/rfc/rfc7323#section-2.3
+const tcpMaxWindowShift = 14
+
+func decodeTCPOption(d *decode.D) uint64 {
+	kind := d.FieldU8("kind", tcpOptionsMap)
+	switch kind {
+	case tcpOptionEnd, tcpOptionNop:
+		return kind
+	}
+
+	if d.BitsLeft() < 8 {
+		d.Errorf("option kind %d: missing length", kind)
+	}
+	l := d.FieldU8("length")
+	if l < 2 {
+		d.Errorf("option kind %d: length %d smaller than 2", kind, l)
+	}
+	if int64(l-2)*8 > d.BitsLeft() {
+		d.Errorf("option kind %d: length %d outside options", kind, l)
+	}
+	if fl, ok := tcpOptionLengths[kind]; ok && l != fl {
+		d.Errorf("option kind %d: length %d should be %d", kind, l, fl)
+	}
+
+	switch kind {
+	case tcpOptionMaxSeg:
+		d.FieldU16("mss")
+	case tcpOptionWinScale:
+		shift := d.FieldU8("shift_count")
+		if shift > tcpMaxWindowShift {
+			// receiver uses 14 for larger values
+			shift = tcpMaxWindowShift
+		}
+		d.FieldValueU("multiplier", 1<<shift)
+	case tcpOptionSACKPermitted:
+	case tcpOptionSACK:
+		if (l-2)%8 != 0 || l == 2 {
+			d.Errorf("option sack: length %d is not 2 plus a multiple of 8", l)
+		}
+		d.FieldArray("blocks", func(d *decode.D) {
+			for i := uint64(0); i < (l-2)/8; i++ {
+				d.FieldStruct("block", func(d *decode.D) {
+					d.FieldU32("left_edge")
+					d.FieldU32("right_edge")
+				})
+			}
+		})
+	case tcpOptionTimestamp:
+		d.FieldU32("value")
+		d.FieldU32("echo_reply")
+	case tcpOptionMD5Signature:
+		// https://www.rfc-editor.org/rfc/rfc2385
+		d.FieldRawLen("digest", 16*8, scalar.RawHex)
+	case tcpOptionAuthentication:
+		// https://www.rfc-editor.org/rfc/rfc5925#section-2.2
+		if l < 4 {
+			d.Errorf("option authentication: length %d smaller than 4", l)
+		}
+		d.FieldU8("key_id")
+		d.FieldU8("rnext_key_id")
+		d.FieldRawLen("mac", int64(l-4)*8, scalar.RawHex)
+	case tcpOptionFastOpen:
+		// empty is a cookie request
+		if l > 2 {
+			d.FieldRawLen("cookie", int64(l-2)*8)
+		}
+	default:
+		d.FieldRawLen("data", int64(l-2)*8)
+	}
+
+	return kind
 }
 
 func decodeTCP(d *decode.D, in any) any {
-	if ipi, ok := in.(format.IPPacketIn); ok && ipi.Protocol != format.IPv4ProtocolTCP {
+	ipi, hasIPI := in.(format.IPPacketIn)
+	if hasIPI && ipi.Protocol != format.IPv4ProtocolTCP {
 		d.Fatalf("incorrect protocol %d", ipi.Protocol)
 	}
 
@@ -54,34 +152,50 @@ func decodeTCP(d *decode.D, in any) any {
 	d.FieldBool("syn")
 	d.FieldBool("fin")
 	d.FieldU16("window_size")
-	// checksumStart := d.Pos()
-	d.FieldU16("checksum", scalar.ActualHex)
-	// checksumEnd := d.Pos()
+	checksumStart := d.Pos()
+	actualChecksum := d.FieldU16("checksum", scalar.ActualHex)
+	checksumEnd := d.Pos()
 	d.FieldU16("urgent_pointer")
 	optionsLen := (int64(dataOffset) - 5) * 8 * 4
 	if optionsLen > 0 {
 		d.FramedFn(optionsLen, func(d *decode.D) {
 			d.FieldArray("options", func(d *decode.D) {
-				for !d.End() {
+				end := false
+				for !end && !d.End() {
 					d.FieldStruct("option", func(d *decode.D) {
-						kind := d.FieldU8("kind", tcpOptionsMap)
-						switch kind {
-						case tcpOptionEnd, tcpOptionNop:
-						default:
-							l := d.FieldU8("length")
-							d.FieldRawLen("data", (int64(l-2))*8)
-						}
+						end = decodeTCPOption(d) == tcpOptionEnd
 					})
 				}
 			})
+			// rest of header after end of options list
+			if !d.End() {
+				d.FieldRawLen("padding", d.BitsLeft(), d.BitBufIsZero())
+			}
 		})
 	}
 
-	// TODO: need to pass ipv4 pseudo header somehow
-	// tcpChecksum := &checksum.IPv4{}
-	// d.MustCopy(tcpChecksum, d.BitBufRange(0, checksumStart))
-	// d.MustCopy(tcpChecksum, d.BitBufRange(checksumEnd, d.Len()-checksumEnd))
-	// _ = d.FieldMustGet("checksum").TryScalarFn(d.ValidateUBytes(tcpChecksum.Sum(nil)), scalar.Hex)
+	// checksum covers pseudo header and whole segment so can only be validated if ip addresses
+	// are known and the segment is complete
+	if hasIPI && !ipi.Truncated {
+		if pseudoHeader := ipPseudoHeader(ipi, int(d.Len()/8)); pseudoHeader != nil {
+			tcpChecksum := &checksum.IPv4{}
+			_, _ = tcpChecksum.Write(pseudoHeader)
+			d.Copy(tcpChecksum, bitio.NewIOReader(d.BitBufRange(0, checksumStart)))
+			d.Copy(tcpChecksum, bitio.NewIOReader(d.BitBufRange(checksumEnd, d.Len()-checksumEnd)))
+			sum := tcpChecksum.Sum(nil)
+			_ = d.FieldMustGet("checksum").TryScalarFn(d.ValidateUBytes(sum), scalar.ActualHex)
+
+			if binary.BigEndian.Uint16(sum) != uint16(actualChecksum) {
+				// with checksum offload the capture is done before the network card calculates the
+				// checksum, field is then usually zero or the partial checksum of the pseudo header
+				pseudoChecksum := &checksum.IPv4{}
+				_, _ = pseudoChecksum.Write(pseudoHeader)
+				partial := binary.BigEndian.Uint16(pseudoChecksum.Sum(nil))
+				d.FieldValueBool("checksum_offload_suspected",
+					actualChecksum == 0 || uint16(actualChecksum) == partial || uint16(actualChecksum) == ^partial)
+			}
+		}
+	}
 
 	d.FieldRawLen("payload", d.BitsLeft())
 
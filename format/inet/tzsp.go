@@ -0,0 +1,159 @@
+package inet
+
+// TaZmen Sniffer Protocol, used by ex: Mikrotik packet sniffer streaming
+// https://en.wikipedia.org/wiki/TZSP
+// https://gitlab.com/wireshark/wireshark/-/blob/master/epan/dissectors/packet-tzsp.c
+
+import (
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+var tzspLinkFrameGroup decode.Group
+
+func init() {
+	interp.RegisterFormat(decode.Format{
+		Name:        format.TZSP,
+		Description: "TaZmen sniffer protocol",
+		Groups:      []string{format.UDP_PAYLOAD},
+		Dependencies: []decode.Dependency{
+			{Names: []string{format.LINK_FRAME}, Group: &tzspLinkFrameGroup},
+		},
+		DecodeFn: decodeTZSP,
+	})
+}
+
+const (
+	tzspTypeReceivedTagList   = 0
+	tzspTypePacketForTransmit = 1
+)
+
+var tzspTypeMap = scalar.UToSymStr{
+	tzspTypeReceivedTagList:   "received_tag_list",
+	tzspTypePacketForTransmit: "packet_for_transmit",
+	2:                         "reserved",
+	3:                         "configuration",
+	4:                         "keepalive",
+	5:                         "port_opener",
+}
+
+const (
+	tzspEncapsulationEthernet   = 1
+	tzspEncapsulationIEEE802_11 = 18
+	tzspEncapsulationPrism      = 119
+	tzspEncapsulationWLANAVS    = 127
+)
+
+var tzspEncapsulationMap = scalar.UToScalar{
+	tzspEncapsulationEthernet:   {Sym: "ethernet"},
+	tzspEncapsulationIEEE802_11: {Sym: "ieee_802_11"},
+	tzspEncapsulationPrism:      {Sym: "prism_header", Description: "Prism monitoring mode header"},
+	tzspEncapsulationWLANAVS:    {Sym: "wlan_avs", Description: "AVS monitoring mode header"},
+}
+
+// encapsulation to pcap link type
+var tzspEncapsulationLinkType = map[uint64]int{
+	tzspEncapsulationEthernet:   format.LinkTypeETHERNET,
+	tzspEncapsulationIEEE802_11: format.LinkTypeIEEE802_11,
+	tzspEncapsulationPrism:      format.LinkTypeIEEE802_11_PRISM,
+	tzspEncapsulationWLANAVS:    format.LinkTypeIEEE802_11_AVS,
+}
+
+const (
+	tzspTagPadding            = 0
+	tzspTagEnd                = 1
+	tzspTagRawRSSI            = 10
+	tzspTagSNR                = 11
+	tzspTagDataRate           = 12
+	tzspTagTimestamp          = 13
+	tzspTagContentionFree     = 15
+	tzspTagDecrypted          = 16
+	tzspTagFCSError           = 17
+	tzspTagRXChannel          = 18
+	tzspTagPacketCount        = 40
+	tzspTagRXFrameLength      = 41
+	tzspTagWLANRadioHdrSerial = 60
+)
+
+var tzspTagMap = scalar.UToSymStr{
+	tzspTagPadding:            "padding",
+	tzspTagEnd:                "end",
+	tzspTagRawRSSI:            "raw_rssi",
+	tzspTagSNR:                "snr",
+	tzspTagDataRate:           "data_rate",
+	tzspTagTimestamp:          "timestamp",
+	tzspTagContentionFree:     "contention_free",
+	tzspTagDecrypted:          "decrypted",
+	tzspTagFCSError:           "fcs_error",
+	tzspTagRXChannel:          "rx_channel",
+	tzspTagPacketCount:        "packet_count",
+	tzspTagRXFrameLength:      "rx_frame_length",
+	tzspTagWLANRadioHdrSerial: "wlan_radio_hdr_serial",
+}
+
+func decodeTZSP(d *decode.D, in any) any {
+	if upi, ok := in.(format.UDPPayloadIn); ok {
+		upi.MustIsPort(d.Fatalf, format.UDPPortTZSP)
+	}
+
+	d.FieldU8("version", d.AssertU(1))
+	typ := d.FieldU8("type", tzspTypeMap)
+	encapsulation := d.FieldU16("encapsulation", tzspEncapsulationMap)
+
+	// only received and transmitted packets have tags and a frame
+	if typ != tzspTypeReceivedTagList && typ != tzspTypePacketForTransmit {
+		if d.BitsLeft() > 0 {
+			d.FieldRawLen("data", d.BitsLeft())
+		}
+		return nil
+	}
+
+	d.FieldArray("tags", func(d *decode.D) {
+		for {
+			var tagType uint64
+			d.FieldStruct("tag", func(d *decode.D) {
+				tagType = d.FieldU8("type", tzspTagMap)
+				if tagType == tzspTagPadding || tagType == tzspTagEnd {
+					return
+				}
+				length := d.FieldU8("length")
+				d.FramedFn(int64(length)*8, func(d *decode.D) {
+					switch {
+					case tagType == tzspTagRawRSSI && length == 1:
+						d.FieldS8("value")
+					case tagType == tzspTagRawRSSI && length == 2:
+						d.FieldS16("value")
+					case tagType == tzspTagTimestamp && length == 4,
+						tagType == tzspTagPacketCount && length == 4:
+						d.FieldU32("value")
+					case tagType == tzspTagRXFrameLength && length == 2:
+						d.FieldU16("value")
+					case length == 1:
+						d.FieldU8("value")
+					default:
+						d.FieldRawLen("value", d.BitsLeft())
+					}
+				})
+			})
+			if tagType == tzspTagEnd {
+				break
+			}
+		}
+	})
+
+	linkType, ok := tzspEncapsulationLinkType[encapsulation]
+	if !ok || !encapsulatedFn(d, func(d *decode.D) {
+		d.FieldFormatOrRawLen(
+			"payload",
+			d.BitsLeft(),
+			tzspLinkFrameGroup,
+			format.LinkFrameIn{Type: linkType},
+		)
+	}) {
+		d.FieldRawLen("payload", d.BitsLeft())
+	}
+
+	return nil
+}
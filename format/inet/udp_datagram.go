@@ -1,7 +1,12 @@
 package inet
 
 import (
+	"encoding/binary"
+	"net"
+
 	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/checksum"
 	"github.com/wader/fq/pkg/decode"
 	"github.com/wader/fq/pkg/interp"
 	"github.com/wader/fq/pkg/scalar"
@@ -21,15 +26,50 @@ func init() {
 	})
 }
 
+// ipPseudoHeader returns the ipv4 or ipv6 pseudo header used for tcp and udp checksums, nil if
+// addresses are unknown
+func ipPseudoHeader(ipi format.IPPacketIn, length int) []byte {
+	src := net.ParseIP(ipi.SourceIP)
+	dst := net.ParseIP(ipi.DestinationIP)
+	if src == nil || dst == nil {
+		return nil
+	}
+	if !ipi.IPv6 {
+		src4, dst4 := src.To4(), dst.To4()
+		if src4 == nil || dst4 == nil {
+			return nil
+		}
+		b := make([]byte, 12)
+		copy(b[0:4], src4)
+		copy(b[4:8], dst4)
+		b[9] = byte(ipi.Protocol)
+		binary.BigEndian.PutUint16(b[10:12], uint16(length))
+		return b
+	}
+	b := make([]byte, 40)
+	copy(b[0:16], src.To16())
+	copy(b[16:32], dst.To16())
+	binary.BigEndian.PutUint32(b[32:36], uint32(length))
+	b[39] = byte(ipi.Protocol)
+	return b
+}
+
 func decodeUDP(d *decode.D, in any) any {
-	if ipi, ok := in.(format.IPPacketIn); ok && ipi.Protocol != format.IPv4ProtocolUDP {
-		d.Fatalf("incorrect protocol %d", ipi.Protocol)
+	var sourceIP string
+	ipi, hasIPI := in.(format.IPPacketIn)
+	if hasIPI {
+		if ipi.Protocol != format.IPv4ProtocolUDP {
+			d.Fatalf("incorrect protocol %d", ipi.Protocol)
+		}
+		sourceIP = ipi.SourceIP
 	}
 
 	sourcePort := d.FieldU16("source_port", format.UDPPortMap)
 	destPort := d.FieldU16("destination_port", format.UDPPortMap)
 	length := d.FieldU16("length")
+	checksumStart := d.Pos()
 	d.FieldU16("checksum", scalar.ActualHex)
+	checksumEnd := d.Pos()
 
 	payloadLen := int64(length-8) * 8
 	d.FieldFormatOrRawLen(
@@ -37,12 +77,33 @@ func decodeUDP(d *decode.D, in any) any {
 		payloadLen,
 		udpPayloadGroup,
 		format.UDPPayloadIn{
+			SourceIP:        sourceIP,
 			SourcePort:      int(sourcePort),
 			DestinationPort: int(destPort),
 		},
 	)
 
-	// TODO: for checksum need to pass ipv4 pseudo header somehow
+	// checksum covers pseudo header, header and payload so can only be validated if ip addresses
+	// are known and the whole datagram is available
+	if hasIPI && int64(length)*8 <= d.Len() {
+		if pseudoHeader := ipPseudoHeader(ipi, int(length)); pseudoHeader != nil {
+			udpChecksum := &checksum.IPv4{}
+			_, _ = udpChecksum.Write(pseudoHeader)
+			d.Copy(udpChecksum, bitio.NewIOReader(d.BitBufRange(0, checksumStart)))
+			d.Copy(udpChecksum, bitio.NewIOReader(d.BitBufRange(checksumEnd, int64(length)*8-checksumEnd)))
+			sum := udpChecksum.Sum(nil)
+			// zero means no checksum so a calculated zero is sent as all ones
+			if sum[0] == 0 && sum[1] == 0 {
+				sum = []byte{0xff, 0xff}
+			}
+			validSums := [][]byte{sum}
+			// zero checksum is only allowed for ipv4
+			if !ipi.IPv6 {
+				validSums = append(validSums, []byte{0, 0})
+			}
+			_ = d.FieldMustGet("checksum").TryScalarFn(d.ValidateUBytes(validSums...), scalar.ActualHex)
+		}
+	}
 
 	return nil
 }
@@ -3,7 +3,9 @@ package macho
 // https://github.com/aidansteele/osx-abi-macho-file-format-reference
 
 import (
+	"bytes"
 	"embed"
+	"fmt"
 	"time"
 
 	"github.com/wader/fq/format"
@@ -16,13 +18,22 @@ import (
 //go:embed macho.jq
 var machoFS embed.FS
 
+var machoProbeGroup decode.Group
+
 func init() {
 	interp.RegisterFormat(decode.Format{
 		Name:        format.MACHO,
 		Description: "Mach-O macOS executable",
 		Groups:      []string{format.PROBE},
-		DecodeFn:    machoDecode,
-		Functions:   []string{"_help"},
+		Dependencies: []decode.Dependency{
+			{Names: []string{format.PROBE}, Group: &machoProbeGroup},
+		},
+		DecodeFn: machoDecode,
+		DecodeInArg: format.MachoIn{
+			ImageOffset: 0,
+			HeadersOnly: false,
+		},
+		Functions: []string{"torepr", "_help"},
 	})
 	interp.RegisterFS(machoFS)
 }
@@ -35,6 +46,8 @@ const (
 	MH_CIGAM_64 = 0xcffa_edfe
 	FAT_MAGIC   = 0xcafe_babe
 	FAT_CIGAM   = 0xbeba_feca
+
+	MH_PIE = 0x20_0000
 )
 
 var magicSymMapper = scalar.UToDescription{
@@ -51,6 +64,25 @@ var endianNames = scalar.UToSymStr{
 	MH_CIGAM_64: "big_endian",
 }
 
+//nolint:revive
+const (
+	CPU_TYPE_X86       = 0x7
+	CPU_TYPE_X86_64    = 0x1000007
+	CPU_TYPE_ARM       = 0xc
+	CPU_TYPE_ARM64     = 0x100000c
+	CPU_TYPE_POWERPC   = 0x12
+	CPU_TYPE_POWERPC64 = 0x1000012
+	CPU_SUBTYPE_ARM64E = 2
+)
+
+// sym is 2^actual, used for fields that are alignment or size exponents
+var powerOfTwoMapper = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	if n, ok := s.Actual.(uint64); ok && n < 64 {
+		s.Sym = uint64(1) << n
+	}
+	return s, nil
+})
+
 var cpuTypes = scalar.UToSymStr{
 	0xff_ff_ff_ff: "any",
 	1:             "vax",
@@ -72,7 +104,7 @@ var cpuTypes = scalar.UToSymStr{
 	18:            "powerpc",
 	0x1000007:     "x86_64",
 	0x100000c:     "arm64",
-	0x1000013:     "powerpc64",
+	0x1000012:     "powerpc64",
 	255:           "veo",
 }
 
@@ -197,7 +229,7 @@ var cpuSubTypes = map[uint64]scalar.UToSymStr{
 		11:            "powerpc_7450",
 		100:           "powerpc_970",
 	},
-	0x1000012: {
+	0x100000c: {
 		0xff_ff_ff_ff: "multiple",
 		0:             "arm64_all",
 		1:             "arm64_v8",
@@ -273,8 +305,15 @@ const (
 	LC_VERSION_MIN_WATCHOS      = 0x30
 	LC_NOTE                     = 0x31 // not implemented
 	LC_BUILD_VERSION            = 0x32
+	LC_DYLD_EXPORTS_TRIE        = 0x80000033
+	LC_DYLD_CHAINED_FIXUPS      = 0x80000034
 )
 
+var cryptIDNames = scalar.UToSymStr{
+	0: "not_encrypted",
+	1: "encrypted",
+}
+
 var loadCommands = scalar.UToSymStr{
 	LC_REQ_DYLD:                 "req_dyld",
 	LC_SEGMENT:                  "segment",
@@ -328,8 +367,18 @@ var loadCommands = scalar.UToSymStr{
 	LC_VERSION_MIN_WATCHOS:      "version_min_watchos",
 	LC_NOTE:                     "note",
 	LC_BUILD_VERSION:            "build_version",
+	LC_DYLD_EXPORTS_TRIE:        "dyld_exports_trie",
+	LC_DYLD_CHAINED_FIXUPS:      "dyld_chained_fixups",
 }
 
+//nolint:revive
+const (
+	S_CSTRING_LITERALS         = 0x2
+	S_NON_LAZY_SYMBOL_POINTERS = 0x6
+	S_MOD_INIT_FUNC_POINTERS   = 0x9
+	S_MOD_TERM_FUNC_POINTERS   = 0xa
+)
+
 var sectionTypes = scalar.UToSymStr{
 	0x0:  "regular",
 	0x1:  "zerofill",
@@ -355,15 +404,117 @@ var sectionTypes = scalar.UToSymStr{
 	0x15: "thread_local_init_function_pointers",
 }
 
-func machoDecode(d *decode.D, _ any) any {
-	ofileDecode(d)
+func machoDecode(d *decode.D, in any) any {
+	mi, _ := in.(format.MachoIn)
+
+	if mi.ImageOffset != 0 {
+		if mi.ImageOffset < 0 || mi.ImageOffset*8 >= d.Len() {
+			d.Fatalf("image_offset %d outside file size %d", mi.ImageOffset, d.Len()/8)
+		}
+		d.SeekAbs(mi.ImageOffset * 8)
+		// images in a dyld shared cache use file offsets relative to start of the cache
+		// and can refer to data in other cache files
+		s := ofileDecode(d, 0, true, mi.HeadersOnly)
+		d.FieldStruct("summary", func(d *decode.D) { fieldOfileSummary(d, s) })
+		return nil
+	}
+
+	// fat files adds summary for all files
+	if s := ofileDecode(d, d.Pos(), false, mi.HeadersOnly); s != nil {
+		d.FieldStruct("summary", func(d *decode.D) { fieldOfileSummary(d, s) })
+	}
 	return nil
 }
 
-func ofileDecode(d *decode.D) {
+type sectionRange struct {
+	name   string
+	offset uint64
+	size   uint64
+}
+
+// fileDataFn decodes data at offset relative to ofile start, if allowExternal is
+// set data outside of the input is marked as an external reference instead
+func fileDataFn(d *decode.D, ofileStart int64, offset uint64, size uint64, allowExternal bool, fn func(d *decode.D)) {
+	start := ofileStart + int64(offset)*8
+	if allowExternal && (start < 0 || start+int64(size)*8 > d.Len()) {
+		d.FieldValueU("external_offset", offset, scalar.ActualHex, scalar.Description("external reference"))
+		return
+	}
+	d.RangeFn(start, int64(size)*8, fn)
+}
+
+// fieldLoadCommandName reads a lc_str name at offset from start of load command, name is NUL
+// terminated and followed by padding to pointer alignment
+func fieldLoadCommandName(d *decode.D, cmdStart int64, cmdEnd int64, offset uint64) string {
+	nameStart := cmdStart + int64(offset)*8
+	if nameStart < d.Pos() || nameStart > cmdEnd {
+		d.Errorf("name offset %d outside load command", offset)
+	}
+	if nameStart > d.Pos() {
+		d.FieldRawLen("unused", nameStart-d.Pos())
+	}
+
+	nameLen := int((cmdEnd - nameStart) / 8)
+	nullIndex := bytes.IndexByte(d.PeekBytes(nameLen), 0)
+	if nullIndex == -1 {
+		return d.FieldUTF8NullFixedLen("name", nameLen)
+	}
+	name := d.FieldUTF8NullFixedLen("name", nullIndex+1)
+	if paddingLen := nameLen - (nullIndex + 1); paddingLen > 0 {
+		d.FieldRawLen("padding", int64(paddingLen)*8, d.BitBufIsZero())
+	}
+	return name
+}
+
+// fieldFixedName reads a NUL terminated name in a fixed size field, bytes after the NUL are
+// normally zero but hand-crafted binaries can hide data there
+func fieldFixedName(d *decode.D, name string, nBytes int) string {
+	bs := d.PeekBytes(nBytes)
+	nullIndex := bytes.IndexByte(bs, 0)
+	if nullIndex == -1 || len(bytes.Trim(bs[nullIndex+1:], "\x00")) == 0 {
+		return d.FieldUTF8NullFixedLen(name, nBytes)
+	}
+	s := d.FieldUTF8NullFixedLen(name, nullIndex+1)
+	d.FieldRawLen(name+"_extra", int64(nBytes-(nullIndex+1))*8, scalar.Description("non-zero bytes after NUL"))
+	return s
+}
+
+// loadCommandsSize measures load commands by following cmdsize, stops at first malformed command
+func loadCommandsSize(d *decode.D, start int64, ncmds uint64) uint64 {
+	pos := d.Pos()
+	defer d.SeekAbs(pos)
+	d.SeekAbs(start)
+
+	var size uint64
+	for i := uint64(0); i < ncmds && d.BitsLeft() >= 8*8; i++ {
+		d.SeekRel(4 * 8)
+		cmdsize := d.U32()
+		if cmdsize < 8 || int64(cmdsize-8)*8 > d.BitsLeft() {
+			break
+		}
+		d.SeekRel(int64(cmdsize-8) * 8)
+		size += cmdsize
+	}
+
+	return size
+}
+
+// ofileStart is what offsets in load commands are relative to, start of ofile for fat files.
+// If headersOnly is set only header and load commands are decoded, data at offsets is skipped.
+// Returns summary of ofile, nil for fat files.
+func ofileDecode(d *decode.D, ofileStart int64, allowExternal bool, headersOnly bool) *ofileSummary {
+	s := &ofileSummary{headersOnly: headersOnly}
+	dataFn := func(d *decode.D, offset uint64, size uint64, fn func(d *decode.D)) {
+		if headersOnly {
+			return
+		}
+		fileDataFn(d, ofileStart, offset, size, allowExternal, fn)
+	}
 	var archBits int
 	var cpuType uint64
+	var cpuSubType uint64
 	var ncmds uint64
+	var sizeofcmds uint64
 	magicBuffer := d.U32LE()
 
 	if magicBuffer == MH_MAGIC || magicBuffer == MH_MAGIC_64 {
@@ -382,38 +533,95 @@ func ofileDecode(d *decode.D) {
 		}
 	} else if magicBuffer == FAT_MAGIC {
 		d.Endian = decode.LittleEndian
-		fatParse(d)
-		return
+		fatParse(d, headersOnly)
+		return nil
 	} else if magicBuffer == FAT_CIGAM {
 		d.Endian = decode.BigEndian
-		fatParse(d)
-		return
+		fatParse(d, headersOnly)
+		return nil
 	} else {
 		// AR files are also valid OFiles but they should be parsed by `-d ar`
 		d.Fatalf("Invalid magic field")
 	}
 
 	d.SeekRel(-4 * 8)
+	headerStart := d.Pos()
+	headerSize := int64(28)
+	if archBits == 64 {
+		headerSize = 32
+	}
+	d.SeekRel(16 * 8)
+	cmdsSize := loadCommandsSize(d, headerStart+headerSize*8, d.U32())
+	d.SeekAbs(headerStart)
+
 	d.FieldStruct("header", func(d *decode.D) {
 		d.FieldValueS("arch_bits", int64(archBits))
 		magic := d.FieldU32("magic", magicSymMapper, scalar.ActualHex)
 		d.FieldValueU("bits", uint64(archBits))
 		d.FieldValueStr("endian", endianNames[magic])
 		cpuType = d.FieldU32("cputype", cpuTypes, scalar.ActualHex)
-		d.FieldU32("cpusubtype", cpuSubTypes[cpuType], scalar.ActualHex)
-		d.FieldU32("filetype", fileTypes)
-		ncmds = d.FieldU32("ncdms")
-		d.FieldU32("sizeofncdms")
+		s.cpuType = cpuType
+		cpuSubType = d.FieldU32("cpusubtype", cpuSubTypes[cpuType], scalar.ActualHex)
+		s.fileType = d.FieldU32("filetype", fileTypes)
+		ncmds = d.FieldU32("ncmds")
+		// less than load commands size means ncmds is too small or sizeofcmds too large
+		sizeofcmds = d.FieldU32("sizeofcmds", d.ValidateU(cmdsSize))
+		// TODO: misspelled names kept as aliases for one release, remove
+		d.FieldValueU("ncdms", ncmds, scalar.Description("deprecated alias for ncmds"))
+		d.FieldValueU("sizeofncdms", sizeofcmds, scalar.Description("deprecated alias for sizeofcmds"))
+		d.FieldValueU("load_commands_size", cmdsSize)
+		s.isPIE = d.U32()&MH_PIE != 0
+		d.SeekRel(-32)
 		d.FieldStruct("flags", parseMachHeaderFlags)
 		if archBits == 64 {
 			d.FieldRawLen("reserved", 4*8, d.BitBufIsZero())
 		}
 	})
+	// section index 0 is the mach header, sections are numbered from 1 in load command order
+	sectionNames := scalar.UToSymStr{0: "mach_header"}
+	// file ranges of segments and sections decoded so far, used to resolve offsets
+	var textFileoff uint64
+	var sectionRanges []sectionRange
+	var chainedSegments []chainedSegment
+	var linkeditSegment *sectionRange
+	var linkeditRegions []linkeditRegion
+	addLinkeditRegion := func(name string, offset uint64, size uint64) {
+		if size == 0 {
+			return
+		}
+		linkeditRegions = append(linkeditRegions, linkeditRegion{name: name, offset: offset, size: size})
+	}
+	dylibNames := dylibOrdinalNames(d, ncmds)
+	// total size of load commands so far
+	var cmdsUsed uint64
 	d.FieldArray("load_commands", func(d *decode.D) {
 		for i := uint64(0); i < ncmds; i++ {
+			if cmdsUsed >= sizeofcmds {
+				d.Errorf("load command %d starts past sizeofcmds %d, ncmds %d too large", i, sizeofcmds, ncmds)
+				break
+			}
+			// stop on malformed command to not seek backwards or loop for a huge ncmds
+			malformed := false
 			d.FieldStruct("load_command", func(d *decode.D) {
+				cmdStart := d.Pos()
 				cmd := d.FieldU32("cmd", loadCommands, scalar.ActualHex)
 				cmdsize := d.FieldU32("cmdsize")
+				cmdEnd := cmdStart + int64(cmdsize)*8
+				cmdsUsed += cmdsize
+				switch {
+				case cmdsize < 8:
+					d.Errorf("load command %d: cmdsize %d smaller than command header", i, cmdsize)
+					malformed = true
+				case cmdsUsed > sizeofcmds:
+					d.Errorf("load command %d: cmdsize %d makes load commands exceed sizeofcmds %d", i, cmdsize, sizeofcmds)
+					malformed = true
+				case cmdEnd > d.Len():
+					d.Errorf("load command %d: cmdsize %d outside file size %d", i, cmdsize, d.Len()/8)
+					malformed = true
+				}
+				if malformed {
+					return
+				}
 				switch cmd {
 				case LC_UUID:
 					d.FieldStruct("uuid_command", func(d *decode.D) {
@@ -422,20 +630,32 @@ func ofileDecode(d *decode.D) {
 				case LC_SEGMENT, LC_SEGMENT_64:
 					// nsect := (cmdsize - uint64(archBits)) / uint64(archBits)
 					var nsects uint64
-					d.FieldStruct("segment_command", func(d *decode.D) {
+					segmentCommand := d.FieldStruct("segment_command", func(d *decode.D) {
 						d.FieldValueS("arch_bits", int64(archBits))
-						d.FieldUTF8NullFixedLen("segname", 16) // OPCODE_DECODER segname==__TEXT
+						segname := fieldFixedName(d, "segname", 16) // OPCODE_DECODER segname==__TEXT
+						var fileoff uint64
+						var filesize uint64
 						if archBits == 32 {
 							d.FieldU32("vmaddr", scalar.ActualHex)
 							d.FieldU32("vmsize")
-							d.FieldU32("fileoff")
-							d.FieldU32("tfilesize")
+							fileoff = d.FieldU32("fileoff")
+							filesize = d.FieldU32("tfilesize")
 						} else {
 							d.FieldU64("vmaddr", scalar.ActualHex)
 							d.FieldU64("vmsize")
-							d.FieldU64("fileoff")
-							d.FieldU64("tfilesize")
+							fileoff = d.FieldU64("fileoff")
+							filesize = d.FieldU64("tfilesize")
+						}
+						switch segname {
+						case "__TEXT":
+							textFileoff = fileoff
+						case "__LINKEDIT":
+							linkeditSegment = &sectionRange{name: segname, offset: fileoff, size: filesize}
+						case "__RESTRICT":
+							// makes dyld ignore DYLD_* environment variables
+							s.hasRestrictSegment = true
 						}
+						chainedSegments = append(chainedSegments, chainedSegment{fileoff: fileoff})
 						d.FieldS32("initprot")
 						d.FieldS32("maxprot")
 						nsects = d.FieldU32("nsects")
@@ -445,8 +665,10 @@ func ofileDecode(d *decode.D) {
 						for i := uint64(0); i < nsects; i++ {
 							d.FieldStruct("section", func(d *decode.D) {
 								// OPCODE_DECODER sectname==__text
-								d.FieldUTF8NullFixedLen("sectname", 16)
-								d.FieldUTF8NullFixedLen("segname", 16)
+								sectname := fieldFixedName(d, "sectname", 16)
+								segname := fieldFixedName(d, "segname", 16)
+								d.FieldRefValue("segment", segmentCommand.Value)
+								sectionNames[uint64(len(sectionNames))] = segname + "," + sectname
 								var size uint64
 								if archBits == 32 {
 									d.FieldU32("address", scalar.ActualHex)
@@ -456,40 +678,53 @@ func ofileDecode(d *decode.D) {
 									size = d.FieldU64("size")
 								}
 								offset := d.FieldU32("offset")
+								sectionRanges = append(sectionRanges, sectionRange{name: segname + "," + sectname, offset: offset, size: size})
 								d.FieldU32("align")
 								d.FieldU32("reloff")
 								d.FieldU32("nreloc")
-								// get section type
-								d.FieldStruct("flags", parseSectionFlags)
-								d.FieldU8("type", sectionTypes)
+								// section type is the low byte of flags
+								var sectType uint64
+								if d.Endian == decode.LittleEndian {
+									sectType = d.FieldU8("type", sectionTypes)
+									d.FieldStruct("flags", parseSectionFlags)
+								} else {
+									d.FieldStruct("flags", parseSectionFlags)
+									sectType = d.FieldU8("type", sectionTypes)
+								}
 								d.FieldU32("reserved1")
 								d.FieldU32("reserved2")
 								if archBits == 64 {
 									d.FieldU32("reserved3")
 								}
-								d.RangeFn(int64(offset)*8, int64(size)*8, func(d *decode.D) {
-									d.FieldRawLen("data", d.BitsLeft())
+								dataFn(d, offset, size, func(d *decode.D) {
+									// upper bits of subtype are capability bits
+									isArm64e := cpuType == CPU_TYPE_ARM64 && cpuSubType&0x00ff_ffff == CPU_SUBTYPE_ARM64E
+									sectionDataDecode(d, segname, sectname, sectType, archBits, isArm64e)
 								})
 							})
 						}
 					})
 				case LC_TWOLEVEL_HINTS:
-					d.FieldU32("offset")
-					d.FieldU32("nhints")
+					offset := d.FieldU32("offset")
+					nhints := d.FieldU32("nhints")
+					addLinkeditRegion("twolevel_hints", offset, nhints*4)
 				case LC_LOAD_DYLIB, LC_ID_DYLIB, LC_LOAD_UPWARD_DYLIB, LC_LOAD_WEAK_DYLIB, LC_LAZY_LOAD_DYLIB, LC_REEXPORT_DYLIB:
+					if cmd != LC_ID_DYLIB {
+						s.dylibCount++
+					}
 					d.FieldStruct("dylib_command", func(d *decode.D) {
 						offset := d.FieldU32("offset")
 						d.FieldU32("timestamp", timestampMapper)
-						d.FieldU32("current_version")
-						d.FieldU32("compatibility_version")
+						d.FieldU32("current_version", dylibVersionMapper)
+						d.FieldU32("compatibility_version", dylibVersionMapper)
 						d.FieldUTF8NullFixedLen("name", int(cmdsize)-int(offset))
 					})
 				case LC_LOAD_DYLINKER, LC_ID_DYLINKER, LC_DYLD_ENVIRONMENT:
 					offset := d.FieldU32("offset")
-					d.FieldUTF8NullFixedLen("name", int(cmdsize)-int(offset))
+					fieldLoadCommandName(d, cmdStart, cmdEnd, offset)
 				case LC_RPATH:
 					offset := d.FieldU32("offset")
-					d.FieldUTF8NullFixedLen("name", int(cmdsize)-int(offset))
+					s.rpaths = append(s.rpaths, d.FieldUTF8NullFixedLen("name", int(cmdsize)-int(offset)))
 				case LC_PREBOUND_DYLIB:
 					// https://github.com/aidansteele/osx-abi-macho-file-format-reference#prebound_dylib_command
 					d.U32() // name_offset
@@ -500,24 +735,12 @@ func ofileDecode(d *decode.D) {
 						return d.RawLen(int64((nmodules / 8) + (nmodules % 8)))
 					})
 				case LC_THREAD, LC_UNIXTHREAD:
-					d.FieldU32("flavor")
-					count := d.FieldU32("count")
-					d.FieldStruct("state", func(d *decode.D) {
-						switch cpuType {
-						case 0x7:
-							threadStateI386Decode(d)
-						case 0xC:
-							threadStateARM32Decode(d)
-						case 0x13:
-							threadStatePPC32Decode(d)
-						case 0x1000007:
-							threadStateX8664Decode(d)
-						case 0x100000C:
-							threadStateARM64Decode(d)
-						case 0x1000013:
-							threadStatePPC64Decode(d)
-						default:
-							d.FieldRawLen("state", int64(count*32))
+					if headersOnly {
+						break
+					}
+					d.FieldArray("states", func(d *decode.D) {
+						for d.Pos() < cmdEnd {
+							d.FieldStruct("state", func(d *decode.D) { threadStateDecode(d, cpuType) })
 						}
 					})
 				case LC_ROUTINES, LC_ROUTINES_64:
@@ -544,10 +767,25 @@ func ofileDecode(d *decode.D) {
 					offset := d.FieldU32("offset")
 					d.FieldUTF8NullFixedLen("name", int(cmdsize)-int(offset))
 				case LC_SYMTAB:
-					d.FieldU32("symoff")
-					d.FieldU32("nsyms")
-					d.FieldU32("stroff")
-					d.FieldU32("strsize")
+					symoff := d.FieldU32("symoff")
+					nsyms := d.FieldU32("nsyms")
+					stroff := d.FieldU32("stroff")
+					strsize := d.FieldU32("strsize")
+					var strTab string
+					if strStart := ofileStart + int64(stroff)*8; !headersOnly && strStart+int64(strsize)*8 <= d.Len() {
+						strTab = string(d.BytesRange(strStart, int(strsize)))
+					}
+					nlistSize := uint64(12)
+					if archBits == 64 {
+						nlistSize = 16
+					}
+					addLinkeditRegion("symbols", symoff, nsyms*nlistSize)
+					addLinkeditRegion("string_table", stroff, strsize)
+					dataFn(d, symoff, nsyms*nlistSize, func(d *decode.D) {
+						d.FieldArray("symbols", func(d *decode.D) {
+							symtabDecode(d, archBits, nsyms, strTab, sectionNames, dylibNames)
+						})
+					})
 				case LC_DYSYMTAB:
 					d.FieldU32("ilocalsym")
 					d.FieldU32("nlocalsym")
@@ -555,23 +793,38 @@ func ofileDecode(d *decode.D) {
 					d.FieldU32("nextdefsym")
 					d.FieldU32("iundefsym")
 					d.FieldU32("nundefsym")
-					d.FieldU32("tocoff")
-					d.FieldU32("ntoc")
-					d.FieldU32("modtaboff")
-					d.FieldU32("nmodtab")
-					d.FieldU32("extrefsymoff")
-					d.FieldU32("nextrefsyms")
-					d.FieldU32("indirectsymoff")
-					d.FieldU32("nindirectsyms")
-
-					d.FieldU32("extreloff")
-					d.FieldU32("nextrel")
-					d.FieldU32("locreloff")
-					d.FieldU32("nlocrel")
+					tocoff := d.FieldU32("tocoff")
+					ntoc := d.FieldU32("ntoc")
+					modtaboff := d.FieldU32("modtaboff")
+					nmodtab := d.FieldU32("nmodtab")
+					extrefsymoff := d.FieldU32("extrefsymoff")
+					nextrefsyms := d.FieldU32("nextrefsyms")
+					indirectsymoff := d.FieldU32("indirectsymoff")
+					nindirectsyms := d.FieldU32("nindirectsyms")
+
+					extreloff := d.FieldU32("extreloff")
+					nextrel := d.FieldU32("nextrel")
+					locreloff := d.FieldU32("locreloff")
+					nlocrel := d.FieldU32("nlocrel")
+
+					// dylib_module is 52 or 56 bytes, toc entries and relocations 8 bytes
+					moduleSize := uint64(52)
+					if archBits == 64 {
+						moduleSize = 56
+					}
+					addLinkeditRegion("toc", tocoff, ntoc*8)
+					addLinkeditRegion("modtab", modtaboff, nmodtab*moduleSize)
+					addLinkeditRegion("extrefsyms", extrefsymoff, nextrefsyms*4)
+					addLinkeditRegion("indirect_symbols", indirectsymoff, nindirectsyms*4)
+					addLinkeditRegion("extrel", extreloff, nextrel*8)
+					addLinkeditRegion("locrel", locreloff, nlocrel*8)
 				case LC_BUILD_VERSION:
-					d.FieldU32("platform")
-					d.FieldU32("minos")
-					d.FieldU32("sdk")
+					platform := d.FieldU32("platform", buildPlatforms)
+					s.minOS = d.FieldU32("minos")
+					s.sdk = d.FieldU32("sdk")
+					s.hasVersion = true
+					s.hasBuildVersion = true
+					s.addDeployment(platform, s.minOS, s.sdk, loadCommands[cmd], true)
 					ntools := d.FieldU32("ntools")
 					var ntoolsIdx uint64
 					d.FieldStructArrayLoop("tools", "tool", func() bool {
@@ -581,30 +834,75 @@ func ofileDecode(d *decode.D) {
 						d.FieldU32("version")
 						ntoolsIdx++
 					})
-				case LC_CODE_SIGNATURE, LC_SEGMENT_SPLIT_INFO, LC_FUNCTION_STARTS, LC_DATA_IN_CODE, LC_DYLIB_CODE_SIGN_DRS, LC_LINKER_OPTIMIZATION_HINT:
+				case LC_CODE_SIGNATURE:
+					s.hasCodeSignature = true
 					d.FieldStruct("linkedit_data", func(d *decode.D) {
-						d.FieldU32("off")
-						d.FieldU32("size")
+						off := d.FieldU32("off")
+						size := d.FieldU32("size")
+						addLinkeditRegion(loadCommands[cmd], off, size)
+						if start := ofileStart + int64(off)*8; !headersOnly && start >= 0 && start+int64(size)*8 <= d.Len() {
+							s.isSigned = codeSignatureHasCMS(d.BytesRange(start, int(size)))
+						}
+						dataFn(d, off, size, func(d *decode.D) {
+							d.FieldStruct("code_signature", codeSignatureDecode)
+						})
+					})
+				case LC_SEGMENT_SPLIT_INFO:
+					d.FieldStruct("linkedit_data", func(d *decode.D) {
+						off := d.FieldU32("off")
+						size := d.FieldU32("size")
+						addLinkeditRegion(loadCommands[cmd], off, size)
+						dataFn(d, off, size, func(d *decode.D) {
+							d.FieldStruct("segment_split_info", func(d *decode.D) { segmentSplitInfoDecode(d, sectionNames) })
+						})
+					})
+				case LC_DYLD_CHAINED_FIXUPS:
+					d.FieldStruct("linkedit_data", func(d *decode.D) {
+						off := d.FieldU32("off")
+						size := d.FieldU32("size")
+						addLinkeditRegion(loadCommands[cmd], off, size)
+						dataFn(d, off, size, func(d *decode.D) {
+							d.FieldStruct("chained_fixups", func(d *decode.D) {
+								chainedFixupsDecode(d, ofileStart, chainedSegments, dylibNames)
+							})
+						})
+					})
+				case LC_FUNCTION_STARTS, LC_DATA_IN_CODE, LC_DYLIB_CODE_SIGN_DRS, LC_LINKER_OPTIMIZATION_HINT, LC_DYLD_EXPORTS_TRIE:
+					d.FieldStruct("linkedit_data", func(d *decode.D) {
+						off := d.FieldU32("off")
+						size := d.FieldU32("size")
+						addLinkeditRegion(loadCommands[cmd], off, size)
 					})
 				case LC_VERSION_MIN_IPHONEOS, LC_VERSION_MIN_MACOSX, LC_VERSION_MIN_TVOS, LC_VERSION_MIN_WATCHOS:
-					d.FieldU32("version")
-					d.FieldU32("sdk")
+					version := d.FieldU32("version")
+					sdk := d.FieldU32("sdk")
+					s.addDeployment(versionMinPlatforms[cmd], version, sdk, loadCommands[cmd], false)
+					// build version is preferred if both are present
+					if !s.hasBuildVersion {
+						s.minOS = version
+						s.sdk = sdk
+						s.hasVersion = true
+					}
 				case LC_DYLD_INFO, LC_DYLD_INFO_ONLY:
 					d.FieldStruct("dyld_info", func(d *decode.D) {
-						d.FieldU32("rebase_off")
-						d.FieldU32("rebase_size")
-						d.FieldU32("bind_off")
-						d.FieldU32("bind_size")
-						d.FieldU32("weak_bind_off")
-						d.FieldU32("weak_bind_size")
-						d.FieldU32("lazy_bind_off")
-						d.FieldU32("lazy_bind_size")
-						d.FieldU32("export_off")
-						d.FieldU32("export_size")
+						for _, name := range []string{"rebase", "bind", "weak_bind", "lazy_bind", "export"} {
+							off := d.FieldU32(name + "_off")
+							size := d.FieldU32(name + "_size")
+							addLinkeditRegion(name, off, size)
+						}
 					})
 				case LC_MAIN:
 					d.FieldStruct("entrypoint", func(d *decode.D) {
-						d.FieldU64("entryoff")
+						// offset from start of __TEXT which in practice is a file offset
+						entryoff := d.FieldU64("entryoff")
+						entryFileoff := textFileoff + entryoff
+						d.FieldValueU("file_offset", uint64(ofileStart/8)+entryFileoff, scalar.ActualHex)
+						for _, sr := range sectionRanges {
+							if entryFileoff >= sr.offset && entryFileoff < sr.offset+sr.size {
+								d.FieldValueStr("section", sr.name)
+								break
+							}
+						}
 						d.FieldU64("stacksize")
 					})
 				case LC_SOURCE_VERSION:
@@ -620,8 +918,13 @@ func ofileDecode(d *decode.D) {
 					d.FieldStruct("encryption_info", func(d *decode.D) {
 						offset := d.FieldU32("offset")
 						size := d.FieldU32("size")
-						d.FieldU32("id")
-						d.RangeFn(int64(offset)*8, int64(size)*8, func(d *decode.D) {
+						if d.FieldU32("cryptid", cryptIDNames) != 0 {
+							s.isEncrypted = true
+						}
+						if cmd == LC_ENCRYPTION_INFO_64 {
+							d.FieldU32("pad")
+						}
+						dataFn(d, offset, size, func(d *decode.D) {
 							d.FieldRawLen("data", d.BitsLeft())
 						})
 					})
@@ -630,20 +933,140 @@ func ofileDecode(d *decode.D) {
 						offset := d.FieldU32("offset")
 						d.FieldU32("minor_version")
 						d.FieldU32("header_addr", scalar.ActualHex)
-						d.FieldUTF8NullFixedLen("name", int(cmdsize)-int(offset))
+						fieldLoadCommandName(d, cmdStart, cmdEnd, offset)
 					})
-				default:
-					if _, ok := loadCommands[cmd]; !ok {
-						d.SeekRel(int64((cmdsize - 8) * 8))
-						// Seek Rel so the parts are marked unknown
-					}
+				}
+
+				// unhandled commands and padding, make sure next command starts at cmdsize
+				if d.Pos() < cmdEnd {
+					d.FieldRawLen("data", cmdEnd-d.Pos())
+				} else if d.Pos() > cmdEnd {
+					d.Errorf("load command decoded %d bytes past cmdsize %d", (d.Pos()-cmdEnd)/8, cmdsize)
+					d.SeekAbs(cmdEnd)
 				}
 			})
+			if malformed {
+				break
+			}
 		}
 	})
+
+	// packed or malformed binaries can have load commands overlapping section data
+	cmdsEnd := uint64(d.Pos()-ofileStart) / 8
+	var firstSection *sectionRange
+	for i, sr := range sectionRanges {
+		if sr.offset == 0 || sr.size == 0 {
+			continue
+		}
+		if firstSection == nil || sr.offset < firstSection.offset {
+			firstSection = &sectionRanges[i]
+		}
+	}
+	if firstSection != nil && cmdsEnd > firstSection.offset {
+		d.FieldValueBool("load_commands_overlap", true, scalar.Description(fmt.Sprintf("load commands end at %d past %s offset %d", cmdsEnd, firstSection.name, firstSection.offset)))
+	}
+
+	if linkeditSegment != nil {
+		fieldLinkeditAccounting(d, *linkeditSegment, linkeditRegions)
+	}
+
+	fieldDeployment(d, s)
+
+	return s
 }
 
-func fatParse(d *decode.D) {
+func sectionDataDecode(d *decode.D, segname string, sectname string, sectType uint64, archBits int, isArm64e bool) {
+	switch {
+	case sectname == "__objc_classlist",
+		sectname == "__objc_nlclslist",
+		sectname == "__objc_catlist",
+		sectname == "__objc_protolist",
+		sectname == "__objc_classrefs",
+		sectname == "__objc_superrefs",
+		sectname == "__objc_selrefs",
+		sectname == "__auth_ptr",
+		sectType == S_NON_LAZY_SYMBOL_POINTERS,
+		sectType == S_MOD_INIT_FUNC_POINTERS,
+		sectType == S_MOD_TERM_FUNC_POINTERS:
+		pointersDecode(d, archBits, isArm64e)
+	case sectname == "__objc_methname",
+		sectname == "__objc_classname",
+		sectname == "__objc_methtype":
+		cstringsDecode(d)
+	case sectType == S_CSTRING_LITERALS:
+		cstringsDecode(d)
+	case segname == "__TEXT" && sectname == "__unwind_info":
+		d.FieldStruct("unwind_info", unwindInfoDecode)
+	case segname == "__LLVM" && sectname == "__bundle":
+		// -fembed-bitcode xar archive with bitcode files
+		d.FieldFormatOrRawLen("bundle", d.BitsLeft(), machoProbeGroup, nil)
+	case sectname == "__eh_frame":
+		d.FieldArray("eh_frame", func(d *decode.D) { ehFrameDecode(d, archBits) })
+	default:
+		d.FieldRawLen("data", d.BitsLeft())
+	}
+}
+
+func pointersDecode(d *decode.D, archBits int, isArm64e bool) {
+	ptrBits := int64(64)
+	if archBits == 32 {
+		ptrBits = 32
+	}
+	d.FieldArray("pointers", func(d *decode.D) {
+		for d.BitsLeft() >= ptrBits {
+			switch {
+			case archBits == 32:
+				d.FieldU32("pointer", scalar.ActualHex)
+			case isArm64e:
+				d.FieldStruct("pointer", func(d *decode.D) { arm64ePointerDecode(d, 16) })
+			default:
+				d.FieldU64("pointer", scalar.ActualHex)
+			}
+		}
+	})
+	// section size is not a multiple of pointer size
+	if d.BitsLeft() > 0 {
+		d.FieldRawLen("remainder", d.BitsLeft())
+	}
+}
+
+// cstringsDecode decodes a sequence of NUL terminated strings, trailing zero bytes are treated as padding
+func cstringsDecode(d *decode.D) {
+	sectionStart := d.Pos()
+	sectionStop := sectionStart + d.BitsLeft()
+	bs := d.BytesRange(sectionStart, int(d.BitsLeft()/8))
+	stringsLen := 0
+	for i := len(bs) - 1; i >= 0; i-- {
+		if bs[i] != 0 {
+			// include the terminating NUL if there is one
+			stringsLen = i + 1
+			if stringsLen < len(bs) {
+				stringsLen++
+			}
+			break
+		}
+	}
+
+	d.FieldArray("strings", func(d *decode.D) {
+		for {
+			i := int((d.Pos() - sectionStart) / 8)
+			if i >= stringsLen {
+				break
+			}
+			n := bytes.IndexByte(bs[i:stringsLen], 0)
+			if n == -1 {
+				d.FieldUTF8("string", stringsLen-i)
+				break
+			}
+			d.FieldUTF8NullFixedLen("string", n+1)
+		}
+	})
+	if d.Pos() < sectionStop {
+		d.FieldRawLen("padding", sectionStop-d.Pos(), d.BitBufIsZero())
+	}
+}
+
+func fatParse(d *decode.D, headersOnly bool) {
 	// Go to start of the file again
 	d.SeekAbs(0)
 	var narchs uint64
@@ -660,56 +1083,86 @@ func fatParse(d *decode.D) {
 			// beware cputype and cpusubtype changes from ofile header to fat header
 			cpuType := d.FieldU32("cputype", cpuTypes, scalar.ActualHex)
 			d.FieldU32("cpusubtype", cpuSubTypes[cpuType], scalar.ActualHex)
-			ofileOffsets = append(ofileOffsets, d.FieldU32("offset"))
-			d.FieldU32("size")
-			d.FieldU32("align")
+			offset := d.FieldU32("offset")
+			size := d.FieldU32("size")
+			align := d.FieldU32("align", powerOfTwoMapper)
+			if align < 64 && offset%(1<<align) != 0 {
+				d.Errorf("fat_arch %d: offset %d not aligned to %d bytes", narchsIdx, offset, uint64(1)<<align)
+			}
+			if fileLen := uint64(d.Len() / 8); offset+size > fileLen {
+				d.Errorf("fat_arch %d: offset %d size %d outside file size %d", narchsIdx, offset, size, fileLen)
+			}
+			ofileOffsets = append(ofileOffsets, offset)
 			narchsIdx++
 		})
 	})
 	nfilesIdx := 0
+	var summaries []*ofileSummary
 	d.FieldStructArrayLoop("files", "file", func() bool {
 		return nfilesIdx < int(narchs)
 	}, func(d *decode.D) {
 		d.SeekAbs(int64(ofileOffsets[nfilesIdx]) * 8)
-		ofileDecode(d)
+		// nested fat files are not valid, would also recurse forever if pointing to itself
+		if magic := d.PeekBits(32); magic == FAT_MAGIC || magic == FAT_CIGAM {
+			d.Fatalf("fat_arch %d: nested fat file at offset %d", nfilesIdx, ofileOffsets[nfilesIdx])
+		}
+		if s := ofileDecode(d, d.Pos(), false, headersOnly); s != nil {
+			summaries = append(summaries, s)
+		}
 		nfilesIdx++
 	})
+	d.FieldStruct("summary", func(d *decode.D) { fieldFatSummary(d, summaries) })
 }
 
-func parseMachHeaderFlags(d *decode.D) {
-	d.FieldRawLen("reserved", 6)
-	d.FieldBool("app_extension_safe")
-	d.FieldBool("no_heap_execution")
-
-	d.FieldBool("has_tlv_descriptors")
-	d.FieldBool("dead_strippable_dylib")
-	d.FieldBool("pie")
-	d.FieldBool("no_reexported_dylibs")
-
-	d.FieldBool("setuid_safe")
-	d.FieldBool("root_safe")
-	d.FieldBool("allow_stack_execution")
-	d.FieldBool("binds_to_weak")
-
-	d.FieldBool("weak_defines")
-	d.FieldBool("canonical")
-	d.FieldBool("subsections_via_symbols")
-	d.FieldBool("allmodsbound")
-
-	d.FieldBool("prebindable")
-	d.FieldBool("nofixprebinding")
-	d.FieldBool("nomultidefs")
-	d.FieldBool("force_flat")
+// mach header flag names by bit number, bits from machHeaderFlagsReservedBit and up are reserved
+var machHeaderFlagNames = [...]string{
+	"noundefs",
+	"incrlink",
+	"dyldlink",
+	"bindatload",
+	"prebound",
+	"split_segs",
+	"lazy_init",
+	"twolevel",
+	"force_flat",
+	"nomultidefs",
+	"nofixprebinding",
+	"prebindable",
+	"allmodsbound",
+	"subsections_via_symbols",
+	"canonical",
+	"weak_defines",
+	"binds_to_weak",
+	"allow_stack_execution",
+	"root_safe",
+	"setuid_safe",
+	"no_reexported_dylibs",
+	"pie",
+	"dead_strippable_dylib",
+	"has_tlv_descriptors",
+	"no_heap_execution",
+	"app_extension_safe",
+}
 
-	d.FieldBool("twolevel")
-	d.FieldBool("lazy_init")
-	d.FieldBool("split_segs")
-	d.FieldBool("prebound")
+const machHeaderFlagsReservedBit = len(machHeaderFlagNames)
 
-	d.FieldBool("bindatload")
-	d.FieldBool("dyldlink")
-	d.FieldBool("incrlink")
-	d.FieldBool("noundefs")
+func parseMachHeaderFlags(d *decode.D) {
+	// bits are read msb first in each byte, little endian has the bytes in reverse order
+	byteOrder := []int{3, 2, 1, 0}
+	if d.Endian == decode.LittleEndian {
+		byteOrder = []int{0, 1, 2, 3}
+	}
+	for _, byteIdx := range byteOrder {
+		for bit := byteIdx*8 + 7; bit >= byteIdx*8; bit-- {
+			if bit >= machHeaderFlagsReservedBit {
+				if bit == 31 {
+					d.FieldRawLen("reserved", int64(32-machHeaderFlagsReservedBit))
+				}
+				continue
+			}
+			d.FieldBool(machHeaderFlagNames[bit])
+		}
+	}
 }
 
 func parseSegmentFlags(d *decode.D) {
@@ -721,6 +1174,26 @@ func parseSegmentFlags(d *decode.D) {
 }
 
 func parseSectionFlags(d *decode.D) {
+	// 24 bit attributes, little endian has the attribute bytes in reverse order
+	if d.Endian == decode.LittleEndian {
+		d.FieldRawLen("reserved", 5)
+		d.FieldBool("attr_some_instructions")
+		d.FieldBool("attr_ext_reloc")
+		d.FieldBool("attr_loc_reloc")
+
+		d.FieldRawLen("reserved1", 8)
+
+		d.FieldBool("attr_pure_instructions")
+		d.FieldBool("attr_no_toc")
+		d.FieldBool("attr_strip_static_syms")
+		d.FieldBool("attr_no_dead_strip")
+		d.FieldBool("attr_live_support")
+		d.FieldBool("attr_self_modifying_code")
+		d.FieldBool("attr_debug")
+		d.FieldRawLen("reserved2", 1)
+		return
+	}
+
 	d.FieldBool("attr_pure_instructions")
 	d.FieldBool("attr_no_toc")
 	d.FieldBool("attr_strip_static_syms")
@@ -745,6 +1218,194 @@ var timestampMapper = scalar.Fn(func(s scalar.S) (scalar.S, error) {
 	return s, nil
 })
 
+// dylib version is xxxx.yy.zz packed as 16.8.8 bits
+// https://opensource.apple.com/source/xnu/xnu-7195.81.3/EXTERNAL_HEADERS/mach-o/loader.h
+//
+//nolint:revive
+const (
+	PLATFORM_MACOS   = 1
+	PLATFORM_IOS     = 2
+	PLATFORM_TVOS    = 3
+	PLATFORM_WATCHOS = 4
+)
+
+var buildPlatforms = scalar.UToSymStr{
+	PLATFORM_MACOS:   "macos",
+	PLATFORM_IOS:     "ios",
+	PLATFORM_TVOS:    "tvos",
+	PLATFORM_WATCHOS: "watchos",
+	5:                "bridgeos",
+	6:                "maccatalyst",
+	7:                "iossimulator",
+	8:                "tvossimulator",
+	9:                "watchossimulator",
+	10:               "driverkit",
+	11:               "visionos",
+	12:               "visionossimulator",
+}
+
+// platform of version min commands
+var versionMinPlatforms = map[uint64]uint64{
+	LC_VERSION_MIN_MACOSX:   PLATFORM_MACOS,
+	LC_VERSION_MIN_IPHONEOS: PLATFORM_IOS,
+	LC_VERSION_MIN_TVOS:     PLATFORM_TVOS,
+	LC_VERSION_MIN_WATCHOS:  PLATFORM_WATCHOS,
+}
+
+var dylibVersionMapper = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	v, ok := s.Actual.(uint64)
+	if !ok {
+		return s, nil
+	}
+	s.Sym = fmt.Sprintf("%d.%d.%d", v>>16, (v>>8)&0xff, v&0xff)
+	return s, nil
+})
+
+// https://opensource.apple.com/source/xnu/xnu-7195.81.3/osfmk/mach/i386/thread_status.h
+//
+//nolint:revive
+const (
+	x86_THREAD_STATE32      = 1
+	x86_THREAD_STATE64      = 4
+	x86_THREAD_STATE        = 7
+	x86_THREAD_FULL_STATE64 = 23
+)
+
+var x86ThreadStateFlavors = scalar.UToSymStr{
+	1:  "x86_thread_state32",
+	2:  "x86_float_state32",
+	3:  "x86_exception_state32",
+	4:  "x86_thread_state64",
+	5:  "x86_float_state64",
+	6:  "x86_exception_state64",
+	7:  "x86_thread_state",
+	8:  "x86_float_state",
+	9:  "x86_exception_state",
+	10: "x86_debug_state32",
+	11: "x86_debug_state64",
+	12: "x86_debug_state",
+	13: "thread_state_none",
+	16: "x86_avx_state32",
+	17: "x86_avx_state64",
+	18: "x86_avx_state",
+	19: "x86_avx512_state32",
+	20: "x86_avx512_state64",
+	21: "x86_avx512_state",
+	22: "x86_pagein_state",
+	23: "x86_thread_full_state64",
+}
+
+// https://opensource.apple.com/source/xnu/xnu-7195.81.3/osfmk/mach/arm/thread_status.h
+//
+//nolint:revive
+const (
+	ARM_THREAD_STATE   = 1
+	ARM_THREAD_STATE64 = 6
+	ARM_THREAD_STATE32 = 9
+)
+
+var armThreadStateFlavors = scalar.UToSymStr{
+	1:  "arm_thread_state",
+	2:  "arm_vfp_state",
+	3:  "arm_exception_state",
+	4:  "arm_debug_state",
+	5:  "thread_state_none",
+	6:  "arm_thread_state64",
+	7:  "arm_exception_state64",
+	9:  "arm_thread_state32",
+	14: "arm_debug_state32",
+	15: "arm_debug_state64",
+	16: "arm_neon_state",
+	17: "arm_neon_state64",
+	18: "arm_cpmu_state64",
+	27: "arm_pagein_state",
+}
+
+// https://opensource.apple.com/source/xnu/xnu-1456.1.26/osfmk/mach/ppc/thread_status.h
+//
+//nolint:revive
+const (
+	PPC_THREAD_STATE   = 1
+	PPC_THREAD_STATE64 = 5
+)
+
+var ppcThreadStateFlavors = scalar.UToSymStr{
+	1: "ppc_thread_state",
+	2: "ppc_float_state",
+	3: "ppc_exception_state",
+	4: "ppc_vector_state",
+	5: "ppc_thread_state64",
+	6: "ppc_exception_state64",
+}
+
+// decodes one flavor, count and state tuple, only general purpose register
+// flavors are decoded, other flavors are left as raw state
+func threadStateDecode(d *decode.D, cpuType uint64) {
+	var flavorNames scalar.UToSymStr
+	switch cpuType {
+	case CPU_TYPE_X86, CPU_TYPE_X86_64:
+		flavorNames = x86ThreadStateFlavors
+	case CPU_TYPE_ARM, CPU_TYPE_ARM64:
+		flavorNames = armThreadStateFlavors
+	case CPU_TYPE_POWERPC, CPU_TYPE_POWERPC64:
+		flavorNames = ppcThreadStateFlavors
+	}
+
+	var flavor uint64
+	if flavorNames != nil {
+		flavor = d.FieldU32("flavor", flavorNames)
+	} else {
+		flavor = d.FieldU32("flavor")
+	}
+	count := d.FieldU32("count")
+
+	d.FramedFn(int64(count)*32, func(d *decode.D) {
+		var fn func(d *decode.D)
+		switch cpuType {
+		case CPU_TYPE_X86, CPU_TYPE_X86_64:
+			switch flavor {
+			case x86_THREAD_STATE32:
+				fn = threadStateI386Decode
+			case x86_THREAD_STATE64, x86_THREAD_FULL_STATE64:
+				fn = threadStateX8664Decode
+			case x86_THREAD_STATE:
+				// x86_thread_state_t, header followed by 32 or 64 bit state
+				fn = func(d *decode.D) { threadStateDecode(d, cpuType) }
+			}
+		case CPU_TYPE_ARM, CPU_TYPE_ARM64:
+			switch flavor {
+			case ARM_THREAD_STATE:
+				if cpuType == CPU_TYPE_ARM64 {
+					// arm_unified_thread_state_t, header followed by 32 or 64 bit state
+					fn = func(d *decode.D) { threadStateDecode(d, cpuType) }
+				} else {
+					fn = threadStateARM32Decode
+				}
+			case ARM_THREAD_STATE32:
+				fn = threadStateARM32Decode
+			case ARM_THREAD_STATE64:
+				fn = threadStateARM64Decode
+			}
+		case CPU_TYPE_POWERPC, CPU_TYPE_POWERPC64:
+			switch flavor {
+			case PPC_THREAD_STATE:
+				fn = threadStatePPC32Decode
+			case PPC_THREAD_STATE64:
+				fn = threadStatePPC64Decode
+			}
+		}
+
+		if fn == nil {
+			d.FieldRawLen("state", d.BitsLeft())
+			return
+		}
+		d.FieldStruct("state", fn)
+		if d.BitsLeft() > 0 {
+			d.FieldRawLen("unused", d.BitsLeft())
+		}
+	})
+}
+
 func threadStateI386Decode(d *decode.D) {
 	d.FieldU32("eax")
 	d.FieldU32("ebx")
@@ -0,0 +1,258 @@
+package macho
+
+// https://github.com/apple-oss-distributions/dyld/blob/main/include/mach-o/fixup-chains.h
+
+import (
+	"strings"
+
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//nolint:revive
+const (
+	DYLD_CHAINED_PTR_ARM64E            = 1
+	DYLD_CHAINED_PTR_64                = 2
+	DYLD_CHAINED_PTR_32                = 3
+	DYLD_CHAINED_PTR_32_CACHE          = 4
+	DYLD_CHAINED_PTR_32_FIRMWARE       = 5
+	DYLD_CHAINED_PTR_64_OFFSET         = 6
+	DYLD_CHAINED_PTR_ARM64E_KERNEL     = 7
+	DYLD_CHAINED_PTR_64_KERNEL_CACHE   = 8
+	DYLD_CHAINED_PTR_ARM64E_USERLAND   = 9
+	DYLD_CHAINED_PTR_ARM64E_FIRMWARE   = 10
+	DYLD_CHAINED_PTR_X86_64_KERNEL     = 11
+	DYLD_CHAINED_PTR_ARM64E_USERLAND24 = 12
+)
+
+var chainedPointerFormatNames = scalar.UToSymStr{
+	DYLD_CHAINED_PTR_ARM64E:            "arm64e",
+	DYLD_CHAINED_PTR_64:                "64",
+	DYLD_CHAINED_PTR_32:                "32",
+	DYLD_CHAINED_PTR_32_CACHE:          "32_cache",
+	DYLD_CHAINED_PTR_32_FIRMWARE:       "32_firmware",
+	DYLD_CHAINED_PTR_64_OFFSET:         "64_offset",
+	DYLD_CHAINED_PTR_ARM64E_KERNEL:     "arm64e_kernel",
+	DYLD_CHAINED_PTR_64_KERNEL_CACHE:   "64_kernel_cache",
+	DYLD_CHAINED_PTR_ARM64E_USERLAND:   "arm64e_userland",
+	DYLD_CHAINED_PTR_ARM64E_FIRMWARE:   "arm64e_firmware",
+	DYLD_CHAINED_PTR_X86_64_KERNEL:     "x86_64_kernel",
+	DYLD_CHAINED_PTR_ARM64E_USERLAND24: "arm64e_userland24",
+}
+
+//nolint:revive
+const (
+	DYLD_CHAINED_IMPORT          = 1
+	DYLD_CHAINED_IMPORT_ADDEND   = 2
+	DYLD_CHAINED_IMPORT_ADDEND64 = 3
+)
+
+var chainedImportFormatNames = scalar.UToSymStr{
+	DYLD_CHAINED_IMPORT:          "import",
+	DYLD_CHAINED_IMPORT_ADDEND:   "import_addend",
+	DYLD_CHAINED_IMPORT_ADDEND64: "import_addend64",
+}
+
+var chainedSymbolsFormatNames = scalar.UToSymStr{
+	0: "uncompressed",
+	1: "zlib",
+}
+
+// DYLD_CHAINED_PTR_START_NONE
+const chainedPageStartNone = 0xffff
+
+var ptrauthKeyNames = scalar.UToScalar{
+	0: {Sym: "ia", Description: "Instruction key A"},
+	1: {Sym: "ib", Description: "Instruction key B"},
+	2: {Sym: "da", Description: "Data key A"},
+	3: {Sym: "db", Description: "Data key B"},
+}
+
+// arm64e pointers are chained fixups with target in the low bits and metadata in the high bits,
+// auth pointers are signed with key, diversity and optionally address diversity when bound at load time.
+// Returns offset to next pointer in chain in 8 byte strides, zero for end of chain.
+func arm64ePointerDecode(d *decode.D, ordinalBits int) uint64 {
+	v := d.FieldU64("value", scalar.ActualHex)
+	isAuth := v&(1<<63) != 0
+	isBind := v&(1<<62) != 0
+	d.FieldValueBool("auth", isAuth)
+	d.FieldValueBool("bind", isBind)
+	switch {
+	case isBind:
+		d.FieldValueU("ordinal", v&(1<<ordinalBits-1))
+	case isAuth:
+		// 32 bit offset from image base
+		d.FieldValueU("target", v&0xffff_ffff, scalar.ActualHex)
+	default:
+		// 43 bit target and high 8 bits of address
+		d.FieldValueU("target", v&0x7ff_ffff_ffff|(v>>43&0xff)<<56, scalar.ActualHex)
+	}
+	if isAuth {
+		d.FieldValueU("diversity", v>>32&0xffff, scalar.ActualHex)
+		d.FieldValueBool("addr_div", v>>48&1 != 0)
+		d.FieldValueU("key", v>>49&0b11, ptrauthKeyNames)
+	} else if isBind {
+		// 19 bit signed addend
+		addend := int64(v>>32&0x7_ffff) << 45 >> 45
+		d.FieldValueS("addend", addend)
+	}
+	next := v >> 51 & 0x7ff
+	d.FieldValueU("next", next)
+
+	return next
+}
+
+func isArm64ePointerFormat(pointerFormat uint64) bool {
+	switch pointerFormat {
+	case DYLD_CHAINED_PTR_ARM64E,
+		DYLD_CHAINED_PTR_ARM64E_USERLAND,
+		DYLD_CHAINED_PTR_ARM64E_USERLAND24:
+		return true
+	}
+	return false
+}
+
+type chainedSegment struct {
+	fileoff uint64
+}
+
+// chainedFixupsDecode decodes dyld_chained_fixups_header and chains of fixups. Chains are only
+// followed for arm64e pointer formats, the chain pointers are decoded at their file offset.
+func chainedFixupsDecode(d *decode.D, ofileStart int64, segments []chainedSegment, dylibNames scalar.UToSymStr) {
+	headerStart := d.Pos()
+
+	d.FieldU32("fixups_version")
+	startsOffset := d.FieldU32("starts_offset")
+	importsOffset := d.FieldU32("imports_offset")
+	symbolsOffset := d.FieldU32("symbols_offset")
+	importsCount := d.FieldU32("imports_count")
+	importsFormat := d.FieldU32("imports_format", chainedImportFormatNames)
+	symbolsFormat := d.FieldU32("symbols_format", chainedSymbolsFormatNames)
+
+	symbolName := func(nameOffset uint64) string {
+		if symbolsFormat != 0 {
+			return ""
+		}
+		pos := headerStart + int64(symbolsOffset+nameOffset)*8
+		if pos < 0 || pos >= d.Len() {
+			return ""
+		}
+		b := d.BytesRange(pos, int((d.Len()-pos)/8))
+		if i := strings.IndexByte(string(b), 0); i != -1 {
+			b = b[:i]
+		}
+		return string(b)
+	}
+
+	ordinalBits := 16
+	d.SeekAbs(headerStart + int64(startsOffset)*8)
+	d.FieldStruct("starts_in_image", func(d *decode.D) {
+		startsStart := d.Pos()
+		segCount := d.FieldU32("seg_count")
+		var segInfoOffsets []uint64
+		d.FieldArray("seg_info_offsets", func(d *decode.D) {
+			for i := uint64(0); i < segCount; i++ {
+				segInfoOffsets = append(segInfoOffsets, d.FieldU32("seg_info_offset"))
+			}
+		})
+		d.FieldArray("segments", func(d *decode.D) {
+			for i, segInfoOffset := range segInfoOffsets {
+				// zero means no fixups in segment
+				if segInfoOffset == 0 {
+					continue
+				}
+				d.SeekAbs(startsStart + int64(segInfoOffset)*8)
+				d.FieldStruct("segment", func(d *decode.D) {
+					d.FieldValueU("segment_index", uint64(i))
+					d.FieldU32("size")
+					pageSize := d.FieldU16("page_size", scalar.ActualHex)
+					pointerFormat := d.FieldU16("pointer_format", chainedPointerFormatNames)
+					d.FieldU64("segment_offset", scalar.ActualHex)
+					d.FieldU32("max_valid_pointer", scalar.ActualHex)
+					pageCount := d.FieldU16("page_count")
+					var pageStarts []uint64
+					d.FieldArray("page_starts", func(d *decode.D) {
+						for j := uint64(0); j < pageCount; j++ {
+							pageStarts = append(pageStarts, d.FieldU16("page_start", scalar.UToSymStr{chainedPageStartNone: "none"}, scalar.ActualHex))
+						}
+					})
+
+					if !isArm64ePointerFormat(pointerFormat) || i >= len(segments) {
+						return
+					}
+					if pointerFormat == DYLD_CHAINED_PTR_ARM64E_USERLAND24 {
+						ordinalBits = 24
+					}
+
+					d.FieldArray("chains", func(d *decode.D) {
+						for j, pageStart := range pageStarts {
+							if pageStart == chainedPageStartNone {
+								continue
+							}
+							offset := segments[i].fileoff + uint64(j)*pageSize + pageStart
+							d.FieldArray("chain", func(d *decode.D) {
+								// stride is 8 bytes, limit to page size to not loop forever
+								for k := uint64(0); k < pageSize/8; k++ {
+									if ofileStart+int64(offset+8)*8 > d.Len() {
+										d.Errorf("chain pointer at file offset %d outside file", offset)
+										break
+									}
+									var next uint64
+									fileDataFn(d, ofileStart, offset, 8, false, func(d *decode.D) {
+										d.FieldStruct("pointer", func(d *decode.D) {
+											d.FieldValueU("file_offset", offset, scalar.ActualHex)
+											next = arm64ePointerDecode(d, ordinalBits)
+										})
+									})
+									if next == 0 {
+										break
+									}
+									offset += next * 8
+								}
+							})
+						}
+					})
+				})
+			}
+		})
+	})
+
+	d.SeekAbs(headerStart + int64(importsOffset)*8)
+	d.FieldArray("imports", func(d *decode.D) {
+		for i := uint64(0); i < importsCount; i++ {
+			d.FieldStruct("import", func(d *decode.D) {
+				var nameOffset uint64
+				switch importsFormat {
+				case DYLD_CHAINED_IMPORT, DYLD_CHAINED_IMPORT_ADDEND:
+					v := d.FieldU32("value", scalar.ActualHex)
+					d.FieldValueU("lib_ordinal", v&0xff, dylibNames)
+					d.FieldValueBool("weak_import", v>>8&1 != 0)
+					nameOffset = v >> 9
+				case DYLD_CHAINED_IMPORT_ADDEND64:
+					v := d.FieldU64("value", scalar.ActualHex)
+					d.FieldValueU("lib_ordinal", v&0xffff)
+					d.FieldValueBool("weak_import", v>>16&1 != 0)
+					nameOffset = v >> 32
+				default:
+					d.Fatalf("unknown imports format %d", importsFormat)
+				}
+				d.FieldValueU("name_offset", nameOffset)
+				d.FieldValueStr("name", symbolName(nameOffset))
+				switch importsFormat {
+				case DYLD_CHAINED_IMPORT_ADDEND:
+					d.FieldS32("addend")
+				case DYLD_CHAINED_IMPORT_ADDEND64:
+					d.FieldS64("addend")
+				}
+			})
+		}
+	})
+
+	// symbol names are last
+	d.SeekAbs(headerStart + int64(symbolsOffset)*8)
+	if symbolsFormat == 0 {
+		d.FieldStruct("symbols", cstringsDecode)
+	} else {
+		d.FieldRawLen("symbols", d.BitsLeft())
+	}
+}
@@ -0,0 +1,552 @@
+package macho
+
+// https://opensource.apple.com/source/Security/Security-59754.80.3/OSX/libsecurity_codesigning/lib/CSCommonPriv.h
+// https://opensource.apple.com/source/Security/Security-59754.80.3/OSX/libsecurity_codesigning/lib/requirement.h
+// https://opensource.apple.com/source/Security/Security-59754.80.3/OSX/libsecurity_codesigning/lib/reqdumper.cpp
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//nolint:revive
+const (
+	CSMAGIC_REQUIREMENT               = 0xfade0c00
+	CSMAGIC_REQUIREMENTS              = 0xfade0c01
+	CSMAGIC_CODEDIRECTORY             = 0xfade0c02
+	CSMAGIC_EMBEDDED_SIGNATURE        = 0xfade0cc0
+	CSMAGIC_DETACHED_SIGNATURE        = 0xfade0cc1
+	CSMAGIC_BLOBWRAPPER               = 0xfade0b01
+	CSMAGIC_EMBEDDED_ENTITLEMENTS     = 0xfade7171
+	CSMAGIC_EMBEDDED_DER_ENTITLEMENTS = 0xfade7172
+)
+
+var csMagicNames = scalar.UToSymStr{
+	CSMAGIC_REQUIREMENT:               "requirement",
+	CSMAGIC_REQUIREMENTS:              "requirements",
+	CSMAGIC_CODEDIRECTORY:             "code_directory",
+	CSMAGIC_EMBEDDED_SIGNATURE:        "embedded_signature",
+	CSMAGIC_DETACHED_SIGNATURE:        "detached_signature",
+	CSMAGIC_BLOBWRAPPER:               "blob_wrapper",
+	CSMAGIC_EMBEDDED_ENTITLEMENTS:     "embedded_entitlements",
+	CSMAGIC_EMBEDDED_DER_ENTITLEMENTS: "embedded_der_entitlements",
+}
+
+var csSlotNames = scalar.UToSymStr{
+	0x00000: "code_directory",
+	0x00001: "info",
+	0x00002: "requirements",
+	0x00003: "resource_dir",
+	0x00004: "application",
+	0x00005: "entitlements",
+	0x00007: "der_entitlements",
+	0x01000: "alternate_code_directory",
+	0x01001: "alternate_code_directory_1",
+	0x01002: "alternate_code_directory_2",
+	0x01003: "alternate_code_directory_3",
+	0x01004: "alternate_code_directory_4",
+	0x10000: "signature",
+}
+
+var csHashTypeNames = scalar.UToSymStr{
+	0: "none",
+	1: "sha1",
+	2: "sha256",
+	3: "sha256_truncated",
+	4: "sha384",
+}
+
+var csRequirementTypeNames = scalar.UToSymStr{
+	1: "host",
+	2: "guest",
+	3: "designated",
+	4: "library",
+	5: "plugin",
+}
+
+//nolint:revive
+const (
+	opFalse              = 0
+	opTrue               = 1
+	opIdent              = 2
+	opAppleAnchor        = 3
+	opAnchorHash         = 4
+	opInfoKeyValue       = 5
+	opAnd                = 6
+	opOr                 = 7
+	opCDHash             = 8
+	opNot                = 9
+	opInfoKeyField       = 10
+	opCertField          = 11
+	opTrustedCert        = 12
+	opTrustedCerts       = 13
+	opCertGeneric        = 14
+	opAppleGenericAnchor = 15
+	opEntitlementField   = 16
+	opCertPolicy         = 17
+	opNamedAnchor        = 18
+	opNamedCode          = 19
+	opPlatform           = 20
+	opNotarized          = 21
+	opCertFieldDate      = 22
+	opLegacyDevID        = 23
+)
+
+// high byte of opcode are flags telling how to handle unknown opcodes
+//
+//nolint:revive
+const (
+	opFlagMask     = 0xff00_0000
+	opGenericFalse = 0x8000_0000 // unknown opcode evaluates to false
+	opGenericSkip  = 0x4000_0000 // unknown opcode is ignored
+)
+
+var requirementOpNames = scalar.UToSymStr{
+	opFalse:              "false",
+	opTrue:               "true",
+	opIdent:              "ident",
+	opAppleAnchor:        "apple_anchor",
+	opAnchorHash:         "anchor_hash",
+	opInfoKeyValue:       "info_key_value",
+	opAnd:                "and",
+	opOr:                 "or",
+	opCDHash:             "cd_hash",
+	opNot:                "not",
+	opInfoKeyField:       "info_key_field",
+	opCertField:          "cert_field",
+	opTrustedCert:        "trusted_cert",
+	opTrustedCerts:       "trusted_certs",
+	opCertGeneric:        "cert_generic",
+	opAppleGenericAnchor: "apple_generic_anchor",
+	opEntitlementField:   "entitlement_field",
+	opCertPolicy:         "cert_policy",
+	opNamedAnchor:        "named_anchor",
+	opNamedCode:          "named_code",
+	opPlatform:           "platform",
+	opNotarized:          "notarized",
+	opCertFieldDate:      "cert_field_date",
+	opLegacyDevID:        "legacy_dev_id",
+}
+
+//nolint:revive
+const (
+	matchExists       = 0
+	matchEqual        = 1
+	matchContains     = 2
+	matchBeginsWith   = 3
+	matchEndsWith     = 4
+	matchLessThan     = 5
+	matchGreaterThan  = 6
+	matchLessEqual    = 7
+	matchGreaterEqual = 8
+	matchOn           = 9
+	matchBefore       = 10
+	matchAfter        = 11
+	matchOnOrBefore   = 12
+	matchOnOrAfter    = 13
+	matchAbsent       = 14
+)
+
+var requirementMatchNames = scalar.UToSymStr{
+	matchExists:       "exists",
+	matchEqual:        "equal",
+	matchContains:     "contains",
+	matchBeginsWith:   "begins_with",
+	matchEndsWith:     "ends_with",
+	matchLessThan:     "less_than",
+	matchGreaterThan:  "greater_than",
+	matchLessEqual:    "less_equal",
+	matchGreaterEqual: "greater_equal",
+	matchOn:           "on",
+	matchBefore:       "before",
+	matchAfter:        "after",
+	matchOnOrBefore:   "on_or_before",
+	matchOnOrAfter:    "on_or_after",
+	matchAbsent:       "absent",
+}
+
+var requirementCertSlotNames = scalar.SToSymStr{
+	-1: "root",
+	0:  "leaf",
+}
+
+// codeSignatureDecode decodes a code signature super blob, always big endian
+func codeSignatureDecode(d *decode.D) {
+	d.Endian = decode.BigEndian
+	csBlobDecode(d)
+}
+
+func csBlobDecode(d *decode.D) {
+	blobStart := d.Pos()
+	magic := d.FieldU32("magic", csMagicNames, scalar.ActualHex)
+	length := d.FieldU32("length")
+	if length < 8 {
+		d.Fatalf("blob length %d < 8", length)
+	}
+
+	d.FramedFn(int64(length-8)*8, func(d *decode.D) {
+		switch magic {
+		case CSMAGIC_EMBEDDED_SIGNATURE, CSMAGIC_DETACHED_SIGNATURE:
+			csSuperBlobDecode(d, blobStart, csSlotNames)
+		case CSMAGIC_REQUIREMENTS:
+			csSuperBlobDecode(d, blobStart, csRequirementTypeNames)
+		case CSMAGIC_REQUIREMENT:
+			csRequirementDecode(d)
+		case CSMAGIC_CODEDIRECTORY:
+			csCodeDirectoryDecode(d, blobStart)
+		case CSMAGIC_EMBEDDED_ENTITLEMENTS:
+			d.FieldUTF8("entitlements", int(d.BitsLeft()/8))
+		default:
+			d.FieldRawLen("data", d.BitsLeft())
+		}
+	})
+}
+
+// super blobs are an index of type and offset pairs followed by blobs
+func csSuperBlobDecode(d *decode.D, blobStart int64, typeNames scalar.UToSymStr) {
+	count := d.FieldU32("count")
+	var offsets []uint64
+	d.FieldArray("index", func(d *decode.D) {
+		for i := uint64(0); i < count; i++ {
+			d.FieldStruct("entry", func(d *decode.D) {
+				d.FieldU32("type", typeNames, scalar.ActualHex)
+				offsets = append(offsets, d.FieldU32("offset"))
+			})
+		}
+	})
+	// magic, length, count and index, blobs before would include the super blob itself
+	minOffset := 12 + count*8
+	d.FieldArray("blobs", func(d *decode.D) {
+		for _, offset := range offsets {
+			if offset < minOffset {
+				d.Fatalf("blob offset %d inside super blob header", offset)
+			}
+			d.SeekAbs(blobStart + int64(offset)*8)
+			d.FieldStruct("blob", csBlobDecode)
+		}
+	})
+}
+
+func csCodeDirectoryDecode(d *decode.D, blobStart int64) {
+	version := d.FieldU32("version", scalar.ActualHex)
+	d.FieldU32("flags", scalar.ActualHex)
+	hashOffset := d.FieldU32("hash_offset")
+	identOffset := d.FieldU32("ident_offset")
+	nSpecialSlots := d.FieldU32("n_special_slots")
+	nCodeSlots := d.FieldU32("n_code_slots")
+	d.FieldU32("code_limit")
+	hashSize := d.FieldU8("hash_size")
+	d.FieldU8("hash_type", csHashTypeNames)
+	d.FieldU8("platform")
+	d.FieldU8("page_size", scalar.Fn(func(s scalar.S) (scalar.S, error) {
+		if n, ok := s.Actual.(uint64); ok && n != 0 {
+			s.Sym = uint64(1) << n
+		}
+		return s, nil
+	}))
+	d.FieldU32("spare2")
+	var teamOffset uint64
+	if version >= 0x20100 {
+		d.FieldU32("scatter_offset")
+	}
+	if version >= 0x20200 {
+		teamOffset = d.FieldU32("team_offset")
+	}
+	if version >= 0x20300 {
+		d.FieldU32("spare3")
+		d.FieldU64("code_limit_64")
+	}
+	if version >= 0x20400 {
+		d.FieldU64("exec_seg_base", scalar.ActualHex)
+		d.FieldU64("exec_seg_limit")
+		d.FieldU64("exec_seg_flags", scalar.ActualHex)
+	}
+	if version >= 0x20500 {
+		d.FieldU32("runtime", scalar.ActualHex)
+		d.FieldU32("pre_encrypt_offset")
+	}
+	if version >= 0x20600 {
+		d.FieldU8("linkage_hash_type", csHashTypeNames)
+		d.FieldU8("linkage_application_type")
+		d.FieldU16("linkage_application_sub_type")
+		d.FieldU32("linkage_offset")
+		d.FieldU32("linkage_size")
+	}
+
+	if identOffset != 0 {
+		d.SeekAbs(blobStart + int64(identOffset)*8)
+		d.FieldUTF8Null("ident")
+	}
+	if teamOffset != 0 {
+		d.SeekAbs(blobStart + int64(teamOffset)*8)
+		d.FieldUTF8Null("team_id")
+	}
+
+	// special slots are stored in reverse order before hash offset
+	d.SeekAbs(blobStart + (int64(hashOffset)-int64(nSpecialSlots)*int64(hashSize))*8)
+	d.FieldArray("special_slots", func(d *decode.D) {
+		for i := nSpecialSlots; i > 0; i-- {
+			d.FieldStruct("slot", func(d *decode.D) {
+				d.FieldValueU("type", i, csSlotNames)
+				d.FieldRawLen("hash", int64(hashSize)*8, scalar.RawHex)
+			})
+		}
+	})
+	d.FieldArray("code_slots", func(d *decode.D) {
+		for i := uint64(0); i < nCodeSlots; i++ {
+			d.FieldRawLen("hash", int64(hashSize)*8, scalar.RawHex)
+		}
+	})
+}
+
+func csRequirementDecode(d *decode.D) {
+	// 1 is expression, the only kind
+	d.FieldU32("kind", scalar.UToSymStr{1: "expr"})
+	var expr string
+	d.FieldStruct("expr", func(d *decode.D) {
+		expr = csRequirementExprDecode(d, reqLevelTop)
+	})
+	d.FieldValueStr("expression", expr)
+}
+
+// syntax levels used to know when parentheses are needed, and binds tighter than or
+const (
+	reqLevelPrimary = iota
+	reqLevelAnd
+	reqLevelOr
+	reqLevelTop
+)
+
+// csRequirementData reads length prefixed 4 byte aligned data
+func csRequirementData(d *decode.D, name string, sms ...scalar.Mapper) []byte {
+	length := d.FieldU32(name + "_length")
+	bs := d.PeekBytes(int(length))
+	d.FieldRawLen(name, int64(length)*8, sms...)
+	csRequirementPadding(d)
+	return bs
+}
+
+// csRequirementString reads length prefixed 4 byte aligned string like identifiers, names and keys
+func csRequirementString(d *decode.D, name string) []byte {
+	length := d.FieldU32(name + "_length")
+	bs := d.PeekBytes(int(length))
+	d.FieldUTF8(name, int(length))
+	csRequirementPadding(d)
+	return bs
+}
+
+func csRequirementPadding(d *decode.D) {
+	if n := d.AlignBits(32); n > 0 {
+		d.FieldRawLen("padding", int64(n), d.BitBufIsZero())
+	}
+}
+
+// reqdumper.cpp Dumper::data, identifier like strings are printed as is
+func csRequirementDataString(bs []byte, dotOkay bool) string {
+	if len(bs) == 0 {
+		return `""`
+	}
+	simple := true
+	for _, c := range bs {
+		isAlnum := (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+		if isAlnum || (dotOkay && c == '.') {
+			continue
+		}
+		if c < 0x20 || c >= 0x7f {
+			return "0x" + hex.EncodeToString(bs)
+		}
+		simple = false
+	}
+	if simple {
+		return string(bs)
+	}
+	s := strings.ReplaceAll(string(bs), `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`
+}
+
+func csRequirementOID(bs []byte) string {
+	if len(bs) == 0 {
+		return ""
+	}
+	parts := []string{strconv.Itoa(int(bs[0]) / 40), strconv.Itoa(int(bs[0]) % 40)}
+	var n uint64
+	for _, b := range bs[1:] {
+		n = n<<7 | uint64(b&0x7f)
+		if b&0x80 == 0 {
+			parts = append(parts, strconv.FormatUint(n, 10))
+			n = 0
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+func csRequirementCertSlot(d *decode.D) string {
+	slot := d.FieldS32("cert_slot", requirementCertSlotNames)
+	switch slot {
+	case -1:
+		return "root"
+	case 0:
+		return "leaf"
+	default:
+		return strconv.FormatInt(slot, 10)
+	}
+}
+
+func csRequirementMatchDecode(d *decode.D) string {
+	var s string
+	d.FieldStruct("match", func(d *decode.D) {
+		op := d.FieldU32("op", requirementMatchNames)
+		switch op {
+		case matchExists:
+			s = " /* exists */"
+			return
+		case matchAbsent:
+			s = " absent "
+			return
+		case matchOn, matchBefore, matchAfter, matchOnOrBefore, matchOnOrAfter:
+			// absolute time in seconds since 2001-01-01 as float64
+			t := d.FieldF64("timestamp")
+			s = map[uint64]string{
+				matchOn:         " = ",
+				matchBefore:     " < ",
+				matchAfter:      " > ",
+				matchOnOrBefore: " <= ",
+				matchOnOrAfter:  " >= ",
+			}[op] + "timestamp \"" + strconv.FormatFloat(t, 'f', -1, 64) + "\""
+			return
+		}
+
+		v := csRequirementDataString(csRequirementString(d, "value"), false)
+		switch op {
+		case matchEqual:
+			s = " = " + v
+		case matchContains:
+			s = " ~ " + v
+		case matchBeginsWith:
+			s = " = " + v + "*"
+		case matchEndsWith:
+			s = " = *" + v
+		case matchLessThan:
+			s = " < " + v
+		case matchGreaterThan:
+			s = " > " + v
+		case matchLessEqual:
+			s = " <= " + v
+		case matchGreaterEqual:
+			s = " >= " + v
+		default:
+			s = fmt.Sprintf(" /* unknown match %d */", op)
+		}
+	})
+	return s
+}
+
+// csRequirementExprDecode decodes an opcode expression tree and returns it in csreq text form
+func csRequirementExprDecode(d *decode.D, level int) string {
+	opFull := d.FieldU32("op", scalar.Fn(func(s scalar.S) (scalar.S, error) {
+		if n, ok := s.Actual.(uint64); ok {
+			if name, ok := requirementOpNames[n&^opFlagMask]; ok {
+				s.Sym = name
+			}
+		}
+		return s, nil
+	}), scalar.ActualHex)
+	op := opFull &^ opFlagMask
+
+	switch op {
+	case opFalse:
+		return "never"
+	case opTrue:
+		return "always"
+	case opIdent:
+		return "identifier " + csRequirementDataString(csRequirementString(d, "identifier"), false)
+	case opAppleAnchor:
+		return "anchor apple"
+	case opAppleGenericAnchor:
+		return "anchor apple generic"
+	case opTrustedCerts:
+		return "anchor trusted"
+	case opNotarized:
+		return "notarized"
+	case opLegacyDevID:
+		return "legacy"
+	case opAnchorHash:
+		slot := csRequirementCertSlot(d)
+		hash := csRequirementData(d, "hash", scalar.RawHex)
+		return "certificate " + slot + " = H\"" + hex.EncodeToString(hash) + "\""
+	case opCDHash:
+		hash := csRequirementData(d, "hash", scalar.RawHex)
+		return "cdhash H\"" + hex.EncodeToString(hash) + "\""
+	case opTrustedCert:
+		return "certificate " + csRequirementCertSlot(d) + " trusted"
+	case opNamedAnchor:
+		return "anchor apple " + csRequirementDataString(csRequirementString(d, "name"), false)
+	case opNamedCode:
+		return "(" + csRequirementDataString(csRequirementString(d, "name"), false) + ")"
+	case opPlatform:
+		return "platform = " + strconv.FormatInt(d.FieldS32("platform"), 10)
+	case opInfoKeyValue:
+		key := csRequirementDataString(csRequirementString(d, "key"), false)
+		value := csRequirementDataString(csRequirementString(d, "value"), false)
+		return "info[" + key + "] = " + value
+	case opInfoKeyField:
+		key := csRequirementDataString(csRequirementString(d, "key"), false)
+		return "info[" + key + "]" + csRequirementMatchDecode(d)
+	case opEntitlementField:
+		key := csRequirementDataString(csRequirementString(d, "key"), false)
+		return "entitlement[" + key + "]" + csRequirementMatchDecode(d)
+	case opCertField:
+		slot := csRequirementCertSlot(d)
+		key := csRequirementDataString(csRequirementString(d, "key"), true)
+		return "certificate " + slot + "[" + key + "]" + csRequirementMatchDecode(d)
+	case opCertGeneric, opCertPolicy, opCertFieldDate:
+		slot := csRequirementCertSlot(d)
+		oid := csRequirementData(d, "oid", scalar.RawHex)
+		d.FieldValueStr("oid_string", csRequirementOID(oid))
+		prefix := map[uint64]string{
+			opCertGeneric:   "field.",
+			opCertPolicy:    "policy.",
+			opCertFieldDate: "timestamp.",
+		}[op]
+		return "certificate " + slot + "[" + prefix + csRequirementOID(oid) + "]" + csRequirementMatchDecode(d)
+	case opAnd:
+		var left, right string
+		d.FieldStruct("left", func(d *decode.D) { left = csRequirementExprDecode(d, reqLevelAnd) })
+		d.FieldStruct("right", func(d *decode.D) { right = csRequirementExprDecode(d, reqLevelAnd) })
+		if level < reqLevelAnd {
+			return "(" + left + " and " + right + ")"
+		}
+		return left + " and " + right
+	case opOr:
+		var left, right string
+		d.FieldStruct("left", func(d *decode.D) { left = csRequirementExprDecode(d, reqLevelOr) })
+		d.FieldStruct("right", func(d *decode.D) { right = csRequirementExprDecode(d, reqLevelOr) })
+		if level < reqLevelOr {
+			return "(" + left + " or " + right + ")"
+		}
+		return left + " or " + right
+	case opNot:
+		var e string
+		d.FieldStruct("expr", func(d *decode.D) { e = csRequirementExprDecode(d, reqLevelPrimary) })
+		return "! " + e
+	default:
+		// unknown opcode with generic flags has length prefixed operands that can be skipped
+		switch {
+		case opFull&opGenericFalse != 0:
+			csRequirementData(d, "operands")
+			return fmt.Sprintf("false /* opcode %d */", op)
+		case opFull&opGenericSkip != 0:
+			csRequirementData(d, "operands")
+			return fmt.Sprintf("/* opcode %d */", op)
+		}
+		// size of operands is unknown so rest is raw
+		d.FieldRawLen("operands", d.BitsLeft())
+		return fmt.Sprintf("/* unknown opcode %d */", op)
+	}
+}
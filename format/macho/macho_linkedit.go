@@ -0,0 +1,83 @@
+package macho
+
+import (
+	"fmt"
+
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/ranges"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+// linkeditRegion is a file range referenced by a load command that should be inside __LINKEDIT
+type linkeditRegion struct {
+	name   string
+	offset uint64
+	size   uint64
+}
+
+// fieldLinkeditAccounting checks that the linkedit segment contains all referenced regions,
+// bytes not covered by any region is slack, usually alignment padding, and regions extending
+// outside the segment indicates tampering or broken signing
+func fieldLinkeditAccounting(d *decode.D, segment sectionRange, regions []linkeditRegion) {
+	segmentRange := ranges.Range{Start: int64(segment.offset), Len: int64(segment.size)}
+
+	d.FieldStruct("linkedit_accounting", func(d *decode.D) {
+		d.FieldValueU("fileoff", segment.offset)
+		d.FieldValueU("filesize", segment.size)
+
+		var covered []ranges.Range
+		d.FieldArray("regions", func(d *decode.D) {
+			for _, r := range regions {
+				rr := ranges.Range{Start: int64(r.offset), Len: int64(r.size)}
+				d.FieldStruct("region", func(d *decode.D) {
+					d.FieldValueStr("name", r.name)
+					d.FieldValueU("offset", r.offset)
+					d.FieldValueU("size", r.size)
+					switch {
+					case rr.Start < segmentRange.Start:
+						d.FieldValueBool("outside_segment", true, scalar.Description(fmt.Sprintf("starts %d bytes before __LINKEDIT", segmentRange.Start-rr.Start)))
+					case rr.Stop() > segmentRange.Stop():
+						d.FieldValueBool("outside_segment", true, scalar.Description(fmt.Sprintf("ends %d bytes after __LINKEDIT", rr.Stop()-segmentRange.Stop())))
+					default:
+						d.FieldValueBool("outside_segment", false)
+					}
+				})
+
+				// only the part inside the segment covers it
+				start := rr.Start
+				if start < segmentRange.Start {
+					start = segmentRange.Start
+				}
+				stop := rr.Stop()
+				if stop > segmentRange.Stop() {
+					stop = segmentRange.Stop()
+				}
+				if start < stop {
+					covered = append(covered, ranges.Range{Start: start, Len: stop - start})
+				}
+			}
+		})
+
+		var slack uint64
+		d.FieldArray("uncovered", func(d *decode.D) {
+			fieldUncovered := func(start int64, stop int64) {
+				if start >= stop {
+					return
+				}
+				d.FieldStruct("range", func(d *decode.D) {
+					d.FieldValueU("offset", uint64(start))
+					d.FieldValueU("size", uint64(stop-start))
+				})
+				slack += uint64(stop - start)
+			}
+
+			pos := segmentRange.Start
+			for _, r := range ranges.Union(covered) {
+				fieldUncovered(pos, r.Start)
+				pos = r.Stop()
+			}
+			fieldUncovered(pos, segmentRange.Stop())
+		})
+		d.FieldValueU("linkedit_slack_bytes", slack)
+	})
+}
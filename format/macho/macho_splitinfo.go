@@ -0,0 +1,119 @@
+package macho
+
+// https://opensource.apple.com/source/ld64/ld64-609/src/ld/OutputFile.cpp (OutputFile::makeSplitSegInfoV2)
+// https://opensource.apple.com/source/dyld/dyld-852.2/dyld3/shared-cache/MachOAnalyzer.cpp (forEachSplitSegInfo)
+
+import (
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//nolint:revive
+const (
+	DYLD_CACHE_ADJ_V2_FORMAT = 0x7f
+)
+
+var splitInfoV2KindNames = scalar.UToSymStr{
+	0x01: "pointer_32",
+	0x02: "pointer_64",
+	0x03: "delta_32",
+	0x04: "delta_64",
+	0x05: "arm64_adrp",
+	0x06: "arm64_off12",
+	0x07: "arm64_br26",
+	0x08: "arm_movw_movt",
+	0x09: "arm_br24",
+	0x0a: "thumb_movw_movt",
+	0x0b: "thumb_br22",
+	0x0c: "image_off_32",
+	0x0d: "threaded_pointer_64",
+	// low nibble is high bits of the movt immediate
+	0x10: "thumb_movw_movt_0",
+	0x11: "thumb_movw_movt_1",
+	0x12: "thumb_movw_movt_2",
+	0x13: "thumb_movw_movt_3",
+	0x14: "thumb_movw_movt_4",
+	0x15: "thumb_movw_movt_5",
+	0x16: "thumb_movw_movt_6",
+	0x17: "thumb_movw_movt_7",
+	0x18: "thumb_movw_movt_8",
+	0x19: "thumb_movw_movt_9",
+	0x1a: "thumb_movw_movt_10",
+	0x1b: "thumb_movw_movt_11",
+	0x1c: "thumb_movw_movt_12",
+	0x1d: "thumb_movw_movt_13",
+	0x1e: "thumb_movw_movt_14",
+	0x1f: "thumb_movw_movt_15",
+	0x20: "arm_movw_movt_0",
+	0x21: "arm_movw_movt_1",
+	0x22: "arm_movw_movt_2",
+	0x23: "arm_movw_movt_3",
+	0x24: "arm_movw_movt_4",
+	0x25: "arm_movw_movt_5",
+	0x26: "arm_movw_movt_6",
+	0x27: "arm_movw_movt_7",
+	0x28: "arm_movw_movt_8",
+	0x29: "arm_movw_movt_9",
+	0x2a: "arm_movw_movt_10",
+	0x2b: "arm_movw_movt_11",
+	0x2c: "arm_movw_movt_12",
+	0x2d: "arm_movw_movt_13",
+	0x2e: "arm_movw_movt_14",
+	0x2f: "arm_movw_movt_15",
+}
+
+// V2 stream:
+// <0x7f> <count> from_to_section+
+// from_to_section: <from_section_index> <to_section_index> <count> to_offset+
+// to_offset: <to_offset_delta> <count> from_offset_kind+
+// from_offset_kind: <kind> <count> <from_offset_delta>+
+func segmentSplitInfoDecode(d *decode.D, sectionNames scalar.UToSymStr) {
+	if d.BitsLeft() == 0 {
+		return
+	}
+	// V1 has no version byte and starts with a kind byte
+	if d.PeekBytes(1)[0] != DYLD_CACHE_ADJ_V2_FORMAT {
+		d.FieldValueU("version", 1)
+		d.FieldRawLen("data", d.BitsLeft())
+		return
+	}
+
+	d.FieldU8("format", scalar.UToSymStr{DYLD_CACHE_ADJ_V2_FORMAT: "v2"}, scalar.ActualHex)
+	d.FieldValueU("version", 2)
+	sectionsCount := d.FieldUFn("sections_count", uleb128)
+	d.FieldArray("sections", func(d *decode.D) {
+		for i := uint64(0); i < sectionsCount; i++ {
+			d.FieldStruct("section", func(d *decode.D) {
+				d.FieldUFn("from_section_index", uleb128, sectionNames)
+				d.FieldUFn("to_section_index", uleb128, sectionNames)
+				toOffsetsCount := d.FieldUFn("to_offsets_count", uleb128)
+				d.FieldArray("to_offsets", func(d *decode.D) {
+					for j := uint64(0); j < toOffsetsCount; j++ {
+						d.FieldStruct("to_offset", func(d *decode.D) {
+							d.FieldUFn("to_offset_delta", uleb128, scalar.ActualHex)
+							kindsCount := d.FieldUFn("kinds_count", uleb128)
+							d.FieldArray("kinds", func(d *decode.D) {
+								for k := uint64(0); k < kindsCount; k++ {
+									d.FieldStruct("kind", func(d *decode.D) {
+										d.FieldUFn("kind", uleb128, splitInfoV2KindNames)
+										fromOffsetsCount := d.FieldUFn("from_offsets_count", uleb128)
+										d.FieldArray("from_offset_deltas", func(d *decode.D) {
+											for l := uint64(0); l < fromOffsetsCount; l++ {
+												d.FieldUFn("from_offset_delta", uleb128, scalar.ActualHex)
+											}
+										})
+									})
+								}
+							})
+						})
+					}
+				})
+			})
+		}
+	})
+
+	// linkedit content is pointer size aligned
+	if d.BitsLeft() > 0 {
+		d.FieldRawLen("padding", d.BitsLeft(), d.BitBufIsZero())
+	}
+}
@@ -0,0 +1,150 @@
+package macho
+
+import (
+	"encoding/binary"
+
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+// ofileSummary is facts collected while decoding an ofile
+type ofileSummary struct {
+	cpuType            uint64
+	fileType           uint64
+	isPIE              bool
+	isEncrypted        bool
+	hasCodeSignature   bool
+	isSigned           bool
+	hasVersion         bool
+	hasBuildVersion    bool
+	minOS              uint64
+	sdk                uint64
+	dylibCount         uint64
+	rpaths             []string
+	hasRestrictSegment bool
+	// signature blob not read
+	headersOnly bool
+	// in order of first seen platform
+	deployments []*deployment
+}
+
+// deployment is minimum OS and SDK version for a platform from build version and version min commands
+type deployment struct {
+	platform uint64
+	minOS    uint64
+	sdk      uint64
+	commands []string
+	// commands for the platform have different versions
+	conflict bool
+}
+
+// addDeployment adds or merges versions for a platform, build version is preferred on conflict as it
+// is the newer command
+func (s *ofileSummary) addDeployment(platform uint64, minOS uint64, sdk uint64, command string, isBuildVersion bool) {
+	for _, dp := range s.deployments {
+		if dp.platform != platform {
+			continue
+		}
+		dp.commands = append(dp.commands, command)
+		if dp.minOS != minOS || dp.sdk != sdk {
+			dp.conflict = true
+			if isBuildVersion {
+				dp.minOS = minOS
+				dp.sdk = sdk
+			}
+		}
+		return
+	}
+	s.deployments = append(s.deployments, &deployment{
+		platform: platform,
+		minOS:    minOS,
+		sdk:      sdk,
+		commands: []string{command},
+	})
+}
+
+// codeSignatureHasCMS looks for a non-empty CMS blob wrapper in a code signature super blob,
+// ad-hoc signatures have no or an empty wrapper
+func codeSignatureHasCMS(bs []byte) bool {
+	if len(bs) < 12 || binary.BigEndian.Uint32(bs) != CSMAGIC_EMBEDDED_SIGNATURE {
+		return false
+	}
+	count := binary.BigEndian.Uint32(bs[8:])
+	for i := uint64(0); i < uint64(count); i++ {
+		entry := 12 + i*8
+		if entry+8 > uint64(len(bs)) {
+			return false
+		}
+		offset := uint64(binary.BigEndian.Uint32(bs[entry+4:]))
+		if offset+8 > uint64(len(bs)) {
+			continue
+		}
+		if binary.BigEndian.Uint32(bs[offset:]) == CSMAGIC_BLOBWRAPPER &&
+			binary.BigEndian.Uint32(bs[offset+4:]) > 8 {
+			return true
+		}
+	}
+	return false
+}
+
+func fieldOfileSummary(d *decode.D, s *ofileSummary) {
+	d.FieldValueU("arch", s.cpuType, cpuTypes)
+	d.FieldValueU("filetype", s.fileType, fileTypes)
+	d.FieldValueBool("is_pie", s.isPIE)
+	d.FieldValueBool("is_encrypted", s.isEncrypted)
+	d.FieldValueBool("has_code_signature", s.hasCodeSignature)
+	if s.headersOnly {
+		d.FieldValueNil("is_signed", scalar.Description("unknown with headers_only"))
+	} else {
+		d.FieldValueBool("is_signed", s.isSigned)
+	}
+	if s.hasVersion {
+		d.FieldValueU("min_os", s.minOS, dylibVersionMapper)
+		d.FieldValueU("sdk", s.sdk, dylibVersionMapper)
+	} else {
+		d.FieldValueNil("min_os")
+		d.FieldValueNil("sdk")
+	}
+	d.FieldValueU("dylib_count", s.dylibCount)
+	d.FieldArray("rpaths", func(d *decode.D) {
+		for _, r := range s.rpaths {
+			d.FieldValueStr("rpath", r)
+		}
+	})
+	d.FieldValueBool("has_restrict_segment", s.hasRestrictSegment)
+}
+
+func fieldFatSummary(d *decode.D, ss []*ofileSummary) {
+	d.FieldArray("archs", func(d *decode.D) {
+		for _, s := range ss {
+			d.FieldValueU("arch", s.cpuType, cpuTypes)
+		}
+	})
+	d.FieldArray("files", func(d *decode.D) {
+		for _, s := range ss {
+			d.FieldStruct("file", func(d *decode.D) { fieldOfileSummary(d, s) })
+		}
+	})
+}
+
+func fieldDeployment(d *decode.D, s *ofileSummary) {
+	d.FieldArray("deployment", func(d *decode.D) {
+		for _, dp := range s.deployments {
+			d.FieldStruct("target", func(d *decode.D) {
+				d.FieldValueU("platform", dp.platform, buildPlatforms)
+				d.FieldValueU("minos", dp.minOS, dylibVersionMapper)
+				d.FieldValueU("sdk", dp.sdk, dylibVersionMapper)
+				d.FieldArray("commands", func(d *decode.D) {
+					for _, c := range dp.commands {
+						d.FieldValueStr("command", c)
+					}
+				})
+				if dp.conflict {
+					d.FieldValueBool("conflict", true, scalar.Description("commands have different versions, build_version preferred"))
+				} else {
+					d.FieldValueBool("conflict", false)
+				}
+			})
+		}
+	})
+}
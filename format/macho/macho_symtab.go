@@ -0,0 +1,196 @@
+package macho
+
+// https://opensource.apple.com/source/xnu/xnu-7195.81.3/EXTERNAL_HEADERS/mach-o/nlist.h
+// https://opensource.apple.com/source/cctools/cctools-973.0.1/include/mach-o/stab.h
+
+import (
+	"strings"
+
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//nolint:revive
+const (
+	N_STAB = 0xe0
+	N_UNDF = 0x0
+
+	SELF_LIBRARY_ORDINAL   = 0x0
+	DYNAMIC_LOOKUP_ORDINAL = 0xfe
+	EXECUTABLE_ORDINAL     = 0xff
+)
+
+// n_type N_TYPE bits shifted down one bit
+var nlistTypeNames = scalar.UToSymStr{
+	0x0: "undf",
+	0x1: "abs",
+	0x5: "indr",
+	0x6: "pbud",
+	0x7: "sect",
+}
+
+var stabTypeNames = scalar.UToSymStr{
+	0x20: "gsym",
+	0x22: "fname",
+	0x24: "fun",
+	0x26: "stsym",
+	0x28: "lcsym",
+	0x2e: "bnsym",
+	0x30: "ast",
+	0x3c: "opt",
+	0x40: "rsym",
+	0x44: "sline",
+	0x4e: "ensym",
+	0x60: "ssym",
+	0x64: "so",
+	0x66: "oso",
+	0x80: "lsym",
+	0x82: "bincl",
+	0x84: "sol",
+	0x86: "params",
+	0x88: "version",
+	0x8a: "olevel",
+	0xa0: "psym",
+	0xa2: "eincl",
+	0xa4: "entry",
+	0xc0: "lbrac",
+	0xc2: "excl",
+	0xe0: "rbrac",
+	0xe2: "bcomm",
+	0xe4: "ecomm",
+	0xe8: "ecoml",
+	0xfe: "leng",
+}
+
+var referenceTypeNames = scalar.UToSymStr{
+	0x0: "undefined_non_lazy",
+	0x1: "undefined_lazy",
+	0x2: "defined",
+	0x3: "private_defined",
+	0x4: "private_undefined_non_lazy",
+	0x5: "private_undefined_lazy",
+}
+
+type strTable string
+
+func (m strTable) MapScalar(s scalar.S) (scalar.S, error) {
+	uv, ok := s.Actual.(uint64)
+	if !ok || uv >= uint64(len(m)) {
+		return s, nil
+	}
+	str := string(m[uv:])
+	if i := strings.IndexByte(str, 0); i != -1 {
+		str = str[:i]
+	}
+	s.Sym = str
+	return s, nil
+}
+
+// dylibOrdinalNames maps two-level namespace library ordinals to dylib names. Ordinals are
+// numbered from 1 in load command order, scan ahead as LC_SYMTAB usually comes before the dylib commands.
+func dylibOrdinalNames(d *decode.D, ncmds uint64) scalar.UToSymStr {
+	names := scalar.UToSymStr{
+		SELF_LIBRARY_ORDINAL:   "self",
+		DYNAMIC_LOOKUP_ORDINAL: "dynamic_lookup",
+		EXECUTABLE_ORDINAL:     "executable",
+	}
+	pos := d.Pos()
+	defer d.SeekAbs(pos)
+
+	ordinal := uint64(1)
+	for i := uint64(0); i < ncmds; i++ {
+		cmdStart := d.Pos()
+		if d.BitsLeft() < 12*8 {
+			break
+		}
+		cmd := d.U32()
+		cmdsize := d.U32()
+		if cmdsize < 12 || int64(cmdsize)*8 > d.BitsLeft()+8*8 {
+			break
+		}
+		switch cmd {
+		case LC_LOAD_DYLIB, LC_LOAD_WEAK_DYLIB, LC_REEXPORT_DYLIB, LC_LOAD_UPWARD_DYLIB, LC_LAZY_LOAD_DYLIB:
+			offset := d.U32()
+			if offset < cmdsize {
+				name := string(d.BytesRange(cmdStart+int64(offset)*8, int(cmdsize-offset)))
+				if i := strings.IndexByte(name, 0); i != -1 {
+					name = name[:i]
+				}
+				names[ordinal] = name
+			}
+			ordinal++
+		}
+		d.SeekAbs(cmdStart + int64(cmdsize)*8)
+	}
+
+	return names
+}
+
+func nlistDescDecode(d *decode.D, undefined bool, dylibNames scalar.UToSymStr) {
+	// high byte is library ordinal for undefined symbols and flags for defined symbols
+	highFn := func(d *decode.D) {
+		if undefined {
+			d.FieldU8("library_ordinal", dylibNames)
+			return
+		}
+		d.FieldU5("unused")
+		d.FieldBool("cold_func")
+		d.FieldBool("alt_entry")
+		d.FieldBool("symbol_resolver")
+	}
+	lowFn := func(d *decode.D) {
+		d.FieldBool("weak_def")
+		d.FieldBool("weak_ref")
+		d.FieldBool("no_dead_strip")
+		d.FieldBool("referenced_dynamically")
+		d.FieldBool("arm_thumb_def")
+		d.FieldU3("reference_type", referenceTypeNames)
+	}
+	if d.Endian == decode.LittleEndian {
+		lowFn(d)
+		highFn(d)
+	} else {
+		highFn(d)
+		lowFn(d)
+	}
+}
+
+func symtabDecode(d *decode.D, archBits int, nsyms uint64, strTab string, sectionNames scalar.UToSymStr, dylibNames scalar.UToSymStr) {
+	nlistSectNames := scalar.UToSymStr{0: "no_sect"}
+	for k, v := range sectionNames {
+		if k != 0 {
+			nlistSectNames[k] = v
+		}
+	}
+
+	for i := uint64(0); i < nsyms; i++ {
+		d.FieldStruct("symbol", func(d *decode.D) {
+			d.FieldU32("strx", strTable(strTab))
+			var isStab bool
+			var nType uint64
+			d.FieldStruct("type", func(d *decode.D) {
+				if d.PeekBits(8)&N_STAB != 0 {
+					isStab = true
+					d.FieldU8("stab", stabTypeNames, scalar.ActualHex)
+					return
+				}
+				d.FieldU3("stab")
+				d.FieldBool("pext")
+				nType = d.FieldU3("type", nlistTypeNames)
+				d.FieldBool("ext")
+			})
+			d.FieldU8("sect", nlistSectNames)
+			if isStab {
+				// meaning depends on stab type, for example line number
+				d.FieldU16("desc")
+			} else {
+				d.FieldStruct("desc", func(d *decode.D) { nlistDescDecode(d, nType == N_UNDF, dylibNames) })
+			}
+			if archBits == 32 {
+				d.FieldU32("value", scalar.ActualHex)
+			} else {
+				d.FieldU64("value", scalar.ActualHex)
+			}
+		})
+	}
+}
@@ -0,0 +1,320 @@
+package macho
+
+// https://opensource.apple.com/source/libunwind/libunwind-35.3/include/mach-o/compact_unwind_encoding.h
+// https://refspecs.linuxfoundation.org/LSB_5.0.0/LSB-Core-generic/LSB-Core-generic/ehframechpt.html
+
+import (
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//nolint:revive
+const (
+	UNWIND_SECOND_LEVEL_REGULAR    = 2
+	UNWIND_SECOND_LEVEL_COMPRESSED = 3
+)
+
+var unwindSecondLevelKindNames = scalar.UToSymStr{
+	UNWIND_SECOND_LEVEL_REGULAR:    "regular",
+	UNWIND_SECOND_LEVEL_COMPRESSED: "compressed",
+}
+
+func unwindInfoDecode(d *decode.D) {
+	sectionStart := d.Pos()
+
+	d.FieldU32("version")
+	commonEncodingsOffset := d.FieldU32("common_encodings_array_section_offset")
+	commonEncodingsCount := d.FieldU32("common_encodings_array_count")
+	personalityOffset := d.FieldU32("personality_array_section_offset")
+	personalityCount := d.FieldU32("personality_array_count")
+	indexOffset := d.FieldU32("index_section_offset")
+	indexCount := d.FieldU32("index_count")
+
+	d.SeekAbs(sectionStart + int64(commonEncodingsOffset)*8)
+	d.FieldArray("common_encodings", func(d *decode.D) {
+		for i := uint64(0); i < commonEncodingsCount; i++ {
+			d.FieldU32("encoding", scalar.ActualHex)
+		}
+	})
+
+	d.SeekAbs(sectionStart + int64(personalityOffset)*8)
+	d.FieldArray("personalities", func(d *decode.D) {
+		for i := uint64(0); i < personalityCount; i++ {
+			d.FieldU32("personality", scalar.ActualHex)
+		}
+	})
+
+	var pageOffsets []uint64
+	var lsdaStart, lsdaStop uint64
+	d.SeekAbs(sectionStart + int64(indexOffset)*8)
+	d.FieldArray("index", func(d *decode.D) {
+		for i := uint64(0); i < indexCount; i++ {
+			d.FieldStruct("entry", func(d *decode.D) {
+				d.FieldU32("function_offset", scalar.ActualHex)
+				pageOffset := d.FieldU32("second_level_pages_section_offset")
+				lsdaOffset := d.FieldU32("lsda_index_array_section_offset")
+				// last entry is a sentinel without a page
+				if pageOffset != 0 {
+					pageOffsets = append(pageOffsets, pageOffset)
+				}
+				if i == 0 {
+					lsdaStart = lsdaOffset
+				}
+				lsdaStop = lsdaOffset
+			})
+		}
+	})
+
+	if lsdaStop > lsdaStart {
+		d.SeekAbs(sectionStart + int64(lsdaStart)*8)
+		d.FieldArray("lsdas", func(d *decode.D) {
+			for i := uint64(0); i < (lsdaStop-lsdaStart)/8; i++ {
+				d.FieldStruct("lsda", func(d *decode.D) {
+					d.FieldU32("function_offset", scalar.ActualHex)
+					d.FieldU32("lsda_offset", scalar.ActualHex)
+				})
+			}
+		})
+	}
+
+	d.FieldArray("pages", func(d *decode.D) {
+		for _, pageOffset := range pageOffsets {
+			pageStart := sectionStart + int64(pageOffset)*8
+			d.SeekAbs(pageStart)
+			d.FieldStruct("page", func(d *decode.D) {
+				kind := d.FieldU32("kind", unwindSecondLevelKindNames)
+				switch kind {
+				case UNWIND_SECOND_LEVEL_REGULAR:
+					entryPageOffset := d.FieldU16("entry_page_offset")
+					entryCount := d.FieldU16("entry_count")
+					d.SeekAbs(pageStart + int64(entryPageOffset)*8)
+					d.FieldArray("entries", func(d *decode.D) {
+						for i := uint64(0); i < entryCount; i++ {
+							d.FieldStruct("entry", func(d *decode.D) {
+								d.FieldU32("function_offset", scalar.ActualHex)
+								d.FieldU32("encoding", scalar.ActualHex)
+							})
+						}
+					})
+				case UNWIND_SECOND_LEVEL_COMPRESSED:
+					entryPageOffset := d.FieldU16("entry_page_offset")
+					entryCount := d.FieldU16("entry_count")
+					encodingsPageOffset := d.FieldU16("encodings_page_offset")
+					encodingsCount := d.FieldU16("encodings_count")
+					d.SeekAbs(pageStart + int64(entryPageOffset)*8)
+					d.FieldArray("entries", func(d *decode.D) {
+						for i := uint64(0); i < entryCount; i++ {
+							d.FieldStruct("entry", func(d *decode.D) {
+								// 32 bit entry with function offset in low 24 bits and encoding index in high 8 bits
+								if d.Endian == decode.LittleEndian {
+									d.FieldU24("function_offset", scalar.ActualHex)
+									d.FieldU8("encoding_index")
+								} else {
+									d.FieldU8("encoding_index")
+									d.FieldU24("function_offset", scalar.ActualHex)
+								}
+							})
+						}
+					})
+					d.SeekAbs(pageStart + int64(encodingsPageOffset)*8)
+					d.FieldArray("encodings", func(d *decode.D) {
+						for i := uint64(0); i < encodingsCount; i++ {
+							d.FieldU32("encoding", scalar.ActualHex)
+						}
+					})
+				}
+			})
+		}
+	})
+}
+
+//nolint:revive
+const (
+	DW_EH_PE_absptr  = 0x00
+	DW_EH_PE_uleb128 = 0x01
+	DW_EH_PE_udata2  = 0x02
+	DW_EH_PE_udata4  = 0x03
+	DW_EH_PE_udata8  = 0x04
+	DW_EH_PE_sleb128 = 0x09
+	DW_EH_PE_sdata2  = 0x0a
+	DW_EH_PE_sdata4  = 0x0b
+	DW_EH_PE_sdata8  = 0x0c
+	DW_EH_PE_omit    = 0xff
+)
+
+var ehPointerEncodingNames = scalar.UToSymStr{
+	0x00: "absptr",
+	0x01: "uleb128",
+	0x02: "udata2",
+	0x03: "udata4",
+	0x04: "udata8",
+	0x09: "sleb128",
+	0x0a: "sdata2",
+	0x0b: "sdata4",
+	0x0c: "sdata8",
+	0x10: "pcrel",
+	0x1b: "pcrel_sdata4",
+	0x9b: "indirect_pcrel_sdata4",
+	0xff: "omit",
+}
+
+func uleb128(d *decode.D) uint64 {
+	var v uint64
+	var shift uint
+	for {
+		b := d.U8()
+		v |= (b & 0x7f) << shift
+		shift += 7
+		if b&0x80 == 0 || shift >= 64 {
+			break
+		}
+	}
+	return v
+}
+
+func sleb128(d *decode.D) int64 {
+	var v int64
+	var shift uint
+	for {
+		b := d.U8()
+		v |= int64(b&0x7f) << shift
+		shift += 7
+		if b&0x80 == 0 || shift >= 64 {
+			if shift < 64 && b&0x40 != 0 {
+				v |= -1 << shift
+			}
+			break
+		}
+	}
+	return v
+}
+
+// ehPointerDecode adds pointer field using encoding, returns false and adds nothing if encoding is unknown
+func ehPointerDecode(d *decode.D, name string, enc uint64, archBits int) bool {
+	switch enc & 0x0f {
+	case DW_EH_PE_absptr:
+		if archBits == 32 {
+			d.FieldU32(name, scalar.ActualHex)
+		} else {
+			d.FieldU64(name, scalar.ActualHex)
+		}
+	case DW_EH_PE_uleb128:
+		d.FieldUFn(name, uleb128, scalar.ActualHex)
+	case DW_EH_PE_udata2:
+		d.FieldU16(name, scalar.ActualHex)
+	case DW_EH_PE_udata4:
+		d.FieldU32(name, scalar.ActualHex)
+	case DW_EH_PE_udata8:
+		d.FieldU64(name, scalar.ActualHex)
+	case DW_EH_PE_sleb128:
+		d.FieldSFn(name, sleb128)
+	case DW_EH_PE_sdata2:
+		d.FieldS16(name)
+	case DW_EH_PE_sdata4:
+		d.FieldS32(name)
+	case DW_EH_PE_sdata8:
+		d.FieldS64(name)
+	default:
+		return false
+	}
+	return true
+}
+
+type ehCIE struct {
+	hasAugmentationData bool
+	fdeEncoding         uint64
+}
+
+func ehFrameDecode(d *decode.D, archBits int) {
+	cies := map[int64]ehCIE{}
+
+	for !d.End() {
+		recordStart := d.Pos()
+		isTerminator := false
+
+		d.FieldStruct("record", func(d *decode.D) {
+			length := d.FieldU32("length")
+			if length == 0 {
+				d.FieldValueStr("type", "terminator")
+				isTerminator = true
+				return
+			}
+			if length == 0xffff_ffff {
+				length = d.FieldU64("extended_length")
+			}
+			idPos := d.Pos()
+			d.FramedFn(int64(length)*8, func(d *decode.D) {
+				id := d.FieldU32("id")
+				if id == 0 {
+					d.FieldValueStr("type", "cie")
+					cie := ehCIE{fdeEncoding: DW_EH_PE_absptr}
+					version := d.FieldU8("version")
+					augmentation := d.FieldUTF8Null("augmentation")
+					if augmentation == "eh" {
+						if archBits == 32 {
+							d.FieldU32("eh_data")
+						} else {
+							d.FieldU64("eh_data")
+						}
+					}
+					d.FieldUFn("code_alignment_factor", uleb128)
+					d.FieldSFn("data_alignment_factor", sleb128)
+					if version == 1 {
+						d.FieldU8("return_address_register")
+					} else {
+						d.FieldUFn("return_address_register", uleb128)
+					}
+					if len(augmentation) > 0 && augmentation[0] == 'z' {
+						cie.hasAugmentationData = true
+						augmentationLength := d.FieldUFn("augmentation_length", uleb128)
+						d.FramedFn(int64(augmentationLength)*8, func(d *decode.D) {
+							d.FieldStruct("augmentation_data", func(d *decode.D) {
+								for _, c := range augmentation[1:] {
+									switch c {
+									case 'R':
+										cie.fdeEncoding = d.FieldU8("fde_pointer_encoding", ehPointerEncodingNames, scalar.ActualHex)
+									case 'L':
+										d.FieldU8("lsda_pointer_encoding", ehPointerEncodingNames, scalar.ActualHex)
+									case 'P':
+										personalityEncoding := d.FieldU8("personality_encoding", ehPointerEncodingNames, scalar.ActualHex)
+										if !ehPointerDecode(d, "personality", personalityEncoding, archBits) {
+											// unknown size, rest of augmentation data is unknown
+											d.FieldRawLen("unknown", d.BitsLeft())
+											return
+										}
+									}
+								}
+							})
+						})
+					}
+					cies[recordStart] = cie
+					d.FieldRawLen("initial_instructions", d.BitsLeft())
+				} else {
+					d.FieldValueStr("type", "fde")
+					cieStart := idPos - int64(id)*8
+					d.FieldValueU("cie_offset", uint64(cieStart/8), scalar.ActualHex)
+					cie, ok := cies[cieStart]
+					if !ok {
+						d.FieldRawLen("data", d.BitsLeft())
+						return
+					}
+					if !ehPointerDecode(d, "pc_begin", cie.fdeEncoding, archBits) {
+						d.FieldRawLen("data", d.BitsLeft())
+						return
+					}
+					// pc range has same size as pc begin but is never relative
+					ehPointerDecode(d, "pc_range", cie.fdeEncoding&0x0f, archBits)
+					if cie.hasAugmentationData {
+						augmentationLength := d.FieldUFn("augmentation_length", uleb128)
+						d.FieldRawLen("augmentation_data", int64(augmentationLength)*8)
+					}
+					d.FieldRawLen("instructions", d.BitsLeft())
+				}
+			})
+		})
+
+		if isTerminator {
+			break
+		}
+	}
+}
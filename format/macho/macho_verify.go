@@ -0,0 +1,43 @@
+package macho
+
+import (
+	"crypto/sha1" //nolint:gosec
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/interp"
+)
+
+func init() {
+	interp.RegisterFunc1("_macho_code_hash", codeHash)
+}
+
+// codeHash hashes binary using code directory hash type name and returns it as hex
+func codeHash(_ *interp.Interp, c any, hashType string) any {
+	var h hash.Hash
+	switch hashType {
+	case "sha1":
+		h = sha1.New() //nolint:gosec
+	case "sha256", "sha256_truncated":
+		h = sha256.New()
+	case "sha384":
+		h = sha512.New384()
+	default:
+		return fmt.Errorf("unsupported hash type %q", hashType)
+	}
+
+	br, err := interp.ToBitReader(c)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(h, bitio.NewIOReader(br)); err != nil {
+		return err
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
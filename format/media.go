@@ -1,6 +1,7 @@
 package format
 
 import (
+	"github.com/wader/fq/pkg/decode"
 	"github.com/wader/fq/pkg/scalar"
 )
 
@@ -248,3 +249,62 @@ var ISO_23091_2_MatrixCoefficients = scalar.UToScalar{
 	13: {Sym: "chroma_derived_cl", Description: "Chromaticity-derived constant luminance system"},
 	14: {Sym: "ictcp", Description: "ITU-R BT.2100-0, ICtCp"},
 }
+
+// ChannelLayout is a layout name and channel positions in coded order for a channel count
+type ChannelLayout struct {
+	Name        string
+	Description string
+	Positions   []string
+}
+
+// ChannelLayouts maps channel count to layout, as a mapper it sets description of a channel count,
+// counts without a layout are application defined
+type ChannelLayouts map[uint64]ChannelLayout
+
+func (cl ChannelLayouts) MapScalar(s scalar.S) (scalar.S, error) {
+	if l, ok := cl[s.ActualU()]; ok {
+		s.Description = l.Description
+	} else {
+		s.Description = "Application defined"
+	}
+	return s, nil
+}
+
+// FieldChannelLayout adds layout name and channel positions for channel count if known, they are
+// synthetic fields as they are implied by the count
+func (cl ChannelLayouts) FieldChannelLayout(d *decode.D, channels uint64) {
+	l, ok := cl[channels]
+	if !ok {
+		return
+	}
+	d.FieldValueStr("channel_layout", l.Name, scalar.Description(l.Description))
+	d.FieldArray("channel_positions", func(d *decode.D) {
+		for _, p := range l.Positions {
+			d.FieldValueStr("position", p)
+		}
+	})
+}
+
+// https://xiph.org/vorbis/doc/Vorbis_I_spec.html#x1-810004.3.9
+var VorbisChannelLayouts = ChannelLayouts{
+	1: {Name: "mono", Description: "Mono", Positions: []string{"center"}},
+	2: {Name: "stereo", Description: "Stereo", Positions: []string{"left", "right"}},
+	3: {Name: "1d_surround", Description: "1D-surround", Positions: []string{"left", "center", "right"}},
+	4: {Name: "quadraphonic", Description: "Quadraphonic surround", Positions: []string{"front_left", "front_right", "rear_left", "rear_right"}},
+	5: {Name: "5.0", Description: "5.0 surround", Positions: []string{"front_left", "center", "front_right", "rear_left", "rear_right"}},
+	6: {Name: "5.1", Description: "5.1 surround", Positions: []string{"front_left", "center", "front_right", "rear_left", "rear_right", "lfe"}},
+	7: {Name: "6.1", Description: "6.1 surround", Positions: []string{"front_left", "center", "front_right", "side_left", "side_right", "rear_center", "lfe"}},
+	8: {Name: "7.1", Description: "7.1 surround", Positions: []string{"front_left", "center", "front_right", "side_left", "side_right", "rear_left", "rear_right", "lfe"}},
+}
+
+// https://www.rfc-editor.org/rfc/rfc9639.html#section-9.1.3
+var FLACChannelLayouts = ChannelLayouts{
+	1: {Name: "mono", Description: "Mono", Positions: []string{"center"}},
+	2: {Name: "stereo", Description: "Stereo", Positions: []string{"left", "right"}},
+	3: {Name: "3.0", Description: "3.0", Positions: []string{"left", "right", "center"}},
+	4: {Name: "quadraphonic", Description: "Quadraphonic", Positions: []string{"front_left", "front_right", "back_left", "back_right"}},
+	5: {Name: "5.0", Description: "5.0 surround", Positions: []string{"front_left", "front_right", "front_center", "back_left", "back_right"}},
+	6: {Name: "5.1", Description: "5.1 surround", Positions: []string{"front_left", "front_right", "front_center", "lfe", "back_left", "back_right"}},
+	7: {Name: "6.1", Description: "6.1 surround", Positions: []string{"front_left", "front_right", "front_center", "lfe", "back_center", "side_left", "side_right"}},
+	8: {Name: "7.1", Description: "7.1 surround", Positions: []string{"front_left", "front_right", "front_center", "lfe", "back_left", "back_right", "side_left", "side_right"}},
+}
@@ -0,0 +1,25 @@
+package format_test
+
+import (
+	"testing"
+
+	"github.com/wader/fq/format"
+)
+
+func TestChannelLayouts(t *testing.T) {
+	for name, cl := range map[string]format.ChannelLayouts{
+		"vorbis": format.VorbisChannelLayouts,
+		"flac":   format.FLACChannelLayouts,
+	} {
+		for channels := uint64(1); channels <= 8; channels++ {
+			l, ok := cl[channels]
+			if !ok {
+				t.Errorf("%s: %d channels has no layout", name, channels)
+				continue
+			}
+			if uint64(len(l.Positions)) != channels {
+				t.Errorf("%s: %s has %d positions, expected %d", name, l.Name, len(l.Positions), channels)
+			}
+		}
+	}
+}
@@ -846,7 +846,8 @@ func init() {
 		// Track Fragment Run
 		"trun": func(ctx *decodeContext, d *decode.D) {
 			m := &moof{}
-			if t := ctx.currentTrafBox(); t != nil {
+			// moof is set by tfhd which might be missing
+			if t := ctx.currentTrafBox(); t != nil && t.moof != nil {
 				m = t.moof
 			}
 
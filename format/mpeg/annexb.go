@@ -1,6 +1,7 @@
 package mpeg
 
 import (
+	"github.com/wader/fq/format"
 	"github.com/wader/fq/pkg/decode"
 )
 
@@ -22,13 +23,15 @@ func annexBDecodeStartCodeLen(v uint64) int64 {
 	}
 }
 
-func annexBDecode(d *decode.D, _ any, format decode.Group) any {
+func annexBDecode(d *decode.D, _ any, naluFormat decode.Group) any {
 	currentOffset, currentPrefixLen, err := annexBFindStartCode(d)
 	// TODO: really restrict to 0?
 	if err != nil || currentOffset != 0 {
 		d.Errorf("could not find start code (first)")
 	}
 
+	var vis videoInfos
+
 	for d.NotEnd() {
 		d.FieldRawLen("start_code", currentPrefixLen)
 
@@ -38,10 +41,28 @@ func annexBDecode(d *decode.D, _ any, format decode.Group) any {
 		}
 
 		naluLen := nextOffset
-		d.FieldFormatLen("nalu", naluLen, format, nil)
+		_, v := d.FieldFormatLen("nalu", naluLen, naluFormat, nil)
+		switch v := v.(type) {
+		case format.AvcNaluOut:
+			if v.VideoInfo != nil {
+				vis.sps(*v.VideoInfo)
+			}
+			if v.IsSlice {
+				vis.slice()
+			}
+		case format.HevcNaluOut:
+			if v.VideoInfo != nil {
+				vis.sps(*v.VideoInfo)
+			}
+			if v.IsSlice {
+				vis.slice()
+			}
+		}
 
 		currentPrefixLen = nextPrefixLen
 	}
 
+	fieldVideoInfos(d, &vis)
+
 	return nil
 }
@@ -32,12 +32,26 @@ func avcAUDecode(d *decode.D, in any) any {
 		d.Fatalf("avcIn required")
 	}
 
+	lengthPrefixedNALUsDecode(d, avcIn.LengthSize, avcNALUFormat)
+
+	return nil
+}
+
+// lengthPrefixedNALUsDecode decodes NALUs each prefixed with a length as stored in mp4 and matroska samples
+func lengthPrefixedNALUsDecode(d *decode.D, lengthSize uint64, naluGroup decode.Group) {
+	switch lengthSize {
+	case 1, 2, 4:
+	default:
+		d.Fatalf("invalid length size %d, should be 1, 2 or 4", lengthSize)
+	}
+
 	for d.NotEnd() {
 		d.FieldStruct("nalu", func(d *decode.D) {
-			l := d.FieldU("length", int(avcIn.LengthSize)*8)
-			d.FieldFormatLen("nalu", int64(l)*8, avcNALUFormat, nil)
+			l := d.FieldU("length", int(lengthSize)*8)
+			if int64(l)*8 > d.BitsLeft() {
+				d.Fatalf("nalu length %d larger than remaining %d bytes", l, d.BitsLeft()/8)
+			}
+			d.FieldFormatLen("nalu", int64(l)*8, naluGroup, nil)
 		})
 	}
-
-	return nil
 }
@@ -103,6 +103,7 @@ func avcNALUDecode(d *decode.D, _ any) any {
 	d.FieldU2("nal_ref_idc")
 	nalType := d.FieldU5("nal_unit_type", avcNALNames)
 	unescapedBR := d.NewBitBufFromReader(nalUnescapeReader{Reader: bitio.NewIOReader(d.BitBufRange(d.Pos(), d.BitsLeft()))})
+	var out format.AvcNaluOut
 
 	switch nalType {
 	case avcNALCodedSliceNonIDR,
@@ -112,6 +113,7 @@ func avcNALUDecode(d *decode.D, _ any) any {
 		avcNALCodedSliceIDR,
 		avcNALCodedSliceAuxWithoutPartition,
 		avcNALCodedSliceExtension:
+		out.IsSlice = true
 		d.FieldStruct("slice_header", func(d *decode.D) {
 			d.FieldUFn("first_mb_in_slice", uEV)
 			d.FieldUFn("slice_type", uEV, sliceNames)
@@ -121,11 +123,14 @@ func avcNALUDecode(d *decode.D, _ any) any {
 	case avcNALSupplementalEnhancementInformation:
 		d.FieldFormatBitBuf("sei", unescapedBR, avcSEIFormat, nil)
 	case avcNALSequenceParameterSet:
-		d.FieldFormatBitBuf("sps", unescapedBR, avcSPSFormat, nil)
+		_, v := d.FieldFormatBitBuf("sps", unescapedBR, avcSPSFormat, nil)
+		if spsOut, ok := v.(format.AvcSpsOut); ok {
+			out.VideoInfo = &spsOut.VideoInfo
+		}
 	case avcNALPictureParameterSet:
 		d.FieldFormatBitBuf("pps", unescapedBR, avcPPSFormat, nil)
 	}
 	d.FieldRawLen("data", d.BitsLeft())
 
-	return nil
+	return out
 }
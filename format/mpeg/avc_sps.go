@@ -53,7 +53,15 @@ var chromaFormatMap = scalar.UToSymStr{
 	3: "4:4:4",
 }
 
-func avcVuiParameters(d *decode.D) {
+// timing info from vui parameters
+type videoTiming struct {
+	present        bool
+	numUnitsInTick uint64
+	timeScale      uint64
+}
+
+func avcVuiParameters(d *decode.D) videoTiming {
+	var timing videoTiming
 	aspectRatioInfoPresentFlag := d.FieldBool("aspect_ratio_info_present_flag")
 	if aspectRatioInfoPresentFlag {
 		aspectRatioIdc := d.FieldU8("aspect_ratio_idc", avcAspectRatioIdcMap)
@@ -87,8 +95,9 @@ func avcVuiParameters(d *decode.D) {
 	timingInfoPresentFlag := d.FieldBool("timing_info_present_flag")
 
 	if timingInfoPresentFlag {
-		d.FieldU32("num_units_in_tick")
-		d.FieldU32("time_scale")
+		timing.present = true
+		timing.numUnitsInTick = d.FieldU32("num_units_in_tick")
+		timing.timeScale = d.FieldU32("time_scale")
 		d.FieldBool("fixed_frame_rate_flag")
 	}
 	nalHrdParametersPresentFlag := d.FieldBool("nal_hrd_parameters_present_flag")
@@ -113,6 +122,23 @@ func avcVuiParameters(d *decode.D) {
 		d.FieldUFn("max_num_reorder_frames", uEV)
 		d.FieldUFn("max_dec_frame_buffering", uEV)
 	}
+
+	return timing
+}
+
+// 7.3.2.1.1.1 Scaling list syntax
+func avcScalingList(d *decode.D, size int) {
+	lastScale := int64(8)
+	nextScale := int64(8)
+	for j := 0; j < size; j++ {
+		if nextScale != 0 {
+			deltaScale := d.FieldSFn("delta_scale", sEV)
+			nextScale = (lastScale + deltaScale + 256) % 256
+		}
+		if nextScale != 0 {
+			lastScale = nextScale
+		}
+	}
 }
 
 func avcHdrParameters(d *decode.D) {
@@ -143,24 +169,47 @@ func avcSPSDecode(d *decode.D, _ any) any {
 	d.FieldBool("constraint_set4_flag")
 	d.FieldBool("constraint_set5_flag")
 	d.FieldU2("reserved_zero_2bits")
-	d.FieldU8("level_idc", avcLevelNames)
-	d.FieldUFn("seq_parameter_set_id", uEV)
+	levelIdc := d.FieldU8("level_idc", avcLevelNames)
+	spsID := d.FieldUFn("seq_parameter_set_id", uEV)
+
+	// defaults when not present
+	chromaFormatIdc := uint64(1)
+	separateColourPlaneFlag := false
+	bitDepthLuma := uint64(8)
+	bitDepthChroma := uint64(8)
 
 	switch profileIdc {
 	// TODO: ffmpeg has some more (legacy values?)
 	case 100, 110, 122, 244, 44, 83, 86, 118, 128, 138, 139, 134, 135:
-		chromaFormatIdc := d.FieldUFn("chroma_format_idc", uEV, chromaFormatMap)
+		chromaFormatIdc = d.FieldUFn("chroma_format_idc", uEV, chromaFormatMap)
 		if chromaFormatIdc == 3 {
-			d.FieldBool("separate_colour_plane_flag")
+			separateColourPlaneFlag = d.FieldBool("separate_colour_plane_flag")
 		}
 
-		d.FieldUFn("bit_depth_luma", uEV, scalar.ActualUAdd(8))
-		d.FieldUFn("bit_depth_chroma", uEV, scalar.ActualUAdd(8))
+		bitDepthLuma = d.FieldUFn("bit_depth_luma", uEV, scalar.ActualUAdd(8))
+		bitDepthChroma = d.FieldUFn("bit_depth_chroma", uEV, scalar.ActualUAdd(8))
 		d.FieldBool("qpprime_y_zero_transform_bypass_flag")
 		seqScalingMatrixPresentFlag := d.FieldBool("seq_scaling_matrix_present_flag")
 		if seqScalingMatrixPresentFlag {
-			// TODO:
-			return nil
+			n := 8
+			if chromaFormatIdc == 3 {
+				n = 12
+			}
+			d.FieldArray("seq_scaling_lists", func(d *decode.D) {
+				for i := 0; i < n; i++ {
+					d.FieldStruct("seq_scaling_list", func(d *decode.D) {
+						seqScalingListPresentFlag := d.FieldBool("seq_scaling_list_present_flag")
+						if !seqScalingListPresentFlag {
+							return
+						}
+						size := 16
+						if i >= 6 {
+							size = 64
+						}
+						d.FieldArray("delta_scales", func(d *decode.D) { avcScalingList(d, size) })
+					})
+				}
+			})
 		}
 	}
 
@@ -183,26 +232,59 @@ func avcSPSDecode(d *decode.D, _ any) any {
 
 	d.FieldUFn("max_num_ref_frames", uEV)
 	d.FieldBool("gaps_in_frame_num_value_allowed_flag")
-	d.FieldUFn("pic_width_in_mbs", uEV, scalar.ActualUAdd(1))
-	d.FieldUFn("pic_height_in_map_units", uEV, scalar.ActualUAdd(1))
+	picWidthInMbs := d.FieldUFn("pic_width_in_mbs", uEV, scalar.ActualUAdd(1))
+	picHeightInMapUnits := d.FieldUFn("pic_height_in_map_units", uEV, scalar.ActualUAdd(1))
 	frameMbsOnlyFlag := d.FieldBool("frame_mbs_only_flag")
 	if !frameMbsOnlyFlag {
 		d.FieldBool("mb_adaptive_frame_field_flag")
 	}
 	d.FieldBool("direct_8x8_inference_flag")
+	var cropLeft, cropRight, cropTop, cropBottom uint64
 	frameCroppingFlag := d.FieldBool("frame_cropping_flag")
 	if frameCroppingFlag {
-		d.FieldUFn("frame_crop_left_offset", uEV)
-		d.FieldUFn("frame_crop_right_offset", uEV)
-		d.FieldUFn("frame_crop_top_offset", uEV)
-		d.FieldUFn("frame_crop_bottom_offset", uEV)
+		cropLeft = d.FieldUFn("frame_crop_left_offset", uEV)
+		cropRight = d.FieldUFn("frame_crop_right_offset", uEV)
+		cropTop = d.FieldUFn("frame_crop_top_offset", uEV)
+		cropBottom = d.FieldUFn("frame_crop_bottom_offset", uEV)
 	}
+	var timing videoTiming
 	vuiParametersPresentFlag := d.FieldBool("vui_parameters_present_flag")
 	if vuiParametersPresentFlag {
-		d.FieldStruct("vui_parameters", avcVuiParameters)
+		d.FieldStruct("vui_parameters", func(d *decode.D) { timing = avcVuiParameters(d) })
 	}
 
 	d.FieldRawLen("rbsp_trailing_bits", d.BitsLeft())
 
-	return nil
+	// 7.4.2.1.1 sps semantics, values from table 6-1
+	frameHeightFactor := uint64(2)
+	if frameMbsOnlyFlag {
+		frameHeightFactor = 1
+	}
+	chromaArrayType := chromaFormatIdc
+	if separateColourPlaneFlag {
+		chromaArrayType = 0
+	}
+	subWidthC, subHeightC := chromaSubsampling(chromaArrayType)
+	codedWidth := picWidthInMbs * 16
+	codedHeight := frameHeightFactor * picHeightInMapUnits * 16
+	vi := format.VideoInfo{
+		SeqParameterSetID: spsID,
+		Profile:           symOrNumber(avcProfileNames, profileIdc),
+		Level:             symOrNumber(avcLevelNames, levelIdc),
+		ChromaFormat:      symOrNumber(chromaFormatMap, chromaFormatIdc),
+		BitDepthLuma:      bitDepthLuma,
+		BitDepthChroma:    bitDepthChroma,
+		CodedWidth:        codedWidth,
+		CodedHeight:       codedHeight,
+		DisplayWidth:      croppedSize(codedWidth, subWidthC*(cropLeft+cropRight)),
+		DisplayHeight:     croppedSize(codedHeight, subHeightC*frameHeightFactor*(cropTop+cropBottom)),
+		Interlaced:        !frameMbsOnlyFlag,
+	}
+	// frame rate is half of tick rate as a tick is a field
+	if timing.present && timing.numUnitsInTick != 0 {
+		vi.HasTiming = true
+		vi.FrameRate = float64(timing.timeScale) / float64(2*timing.numUnitsInTick)
+	}
+
+	return format.AvcSpsOut{VideoInfo: vi}
 }
@@ -30,12 +30,7 @@ func hevcAUDecode(d *decode.D, in any) any {
 		d.Errorf("HevcAuIn required")
 	}
 
-	for d.NotEnd() {
-		d.FieldStruct("nalu", func(d *decode.D) {
-			l := d.FieldU("length", int(hevcIn.LengthSize)*8)
-			d.FieldFormatLen("nalu", int64(l)*8, hevcAUNALFormat, nil)
-		})
-	}
+	lengthPrefixedNALUsDecode(d, hevcIn.LengthSize, hevcAUNALFormat)
 
 	return nil
 }
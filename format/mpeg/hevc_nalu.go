@@ -88,6 +88,8 @@ func hevcNALUDecode(d *decode.D, _ any) any {
 	d.FieldU6("nuh_layer_id")
 	d.FieldU3("nuh_temporal_id_plus1")
 	unescapedBR := d.NewBitBufFromReader(nalUnescapeReader{Reader: bitio.NewIOReader(d.BitBufRange(d.Pos(), d.BitsLeft()))})
+	// 0-31 are VCL NAL unit types
+	out := format.HevcNaluOut{IsSlice: nalType < 32}
 
 	switch nalType {
 	case hevcNALNUTVPS:
@@ -95,9 +97,12 @@ func hevcNALUDecode(d *decode.D, _ any) any {
 	case hevcNALNUTPPS:
 		d.FieldFormatBitBuf("pps", unescapedBR, hevcPPSFormat, nil)
 	case hevcNALNUTSPS:
-		d.FieldFormatBitBuf("sps", unescapedBR, hevcSPSFormat, nil)
+		_, v := d.FieldFormatBitBuf("sps", unescapedBR, hevcSPSFormat, nil)
+		if spsOut, ok := v.(format.HevcSpsOut); ok {
+			out.VideoInfo = &spsOut.VideoInfo
+		}
 	}
 	d.FieldRawLen("data", d.BitsLeft())
 
-	return nil
+	return out
 }
@@ -3,9 +3,12 @@ package mpeg
 // https://www.itu.int/rec/T-REC-H.265
 
 import (
+	"fmt"
+
 	"github.com/wader/fq/format"
 	"github.com/wader/fq/pkg/decode"
 	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
 )
 
 func init() {
@@ -16,19 +19,62 @@ func init() {
 	})
 }
 
-func profileLayerDecode(d *decode.D, prefix string, profilePresent bool, levelPresent bool, isSublayer bool) {
+// A.3 Profiles
+var hevcProfileNames = scalar.UToSymStr{
+	1:  "main",
+	2:  "main_10",
+	3:  "main_still_picture",
+	4:  "format_range_extensions",
+	5:  "high_throughput",
+	6:  "multiview_main",
+	7:  "scalable_main",
+	8:  "3d_main",
+	9:  "screen_content_coding",
+	10: "scalable_format_range_extensions",
+	11: "high_throughput_screen_content_coding",
+}
+
+var hevcTierNames = scalar.UToSymStr{
+	0: "main",
+	1: "high",
+}
+
+// level_idc is 30 times the level number
+func hevcLevelName(levelIdc uint64) string {
+	if levelIdc%30 == 0 {
+		return fmt.Sprintf("%d", levelIdc/30)
+	}
+	return fmt.Sprintf("%d.%d", levelIdc/30, (levelIdc%30)/3)
+}
+
+var hevcLevelSym = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	s.Sym = hevcLevelName(s.ActualU())
+	return s, nil
+})
+
+type hevcProfileLayer struct {
+	profileIdc        uint64
+	tierFlag          uint64
+	levelIdc          uint64
+	progressiveSource bool
+	interlacedSource  bool
+}
+
+func profileLayerDecode(d *decode.D, prefix string, profilePresent bool, levelPresent bool, isSublayer bool) hevcProfileLayer {
+	var pl hevcProfileLayer
 	if profilePresent {
 		d.FieldU2(prefix + "profile_space")
-		d.FieldU1(prefix + "tier_flag")
-		generalProfileIdc := d.FieldU5(prefix + "profile_idc")
+		pl.tierFlag = d.FieldU1(prefix+"tier_flag", hevcTierNames)
+		generalProfileIdc := d.FieldU5(prefix+"profile_idc", hevcProfileNames)
+		pl.profileIdc = generalProfileIdc
 		var generalProfileCompatibilityFlags [32]bool
 		d.FieldArray(prefix+"profile_compatibility_flags", func(d *decode.D) {
 			for j := 0; j < 32; j++ {
 				generalProfileCompatibilityFlags[j] = d.FieldBool(prefix + "profile_compatibility_flag")
 			}
 		})
-		d.FieldBool(prefix + "progressive_source_flag")
-		d.FieldBool(prefix + "interlaced_source_flag")
+		pl.progressiveSource = d.FieldBool(prefix + "progressive_source_flag")
+		pl.interlacedSource = d.FieldBool(prefix + "interlaced_source_flag")
 		d.FieldBool(prefix + "non_packed_constraint_flag")
 		d.FieldBool(prefix + "frame_only_constraint_flag")
 		if generalProfileIdc == 4 || generalProfileCompatibilityFlags[4] ||
@@ -70,13 +116,15 @@ func profileLayerDecode(d *decode.D, prefix string, profilePresent bool, levelPr
 		}
 	}
 	if levelPresent {
-		d.FieldU8(prefix + "level_idc")
+		pl.levelIdc = d.FieldU8(prefix+"level_idc", hevcLevelSym)
 	}
+
+	return pl
 }
 
 // H.265 page 41
-func profileTierLevelDecode(d *decode.D, profilePresentFlag bool, maxNumSubLayersMinus1 uint64) {
-	profileLayerDecode(d, "general_", profilePresentFlag, true, false)
+func profileTierLevelDecode(d *decode.D, profilePresentFlag bool, maxNumSubLayersMinus1 uint64) hevcProfileLayer {
+	general := profileLayerDecode(d, "general_", profilePresentFlag, true, false)
 	subLayerProfilePresentFlags := make([]bool, maxNumSubLayersMinus1)
 	subLayerLevelPresentFlags := make([]bool, maxNumSubLayersMinus1)
 	d.FieldArray("sub_layer_presents", func(d *decode.D) {
@@ -101,6 +149,8 @@ func profileTierLevelDecode(d *decode.D, profilePresentFlag bool, maxNumSubLayer
 			})
 		}
 	})
+
+	return general
 }
 
 func hevcSubLayerHrdParameters(d *decode.D, subPicHrdParamsPresentFlag bool, cpbCntMinus1 int) {
@@ -171,7 +221,104 @@ func hevcHrdParameters(d *decode.D, commonInfPresentFlag bool, maxNumSubLayersMi
 	})
 }
 
-func hevcVuiParameters(d *decode.D, spsMaxSubLayersMinus1 uint64) {
+// 7.3.4 Scaling list data syntax
+func hevcScalingListData(d *decode.D) {
+	d.FieldArray("scaling_lists", func(d *decode.D) {
+		for sizeID := 0; sizeID < 4; sizeID++ {
+			matrixIDStep := 1
+			if sizeID == 3 {
+				matrixIDStep = 3
+			}
+			for matrixID := 0; matrixID < 6; matrixID += matrixIDStep {
+				d.FieldStruct("scaling_list", func(d *decode.D) {
+					d.FieldValueU("size_id", uint64(sizeID))
+					d.FieldValueU("matrix_id", uint64(matrixID))
+					scalingListPredModeFlag := d.FieldBool("scaling_list_pred_mode_flag")
+					if !scalingListPredModeFlag {
+						d.FieldUFn("scaling_list_pred_matrix_id_delta", uEV)
+						return
+					}
+					coefNum := 64
+					if n := 1 << (4 + (sizeID << 1)); n < coefNum {
+						coefNum = n
+					}
+					if sizeID > 1 {
+						d.FieldSFn("scaling_list_dc_coef_minus8", sEV)
+					}
+					d.FieldArray("scaling_list_delta_coefs", func(d *decode.D) {
+						for i := 0; i < coefNum; i++ {
+							d.FieldSFn("scaling_list_delta_coef", sEV)
+						}
+					})
+				})
+			}
+		}
+	})
+}
+
+// 7.3.7 Short-term reference picture set syntax, returns NumDeltaPocs
+func hevcStRefPicSet(d *decode.D, stRpsIdx uint64, numShortTermRefPicSets uint64, numDeltaPocs []uint64) uint64 {
+	var interRefPicSetPredictionFlag bool
+	if stRpsIdx != 0 {
+		interRefPicSetPredictionFlag = d.FieldBool("inter_ref_pic_set_prediction_flag")
+	}
+	if interRefPicSetPredictionFlag {
+		deltaIdxMinus1 := uint64(0)
+		if stRpsIdx == numShortTermRefPicSets {
+			deltaIdxMinus1 = d.FieldUFn("delta_idx_minus1", uEV)
+		}
+		d.FieldBool("delta_rps_sign")
+		d.FieldUFn("abs_delta_rps_minus1", uEV)
+		refRpsIdx := stRpsIdx - (deltaIdxMinus1 + 1)
+		if refRpsIdx >= uint64(len(numDeltaPocs)) {
+			d.Fatalf("invalid reference rps index %d", refRpsIdx)
+		}
+		var n uint64
+		d.FieldArray("delta_pocs", func(d *decode.D) {
+			for j := uint64(0); j <= numDeltaPocs[refRpsIdx]; j++ {
+				d.FieldStruct("delta_poc", func(d *decode.D) {
+					usedByCurrPicFlag := d.FieldBool("used_by_curr_pic_flag")
+					useDeltaFlag := true
+					if !usedByCurrPicFlag {
+						useDeltaFlag = d.FieldBool("use_delta_flag")
+					}
+					if usedByCurrPicFlag || useDeltaFlag {
+						n++
+					}
+				})
+			}
+		})
+		return n
+	}
+
+	numNegativePics := d.FieldUFn("num_negative_pics", uEV)
+	numPositivePics := d.FieldUFn("num_positive_pics", uEV)
+	d.FieldArray("negative_pics", func(d *decode.D) {
+		for i := uint64(0); i < numNegativePics; i++ {
+			d.FieldStruct("negative_pic", func(d *decode.D) {
+				d.FieldUFn("delta_poc_s0_minus1", uEV)
+				d.FieldBool("used_by_curr_pic_s0_flag")
+			})
+		}
+	})
+	d.FieldArray("positive_pics", func(d *decode.D) {
+		for i := uint64(0); i < numPositivePics; i++ {
+			d.FieldStruct("positive_pic", func(d *decode.D) {
+				d.FieldUFn("delta_poc_s1_minus1", uEV)
+				d.FieldBool("used_by_curr_pic_s1_flag")
+			})
+		}
+	})
+	return numNegativePics + numPositivePics
+}
+
+type hevcVui struct {
+	fieldSeq bool
+	timing   videoTiming
+}
+
+func hevcVuiParameters(d *decode.D, spsMaxSubLayersMinus1 uint64) hevcVui {
+	var vui hevcVui
 	aspectRatioInfoPresentFlag := d.FieldBool("aspect_ratio_info_present_flag")
 	if aspectRatioInfoPresentFlag {
 		aspectRatioIdc := d.FieldU8("aspect_ratio_idc", avcAspectRatioIdcMap)
@@ -203,7 +350,7 @@ func hevcVuiParameters(d *decode.D, spsMaxSubLayersMinus1 uint64) {
 	}
 
 	d.FieldBool("neutral_chroma_indication_flag")
-	d.FieldBool("field_seq_flag")
+	vui.fieldSeq = d.FieldBool("field_seq_flag")
 	d.FieldBool("frame_field_info_present_flag")
 	defaultDisplayWindowFlag := d.FieldBool("default_display_window_flag")
 	if defaultDisplayWindowFlag {
@@ -215,8 +362,9 @@ func hevcVuiParameters(d *decode.D, spsMaxSubLayersMinus1 uint64) {
 
 	vuiTimingInfoPresentFlag := d.FieldBool("vui_timing_info_present_flag")
 	if vuiTimingInfoPresentFlag {
-		d.FieldU32("vui_num_units_in_tick")
-		d.FieldU32("vui_time_scale")
+		vui.timing.present = true
+		vui.timing.numUnitsInTick = d.FieldU32("vui_num_units_in_tick")
+		vui.timing.timeScale = d.FieldU32("vui_time_scale")
 		vuiPocProportionalToTimingFlag := d.FieldBool("vui_poc_proportional_to_timing_flag")
 		if vuiPocProportionalToTimingFlag {
 			d.FieldUFn("vui_num_ticks_poc_diff_one_minus1", uEV)
@@ -238,6 +386,8 @@ func hevcVuiParameters(d *decode.D, spsMaxSubLayersMinus1 uint64) {
 		d.FieldUFn("log2_max_mv_length_horizontal", uEV)
 		d.FieldUFn("log2_max_mv_length_vertical", uEV)
 	}
+
+	return vui
 }
 
 // H.265 page 34
@@ -245,24 +395,26 @@ func hevcSPSDecode(d *decode.D, _ any) any {
 	d.FieldU4("sps_video_parameter_set_id")
 	spsMaxSubLayersMinus1 := d.FieldU3("sps_max_sub_layers_minus1")
 	d.FieldBool("sps_temporal_id_nesting_flag")
-	profileTierLevelDecode(d, true, spsMaxSubLayersMinus1)
-	d.FieldUFn("sps_seq_parameter_set_id", uEV)
+	general := profileTierLevelDecode(d, true, spsMaxSubLayersMinus1)
+	spsID := d.FieldUFn("sps_seq_parameter_set_id", uEV)
 	chromaFormatIdc := d.FieldUFn("chroma_format_idc", uEV, chromaFormatMap)
+	separateColourPlaneFlag := false
 	if chromaFormatIdc == 3 {
-		d.FieldBool("separate_colour_plane_flag")
+		separateColourPlaneFlag = d.FieldBool("separate_colour_plane_flag")
 	}
-	d.FieldUFn("pic_width_in_luma_samples", uEV)
-	d.FieldUFn("pic_height_in_luma_samples", uEV)
+	picWidth := d.FieldUFn("pic_width_in_luma_samples", uEV)
+	picHeight := d.FieldUFn("pic_height_in_luma_samples", uEV)
+	var confLeft, confRight, confTop, confBottom uint64
 	conformanceWindowFlag := d.FieldBool("conformance_window_flag")
 	if conformanceWindowFlag {
-		d.FieldUFn("conf_win_left_offset", uEV)
-		d.FieldUFn("conf_win_right_offset", uEV)
-		d.FieldUFn("conf_win_top_offset", uEV)
-		d.FieldUFn("conf_win_bottom_offset", uEV)
+		confLeft = d.FieldUFn("conf_win_left_offset", uEV)
+		confRight = d.FieldUFn("conf_win_right_offset", uEV)
+		confTop = d.FieldUFn("conf_win_top_offset", uEV)
+		confBottom = d.FieldUFn("conf_win_bottom_offset", uEV)
 	}
-	d.FieldUFn("bit_depth_luma_minus8", uEV)
-	d.FieldUFn("bit_depth_chroma_minus8", uEV)
-	d.FieldUFn("log2_max_pic_order_cnt_lsb_minus4", uEV)
+	bitDepthLumaMinus8 := d.FieldUFn("bit_depth_luma_minus8", uEV)
+	bitDepthChromaMinus8 := d.FieldUFn("bit_depth_chroma_minus8", uEV)
+	log2MaxPicOrderCntLsbMinus4 := d.FieldUFn("log2_max_pic_order_cnt_lsb_minus4", uEV)
 	spsSubLayerOrderingInfoPresentFlag := d.FieldBool("sps_sub_layer_ordering_info_present_flag")
 	d.FieldArray("sps_sub_layer_ordering_infos", func(d *decode.D) {
 		i := spsMaxSubLayersMinus1
@@ -287,8 +439,7 @@ func hevcSPSDecode(d *decode.D, _ any) any {
 	if scalingListEnabledFlag {
 		spsScalingListDataPresentFlag := d.FieldBool("sps_scaling_list_data_present_flag")
 		if spsScalingListDataPresentFlag {
-			// TODO: scaling_list_data
-			return nil
+			hevcScalingListData(d)
 		}
 	}
 	d.FieldBool("amp_enabled_flag")
@@ -302,20 +453,36 @@ func hevcSPSDecode(d *decode.D, _ any) any {
 		d.FieldBool("pcm_loop_filter_disabled_flag")
 	}
 	numShortTermRefPicSets := d.FieldUFn("num_short_term_ref_pic_sets", uEV)
-	if numShortTermRefPicSets > 0 {
-		// TODO
-		return nil
+	const maxShortTermRefPicSets = 64
+	if numShortTermRefPicSets > maxShortTermRefPicSets {
+		d.Fatalf("num_short_term_ref_pic_sets %d larger than %d", numShortTermRefPicSets, maxShortTermRefPicSets)
 	}
+	numDeltaPocs := make([]uint64, 0, numShortTermRefPicSets)
+	d.FieldArray("st_ref_pic_sets", func(d *decode.D) {
+		for i := uint64(0); i < numShortTermRefPicSets; i++ {
+			d.FieldStruct("st_ref_pic_set", func(d *decode.D) {
+				numDeltaPocs = append(numDeltaPocs, hevcStRefPicSet(d, i, numShortTermRefPicSets, numDeltaPocs))
+			})
+		}
+	})
 	longTermRefPicsPresentFlag := d.FieldBool("long_term_ref_pics_present_flag")
 	if longTermRefPicsPresentFlag {
-		// TODO
-		return nil
+		numLongTermRefPicsSps := d.FieldUFn("num_long_term_ref_pics_sps", uEV)
+		d.FieldArray("long_term_ref_pics", func(d *decode.D) {
+			for i := uint64(0); i < numLongTermRefPicsSps; i++ {
+				d.FieldStruct("long_term_ref_pic", func(d *decode.D) {
+					d.FieldU("lt_ref_pic_poc_lsb_sps", int(log2MaxPicOrderCntLsbMinus4+4))
+					d.FieldBool("used_by_curr_pic_lt_sps_flag")
+				})
+			}
+		})
 	}
 	d.FieldBool("sps_temporal_mvp_enabled_flag")
 	d.FieldBool("strong_intra_smoothing_enabled_flag")
+	var vui hevcVui
 	vuiParametersPresentFlag := d.FieldBool("vui_parameters_present_flag")
 	if vuiParametersPresentFlag {
-		d.FieldStruct("vui_parameters", func(d *decode.D) { hevcVuiParameters(d, spsMaxSubLayersMinus1) })
+		d.FieldStruct("vui_parameters", func(d *decode.D) { vui = hevcVuiParameters(d, spsMaxSubLayersMinus1) })
 	}
 	spsExtensionPresentFlag := d.FieldBool("sps_extension_present_flag")
 	if spsExtensionPresentFlag {
@@ -328,5 +495,30 @@ func hevcSPSDecode(d *decode.D, _ any) any {
 
 	// TODO
 
-	return nil
+	// 7.4.3.2.1 conformance window offsets are in chroma sample units
+	chromaArrayType := chromaFormatIdc
+	if separateColourPlaneFlag {
+		chromaArrayType = 0
+	}
+	subWidthC, subHeightC := chromaSubsampling(chromaArrayType)
+	vi := format.VideoInfo{
+		SeqParameterSetID: spsID,
+		Profile:           symOrNumber(hevcProfileNames, general.profileIdc),
+		Level:             hevcLevelName(general.levelIdc),
+		Tier:              hevcTierNames[general.tierFlag],
+		ChromaFormat:      symOrNumber(chromaFormatMap, chromaFormatIdc),
+		BitDepthLuma:      bitDepthLumaMinus8 + 8,
+		BitDepthChroma:    bitDepthChromaMinus8 + 8,
+		CodedWidth:        picWidth,
+		CodedHeight:       picHeight,
+		DisplayWidth:      croppedSize(picWidth, subWidthC*(confLeft+confRight)),
+		DisplayHeight:     croppedSize(picHeight, subHeightC*(confTop+confBottom)),
+		Interlaced:        vui.fieldSeq || (general.interlacedSource && !general.progressiveSource),
+	}
+	if vui.timing.present && vui.timing.numUnitsInTick != 0 {
+		vi.HasTiming = true
+		vi.FrameRate = float64(vui.timing.timeScale) / float64(vui.timing.numUnitsInTick)
+	}
+
+	return format.HevcSpsOut{VideoInfo: vi}
 }
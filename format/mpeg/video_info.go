@@ -0,0 +1,94 @@
+package mpeg
+
+import (
+	"fmt"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+// SubWidthC and SubHeightC for ChromaArrayType, H.264 table 6-1 and H.265 table 6-1
+func chromaSubsampling(chromaArrayType uint64) (uint64, uint64) {
+	switch chromaArrayType {
+	case 1:
+		return 2, 2
+	case 2:
+		return 2, 1
+	default:
+		return 1, 1
+	}
+}
+
+func croppedSize(size uint64, crop uint64) uint64 {
+	if crop > size {
+		return 0
+	}
+	return size - crop
+}
+
+func symOrNumber(m scalar.UToSymStr, v uint64) string {
+	if s, ok := m[v]; ok {
+		return s
+	}
+	return fmt.Sprintf("%d", v)
+}
+
+// videoInfos collects distinct stream properties from sequence parameter sets
+type videoInfos struct {
+	infos     []format.VideoInfo
+	latest    int
+	active    int
+	seenSlice bool
+}
+
+func (vis *videoInfos) sps(vi format.VideoInfo) {
+	for i, e := range vis.infos {
+		if e == vi {
+			vis.latest = i
+			return
+		}
+	}
+	vis.infos = append(vis.infos, vi)
+	vis.latest = len(vis.infos) - 1
+}
+
+// slice uses the most recent sequence parameter set
+func (vis *videoInfos) slice() {
+	if len(vis.infos) > 0 {
+		vis.active = vis.latest
+		vis.seenSlice = true
+	}
+}
+
+// fieldVideoInfos adds a video_info struct for each sequence parameter set with distinct values.
+// Active is the one used by the last slice, or the last one seen if there are no slices.
+func fieldVideoInfos(d *decode.D, vis *videoInfos) {
+	active := vis.active
+	if !vis.seenSlice {
+		active = vis.latest
+	}
+	for i, vi := range vis.infos {
+		d.FieldStruct("video_info", func(d *decode.D) {
+			d.FieldValueU("seq_parameter_set_id", vi.SeqParameterSetID)
+			d.FieldValueStr("profile", vi.Profile)
+			d.FieldValueStr("level", vi.Level)
+			if vi.Tier != "" {
+				d.FieldValueStr("tier", vi.Tier)
+			}
+			d.FieldValueStr("chroma_format", vi.ChromaFormat)
+			d.FieldValueU("bit_depth_luma", vi.BitDepthLuma)
+			d.FieldValueU("bit_depth_chroma", vi.BitDepthChroma)
+			d.FieldValueU("coded_width", vi.CodedWidth)
+			d.FieldValueU("coded_height", vi.CodedHeight)
+			d.FieldValueU("display_width", vi.DisplayWidth)
+			d.FieldValueU("display_height", vi.DisplayHeight)
+			d.FieldValueBool("interlaced", vi.Interlaced)
+			d.FieldValueBool("timing_info_present", vi.HasTiming)
+			if vi.HasTiming {
+				d.FieldValueFloat("frame_rate", vi.FrameRate)
+			}
+			d.FieldValueBool("active", i == active)
+		})
+	}
+}
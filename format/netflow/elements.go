@@ -0,0 +1,128 @@
+package netflow
+
+import "github.com/wader/fq/pkg/scalar"
+
+type elementType int
+
+const (
+	typeOctets elementType = iota
+	typeUnsigned
+	typeIPv4
+	typeIPv6
+	typeMAC
+	typeString
+	typeSeconds
+	typeMilliseconds
+)
+
+type element struct {
+	name string
+	typ  elementType
+}
+
+// IANA IPFIX information elements, element ids 1-127 are same as NetFlow v9 field types
+var elements = map[uint64]element{
+	1:   {"octet_delta_count", typeUnsigned},
+	2:   {"packet_delta_count", typeUnsigned},
+	3:   {"delta_flow_count", typeUnsigned},
+	4:   {"protocol_identifier", typeUnsigned},
+	5:   {"ip_class_of_service", typeUnsigned},
+	6:   {"tcp_control_bits", typeUnsigned},
+	7:   {"source_transport_port", typeUnsigned},
+	8:   {"source_ipv4_address", typeIPv4},
+	9:   {"source_ipv4_prefix_length", typeUnsigned},
+	10:  {"ingress_interface", typeUnsigned},
+	11:  {"destination_transport_port", typeUnsigned},
+	12:  {"destination_ipv4_address", typeIPv4},
+	13:  {"destination_ipv4_prefix_length", typeUnsigned},
+	14:  {"egress_interface", typeUnsigned},
+	15:  {"ip_next_hop_ipv4_address", typeIPv4},
+	16:  {"bgp_source_as_number", typeUnsigned},
+	17:  {"bgp_destination_as_number", typeUnsigned},
+	18:  {"bgp_next_hop_ipv4_address", typeIPv4},
+	19:  {"post_mcast_packet_delta_count", typeUnsigned},
+	20:  {"post_mcast_octet_delta_count", typeUnsigned},
+	21:  {"flow_end_sys_up_time", typeUnsigned},
+	22:  {"flow_start_sys_up_time", typeUnsigned},
+	23:  {"post_octet_delta_count", typeUnsigned},
+	24:  {"post_packet_delta_count", typeUnsigned},
+	25:  {"minimum_ip_total_length", typeUnsigned},
+	26:  {"maximum_ip_total_length", typeUnsigned},
+	27:  {"source_ipv6_address", typeIPv6},
+	28:  {"destination_ipv6_address", typeIPv6},
+	29:  {"source_ipv6_prefix_length", typeUnsigned},
+	30:  {"destination_ipv6_prefix_length", typeUnsigned},
+	31:  {"flow_label_ipv6", typeUnsigned},
+	32:  {"icmp_type_code_ipv4", typeUnsigned},
+	33:  {"igmp_type", typeUnsigned},
+	34:  {"sampling_interval", typeUnsigned},
+	35:  {"sampling_algorithm", typeUnsigned},
+	36:  {"flow_active_timeout", typeUnsigned},
+	37:  {"flow_idle_timeout", typeUnsigned},
+	38:  {"engine_type", typeUnsigned},
+	39:  {"engine_id", typeUnsigned},
+	40:  {"exported_octet_total_count", typeUnsigned},
+	41:  {"exported_message_total_count", typeUnsigned},
+	42:  {"exported_flow_record_total_count", typeUnsigned},
+	44:  {"source_ipv4_prefix", typeIPv4},
+	45:  {"destination_ipv4_prefix", typeIPv4},
+	46:  {"mpls_top_label_type", typeUnsigned},
+	47:  {"mpls_top_label_ipv4_address", typeIPv4},
+	52:  {"minimum_ttl", typeUnsigned},
+	53:  {"maximum_ttl", typeUnsigned},
+	54:  {"fragment_identification", typeUnsigned},
+	55:  {"post_ip_class_of_service", typeUnsigned},
+	56:  {"source_mac_address", typeMAC},
+	57:  {"post_destination_mac_address", typeMAC},
+	58:  {"vlan_id", typeUnsigned},
+	59:  {"post_vlan_id", typeUnsigned},
+	60:  {"ip_version", typeUnsigned},
+	61:  {"flow_direction", typeUnsigned},
+	62:  {"ip_next_hop_ipv6_address", typeIPv6},
+	63:  {"bgp_next_hop_ipv6_address", typeIPv6},
+	64:  {"ipv6_extension_headers", typeUnsigned},
+	70:  {"mpls_top_label_stack_section", typeOctets},
+	80:  {"destination_mac_address", typeMAC},
+	81:  {"post_source_mac_address", typeMAC},
+	82:  {"interface_name", typeString},
+	83:  {"interface_description", typeString},
+	85:  {"octet_total_count", typeUnsigned},
+	86:  {"packet_total_count", typeUnsigned},
+	88:  {"fragment_offset", typeUnsigned},
+	89:  {"forwarding_status", typeUnsigned},
+	95:  {"application_id", typeOctets},
+	96:  {"application_name", typeString},
+	136: {"flow_end_reason", typeUnsigned},
+	148: {"flow_id", typeUnsigned},
+	149: {"observation_domain_id", typeUnsigned},
+	150: {"flow_start_seconds", typeSeconds},
+	151: {"flow_end_seconds", typeSeconds},
+	152: {"flow_start_milliseconds", typeMilliseconds},
+	153: {"flow_end_milliseconds", typeMilliseconds},
+	160: {"system_init_time_milliseconds", typeMilliseconds},
+	176: {"icmp_type_ipv4", typeUnsigned},
+	177: {"icmp_code_ipv4", typeUnsigned},
+	178: {"icmp_type_ipv6", typeUnsigned},
+	179: {"icmp_code_ipv6", typeUnsigned},
+	180: {"udp_source_port", typeUnsigned},
+	181: {"udp_destination_port", typeUnsigned},
+	182: {"tcp_source_port", typeUnsigned},
+	183: {"tcp_destination_port", typeUnsigned},
+	184: {"tcp_sequence_number", typeUnsigned},
+	185: {"tcp_acknowledgement_number", typeUnsigned},
+	186: {"tcp_window_size", typeUnsigned},
+	192: {"ip_ttl", typeUnsigned},
+	210: {"padding_octets", typeOctets},
+	225: {"post_nat_source_ipv4_address", typeIPv4},
+	226: {"post_nat_destination_ipv4_address", typeIPv4},
+	227: {"post_napt_source_transport_port", typeUnsigned},
+	228: {"post_napt_destination_transport_port", typeUnsigned},
+}
+
+var elementNames = scalar.UToSymStr{}
+
+func init() {
+	for id, e := range elements {
+		elementNames[id] = e.name
+	}
+}
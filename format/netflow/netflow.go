@@ -0,0 +1,435 @@
+package netflow
+
+// https://www.cisco.com/c/en/us/td/docs/net_mgmt/netflow_collection_engine/3-6/user/guide/format.html v5
+// https://www.rfc-editor.org/rfc/rfc3954 NetFlow v9
+// https://www.rfc-editor.org/rfc/rfc7011 IPFIX
+// https://www.iana.org/assignments/ipfix/ipfix.xhtml
+
+// TODO: enterprise specific elements
+// TODO: structured data types (basicList etc)
+
+import (
+	"bytes"
+	"embed"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/internal/bitioextra"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+//go:embed netflow.jq
+var netflowFS embed.FS
+
+func init() {
+	interp.RegisterFormat(decode.Format{
+		Name:        format.NETFLOW,
+		Description: "NetFlow v5, v9 and IPFIX flow export",
+		Groups:      []string{format.UDP_PAYLOAD},
+		DecodeFn:    netflowDecode,
+		Functions:   []string{"_help"},
+	})
+	interp.RegisterFS(netflowFS)
+}
+
+const (
+	versionV5    = 5
+	versionV9    = 9
+	versionIPFIX = 10
+)
+
+var versionNames = scalar.UToSymStr{
+	versionV5:    "v5",
+	versionV9:    "v9",
+	versionIPFIX: "ipfix",
+}
+
+const (
+	setV9Template             = 0
+	setV9OptionsTemplate      = 1
+	setIPFIXTemplate          = 2
+	setIPFIXOptionsTemplate   = 3
+	setDataMin                = 256
+	ipfixVariableLength       = 65535
+	ipfixVariableLengthLong   = 255
+	v5RecordLength            = 48
+	setHeaderLength           = 4
+	templateFieldSpecifierLen = 4
+)
+
+var v9SetNames = scalar.UToSymStr{
+	setV9Template:        "template",
+	setV9OptionsTemplate: "options_template",
+}
+
+var ipfixSetNames = scalar.UToSymStr{
+	setIPFIXTemplate:        "template",
+	setIPFIXOptionsTemplate: "options_template",
+}
+
+// v9 options template scope field types
+var v9ScopeNames = scalar.UToSymStr{
+	1: "system",
+	2: "interface",
+	3: "line_card",
+	4: "cache",
+	5: "template",
+}
+
+var samplingModeNames = scalar.UToSymStr{
+	0: "none",
+	1: "deterministic",
+	2: "random",
+}
+
+var mapUToIPv4Sym = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], uint32(s.ActualU()))
+	s.Sym = net.IP(b[:]).String()
+	return s, nil
+})
+
+var mapIPv6Sym = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	b := &bytes.Buffer{}
+	if _, err := bitioextra.CopyBits(b, s.ActualBitBuf()); err != nil {
+		return s, err
+	}
+	s.Sym = net.IP(b.Bytes()).String()
+	return s, nil
+})
+
+var mapUToMACSym = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], s.ActualU())
+	s.Sym = fmt.Sprintf("%.2x:%.2x:%.2x:%.2x:%.2x:%.2x", b[2], b[3], b[4], b[5], b[6], b[7])
+	return s, nil
+})
+
+var mapUnixSecondsSym = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	s.Sym = time.Unix(int64(s.ActualU()), 0).UTC().Format(time.RFC3339)
+	return s, nil
+})
+
+var mapUnixMillisecondsSym = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	s.Sym = time.UnixMilli(int64(s.ActualU())).UTC().Format(time.RFC3339Nano)
+	return s, nil
+})
+
+// template field specifier
+type templateField struct {
+	id         uint64
+	length     uint64
+	enterprise uint64
+	scope      bool
+}
+
+// templates seen so far in all packets of a capture
+type templateKey struct {
+	exporter string
+	version  uint64
+	domain   uint64
+	id       uint64
+}
+
+type templates map[templateKey][]templateField
+
+func fieldSpecifier(d *decode.D, version uint64, scope bool) templateField {
+	var f templateField
+	f.scope = scope
+	d.FieldStruct("field", func(d *decode.D) {
+		switch {
+		case version == versionV9 && scope:
+			f.id = d.FieldU16("type", v9ScopeNames)
+		case version == versionV9:
+			f.id = d.FieldU16("type", elementNames)
+		default:
+			// enterprise specific element ids are not IANA element ids
+			if d.FieldBool("enterprise") {
+				f.id = d.FieldU15("element_id")
+				f.length = d.FieldU16("length")
+				f.enterprise = d.FieldU32("enterprise_number")
+				return
+			}
+			f.id = d.FieldU15("element_id", elementNames)
+		}
+		f.length = d.FieldU16("length")
+	})
+	return f
+}
+
+func templateSetDecode(d *decode.D, version uint64, key templateKey, tmpls templates) {
+	d.FieldArray("templates", func(d *decode.D) {
+		for d.BitsLeft() >= 4*8 {
+			d.FieldStruct("template", func(d *decode.D) {
+				key.id = d.FieldU16("template_id")
+				fieldCount := d.FieldU16("field_count")
+				// ipfix template withdrawal
+				if fieldCount == 0 {
+					delete(tmpls, key)
+					return
+				}
+				if int64(fieldCount)*templateFieldSpecifierLen*8 > d.BitsLeft() {
+					d.Fatalf("field_count %d outside set", fieldCount)
+				}
+				var fields []templateField
+				d.FieldArray("fields", func(d *decode.D) {
+					for i := uint64(0); i < fieldCount; i++ {
+						fields = append(fields, fieldSpecifier(d, version, false))
+					}
+				})
+				tmpls[key] = fields
+			})
+		}
+	})
+	if d.BitsLeft() > 0 {
+		d.FieldRawLen("padding", d.BitsLeft())
+	}
+}
+
+func optionsTemplateSetDecode(d *decode.D, version uint64, key templateKey, tmpls templates) {
+	d.FieldArray("templates", func(d *decode.D) {
+		for d.BitsLeft() >= 6*8 {
+			d.FieldStruct("template", func(d *decode.D) {
+				key.id = d.FieldU16("template_id")
+				var scopeCount, fieldCount uint64
+				if version == versionV9 {
+					// lengths in bytes of scope and option field specifiers
+					scopeCount = d.FieldU16("option_scope_length") / templateFieldSpecifierLen
+					fieldCount = scopeCount + d.FieldU16("option_length")/templateFieldSpecifierLen
+				} else {
+					fieldCount = d.FieldU16("field_count")
+					scopeCount = d.FieldU16("scope_field_count")
+					if fieldCount == 0 {
+						delete(tmpls, key)
+						return
+					}
+					if scopeCount == 0 || scopeCount > fieldCount {
+						d.Fatalf("invalid scope_field_count %d", scopeCount)
+					}
+				}
+				if int64(fieldCount)*templateFieldSpecifierLen*8 > d.BitsLeft() {
+					d.Fatalf("field count %d outside set", fieldCount)
+				}
+				var fields []templateField
+				d.FieldArray("scope_fields", func(d *decode.D) {
+					for i := uint64(0); i < scopeCount; i++ {
+						fields = append(fields, fieldSpecifier(d, version, true))
+					}
+				})
+				d.FieldArray("fields", func(d *decode.D) {
+					for i := scopeCount; i < fieldCount; i++ {
+						fields = append(fields, fieldSpecifier(d, version, false))
+					}
+				})
+				tmpls[key] = fields
+			})
+		}
+	})
+	if d.BitsLeft() > 0 {
+		d.FieldRawLen("padding", d.BitsLeft())
+	}
+}
+
+func dataFieldDecode(d *decode.D, version uint64, f templateField) {
+	e, ok := elements[f.id]
+	var name string
+	switch {
+	case f.enterprise != 0:
+		name = fmt.Sprintf("enterprise_%d_%d", f.enterprise, f.id)
+		e = element{}
+	case version == versionV9 && f.scope:
+		name = "scope_" + v9ScopeNames[f.id]
+		if _, ok := v9ScopeNames[f.id]; !ok {
+			name = fmt.Sprintf("scope_%d", f.id)
+		}
+		e = element{typ: typeUnsigned}
+	case ok:
+		name = e.name
+	default:
+		name = fmt.Sprintf("element_%d", f.id)
+		e = element{typ: typeUnsigned}
+	}
+
+	length := f.length
+	if length == ipfixVariableLength {
+		length = d.FieldU8(name + "_length")
+		if length == ipfixVariableLengthLong {
+			length = d.FieldU16(name + "_length_long")
+		}
+	}
+
+	nBits := int64(length) * 8
+	switch {
+	case e.typ == typeIPv4 && length == 4:
+		d.FieldU32(name, mapUToIPv4Sym, scalar.ActualHex)
+	case e.typ == typeIPv6 && length == 16:
+		d.FieldRawLen(name, nBits, mapIPv6Sym)
+	case e.typ == typeMAC && length == 6:
+		d.FieldU48(name, mapUToMACSym, scalar.ActualHex)
+	case e.typ == typeString:
+		d.FieldUTF8NullFixedLen(name, int(length))
+	case e.typ == typeSeconds && length == 4:
+		d.FieldU32(name, mapUnixSecondsSym)
+	case e.typ == typeMilliseconds && length == 8:
+		d.FieldU64(name, mapUnixMillisecondsSym)
+	case (e.typ == typeUnsigned || e.typ == typeSeconds || e.typ == typeMilliseconds) && length >= 1 && length <= 8:
+		// reduced size encoding allows shorter unsigned values
+		d.FieldU(name, int(nBits))
+	default:
+		d.FieldRawLen(name, nBits)
+	}
+}
+
+func dataSetDecode(d *decode.D, version uint64, fields []templateField) {
+	var minLen int64
+	for _, f := range fields {
+		if f.length == ipfixVariableLength {
+			minLen++
+		} else {
+			minLen += int64(f.length)
+		}
+	}
+	if minLen == 0 {
+		d.Fatalf("template has zero length records")
+	}
+
+	d.FieldArray("records", func(d *decode.D) {
+		for d.BitsLeft() >= minLen*8 {
+			d.FieldStruct("record", func(d *decode.D) {
+				for _, f := range fields {
+					dataFieldDecode(d, version, f)
+				}
+			})
+		}
+	})
+	if d.BitsLeft() > 0 {
+		d.FieldRawLen("padding", d.BitsLeft())
+	}
+}
+
+func setsDecode(d *decode.D, version uint64, exporter string, domain uint64) {
+	tmpls := d.SharedState("netflow_templates", func() any { return templates{} }).(templates)
+	key := templateKey{exporter: exporter, version: version, domain: domain}
+
+	setNames := ipfixSetNames
+	templateID, optionsTemplateID := uint64(setIPFIXTemplate), uint64(setIPFIXOptionsTemplate)
+	if version == versionV9 {
+		setNames = v9SetNames
+		templateID, optionsTemplateID = setV9Template, setV9OptionsTemplate
+	}
+
+	d.FieldArray("sets", func(d *decode.D) {
+		for !d.End() {
+			d.FieldStruct("set", func(d *decode.D) {
+				setID := d.FieldU16("set_id", setNames)
+				length := d.FieldU16("length")
+				if length < setHeaderLength {
+					d.Fatalf("set length %d less than header", length)
+				}
+				d.FramedFn(int64(length-setHeaderLength)*8, func(d *decode.D) {
+					switch {
+					case setID == templateID:
+						templateSetDecode(d, version, key, tmpls)
+					case setID == optionsTemplateID:
+						optionsTemplateSetDecode(d, version, key, tmpls)
+					case setID >= setDataMin:
+						key.id = setID
+						fields, ok := tmpls[key]
+						if !ok {
+							// data before template, can't be decoded
+							d.FieldValueBool("missing_template", true)
+							d.FieldRawLen("data", d.BitsLeft())
+							return
+						}
+						dataSetDecode(d, version, fields)
+					default:
+						d.FieldRawLen("data", d.BitsLeft())
+					}
+				})
+			})
+		}
+	})
+}
+
+func v5Decode(d *decode.D) {
+	count := d.FieldU16("count")
+	d.FieldU32("sys_uptime")
+	d.FieldU32("unix_secs", mapUnixSecondsSym)
+	d.FieldU32("unix_nsecs")
+	d.FieldU32("flow_sequence")
+	d.FieldU8("engine_type")
+	d.FieldU8("engine_id")
+	d.FieldU2("sampling_mode", samplingModeNames)
+	d.FieldU14("sampling_interval")
+	if int64(count)*v5RecordLength*8 > d.BitsLeft() {
+		d.Fatalf("count %d records outside packet", count)
+	}
+
+	d.FieldArray("records", func(d *decode.D) {
+		for i := uint64(0); i < count; i++ {
+			d.FieldStruct("record", func(d *decode.D) {
+				d.FieldU32("srcaddr", mapUToIPv4Sym, scalar.ActualHex)
+				d.FieldU32("dstaddr", mapUToIPv4Sym, scalar.ActualHex)
+				d.FieldU32("nexthop", mapUToIPv4Sym, scalar.ActualHex)
+				d.FieldU16("input")
+				d.FieldU16("output")
+				d.FieldU32("d_pkts")
+				d.FieldU32("d_octets")
+				d.FieldU32("first")
+				d.FieldU32("last")
+				d.FieldU16("srcport")
+				d.FieldU16("dstport")
+				d.FieldU8("pad1")
+				d.FieldU8("tcp_flags")
+				d.FieldU8("prot", format.IPv4ProtocolMap)
+				d.FieldU8("tos")
+				d.FieldU16("src_as")
+				d.FieldU16("dst_as")
+				d.FieldU8("src_mask")
+				d.FieldU8("dst_mask")
+				d.FieldU16("pad2")
+			})
+		}
+	})
+}
+
+func netflowDecode(d *decode.D, in any) any {
+	var exporter string
+	if upi, ok := in.(format.UDPPayloadIn); ok {
+		upi.MustIsPort(d.Fatalf, format.UDPPortNetFlow, format.UDPPortIPFIX)
+		exporter = upi.SourceIP
+	}
+
+	version := d.FieldU16("version", versionNames)
+	switch version {
+	case versionV5:
+		v5Decode(d)
+	case versionV9:
+		d.FieldU16("count")
+		d.FieldU32("sys_uptime")
+		d.FieldU32("unix_secs", mapUnixSecondsSym)
+		d.FieldU32("sequence")
+		sourceID := d.FieldU32("source_id")
+		setsDecode(d, version, exporter, sourceID)
+	case versionIPFIX:
+		length := d.FieldU16("length")
+		d.FieldU32("export_time", mapUnixSecondsSym)
+		d.FieldU32("sequence")
+		domain := d.FieldU32("observation_domain_id")
+		if length < 16 || int64(length-16)*8 > d.BitsLeft() {
+			d.Fatalf("invalid length %d", length)
+		}
+		d.FramedFn(int64(length-16)*8, func(d *decode.D) {
+			setsDecode(d, version, exporter, domain)
+		})
+	default:
+		d.Fatalf("unsupported version %d", version)
+	}
+
+	return nil
+}
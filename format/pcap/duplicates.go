@@ -0,0 +1,56 @@
+package pcap
+
+import "hash/fnv"
+
+type duplicateKey struct {
+	hash   uint64
+	length int
+}
+
+// duplicates finds packets with same length and content as one of the last window packets,
+// usually caused by capturing both directions of a mirror port or on a bridge. Note that a
+// retransmission without any changed header field, ex ipv6 without ip id, is also a duplicate.
+type duplicates struct {
+	window  int
+	indexes map[duplicateKey]int64
+	ring    []duplicateKey
+	ringPos int
+	count   int64
+}
+
+func newDuplicates(window int64) *duplicates {
+	if window < 0 {
+		window = 0
+	}
+	return &duplicates{
+		window:  int(window),
+		indexes: map[duplicateKey]int64{},
+	}
+}
+
+// check returns index of earlier packet with same content if bs is a duplicate, otherwise
+// bs is added to the window
+func (dd *duplicates) check(packetIndex int64, bs []byte) (int64, bool) {
+	if dd.window == 0 {
+		return 0, false
+	}
+
+	h := fnv.New64a()
+	_, _ = h.Write(bs)
+	key := duplicateKey{hash: h.Sum64(), length: len(bs)}
+	if index, ok := dd.indexes[key]; ok {
+		dd.count++
+		return index, true
+	}
+
+	if len(dd.ring) < dd.window {
+		dd.ring = append(dd.ring, key)
+	} else {
+		delete(dd.indexes, dd.ring[dd.ringPos])
+		dd.ring[dd.ringPos] = key
+		dd.ringPos = (dd.ringPos + 1) % dd.window
+	}
+	dd.indexes[key] = packetIndex
+
+	return 0, false
+}
@@ -1,9 +1,14 @@
 package pcap
 
 // https://wiki.wireshark.org/Development/LibpcapFileFormat
+// https://wiki.wireshark.org/Development/LibpcapFileFormat#modified-pcap
 // TODO: tshark seems to not support sll2 in pcap, confusing
 
 import (
+	"embed"
+	"fmt"
+	"time"
+
 	"github.com/wader/fq/format"
 	"github.com/wader/fq/format/inet/flowsdecoder"
 	"github.com/wader/fq/pkg/decode"
@@ -11,20 +16,37 @@ import (
 	"github.com/wader/fq/pkg/scalar"
 )
 
+//go:embed pcap.jq
+var pcapFS embed.FS
+
 var pcapLinkFrameFormat decode.Group
 var pcapTCPStreamFormat decode.Group
+var pcapUDPStreamFormat decode.Group
 var pcapIPv4PacketFormat decode.Group
 
 const (
 	bigEndian    = 0xa1b2c3d4
 	littleEndian = 0xd4c3b2a1
+	// modified pcap by Alexey Kuznetzov with extra fields in packet header
+	modifiedBigEndian    = 0xa1b2cd34
+	modifiedLittleEndian = 0x34cdb2a1
 )
 
+// network field bit set if bits 28-31 has frame check sequence length
+const pcapFCSLenPresent = 0x0400_0000
+
 var endianMap = scalar.UToSymStr{
-	bigEndian:    "big_endian",
-	littleEndian: "little_endian",
+	bigEndian:            "big_endian",
+	littleEndian:         "little_endian",
+	modifiedBigEndian:    "modified_big_endian",
+	modifiedLittleEndian: "modified_little_endian",
 }
 
+const (
+	packetHeaderSize         = 16
+	modifiedPacketHeaderSize = 24
+)
+
 func init() {
 	interp.RegisterFormat(decode.Format{
 		Name:        format.PCAP,
@@ -33,38 +55,175 @@ func init() {
 		Dependencies: []decode.Dependency{
 			{Names: []string{format.LINK_FRAME}, Group: &pcapLinkFrameFormat},
 			{Names: []string{format.TCP_STREAM}, Group: &pcapTCPStreamFormat},
+			{Names: []string{format.UDP_STREAM}, Group: &pcapUDPStreamFormat},
 			{Names: []string{format.IPV4_PACKET}, Group: &pcapIPv4PacketFormat},
 		},
 		DecodeFn: decodePcap,
+		DecodeInArg: format.PcapIn{
+			PacketStart:          0,
+			PacketCount:          0,
+			MaxPackets:           0,
+			TimeStart:            0,
+			TimeEnd:              0,
+			Flows:                true,
+			PacketsLimit:         0,
+			ChecksumOffload:      checksumOffloadAuto,
+			ChecksumOffloadRatio: 0.5,
+			DuplicateWindow:      32,
+			Dedup:                false,
+		},
+		Functions: []string{"_help"},
 	})
+	interp.RegisterFS(pcapFS)
+}
+
+// countPackets counts packets by only reading record headers
+func countPackets(d *decode.D, headerSize int64) int64 {
+	pos := d.Pos()
+	defer d.SeekAbs(pos)
+
+	var n int64
+	for d.BitsLeft() >= headerSize*8 {
+		d.SeekRel(8 * 8)
+		inclLen := int64(d.U32())
+		d.SeekRel((headerSize - 12) * 8)
+		if inclLen*8 > d.BitsLeft() {
+			break
+		}
+		d.SeekRel(inclLen * 8)
+		n++
+	}
+
+	return n
 }
 
-func decodePcap(d *decode.D, _ any) any {
-	endian := d.FieldU32("magic", d.AssertU(bigEndian, littleEndian), endianMap, scalar.ActualHex)
+func decodePcap(d *decode.D, in any) any {
+	pi, _ := in.(format.PcapIn)
+
+	endian := d.FieldU32("magic", d.AssertU(bigEndian, littleEndian, modifiedBigEndian, modifiedLittleEndian), endianMap, scalar.ActualHex)
+	modified := false
 	switch endian {
 	case bigEndian:
 		d.Endian = decode.BigEndian
 	case littleEndian:
 		d.Endian = decode.LittleEndian
+	case modifiedBigEndian:
+		d.Endian = decode.BigEndian
+		modified = true
+	case modifiedLittleEndian:
+		d.Endian = decode.LittleEndian
+		modified = true
 	default:
 		d.Fatalf("unknown endian %d", endian)
 	}
-	d.FieldU16("version_major")
-	d.FieldU16("version_minor")
-	d.FieldS32("thiszone")
-	d.FieldU32("sigfigs")
+	headerSize := int64(packetHeaderSize)
+	if modified {
+		headerSize = modifiedPacketHeaderSize
+	}
+	versionMajor := d.FieldU16("version_major")
+	versionMinor := d.FieldU16("version_minor")
+	version := fmt.Sprintf("%d.%d", versionMajor, versionMinor)
+	if versionMajor != 2 || versionMinor != 4 {
+		d.FieldValueStr("version", version, scalar.Description("unusual version, expected 2.4"))
+	} else {
+		d.FieldValueStr("version", version)
+	}
+	// timestamps are in local time, thiszone is the correction to UTC in seconds, almost
+	// always zero, non-zero usually means a broken writer or timestamps shifted from UTC
+	thisZone := d.FieldS32("thiszone", scalar.Fn(func(s scalar.S) (scalar.S, error) {
+		if s.ActualS() != 0 {
+			s.Description = fmt.Sprintf("non-zero, %+d seconds applied to timestamps", s.ActualS())
+		}
+		return s, nil
+	}))
+	// accuracy of timestamps, in practice always zero
+	d.FieldU32("sigfigs", scalar.Fn(func(s scalar.S) (scalar.S, error) {
+		if s.ActualU() != 0 {
+			s.Description = "non-zero, usually 0"
+		}
+		return s, nil
+	}))
 	d.FieldU32("snaplen")
-	linkType := int(d.FieldU32("network", format.LinkTypeMap))
+	network := d.FieldU32("network", format.LinkTypeMap)
+	linkType := int(network)
+	var fcsLen int
+	// upper bits can have length of frame check sequence at end of frames in 16 bit units
+	if network&pcapFCSLenPresent != 0 {
+		linkType = int(network & 0xffff)
+		fcsLen = int(network>>28) * 2
+		d.FieldValueU("link_type", uint64(linkType), format.LinkTypeMap)
+		d.FieldValueU("fcs_length", uint64(fcsLen), scalar.Description("bytes"))
+	}
+
+	packetStart := pi.PacketStart
+	if packetStart < 0 {
+		packetStart += countPackets(d, headerSize)
+	}
 
-	fd := flowsdecoder.New()
+	var fd *flowsdecoder.Decoder
+	if pi.Flows {
+		fd = newFlowsDecoder(d, pi.ChecksumOffload)
+	}
+	dups := newDuplicates(pi.DuplicateWindow)
+	tsEpoch := time.Unix(thisZone, 0).UTC()
+	tsSecMapper := scalar.SymActualUTime(tsEpoch, time.RFC3339)
+
+	ps := &packetSelection{
+		start:     packetStart,
+		count:     pi.PacketCount,
+		max:       pi.MaxPackets,
+		timeStart: pi.TimeStart,
+		timeEnd:   pi.TimeEnd,
+	}
+
+	// set if file ends in the middle of a packet, usually a capture that was not stopped properly
+	var incompleteErr error
 
 	d.FieldArray("packets", func(d *decode.D) {
 		for !d.End() {
+			if pi.PacketsLimit > 0 && ps.index >= pi.PacketsLimit {
+				break
+			}
+			if d.BitsLeft() < headerSize*8 {
+				break
+			}
 			d.FieldStruct("packet", func(d *decode.D) {
-				d.FieldU32("ts_sec")
-				d.FieldU32("ts_usec")
+				tsSec := d.FieldU32("ts_sec", tsSecMapper)
+				tsUsec := d.FieldU32("ts_usec")
+				ts := float64(thisZone) + float64(tsSec) + float64(tsUsec)/1e6
+				d.FieldValueFloat("timestamp", ts, scalar.DescriptionActualFUnixTime)
 				inclLen := d.FieldU32("incl_len")
-				origLen := d.FieldU32("orig_len")
+				origLen := d.FieldU32("orig_len", scalar.Fn(func(s scalar.S) (scalar.S, error) {
+					if inclLen > s.ActualU() {
+						s.Description = "smaller than incl_len"
+					}
+					return s, nil
+				}))
+				if inclLen < origLen {
+					d.FieldValueBool("truncated", true)
+				}
+				if modified {
+					d.FieldU32("ifindex")
+					// protocol is from sk_buff and in network byte order
+					d.FieldU16BE("protocol", format.EtherTypeMap, scalar.ActualHex)
+					d.FieldU8("pkt_type", format.LinuxPacketTypeMap)
+					d.FieldU8("pad")
+				}
+
+				index := ps.index
+
+				// file ends inside packet, raw partial packet is not decoded or used for flows
+				if packetBits := int64(inclLen) * 8; packetBits > d.BitsLeft() {
+					incompleteErr = fmt.Errorf("packet %d: incl_len %d but only %d bytes left", index, inclLen, d.BitsLeft()/8)
+					d.FieldRawLen("packet", d.BitsLeft(), scalar.Description("incomplete"))
+					return
+				}
+
+				// skipped packets are not decoded or used for flows
+				if !ps.selectPacket(ts) {
+					d.FieldRawLen("packet", int64(inclLen)*8, scalar.Description("skipped"))
+					return
+				}
 
 				// "incl_len: the number of bytes of packet data actually captured and saved in the file. This value should never become larger than orig_len or the snaplen value of the global header"
 				// "orig_len: the length of the packet as it appeared on the network when it was captured. If incl_len and orig_len differ, the actually saved packet size was limited by snaplen."
@@ -74,15 +233,15 @@ func decodePcap(d *decode.D, _ any) any {
 				// 	d.Errorf("incl_len %d > snaplen %d", inclLen, snapLen)
 				// }
 
-				if inclLen > origLen {
-					d.Errorf("incl_len %d > orig_len %d", inclLen, origLen)
-				}
-
 				bs := d.ReadAllBits(d.BitBufRange(d.Pos(), int64(inclLen)*8))
 
-				if fn, ok := linkToDecodeFn[linkType]; ok {
-					// TODO: report decode errors
-					_ = fn(fd, bs)
+				duplicateOf, isDuplicate := dups.check(index, bs)
+				if isDuplicate {
+					d.FieldValueS("duplicate_of", duplicateOf)
+				}
+
+				if pi.Flows && !(pi.Dedup && isDuplicate) {
+					linkFrameFlows(fd, index, linkType, fcsLen, bs, d.Pos()/8, time.Unix(thisZone+int64(tsSec), int64(tsUsec)*1000))
 				}
 
 				d.FieldFormatOrRawLen(
@@ -91,14 +250,63 @@ func decodePcap(d *decode.D, _ any) any {
 					pcapLinkFrameFormat, format.LinkFrameIn{
 						Type:           linkType,
 						IsLittleEndian: d.Endian == decode.LittleEndian,
+						FCSLen:         fcsLen,
 					},
 				)
 			})
 		}
 	})
-	fd.Flush()
 
-	fieldFlows(d, fd, pcapTCPStreamFormat, pcapIPv4PacketFormat)
+	// packets not in packets array are only used for flows, no decode tree is built for them
+	if !d.End() {
+		unlistedStart := d.Pos()
+		var unlistedPackets int64
+		for d.BitsLeft() >= headerSize*8 {
+			tsSec := d.U32()
+			tsUsec := d.U32()
+			inclLen := int64(d.U32())
+			d.SeekRel((headerSize - 12) * 8)
+			if inclLen*8 > d.BitsLeft() {
+				d.SeekRel(-headerSize * 8)
+				break
+			}
+			ts := float64(thisZone) + float64(tsSec) + float64(tsUsec)/1e6
+			index := ps.index
+			if ps.selectPacket(ts) && (pi.Flows || pi.DuplicateWindow > 0) {
+				bs := d.ReadAllBits(d.BitBufRange(d.Pos(), inclLen*8))
+				_, isDuplicate := dups.check(index, bs)
+				if pi.Flows && !(pi.Dedup && isDuplicate) {
+					linkFrameFlows(fd, index, linkType, fcsLen, bs, d.Pos()/8, time.Unix(thisZone+int64(tsSec), int64(tsUsec)*1000))
+				}
+			}
+			d.SeekRel(inclLen * 8)
+			unlistedPackets++
+		}
+		unlistedEnd := d.Pos()
+		d.SeekAbs(unlistedStart)
+		if unlistedPackets > 0 {
+			d.FieldValueS("unlisted_packets", unlistedPackets)
+			d.FieldRawLen("unlisted", unlistedEnd-unlistedStart, scalar.Description("packets not in packets array"))
+		}
+	}
+
+	d.FieldValueS("duplicate_packets", dups.count, scalar.Description("same content as one of previous duplicate_window packets"))
+
+	// incomplete packet header or packet after packets array
+	if !d.End() {
+		incompleteErr = fmt.Errorf("packet %d: incomplete packet at end of file", ps.index)
+		d.FieldRawLen("incomplete_packet", d.BitsLeft())
+	}
+
+	if pi.Flows {
+		fd.Flush()
+		fieldFlows(d, fd, pi.ChecksumOffload, pi.ChecksumOffloadRatio, pcapLinkFrameFormat, pcapTCPStreamFormat, pcapUDPStreamFormat, pcapIPv4PacketFormat)
+	}
+
+	// error last so that all complete packets and flows are decoded
+	if incompleteErr != nil {
+		d.Errorf("%s", incompleteErr)
+	}
 
 	return nil
 }
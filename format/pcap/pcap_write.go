@@ -0,0 +1,73 @@
+package pcap
+
+// write packets as little endian pcap with microsecond timestamps
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/interp"
+)
+
+func init() {
+	interp.RegisterFunc0("_to_pcap", toPcap)
+}
+
+type toPcapPacket struct {
+	TsSec   int
+	TsUsec  int
+	OrigLen int
+	Data    any
+}
+
+type toPcapIn struct {
+	LinkType int
+	Snaplen  int
+	Packets  []toPcapPacket
+}
+
+func toPcap(_ *interp.Interp, c toPcapIn) any {
+	buf := &bytes.Buffer{}
+	le := binary.LittleEndian
+
+	var header [24]byte
+	le.PutUint32(header[0:], bigEndian)
+	le.PutUint16(header[4:], 2)
+	le.PutUint16(header[6:], 4)
+	// thiszone and sigfigs are zero
+	le.PutUint32(header[16:], uint32(c.Snaplen))
+	le.PutUint32(header[20:], uint32(c.LinkType))
+	buf.Write(header[:])
+
+	for i, p := range c.Packets {
+		br, err := interp.ToBitReader(p.Data)
+		if err != nil {
+			return fmt.Errorf("packet %d: %w", i, err)
+		}
+		data, err := io.ReadAll(bitio.NewIOReader(br))
+		if err != nil {
+			return fmt.Errorf("packet %d: %w", i, err)
+		}
+		origLen := p.OrigLen
+		if origLen == 0 {
+			origLen = len(data)
+		}
+
+		var packetHeader [packetHeaderSize]byte
+		le.PutUint32(packetHeader[0:], uint32(p.TsSec))
+		le.PutUint32(packetHeader[4:], uint32(p.TsUsec))
+		le.PutUint32(packetHeader[8:], uint32(len(data)))
+		le.PutUint32(packetHeader[12:], uint32(origLen))
+		buf.Write(packetHeader[:])
+		buf.Write(data)
+	}
+
+	bb, err := interp.NewBinaryFromBitReader(bitio.NewBitReader(buf.Bytes(), -1), 8, 0)
+	if err != nil {
+		return err
+	}
+	return bb
+}
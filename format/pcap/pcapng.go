@@ -3,11 +3,15 @@ package pcap
 // https://pcapng.github.io/pcapng/draft-ietf-opsawg-pcapng.html
 
 import (
+	"bytes"
 	"encoding/binary"
+	"fmt"
 	"net"
+	"time"
 
 	"github.com/wader/fq/format"
 	"github.com/wader/fq/format/inet/flowsdecoder"
+	"github.com/wader/fq/internal/bitioextra"
 	"github.com/wader/fq/pkg/decode"
 	"github.com/wader/fq/pkg/interp"
 	"github.com/wader/fq/pkg/scalar"
@@ -15,6 +19,7 @@ import (
 
 var pcapngLinkFrameFormat decode.Group
 var pcapngTCPStreamFormat decode.Group
+var pcapngUDPStreamFormat decode.Group
 var pcapngIPvPacket4Format decode.Group
 
 func init() {
@@ -26,9 +31,23 @@ func init() {
 		Dependencies: []decode.Dependency{
 			{Names: []string{format.LINK_FRAME}, Group: &pcapngLinkFrameFormat},
 			{Names: []string{format.TCP_STREAM}, Group: &pcapngTCPStreamFormat},
+			{Names: []string{format.UDP_STREAM}, Group: &pcapngUDPStreamFormat},
 			{Names: []string{format.IPV4_PACKET}, Group: &pcapngIPvPacket4Format},
 		},
 		DecodeFn: decodePcapng,
+		DecodeInArg: format.PcapngIn{
+			PacketStart:          0,
+			PacketCount:          0,
+			MaxPackets:           0,
+			TimeStart:            0,
+			TimeEnd:              0,
+			Flows:                true,
+			PacketsLimit:         0,
+			ChecksumOffload:      checksumOffloadAuto,
+			ChecksumOffloadRatio: 0.5,
+			DuplicateWindow:      32,
+			Dedup:                false,
+		},
 	})
 }
 
@@ -45,23 +64,26 @@ var ngEndianMap = scalar.UToSymStr{
 const (
 	blockTypeSectionHeader        = 0x0a0d0d0a
 	blockTypeInterfaceDescription = 0x00000001
+	blockTypePacket               = 0x00000002
+	blockTypeSimplePacket         = 0x00000003
 	blockTypeNameResolution       = 0x00000004
 	blockTypeInterfaceStatistics  = 0x00000005
 	blockTypeEnhancedPacketBlock  = 0x00000006
+	blockTypeDecryptionSecrets    = 0x0000000a
 )
 
 // from https://pcapng.github.io/pcapng/draft-ietf-opsawg-pcapng.html#section_block_code_registry
 var blockTypeMap = scalar.UToScalar{
 	blockTypeInterfaceDescription: {Sym: "interface_description", Description: "Interface Description Block"},
-	0x00000002:                    {Description: "Packet Block"},
-	0x00000003:                    {Description: "Simple Packet Block"},
+	blockTypePacket:               {Sym: "packet", Description: "Packet Block (obsolete)"},
+	blockTypeSimplePacket:         {Sym: "simple_packet", Description: "Simple Packet Block"},
 	blockTypeNameResolution:       {Sym: "name_resolution", Description: "Name Resolution Block"},
 	blockTypeInterfaceStatistics:  {Sym: "interface_statistics", Description: "Interface Statistics Block"},
 	blockTypeEnhancedPacketBlock:  {Sym: "enhanced_packet", Description: "Enhanced Packet Block"},
 	0x00000007:                    {Description: "IRIG Timestamp Block"},
 	0x00000008:                    {Description: "ARINC 429 in AFDX Encapsulation Information Block"},
 	0x00000009:                    {Description: "systemd Journal Export Block"},
-	0x0000000a:                    {Description: "Decryption Secrets Block"},
+	blockTypeDecryptionSecrets:    {Sym: "decryption_secrets", Description: "Decryption Secrets Block"},
 	0x00000101:                    {Description: "Hone Project Machine Info Block"},
 	0x00000102:                    {Description: "Hone Project Connection Event Block"},
 	0x00000201:                    {Description: "Sysdig Machine Info Block"},
@@ -106,6 +128,9 @@ const (
 	enhancedPacketFlags     = 2
 	enhancedPacketHash      = 3
 	enhancedPacketDropcount = 4
+	enhancedPacketPacketID  = 5
+	enhancedPacketQueue     = 6
+	enhancedPacketVerdict   = 7
 
 	nameResolutionDNSName    = 2
 	nameResolutionDNSIP4addr = 3
@@ -151,6 +176,9 @@ var enhancedPacketOptionsMap = scalar.UToScalar{
 	enhancedPacketFlags:     {Sym: "flags"},
 	enhancedPacketHash:      {Sym: "hash"},
 	enhancedPacketDropcount: {Sym: "dropcount"},
+	enhancedPacketPacketID:  {Sym: "packetid"},
+	enhancedPacketQueue:     {Sym: "queue"},
+	enhancedPacketVerdict:   {Sym: "verdict"},
 }
 
 var nameResolutionOptionsMap = scalar.UToScalar{
@@ -173,6 +201,26 @@ var interfaceStatisticsOptionsMap = scalar.UToScalar{
 	interfaceStatisticsUsrdeliv:     {Sym: "usrdeliv"},
 }
 
+var decryptionSecretsOptionsMap = scalar.UToScalar{
+	optionEnd:     {Sym: "end", Description: "End of options"},
+	optionComment: {Sym: "comment", Description: "Comment"},
+}
+
+const (
+	secretsTypeTLSKeyLog       = 0x544c534b
+	secretsTypeSSHKeyLog       = 0x5353484b
+	secretsTypeWireGuardKeyLog = 0x57474b4c
+)
+
+var secretsTypeMap = scalar.UToScalar{
+	secretsTypeTLSKeyLog:       {Sym: "tls_keylog", Description: "TLS Key Log"},
+	secretsTypeSSHKeyLog:       {Sym: "ssh_keylog", Description: "SSH Key Log"},
+	secretsTypeWireGuardKeyLog: {Sym: "wireguard_keylog", Description: "WireGuard Key Log"},
+	0x5a4e574b:                 {Sym: "zigbee_nwk_key", Description: "ZigBee NWK Key"},
+	0x5a415053:                 {Sym: "zigbee_aps_key", Description: "ZigBee APS Key"},
+	0x55414b4c:                 {Sym: "opcua_keylog", Description: "OPC UA Key Log"},
+}
+
 const (
 	nameResolutionRecordEnd  = 0x0000
 	nameResolutionRecordIpv4 = 0x0001
@@ -185,7 +233,9 @@ var nameResolutionRecordMap = scalar.UToSymStr{
 	nameResolutionRecordIpv6: "ipv6",
 }
 
-func decoodeOptions(d *decode.D, opts scalar.UToScalar) {
+type optionValueFn func(d *decode.D)
+
+func decoodeOptions(d *decode.D, opts scalar.UToScalar, valueFns map[uint64]optionValueFn) {
 	if d.BitsLeft() < 32 {
 		return
 	}
@@ -198,7 +248,14 @@ func decoodeOptions(d *decode.D, opts scalar.UToScalar) {
 				seenEnd = true
 				return
 			}
-			d.FieldUTF8NullFixedLen("value", int(length))
+			d.FramedFn(int64(length)*8, func(d *decode.D) {
+				if fn, ok := valueFns[code]; ok {
+					fn(d)
+				} else {
+					// comment and other string options
+					d.FieldUTF8NullFixedLen("value", int(d.BitsLeft()/8))
+				}
+			})
 			d.FieldRawLen("padding", int64(d.AlignBits(32)))
 		})
 	}
@@ -212,45 +269,393 @@ var mapUToIPv4Sym = scalar.Fn(func(s scalar.S) (scalar.S, error) {
 	return s, nil
 })
 
-var blockFns = map[uint64]func(d *decode.D, dc *decodeContext){
-	// TODO: SimplePacket
-	// TODO: Packet
-	blockTypeInterfaceDescription: func(d *decode.D, dc *decodeContext) {
-		typ := d.FieldU16("link_type", format.LinkTypeMap)
-		d.FieldU16("reserved")
-		d.FieldU32("snap_len")
-		d.FieldArray("options", func(d *decode.D) { decoodeOptions(d, interfaceDescriptionOptionsMap) })
+// TODO: share
+var mapUToEtherSym = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], s.ActualU())
+	s.Sym = net.HardwareAddr(b[2:]).String()
+	return s, nil
+})
 
-		dc.interfaceTypes[len(dc.interfaceTypes)] = int(typ)
+// TODO: share
+var mapUToIPv6Sym = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	b := &bytes.Buffer{}
+	if _, err := bitioextra.CopyBits(b, s.ActualBitBuf()); err != nil {
+		return s, err
+	}
+	s.Sym = net.IP(b.Bytes()).String()
+	return s, nil
+})
+
+// most significant bit set means negative power of 2 otherwise negative power of 10
+var mapTsresolDescription = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	v := s.ActualU()
+	if v&0x80 != 0 {
+		s.Description = fmt.Sprintf("2^-%d seconds", v&0x7f)
+	} else {
+		s.Description = fmt.Sprintf("10^-%d seconds", v)
+	}
+	return s, nil
+})
+
+var hashAlgorithmMap = scalar.UToSymStr{
+	0: "2s_complement",
+	1: "xor",
+	2: "crc32",
+	3: "md5",
+	4: "sha1",
+	5: "toeplitz",
+}
+
+var verdictTypeMap = scalar.UToSymStr{
+	0: "hardware",
+	1: "linux_ebpf_tc",
+	2: "linux_ebpf_xdp",
+}
+
+func optionU8(d *decode.D)  { d.FieldU8("value") }
+func optionU32(d *decode.D) { d.FieldU32("value") }
+func optionU64(d *decode.D) { d.FieldU64("value") }
+
+func optionTimestamp(d *decode.D) {
+	d.FieldU32("timestamp_high")
+	d.FieldU32("timestamp_low")
+}
+
+var interfaceDescriptionOptionFns = map[uint64]optionValueFn{
+	interfaceDescriptionIPv4addr: func(d *decode.D) {
+		d.FieldU32BE("address", mapUToIPv4Sym, scalar.ActualHex)
+		d.FieldU32BE("netmask", mapUToIPv4Sym, scalar.ActualHex)
 	},
-	blockTypeEnhancedPacketBlock: func(d *decode.D, dc *decodeContext) {
-		interfaceID := d.FieldU32("interface_id")
-		d.FieldU32("timestamp_high")
-		d.FieldU32("timestamp_low")
-		capturedLength := d.FieldU32("capture_packet_length")
-		d.FieldU32("original_packet_length")
+	interfaceDescriptionMACaddr: func(d *decode.D) { d.FieldU48BE("value", mapUToEtherSym, scalar.ActualHex) },
+	interfaceDescriptionEUIaddr: func(d *decode.D) { d.FieldU64BE("value", scalar.ActualHex) },
+	interfaceDescriptionSpeed:   optionU64,
+	interfaceDescriptionTsresol: func(d *decode.D) { d.FieldU8("value", mapTsresolDescription) },
+	interfaceDescriptionTzone:   func(d *decode.D) { d.FieldS32("value") },
+	interfaceDescriptionFilter: func(d *decode.D) {
+		d.FieldU8("filter_type", scalar.UToSymStr{0: "libpcap", 1: "bpf"})
+		d.FieldUTF8NullFixedLen("value", int(d.BitsLeft()/8))
+	},
+	interfaceDescriptionFcslen:   optionU8,
+	interfaceDescriptionTsoffset: func(d *decode.D) { d.FieldS64("value") },
+}
 
-		bs := d.ReadAllBits(d.BitBufRange(d.Pos(), int64(capturedLength)*8))
+var enhancedPacketOptionFns = map[uint64]optionValueFn{
+	enhancedPacketFlags: func(d *decode.D) { d.FieldU32("value", scalar.ActualHex) },
+	enhancedPacketHash: func(d *decode.D) {
+		d.FieldU8("algorithm", hashAlgorithmMap)
+		d.FieldRawLen("value", d.BitsLeft())
+	},
+	enhancedPacketDropcount: optionU64,
+	enhancedPacketPacketID:  optionU64,
+	enhancedPacketQueue:     optionU32,
+	enhancedPacketVerdict: func(d *decode.D) {
+		d.FieldU8("verdict_type", verdictTypeMap)
+		d.FieldRawLen("value", d.BitsLeft())
+	},
+}
 
-		linkType := dc.interfaceTypes[int(interfaceID)]
+var nameResolutionOptionFns = map[uint64]optionValueFn{
+	nameResolutionDNSIP4addr: func(d *decode.D) { d.FieldU32BE("value", mapUToIPv4Sym, scalar.ActualHex) },
+	nameResolutionDNSIP6addr: func(d *decode.D) { d.FieldRawLen("value", 128, mapUToIPv6Sym) },
+}
+
+var interfaceStatisticsOptionFns = map[uint64]optionValueFn{
+	interfaceStatisticsStarttime:    optionTimestamp,
+	interfaceStatisticsEndtime:      optionTimestamp,
+	interfaceStatisticsIfRecv:       optionU64,
+	interfaceStatisticsIfDrop:       optionU64,
+	interfaceStatisticsFilterAccept: optionU64,
+	interfaceStatisticsOSDrop:       optionU64,
+	interfaceStatisticsUsrdeliv:     optionU64,
+}
+
+// interfaceTimestamp is timestamp resolution and offset from interface description options
+type interfaceTimestamp struct {
+	tsresol  uint64
+	tsoffset int64
+}
 
-		if fn, ok := linkToDecodeFn[linkType]; ok {
-			// TODO: report decode errors
-			_ = fn(dc.flowDecoder, bs)
+// time of timestamp in units of tsresol seconds, zero time if interface is unknown
+func (dc *decodeContext) timestamp(interfaceID int, ts uint64) time.Time {
+	it, ok := dc.interfaceTimestamps[interfaceID]
+	if !ok {
+		return time.Time{}
+	}
+	var unitsPerSecond uint64
+	if it.tsresol&0x80 != 0 {
+		unitsPerSecond = 1 << (it.tsresol & 0x7f)
+	} else if it.tsresol <= 19 {
+		unitsPerSecond = 1
+		for i := uint64(0); i < it.tsresol; i++ {
+			unitsPerSecond *= 10
 		}
+	}
+	// too large to fit in 64 bit
+	if unitsPerSecond == 0 {
+		return time.Time{}
+	}
+	sec := ts / unitsPerSecond
+	nsec := float64(ts%unitsPerSecond) / float64(unitsPerSecond) * 1e9
+	return time.Unix(it.tsoffset+int64(sec), int64(nsec))
+}
 
+// usePacket selects packet and checks selected packets for duplicates, selected packets are
+// used for flows unless excluded as duplicates
+func usePacket(d *decode.D, dc *decodeContext, interfaceID int, capturedLength int64, fcsLen int, ts time.Time) (selected bool, duplicateOf int64, isDuplicate bool) {
+	index := dc.packetIndex
+	dc.packetIndex++
+
+	// not using UnixNano as timestamps far from now can overflow
+	var tsFloat float64
+	if !ts.IsZero() {
+		tsFloat = float64(ts.Unix()) + float64(ts.Nanosecond())/1e9
+	}
+	if !dc.selection.selectPacket(tsFloat) {
+		return false, 0, false
+	}
+	if dc.flowDecoder == nil && dc.duplicates.window == 0 {
+		return true, 0, false
+	}
+
+	bs := d.ReadAllBits(d.BitBufRange(d.Pos(), capturedLength*8))
+	duplicateOf, isDuplicate = dc.duplicates.check(index, bs)
+	if dc.flowDecoder != nil && !(dc.dedup && isDuplicate) {
+		linkFrameFlows(dc.flowDecoder, index, dc.interfaceTypes[interfaceID], fcsLen, bs, d.Pos()/8, ts)
+	}
+
+	return true, duplicateOf, isDuplicate
+}
+
+func fieldPacket(d *decode.D, dc *decodeContext, interfaceID int, capturedLength int64, fcsLen int, ts time.Time) {
+	selected, duplicateOf, isDuplicate := usePacket(d, dc, interfaceID, capturedLength, fcsLen, ts)
+	if selected {
+		if isDuplicate {
+			d.FieldValueS("duplicate_of", duplicateOf)
+		}
 		d.FieldFormatOrRawLen(
 			"packet",
-			int64(capturedLength)*8,
+			capturedLength*8,
 			pcapngLinkFrameFormat,
 			format.LinkFrameIn{
-				Type:           linkType,
+				Type:           dc.interfaceTypes[interfaceID],
 				IsLittleEndian: d.Endian == decode.LittleEndian,
+				FCSLen:         fcsLen,
 			},
 		)
+	} else {
+		// skipped packets are not decoded or used for flows
+		d.FieldRawLen("packet", capturedLength*8, scalar.Description("skipped"))
+	}
 
-		d.FieldRawLen("padding", int64(d.AlignBits(32)))
-		d.FieldArray("options", func(d *decode.D) { decoodeOptions(d, enhancedPacketOptionsMap) })
+	d.FieldRawLen("padding", int64(d.AlignBits(32)))
+}
+
+func isPacketBlockType(typ uint64) bool {
+	return typ == blockTypePacket || typ == blockTypeSimplePacket || typ == blockTypeEnhancedPacketBlock
+}
+
+// packetBlockFlows is like the packet block functions but only selects and uses packet for flows
+// without adding any fields
+func packetBlockFlows(d *decode.D, dc *decodeContext, typ uint64) {
+	var interfaceID int
+	var capturedLength int64
+	var fcsLen int
+	var ts time.Time
+	switch typ {
+	case blockTypePacket:
+		interfaceID = int(d.U16())
+		d.SeekRel(16)
+		tsHigh := d.U32()
+		tsLow := d.U32()
+		capturedLength = int64(d.U32())
+		d.SeekRel(32)
+		fcsLen = dc.interfaceFCSLens[interfaceID]
+		ts = dc.timestamp(interfaceID, tsHigh<<32|tsLow)
+	case blockTypeSimplePacket:
+		capturedLength = int64(d.U32())
+		if l := d.BitsLeft() / 8; capturedLength > l {
+			capturedLength = l
+		}
+		fcsLen = dc.interfaceFCSLens[0]
+	case blockTypeEnhancedPacketBlock:
+		interfaceID = int(d.U32())
+		tsHigh := d.U32()
+		tsLow := d.U32()
+		capturedLength = int64(d.U32())
+		d.SeekRel(32)
+		fcsLen = enhancedPacketFCSLen(d, capturedLength, dc.interfaceFCSLens[interfaceID])
+		ts = dc.timestamp(interfaceID, tsHigh<<32|tsLow)
+	}
+	if capturedLength*8 > d.BitsLeft() {
+		return
+	}
+	usePacket(d, dc, interfaceID, capturedLength, fcsLen, ts)
+}
+
+// unlistedPacketBlocks adds a run of packet blocks after packets_limit as one raw field, the
+// packets are only used for flows and no decode tree is built for them. Returns false if next
+// block is not a packet block.
+func unlistedPacketBlocks(d *decode.D, dc *decodeContext) bool {
+	start := d.Pos()
+	var blocks int64
+	for d.BitsLeft() >= 12*8 {
+		pos := d.Pos()
+		typ := d.U32()
+		length := int64(d.U32())
+		if !isPacketBlockType(typ) || length < 12 || (length-8)*8 > d.BitsLeft() {
+			d.SeekAbs(pos)
+			break
+		}
+		d.FramedFn((length-12)*8, func(d *decode.D) { packetBlockFlows(d, dc, typ) })
+		d.SeekRel(32)
+		blocks++
+	}
+	if blocks == 0 {
+		return false
+	}
+
+	end := d.Pos()
+	d.SeekAbs(start)
+	d.FieldRawLen("unlisted", end-start, scalar.Description(fmt.Sprintf("%d packet blocks not in blocks array", blocks)))
+
+	return true
+}
+
+// countPacketBlocks counts packet blocks in all sections by only reading block headers
+func countPacketBlocks(d *decode.D) int64 {
+	pos := d.Pos()
+	endian := d.Endian
+	defer func() {
+		d.SeekAbs(pos)
+		d.Endian = endian
+	}()
+
+	var n int64
+	for d.BitsLeft() >= 12*8 {
+		// block type is a palindrome so endian does not matter
+		if d.PeekBits(32) == blockTypeSectionHeader {
+			d.SeekRel(64)
+			switch d.U32BE() {
+			case ngBigEndian:
+				d.Endian = decode.BigEndian
+			case ngLittleEndian:
+				d.Endian = decode.LittleEndian
+			default:
+				return n
+			}
+			d.SeekRel(-96)
+		}
+		typ := d.U32()
+		length := int64(d.U32())
+		if length < 12 || (length-8)*8 > d.BitsLeft() {
+			break
+		}
+		if isPacketBlockType(typ) {
+			n++
+		}
+		d.SeekRel((length - 8) * 8)
+	}
+
+	return n
+}
+
+// enhancedPacketFCSLen returns frame check sequence length from epb_flags bits 5-8 if
+// non-zero, otherwise fcsLen. Options are after packet data so peek them without
+// adding fields.
+func enhancedPacketFCSLen(d *decode.D, capturedLength int64, fcsLen int) int {
+	pos := d.Pos()
+	defer d.SeekAbs(pos)
+
+	if capturedLength*8 > d.BitsLeft() {
+		return fcsLen
+	}
+	d.SeekRel(capturedLength * 8)
+	d.SeekRel(int64(d.AlignBits(32)))
+	for d.BitsLeft() >= 32 {
+		code := d.U16()
+		length := int64(d.U16())
+		if code == optionEnd || length*8 > d.BitsLeft() {
+			break
+		}
+		if code == enhancedPacketFlags && length == 4 {
+			if l := int(d.U32()>>5) & 0xf; l != 0 {
+				return l
+			}
+			break
+		}
+		d.SeekRel(length * 8)
+		d.SeekRel(int64(d.AlignBits(32)))
+	}
+
+	return fcsLen
+}
+
+var blockFns = map[uint64]func(d *decode.D, dc *decodeContext){
+	blockTypeInterfaceDescription: func(d *decode.D, dc *decodeContext) {
+		typ := d.FieldU16("link_type", format.LinkTypeMap)
+		d.FieldU16("reserved")
+		d.FieldU32("snap_len")
+		// default resolution is microseconds
+		it := interfaceTimestamp{tsresol: 6}
+		optionFns := map[uint64]optionValueFn{}
+		for k, fn := range interfaceDescriptionOptionFns {
+			optionFns[k] = fn
+		}
+		optionFns[interfaceDescriptionTsresol] = func(d *decode.D) {
+			it.tsresol = d.FieldU8("value", mapTsresolDescription)
+		}
+		optionFns[interfaceDescriptionTsoffset] = func(d *decode.D) {
+			it.tsoffset = d.FieldS64("value")
+		}
+		var fcsLen int
+		optionFns[interfaceDescriptionFcslen] = func(d *decode.D) {
+			// length is in bits, ignore if not whole bytes
+			if l := int(d.FieldU8("value")); l%8 == 0 {
+				fcsLen = l / 8
+			}
+		}
+		d.FieldArray("options", func(d *decode.D) { decoodeOptions(d, interfaceDescriptionOptionsMap, optionFns) })
+
+		dc.interfaceFCSLens[len(dc.interfaceTypes)] = fcsLen
+
+		dc.interfaceTimestamps[len(dc.interfaceTypes)] = it
+		dc.interfaceTypes[len(dc.interfaceTypes)] = int(typ)
+	},
+	blockTypePacket: func(d *decode.D, dc *decodeContext) {
+		interfaceID := d.FieldU16("interface_id")
+		d.FieldU16("drops_count")
+		tsHigh := d.FieldU32("timestamp_high")
+		tsLow := d.FieldU32("timestamp_low")
+		capturedLength := d.FieldU32("capture_packet_length")
+		d.FieldU32("original_packet_length")
+		fcsLen := dc.interfaceFCSLens[int(interfaceID)]
+		fieldPacket(d, dc, int(interfaceID), int64(capturedLength), fcsLen, dc.timestamp(int(interfaceID), tsHigh<<32|tsLow))
+		d.FieldArray("options", func(d *decode.D) {
+			decoodeOptions(d, enhancedPacketOptionsMap, enhancedPacketOptionFns)
+		})
+	},
+	blockTypeSimplePacket: func(d *decode.D, dc *decodeContext) {
+		originalLength := d.FieldU32("original_packet_length")
+		// captured length is implied by block length and is at most snap length
+		capturedLength := int64(originalLength)
+		if l := d.BitsLeft() / 8; capturedLength > l {
+			capturedLength = l
+		}
+		// always first interface, has no timestamp
+		fieldPacket(d, dc, 0, capturedLength, dc.interfaceFCSLens[0], time.Time{})
+	},
+	blockTypeEnhancedPacketBlock: func(d *decode.D, dc *decodeContext) {
+		interfaceID := d.FieldU32("interface_id")
+		tsHigh := d.FieldU32("timestamp_high")
+		tsLow := d.FieldU32("timestamp_low")
+		capturedLength := d.FieldU32("capture_packet_length")
+		d.FieldU32("original_packet_length")
+		fcsLen := enhancedPacketFCSLen(d, int64(capturedLength), dc.interfaceFCSLens[int(interfaceID)])
+		fieldPacket(d, dc, int(interfaceID), int64(capturedLength), fcsLen, dc.timestamp(int(interfaceID), tsHigh<<32|tsLow))
+		d.FieldArray("options", func(d *decode.D) {
+			decoodeOptions(d, enhancedPacketOptionsMap, enhancedPacketOptionFns)
+		})
 	},
 	blockTypeNameResolution: func(d *decode.D, _ *decodeContext) {
 		seenEnd := false
@@ -272,6 +677,13 @@ var blockFns = map[uint64]func(d *decode.D, dc *decodeContext){
 									d.FieldUTF8Null("string")
 								}
 							})
+						case nameResolutionRecordIpv6:
+							d.FieldRawLen("address", 128, mapUToIPv6Sym)
+							d.FieldArray("entries", func(d *decode.D) {
+								for !d.End() {
+									d.FieldUTF8Null("string")
+								}
+							})
 						default:
 							d.FieldUTF8NullFixedLen("value", int(d.BitsLeft()/8))
 						}
@@ -280,14 +692,29 @@ var blockFns = map[uint64]func(d *decode.D, dc *decodeContext){
 				})
 			}
 		})
-		d.FieldArray("options", func(d *decode.D) { decoodeOptions(d, nameResolutionOptionsMap) })
+		d.FieldArray("options", func(d *decode.D) { decoodeOptions(d, nameResolutionOptionsMap, nameResolutionOptionFns) })
+	},
+	blockTypeDecryptionSecrets: func(d *decode.D, _ *decodeContext) {
+		typ := d.FieldU32("secrets_type", secretsTypeMap, scalar.ActualHex)
+		length := d.FieldU32("secrets_length")
+		switch typ {
+		case secretsTypeTLSKeyLog,
+			secretsTypeSSHKeyLog,
+			secretsTypeWireGuardKeyLog:
+			// key log files are text with one secret per line
+			d.FieldUTF8("payload", int(length))
+		default:
+			d.FieldRawLen("payload", int64(length)*8)
+		}
+		d.FieldRawLen("padding", int64(d.AlignBits(32)))
+		d.FieldArray("options", func(d *decode.D) { decoodeOptions(d, decryptionSecretsOptionsMap, nil) })
 	},
 	blockTypeInterfaceStatistics: func(d *decode.D, _ *decodeContext) {
 		d.FieldU32("interface_id")
 		d.FieldU32("timestamp_high")
 		d.FieldU32("timestamp_low")
 		d.FieldRawLen("padding", int64(d.AlignBits(32)))
-		d.FieldArray("options", func(d *decode.D) { decoodeOptions(d, interfaceStatisticsOptionsMap) })
+		d.FieldArray("options", func(d *decode.D) { decoodeOptions(d, interfaceStatisticsOptionsMap, interfaceStatisticsOptionFns) })
 	},
 }
 
@@ -340,7 +767,7 @@ func decodeSection(d *decode.D, dc *decodeContext) {
 				d.FieldU16("minor_version")
 				sectionLength = d.FieldS64("section_length")
 				d.FramedFn(d.BitsLeft()-32, func(d *decode.D) {
-					d.FieldArray("options", func(d *decode.D) { decoodeOptions(d, sectionHeaderOptionsMap) })
+					d.FieldArray("options", func(d *decode.D) { decoodeOptions(d, sectionHeaderOptionsMap, nil) })
 				})
 				d.FieldU32("footer_total_length")
 			})
@@ -350,6 +777,14 @@ func decodeSection(d *decode.D, dc *decodeContext) {
 
 		for (sectionLength == -1 && !d.End()) ||
 			(sectionLength != -1 && d.Pos()-sectionStart < sectionLength*8) {
+			// unknown section length, next section header starts a new section.
+			// block type is a palindrome so endian does not matter
+			if sectionLength == -1 && d.PeekBits(32) == blockTypeSectionHeader {
+				break
+			}
+			if dc.packetsLimit > 0 && dc.selection.index >= dc.packetsLimit && unlistedPacketBlocks(d, dc) {
+				continue
+			}
 			d.FieldStruct("block", func(d *decode.D) { decodeBlock(d, dc) })
 		}
 	})
@@ -358,22 +793,59 @@ func decodeSection(d *decode.D, dc *decodeContext) {
 type decodeContext struct {
 	sectionHeaderFound bool
 	interfaceTypes     map[int]int
-	flowDecoder        *flowsdecoder.Decoder
+	// by interface id
+	interfaceTimestamps map[int]interfaceTimestamp
+	// by interface id, bytes of frame check sequence at end of packets from if_fcslen
+	interfaceFCSLens map[int]int
+	// nil if flows are disabled
+	flowDecoder *flowsdecoder.Decoder
+	// index of packet in section
+	packetIndex int64
+	// shared by all sections, index is of packet in capture
+	selection    *packetSelection
+	packetsLimit int64
+	// by section, compares packets in section
+	duplicates *duplicates
+	dedup      bool
 }
 
-func decodePcapng(d *decode.D, _ any) any {
+func decodePcapng(d *decode.D, in any) any {
+	pi, _ := in.(format.PcapngIn)
+
+	packetStart := pi.PacketStart
+	if packetStart < 0 {
+		packetStart += countPacketBlocks(d)
+	}
+	ps := &packetSelection{
+		start:     packetStart,
+		count:     pi.PacketCount,
+		max:       pi.MaxPackets,
+		timeStart: pi.TimeStart,
+		timeEnd:   pi.TimeEnd,
+	}
+
 	sectionHeaders := 0
 	for !d.End() {
-		fd := flowsdecoder.New()
 		dc := decodeContext{
-			interfaceTypes: map[int]int{},
-			flowDecoder:    fd,
+			interfaceTypes:      map[int]int{},
+			interfaceTimestamps: map[int]interfaceTimestamp{},
+			interfaceFCSLens:    map[int]int{},
+			selection:           ps,
+			packetsLimit:        pi.PacketsLimit,
+			duplicates:          newDuplicates(pi.DuplicateWindow),
+			dedup:               pi.Dedup,
+		}
+		if pi.Flows {
+			dc.flowDecoder = newFlowsDecoder(d, pi.ChecksumOffload)
 		}
 
 		d.FieldStruct("section", func(d *decode.D) {
 			decodeSection(d, &dc)
-			fd.Flush()
-			fieldFlows(d, dc.flowDecoder, pcapngTCPStreamFormat, pcapngIPvPacket4Format)
+			d.FieldValueS("duplicate_packets", dc.duplicates.count, scalar.Description("same content as one of previous duplicate_window packets"))
+			if dc.flowDecoder != nil {
+				dc.flowDecoder.Flush()
+				fieldFlows(d, dc.flowDecoder, pi.ChecksumOffload, pi.ChecksumOffloadRatio, pcapngLinkFrameFormat, pcapngTCPStreamFormat, pcapngUDPStreamFormat, pcapngIPvPacket4Format)
+			}
 		})
 		if dc.sectionHeaderFound {
 			sectionHeaders++
@@ -1,40 +1,286 @@
 package pcap
 
 import (
-	"fmt"
+	"time"
 
 	"github.com/wader/fq/format"
 	"github.com/wader/fq/format/inet/flowsdecoder"
 	"github.com/wader/fq/pkg/bitio"
 	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
 )
 
 var linkToDecodeFn = map[int]func(fd *flowsdecoder.Decoder, bs []byte) error{
-	format.LinkTypeNULL:      (*flowsdecoder.Decoder).LoopbackFrame,
-	format.LinkTypeETHERNET:  (*flowsdecoder.Decoder).EthernetFrame,
-	format.LinkTypeLINUX_SLL: (*flowsdecoder.Decoder).SLLPacket,
-	format.LinkTypeLINUX_SLL2: func(fd *flowsdecoder.Decoder, bs []byte) error {
-		if len(bs) < 20 {
-			// TODO: too short sll packet, error somehow?
-			return fmt.Errorf("packet too short %d", len(bs))
+	format.LinkTypeNULL:                (*flowsdecoder.Decoder).LoopbackFrame,
+	format.LinkTypeETHERNET:            (*flowsdecoder.Decoder).EthernetFrame,
+	format.LinkTypeLINUX_SLL:           (*flowsdecoder.Decoder).SLLPacket,
+	format.LinkTypeLINUX_SLL2:          (*flowsdecoder.Decoder).SLL2Packet,
+	format.LinkTypeIEEE802_11:          (*flowsdecoder.Decoder).IEEE80211Frame,
+	format.LinkTypeIEEE802_11_RADIOTAP: (*flowsdecoder.Decoder).RadiotapFrame,
+	format.LinkTypePPP:                 (*flowsdecoder.Decoder).PPPFrame,
+	format.LinkTypeC_HDLC:              (*flowsdecoder.Decoder).CiscoHDLCFrame,
+	format.LinkTypePPP_HDLC: func(fd *flowsdecoder.Decoder, bs []byte) error {
+		// can be either ppp in hdlc-like framing or cisco hdlc
+		if len(bs) > 0 && (bs[0] == 0x0f || bs[0] == 0x8f) {
+			return fd.CiscoHDLCFrame(bs)
 		}
+		return fd.PPPFrame(bs)
+	},
+}
+
+const (
+	checksumOffloadAuto   = "auto"
+	checksumOffloadStrict = "strict"
+	checksumOffloadIgnore = "ignore"
+)
+
+func newFlowsDecoder(d *decode.D, checksumOffload string) *flowsdecoder.Decoder {
+	fd := flowsdecoder.New()
+	switch checksumOffload {
+	case checksumOffloadAuto, checksumOffloadStrict:
+		fd.CheckChecksums = true
+	case checksumOffloadIgnore:
+	default:
+		d.Fatalf("unknown checksum_offload %q, should be auto, strict or ignore", checksumOffload)
+	}
+	return fd
+}
+
+// packetSelection selects packets to decode and use for flows by index in capture and timestamp
+type packetSelection struct {
+	start     int64
+	count     int64
+	max       int64
+	timeStart float64
+	timeEnd   float64
+	// index of next packet in capture
+	index   int64
+	decoded int64
+}
+
+func (ps *packetSelection) selectPacket(ts float64) bool {
+	selected := ps.index >= ps.start &&
+		(ps.count == 0 || ps.index < ps.start+ps.count) &&
+		(ps.max == 0 || ps.decoded < ps.max) &&
+		ts >= ps.timeStart && (ps.timeEnd == 0 || ts <= ps.timeEnd)
+	ps.index++
+	if selected {
+		ps.decoded++
+	}
+	return selected
+}
+
+// number of ports to include in protocol summary, rest are counted as other
+const protocolSummaryTopPorts = 10
+
+// offset is byte offset of frame in capture, ts is capture time or zero if unknown,
+// errors are collected in fd.PacketErrors
+func linkFrameFlows(fd *flowsdecoder.Decoder, packetIndex int64, linkType int, fcsLen int, bs []byte, offset int64, ts time.Time) {
+	fd.ProtocolSummary.LinkFrame(linkType, len(bs))
+	// frame check sequence is not part of frame content
+	if fcsLen > 0 && fcsLen <= len(bs) {
+		bs = bs[:len(bs)-fcsLen]
+	}
+	fd.PacketIndex = packetIndex
+	fd.LinkType = linkType
+	fd.FrameOffset = offset
+	fd.FrameTimestamp = ts
+	fn, ok := linkToDecodeFn[linkType]
+	if !ok {
+		return
+	}
+	if err := fn(fd, bs); err != nil {
+		fd.PacketErrors = append(fd.PacketErrors, flowsdecoder.PacketError{PacketIndex: packetIndex, Err: err})
+	}
+}
 
-		// TODO: gopacket does not support SLL2 atm so convert SLL to SSL2
-		nbs := []byte{
-			0, bs[10], // packet type
-			bs[8], bs[9], // arphdr
-			0, bs[11], // link layer address length
-			bs[12], bs[13], bs[14], bs[15], bs[16], bs[17], bs[18], bs[19], //  link layer address
-			bs[0], bs[1], // protocol type
+func fieldProtocolCounts(d *decode.D, name string, keyName string, pc flowsdecoder.ProtocolCounts, limit int, sms ...scalar.Mapper) {
+	d.FieldArray(name, func(d *decode.D) {
+		for _, c := range pc.Sorted(limit) {
+			d.FieldStruct("protocol", func(d *decode.D) {
+				if c.Key == flowsdecoder.ProtocolOther {
+					d.FieldValueStr(keyName, "other")
+				} else {
+					d.FieldValueU(keyName, uint64(c.Key), sms...)
+				}
+				d.FieldValueU("packets", c.Packets)
+				d.FieldValueU("bytes", c.Bytes)
+			})
 		}
-		nbs = append(nbs, bs[20:]...)
+	})
+}
 
-		return fd.SLLPacket(nbs)
-	},
+func fieldProtocolSummary(d *decode.D, ps flowsdecoder.ProtocolSummary, flowErrors int) {
+	d.FieldStruct("protocol_summary", func(d *decode.D) {
+		d.FieldValueU("flow_errors", uint64(flowErrors))
+		fieldProtocolCounts(d, "link_types", "link_type", ps.LinkTypes, 0, format.LinkTypeMap)
+		fieldProtocolCounts(d, "ether_types", "ether_type", ps.EtherTypes, 0, format.EtherTypeMap, scalar.ActualHex)
+		fieldProtocolCounts(d, "ip_protocols", "protocol", ps.IPProtocols, 0, format.IPv4ProtocolMap)
+		fieldProtocolCounts(d, "tcp_ports", "port", ps.TCPPorts, protocolSummaryTopPorts, format.TCPPortMap)
+		fieldProtocolCounts(d, "udp_ports", "port", ps.UDPPorts, protocolSummaryTopPorts, format.UDPPortMap)
+	})
+}
+
+func unixFloat(t time.Time) float64 {
+	return float64(t.UnixNano()) / 1e9
+}
+
+// connectionDuration is time between first and last segment in any direction
+func connectionDuration(c *flowsdecoder.TCPConnection) (float64, bool) {
+	var first, last time.Time
+	for _, td := range []*flowsdecoder.TCPDirection{&c.Client, &c.Server} {
+		if td.FirstTimestamp.IsZero() {
+			continue
+		}
+		if first.IsZero() || td.FirstTimestamp.Before(first) {
+			first = td.FirstTimestamp
+		}
+		if td.LastTimestamp.After(last) {
+			last = td.LastTimestamp
+		}
+	}
+	if first.IsZero() {
+		return 0, false
+	}
+	return last.Sub(first).Seconds(), true
+}
+
+func fieldChecksums(d *decode.D, cs flowsdecoder.Checksums, checksumOffload string, checksumOffloadRatio float64) {
+	if checksumOffload == checksumOffloadAuto {
+		cs.ClassifyOffload(checksumOffloadRatio)
+	}
+
+	d.FieldStruct("checksums", func(d *decode.D) {
+		d.FieldValueStr("checksum_offload", checksumOffload)
+		d.FieldValueU("packets", cs.Packets)
+		d.FieldValueU("failed_packets", cs.Failed)
+		likelyOffload := false
+		d.FieldArray("failing_hosts", func(d *decode.D) {
+			for _, h := range cs.Hosts {
+				if h.SentFailed == 0 {
+					continue
+				}
+				likelyOffload = likelyOffload || h.LikelyOffload
+				d.FieldStruct("host", func(d *decode.D) {
+					d.FieldValueStr("ip", h.IP.String())
+					d.FieldValueU("sent_packets", h.SentPackets)
+					d.FieldValueU("sent_failed", h.SentFailed)
+					d.FieldValueU("received_packets", h.ReceivedPackets)
+					d.FieldValueU("received_failed", h.ReceivedFailed)
+					d.FieldValueBool("likely_offload", h.LikelyOffload)
+				})
+			}
+		})
+		d.FieldValueBool("likely_offload", likelyOffload)
+		d.FieldArray("errors", func(d *decode.D) {
+			for _, ce := range cs.Errors {
+				d.FieldStruct("error", func(d *decode.D) {
+					d.FieldValueS("packet_index", ce.PacketIndex)
+					d.FieldValueStr("layer", ce.Layer)
+					d.FieldValueStr("source_ip", ce.SourceIP.String())
+					d.FieldValueStr("destination_ip", ce.DestinationIP.String())
+					d.FieldValueU("expected", uint64(ce.Expected), scalar.ActualHex)
+					d.FieldValueU("actual", uint64(ce.Actual), scalar.ActualHex)
+					if ce.LikelyOffload {
+						d.FieldValueStr("reason", "likely_offload", scalar.Description("likely checksum offload"))
+					} else {
+						d.FieldValueStr("reason", "mismatch")
+					}
+				})
+			}
+		})
+	})
+}
+
+func fieldICMPMessage(d *decode.D, prefix string, m *flowsdecoder.ICMPMessage) {
+	d.FieldValueS(prefix+"packet_index", m.PacketIndex)
+	if !m.Timestamp.IsZero() {
+		d.FieldValueFloat(prefix+"timestamp", unixFloat(m.Timestamp), scalar.DescriptionActualFUnixTime)
+	}
+}
+
+func fieldICMPExchanges(d *decode.D, exchanges []*flowsdecoder.ICMPExchange, ipv4PacketFormat decode.Group) {
+	d.FieldArray("icmp_exchanges", func(d *decode.D) {
+		for _, e := range exchanges {
+			d.FieldStruct("icmp_exchange", func(d *decode.D) {
+				d.FieldValueStr("kind", e.Kind)
+				d.FieldValueS("ip_version", int64(e.Version))
+				d.FieldValueStr("source_ip", e.SourceIP.String())
+				d.FieldValueStr("destination_ip", e.DestinationIP.String())
+				d.FieldValueU("type", uint64(e.Type))
+				d.FieldValueU("code", uint64(e.Code))
+
+				switch e.Kind {
+				case flowsdecoder.ICMPExchangeEcho:
+					d.FieldValueU("id", uint64(e.ID))
+					d.FieldValueU("seq", uint64(e.Seq))
+					if e.Request != nil {
+						fieldICMPMessage(d, "request_", e.Request)
+					}
+					if e.Reply != nil {
+						fieldICMPMessage(d, "reply_", e.Reply)
+					}
+					if e.Request != nil && e.Reply != nil && !e.Request.Timestamp.IsZero() {
+						d.FieldValueFloat("rtt", e.Reply.Timestamp.Sub(e.Request.Timestamp).Seconds())
+					}
+				case flowsdecoder.ICMPExchangeError:
+					fieldICMPMessage(d, "", e.Request)
+					br := bitio.NewBitReader(e.Quoted, -1)
+					if e.Version == 4 {
+						if dv, _, _ := d.TryFieldFormatBitBuf("quoted", br, ipv4PacketFormat, nil); dv != nil {
+							return
+						}
+					}
+					d.FieldRootBitBuf("quoted", br)
+				}
+			})
+		}
+	})
+}
+
+func fieldOtherPackets(d *decode.D, packets []flowsdecoder.OtherPacket, linkFrameFormat decode.Group) {
+	d.FieldArray("other_packets", func(d *decode.D) {
+		for _, op := range packets {
+			d.FieldStruct("other_packet", func(d *decode.D) {
+				d.FieldValueS("packet_index", op.PacketIndex)
+				d.FieldValueU("link_type", uint64(op.LinkType), format.LinkTypeMap)
+				if op.EtherType != flowsdecoder.ProtocolOther {
+					d.FieldValueU("ether_type", uint64(op.EtherType), format.EtherTypeMap, scalar.ActualHex)
+				}
+				br := bitio.NewBitReader(op.Frame, -1)
+				if dv, _, _ := d.TryFieldFormatBitBuf(
+					"frame",
+					br,
+					linkFrameFormat,
+					format.LinkFrameIn{
+						Type:           op.LinkType,
+						IsLittleEndian: d.Endian == decode.LittleEndian,
+					},
+				); dv == nil {
+					d.FieldRootBitBuf("frame", br)
+				}
+			})
+		}
+	})
 }
 
 // TODO: make some of this shared if more packet capture formats are added
-func fieldFlows(d *decode.D, fd *flowsdecoder.Decoder, tcpStreamFormat decode.Group, ipv4PacketFormat decode.Group) {
+func fieldFlows(d *decode.D, fd *flowsdecoder.Decoder, checksumOffload string, checksumOffloadRatio float64, linkFrameFormat decode.Group, tcpStreamFormat decode.Group, udpStreamFormat decode.Group, ipv4PacketFormat decode.Group) {
+	fieldProtocolSummary(d, fd.ProtocolSummary, len(fd.PacketErrors))
+
+	d.FieldArray("flow_errors", func(d *decode.D) {
+		for _, pe := range fd.PacketErrors {
+			d.FieldStruct("flow_error", func(d *decode.D) {
+				d.FieldValueS("packet_index", pe.PacketIndex)
+				d.FieldValueStr("error", pe.Err.Error())
+			})
+		}
+	})
+
+	if fd.CheckChecksums {
+		fieldChecksums(d, fd.Checksums, checksumOffload, checksumOffloadRatio)
+	}
+
 	d.FieldArray("ipv4_reassembled", func(d *decode.D) {
 		for _, p := range fd.IPV4Reassembled {
 			br := bitio.NewBitReader(p.Datagram, -1)
@@ -58,6 +304,28 @@ func fieldFlows(d *decode.D, fd *flowsdecoder.Decoder, tcpStreamFormat decode.Gr
 					d.FieldValueBool("has_start", td.HasStart)
 					d.FieldValueBool("has_end", td.HasEnd)
 					d.FieldValueU("skipped_bytes", td.SkippedBytes)
+					if !td.FirstTimestamp.IsZero() {
+						d.FieldValueFloat("first_timestamp", unixFloat(td.FirstTimestamp), scalar.DescriptionActualFUnixTime)
+						d.FieldValueFloat("last_timestamp", unixFloat(td.LastTimestamp), scalar.DescriptionActualFUnixTime)
+					}
+					d.FieldValueU("bytes", td.Bytes)
+					d.FieldValueU("segments", td.Segments)
+					d.FieldValueU("retransmitted_segments", td.RetransmittedSegments)
+					d.FieldValueU("out_of_order_segments", td.OutOfOrderSegments)
+					d.FieldArray("tcp_flags", func(d *decode.D) {
+						for _, n := range td.Flags.Names() {
+							d.FieldValueStr("flag", n)
+						}
+					})
+					d.FieldArray("source_ranges", func(d *decode.D) {
+						for _, sr := range td.SourceRanges {
+							d.FieldStruct("source_range", func(d *decode.D) {
+								d.FieldValueS("stream_offset", sr.StreamOffset)
+								d.FieldValueS("offset", sr.Offset)
+								d.FieldValueS("size", sr.Length)
+							})
+						}
+					})
 
 					br := bitio.NewBitReader(td.Buffer.Bytes(), -1)
 					if dv, _, _ := d.TryFieldFormatBitBuf(
@@ -90,7 +358,79 @@ func fieldFlows(d *decode.D, fd *flowsdecoder.Decoder, tcpStreamFormat decode.Gr
 						DestinationPort: s.Client.Endpoint.Port,
 					})
 				})
+				if duration, ok := connectionDuration(s); ok {
+					d.FieldValueFloat("duration", duration)
+				}
+				d.FieldValueStr("close_reason", s.CloseReason())
+				// only present if seen, common for bgp sessions between routers
+				if s.Client.MD5Signature || s.Server.MD5Signature {
+					d.FieldValueBool("md5_protected", true, scalar.Description("TCP MD5 signature option seen"))
+				}
+				if s.Client.AuthenticationOption || s.Server.AuthenticationOption {
+					d.FieldValueBool("ao_protected", true, scalar.Description("TCP Authentication Option seen"))
+				}
 			})
 		}
 	})
+
+	d.FieldArray("udp_flows", func(d *decode.D) {
+		for _, s := range fd.UDPFlows {
+			d.FieldStruct("udp_flow", func(d *decode.D) {
+				f := func(d *decode.D, ud *flowsdecoder.UDPDirection, usi format.UDPStreamIn) {
+					d.FieldValueStr("ip", ud.Endpoint.IP.String())
+					d.FieldValueU("port", uint64(ud.Endpoint.Port), format.UDPPortMap)
+					if !ud.FirstTimestamp.IsZero() {
+						d.FieldValueFloat("first_timestamp", unixFloat(ud.FirstTimestamp), scalar.DescriptionActualFUnixTime)
+						d.FieldValueFloat("last_timestamp", unixFloat(ud.LastTimestamp), scalar.DescriptionActualFUnixTime)
+					}
+					d.FieldArray("datagrams", func(d *decode.D) {
+						for _, sr := range ud.Datagrams {
+							d.FieldStruct("datagram", func(d *decode.D) {
+								d.FieldValueS("stream_offset", sr.StreamOffset)
+								d.FieldValueS("offset", sr.Offset)
+								d.FieldValueS("size", sr.Length)
+							})
+						}
+					})
+
+					br := bitio.NewBitReader(ud.Buffer.Bytes(), -1)
+					if dv, _, _ := d.TryFieldFormatBitBuf(
+						"stream",
+						br,
+						udpStreamFormat,
+						usi,
+					); dv == nil {
+						d.FieldRootBitBuf("stream", br)
+					}
+				}
+				datagramSizes := func(ud *flowsdecoder.UDPDirection) []int64 {
+					var sizes []int64
+					for _, sr := range ud.Datagrams {
+						sizes = append(sizes, sr.Length)
+					}
+					return sizes
+				}
+
+				d.FieldStruct("client", func(d *decode.D) {
+					f(d, &s.Client, format.UDPStreamIn{
+						IsClient:        true,
+						SourcePort:      s.Client.Endpoint.Port,
+						DestinationPort: s.Server.Endpoint.Port,
+						DatagramSizes:   datagramSizes(&s.Client),
+					})
+				})
+				d.FieldStruct("server", func(d *decode.D) {
+					f(d, &s.Server, format.UDPStreamIn{
+						IsClient:        false,
+						SourcePort:      s.Server.Endpoint.Port,
+						DestinationPort: s.Client.Endpoint.Port,
+						DatagramSizes:   datagramSizes(&s.Server),
+					})
+				})
+			})
+		}
+	})
+
+	fieldICMPExchanges(d, fd.ICMPExchanges, ipv4PacketFormat)
+	fieldOtherPackets(d, fd.OtherPackets, linkFrameFormat)
 }
@@ -5,7 +5,6 @@ package png
 // https://wiki.mozilla.org/APNG_Specification
 
 import (
-	"compress/zlib"
 	"hash/crc32"
 
 	"github.com/wader/fq/format"
@@ -127,10 +126,10 @@ func pngDecode(d *decode.D, _ any) any {
 
 				switch compressionMethod {
 				case compressionDeflate:
-					d.FieldFormatReaderLen("uncompressed", dataLen, zlib.NewReader, decode.FormatFn(func(d *decode.D, _ any) any {
+					d.FieldCompressedLen("uncompressed", dataLen, decode.CompressionZlib, decode.FormatFn(func(d *decode.D, _ any) any {
 						d.FieldUTF8("text", int(d.BitsLeft()/8))
 						return nil
-					}))
+					}), nil)
 				default:
 					d.FieldRawLen("data", dataLen)
 				}
@@ -144,7 +143,7 @@ func pngDecode(d *decode.D, _ any) any {
 
 				switch compressionMethod {
 				case compressionDeflate:
-					d.FieldFormatReaderLen("uncompressed", dataLen, zlib.NewReader, iccProfileFormat)
+					d.FieldCompressedLen("uncompressed", dataLen, decode.CompressionZlib, iccProfileFormat, nil)
 				default:
 					d.FieldRawLen("data", dataLen)
 				}
@@ -0,0 +1,117 @@
+package format_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/wader/fq/format/all"
+	"github.com/wader/fq/internal/difftest"
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+)
+
+const probeTimeout = 10 * time.Second
+
+// probeCorpusFiles returns all test fixtures and probe corpus files
+func probeCorpusFiles(t *testing.T) []string {
+	var paths []string
+	if err := filepath.Walk(".", func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() ||
+			filepath.Ext(path) == ".fqtest" ||
+			!strings.Contains(filepath.ToSlash(path), "testdata/") ||
+			path == filepath.Join("testdata", "probe_accepts.txt") {
+			return nil
+		}
+		paths = append(paths, path)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+type probeResult struct {
+	ok       bool
+	panicErr any
+	stack    string
+}
+
+func probeDecode(f decode.Format, b []byte) probeResult {
+	resultCh := make(chan probeResult, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				resultCh <- probeResult{panicErr: r}
+			}
+		}()
+		_, _, err := decode.Decode(
+			context.Background(),
+			bitio.NewBitReader(b, -1),
+			decode.Group{f},
+			decode.Options{IsRoot: true},
+		)
+		resultCh <- probeResult{ok: err == nil}
+	}()
+
+	select {
+	case r := <-resultCh:
+		return r
+	case <-time.After(probeTimeout):
+		return probeResult{panicErr: fmt.Errorf("timeout after %s", probeTimeout)}
+	}
+}
+
+// TestProbeCorpus decodes all fixtures and probe corpus files using each probe format and fails if
+// a decoder panics or does not finish. Which formats that accept each file is compared to
+// testdata/probe_accepts.txt to notice changes that could affect probe order, update it using
+// WRITE_ACTUAL=1.
+func TestProbeCorpus(t *testing.T) {
+	probeGroup := interp.DefaultRegistry.MustFormatGroup("probe")
+	paths := probeCorpusFiles(t)
+
+	difftest.TestWithOptions(t, difftest.Options{
+		Path:        "testdata",
+		Pattern:     "probe_accepts.txt",
+		ColorDiff:   os.Getenv("DIFF_COLOR") != "",
+		WriteOutput: os.Getenv("WRITE_ACTUAL") != "",
+		Fn: func(t *testing.T, path, input string) (string, string, error) {
+			sb := &strings.Builder{}
+			for _, p := range paths {
+				b, err := ioutil.ReadFile(p)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				var accepts []string
+				for _, f := range probeGroup {
+					r := probeDecode(f, b)
+					if r.panicErr != nil {
+						t.Errorf("%s: %s: %v", p, f.Name, r.panicErr)
+						continue
+					}
+					if r.ok {
+						accepts = append(accepts, f.Name)
+					}
+				}
+				if len(accepts) == 0 {
+					accepts = []string{"-"}
+				}
+				fmt.Fprintf(sb, "%s: %s\n", filepath.ToSlash(p), strings.Join(accepts, " "))
+			}
+
+			return path, sb.String(), nil
+		},
+	})
+}
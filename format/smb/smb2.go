@@ -0,0 +1,555 @@
+package smb
+
+// https://learn.microsoft.com/en-us/openspecs/windows_protocols/ms-smb2/
+// https://www.rfc-editor.org/rfc/rfc1002 NetBIOS session service
+
+// TODO: negotiate and create contexts
+// TODO: more commands, ioctl, query_directory, query_info etc
+
+import (
+	"encoding/binary"
+	"time"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+func init() {
+	interp.RegisterFormat(decode.Format{
+		Name:        format.SMB2,
+		Description: "Server Message Block 2 and 3",
+		Groups: []string{
+			format.TCP_STREAM,
+		},
+		DecodeFn: smb2Decode,
+	})
+}
+
+const (
+	netbiosSessionMessage = 0x00
+)
+
+var netbiosMessageTypeMap = scalar.UToScalar{
+	netbiosSessionMessage: {Sym: "session_message", Description: "Session message"},
+	0x81:                  {Sym: "session_request", Description: "Session request"},
+	0x82:                  {Sym: "positive_response", Description: "Positive session response"},
+	0x83:                  {Sym: "negative_response", Description: "Negative session response"},
+	0x84:                  {Sym: "retarget_response", Description: "Retarget session response"},
+	0x85:                  {Sym: "keep_alive", Description: "Session keep alive"},
+}
+
+const (
+	smb1ProtocolID          = 0xff_53_4d_42 // \xffSMB
+	smb2ProtocolID          = 0xfe_53_4d_42 // \xfeSMB
+	smb2TransformProtocolID = 0xfd_53_4d_42 // \xfdSMB
+)
+
+var protocolIDMap = scalar.UToScalar{
+	smb1ProtocolID:          {Sym: "smb1", Description: "SMB1, not decoded"},
+	smb2ProtocolID:          {Sym: "smb2"},
+	smb2TransformProtocolID: {Sym: "smb2_transform", Description: "Encrypted message"},
+}
+
+const smb2HeaderSize = 64
+
+const (
+	smb2CommandNegotiate    = 0x00
+	smb2CommandSessionSetup = 0x01
+	smb2CommandTreeConnect  = 0x03
+	smb2CommandCreate       = 0x05
+	smb2CommandClose        = 0x06
+	smb2CommandRead         = 0x08
+	smb2CommandWrite        = 0x09
+)
+
+var smb2CommandMap = scalar.UToScalar{
+	smb2CommandNegotiate:    {Sym: "negotiate"},
+	smb2CommandSessionSetup: {Sym: "session_setup"},
+	0x02:                    {Sym: "logoff"},
+	smb2CommandTreeConnect:  {Sym: "tree_connect"},
+	0x04:                    {Sym: "tree_disconnect"},
+	smb2CommandCreate:       {Sym: "create"},
+	smb2CommandClose:        {Sym: "close"},
+	0x07:                    {Sym: "flush"},
+	smb2CommandRead:         {Sym: "read"},
+	smb2CommandWrite:        {Sym: "write"},
+	0x0a:                    {Sym: "lock"},
+	0x0b:                    {Sym: "ioctl"},
+	0x0c:                    {Sym: "cancel"},
+	0x0d:                    {Sym: "echo"},
+	0x0e:                    {Sym: "query_directory"},
+	0x0f:                    {Sym: "change_notify"},
+	0x10:                    {Sym: "query_info"},
+	0x11:                    {Sym: "set_info"},
+	0x12:                    {Sym: "oplock_break"},
+}
+
+const ntStatusMoreProcessingRequired = 0xc0000016
+
+// common NTSTATUS values, https://learn.microsoft.com/en-us/openspecs/windows_protocols/ms-erref/
+var ntStatusMap = scalar.UToScalar{
+	0x00000000:                     {Sym: "success"},
+	0x00000103:                     {Sym: "pending"},
+	0x80000005:                     {Sym: "buffer_overflow"},
+	0x80000006:                     {Sym: "no_more_files"},
+	0xc000000d:                     {Sym: "invalid_parameter"},
+	0xc0000011:                     {Sym: "end_of_file"},
+	ntStatusMoreProcessingRequired: {Sym: "more_processing_required"},
+	0xc0000022:                     {Sym: "access_denied"},
+	0xc0000034:                     {Sym: "object_name_not_found"},
+	0xc0000035:                     {Sym: "object_name_collision"},
+	0xc000003a:                     {Sym: "object_path_not_found"},
+	0xc0000043:                     {Sym: "sharing_violation"},
+	0xc000006d:                     {Sym: "logon_failure"},
+	0xc00000bb:                     {Sym: "not_supported"},
+	0xc00000cc:                     {Sym: "bad_network_name"},
+	0xc0000101:                     {Sym: "directory_not_empty"},
+	0xc0000120:                     {Sym: "cancelled"},
+	0xc0000128:                     {Sym: "file_closed"},
+	0xc0000203:                     {Sym: "user_session_deleted"},
+}
+
+var smb2DialectMap = scalar.UToScalar{
+	0x0202: {Sym: "smb_2.0.2"},
+	0x0210: {Sym: "smb_2.1"},
+	0x0300: {Sym: "smb_3.0"},
+	0x0302: {Sym: "smb_3.0.2"},
+	0x0311: {Sym: "smb_3.1.1"},
+	0x02ff: {Sym: "smb_2.x", Description: "Wildcard revision"},
+}
+
+var smb2ShareTypeMap = scalar.UToSymStr{
+	0x01: "disk",
+	0x02: "pipe",
+	0x03: "print",
+}
+
+var smb2OplockLevelMap = scalar.UToSymStr{
+	0x00: "none",
+	0x01: "ii",
+	0x08: "exclusive",
+	0x09: "batch",
+	0xff: "lease",
+}
+
+var smb2CreateDispositionMap = scalar.UToSymStr{
+	0: "supersede",
+	1: "open",
+	2: "create",
+	3: "open_if",
+	4: "overwrite",
+	5: "overwrite_if",
+}
+
+var smb2CreateActionMap = scalar.UToSymStr{
+	0: "superseded",
+	1: "opened",
+	2: "created",
+	3: "overwritten",
+}
+
+// 100ns intervals since 1601-01-01
+var filetimeEpochDate = time.Date(1601, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+var descriptionFiletime = scalar.Fn(func(s scalar.S) (scalar.S, error) {
+	v := s.ActualU()
+	if v == 0 {
+		return s, nil
+	}
+	s.Description = filetimeEpochDate.
+		Add(time.Duration(v/10_000_000) * time.Second).
+		Add(time.Duration(v%10_000_000) * 100).
+		Format(time.RFC3339Nano)
+	return s, nil
+})
+
+type smb2Header struct {
+	command     uint64
+	status      uint64
+	isResponse  bool
+	nextCommand uint64
+}
+
+func fieldFileID(d *decode.D) {
+	d.FieldStruct("file_id", func(d *decode.D) {
+		d.FieldU64("persistent", scalar.ActualHex)
+		d.FieldU64("volatile", scalar.ActualHex)
+	})
+}
+
+// fieldBuffer adds a variable length buffer at offset relative to start of header, buffers
+// overlapping already decoded fields or outside of message are left for the trailing raw data
+func fieldBuffer(d *decode.D, headerPos int64, offset uint64, length uint64, fn func(d *decode.D, nBytes int)) {
+	if length == 0 {
+		return
+	}
+	start := headerPos + int64(offset)*8
+	if start < d.Pos() || start+int64(length)*8 > d.Len() {
+		return
+	}
+	if start > d.Pos() {
+		d.FieldRawLen("padding", start-d.Pos())
+	}
+	fn(d, int(length))
+}
+
+func rawBuffer(name string) func(d *decode.D, nBytes int) {
+	return func(d *decode.D, nBytes int) { d.FieldRawLen(name, int64(nBytes)*8) }
+}
+
+func utf16Buffer(name string) func(d *decode.D, nBytes int) {
+	return func(d *decode.D, nBytes int) { d.FieldUTF16LE(name, nBytes) }
+}
+
+func smb2DecodeHeader(d *decode.D) smb2Header {
+	var h smb2Header
+
+	// flags are needed to know if this is a response before decoding the credit field
+	flags := binary.LittleEndian.Uint32(d.PeekBytes(20)[16:20])
+	h.isResponse = flags&0x1 != 0
+	isAsync := flags&0x2 != 0
+
+	d.FieldU32BE("protocol_id", protocolIDMap, scalar.ActualHex)
+	d.FieldU16("structure_size", d.AssertU(smb2HeaderSize))
+	d.FieldU16("credit_charge")
+	h.status = d.FieldU32("status", ntStatusMap, scalar.ActualHex)
+	h.command = d.FieldU16("command", smb2CommandMap)
+	if h.isResponse {
+		d.FieldU16("credit_response")
+	} else {
+		d.FieldU16("credit_request")
+	}
+	// little endian 32 bit flags, bits in byte order
+	d.FieldStruct("flags", func(d *decode.D) {
+		d.Endian = decode.BigEndian
+		d.FieldU1("unused0")
+		d.FieldU3("priority")
+		d.FieldBool("signed")
+		d.FieldBool("related_operations")
+		d.FieldBool("async_command")
+		d.FieldBool("server_to_redir")
+		d.FieldU16("unused1")
+		d.FieldU2("unused2")
+		d.FieldBool("replay_operation")
+		d.FieldBool("dfs_operations")
+		d.FieldU4("unused3")
+	})
+	h.nextCommand = d.FieldU32("next_command")
+	d.FieldU64("message_id")
+	if isAsync {
+		d.FieldU64("async_id", scalar.ActualHex)
+	} else {
+		d.FieldU32("reserved")
+		d.FieldU32("tree_id", scalar.ActualHex)
+	}
+	d.FieldU64("session_id", scalar.ActualHex)
+	d.FieldRawLen("signature", 16*8)
+
+	return h
+}
+
+func smb2DecodeNegotiate(d *decode.D, headerPos int64, isResponse bool) {
+	d.FieldU16("structure_size")
+	if !isResponse {
+		dialectCount := d.FieldU16("dialect_count")
+		d.FieldU16("security_mode", scalar.ActualHex)
+		d.FieldU16("reserved")
+		d.FieldU32("capabilities", scalar.ActualHex)
+		d.FieldRawLen("client_guid", 16*8)
+		d.FieldU32("negotiate_context_offset")
+		d.FieldU16("negotiate_context_count")
+		d.FieldU16("reserved2")
+		d.FieldArray("dialects", func(d *decode.D) {
+			for i := uint64(0); i < dialectCount; i++ {
+				d.FieldU16("dialect", smb2DialectMap, scalar.ActualHex)
+			}
+		})
+		return
+	}
+
+	d.FieldU16("security_mode", scalar.ActualHex)
+	d.FieldU16("dialect_revision", smb2DialectMap, scalar.ActualHex)
+	d.FieldU16("negotiate_context_count")
+	d.FieldRawLen("server_guid", 16*8)
+	d.FieldU32("capabilities", scalar.ActualHex)
+	d.FieldU32("max_transact_size")
+	d.FieldU32("max_read_size")
+	d.FieldU32("max_write_size")
+	d.FieldU64("system_time", descriptionFiletime)
+	d.FieldU64("server_start_time", descriptionFiletime)
+	securityBufferOffset := d.FieldU16("security_buffer_offset")
+	securityBufferLength := d.FieldU16("security_buffer_length")
+	d.FieldU32("negotiate_context_offset")
+	fieldBuffer(d, headerPos, securityBufferOffset, securityBufferLength, rawBuffer("security_buffer"))
+}
+
+func smb2DecodeSessionSetup(d *decode.D, headerPos int64, isResponse bool) {
+	d.FieldU16("structure_size")
+	if !isResponse {
+		d.FieldU8("flags", scalar.ActualHex)
+		d.FieldU8("security_mode", scalar.ActualHex)
+		d.FieldU32("capabilities", scalar.ActualHex)
+		d.FieldU32("channel")
+		securityBufferOffset := d.FieldU16("security_buffer_offset")
+		securityBufferLength := d.FieldU16("security_buffer_length")
+		d.FieldU64("previous_session_id", scalar.ActualHex)
+		fieldBuffer(d, headerPos, securityBufferOffset, securityBufferLength, rawBuffer("security_buffer"))
+		return
+	}
+
+	d.FieldU16("session_flags", scalar.ActualHex)
+	securityBufferOffset := d.FieldU16("security_buffer_offset")
+	securityBufferLength := d.FieldU16("security_buffer_length")
+	fieldBuffer(d, headerPos, securityBufferOffset, securityBufferLength, rawBuffer("security_buffer"))
+}
+
+func smb2DecodeTreeConnect(d *decode.D, headerPos int64, isResponse bool) {
+	d.FieldU16("structure_size")
+	if !isResponse {
+		d.FieldU16("flags", scalar.ActualHex)
+		pathOffset := d.FieldU16("path_offset")
+		pathLength := d.FieldU16("path_length")
+		fieldBuffer(d, headerPos, pathOffset, pathLength, utf16Buffer("path"))
+		return
+	}
+
+	d.FieldU8("share_type", smb2ShareTypeMap)
+	d.FieldU8("reserved")
+	d.FieldU32("share_flags", scalar.ActualHex)
+	d.FieldU32("capabilities", scalar.ActualHex)
+	d.FieldU32("maximal_access", scalar.ActualHex)
+}
+
+func smb2DecodeCreate(d *decode.D, headerPos int64, isResponse bool) {
+	d.FieldU16("structure_size")
+	if !isResponse {
+		d.FieldU8("security_flags")
+		d.FieldU8("requested_oplock_level", smb2OplockLevelMap)
+		d.FieldU32("impersonation_level")
+		d.FieldU64("smb_create_flags")
+		d.FieldU64("reserved")
+		d.FieldU32("desired_access", scalar.ActualHex)
+		d.FieldU32("file_attributes", scalar.ActualHex)
+		d.FieldU32("share_access", scalar.ActualHex)
+		d.FieldU32("create_disposition", smb2CreateDispositionMap)
+		d.FieldU32("create_options", scalar.ActualHex)
+		nameOffset := d.FieldU16("name_offset")
+		nameLength := d.FieldU16("name_length")
+		d.FieldU32("create_contexts_offset")
+		d.FieldU32("create_contexts_length")
+		fieldBuffer(d, headerPos, nameOffset, nameLength, utf16Buffer("name"))
+		return
+	}
+
+	d.FieldU8("oplock_level", smb2OplockLevelMap)
+	d.FieldU8("flags", scalar.ActualHex)
+	d.FieldU32("create_action", smb2CreateActionMap)
+	d.FieldU64("creation_time", descriptionFiletime)
+	d.FieldU64("last_access_time", descriptionFiletime)
+	d.FieldU64("last_write_time", descriptionFiletime)
+	d.FieldU64("change_time", descriptionFiletime)
+	d.FieldU64("allocation_size")
+	d.FieldU64("end_of_file")
+	d.FieldU32("file_attributes", scalar.ActualHex)
+	d.FieldU32("reserved2")
+	fieldFileID(d)
+	d.FieldU32("create_contexts_offset")
+	d.FieldU32("create_contexts_length")
+}
+
+func smb2DecodeClose(d *decode.D, isResponse bool) {
+	d.FieldU16("structure_size")
+	d.FieldU16("flags", scalar.ActualHex)
+	d.FieldU32("reserved")
+	if !isResponse {
+		fieldFileID(d)
+		return
+	}
+
+	d.FieldU64("creation_time", descriptionFiletime)
+	d.FieldU64("last_access_time", descriptionFiletime)
+	d.FieldU64("last_write_time", descriptionFiletime)
+	d.FieldU64("change_time", descriptionFiletime)
+	d.FieldU64("allocation_size")
+	d.FieldU64("end_of_file")
+	d.FieldU32("file_attributes", scalar.ActualHex)
+}
+
+func smb2DecodeRead(d *decode.D, headerPos int64, isResponse bool) {
+	d.FieldU16("structure_size")
+	if !isResponse {
+		d.FieldU8("padding")
+		d.FieldU8("flags", scalar.ActualHex)
+		d.FieldU32("length")
+		d.FieldU64("offset")
+		fieldFileID(d)
+		d.FieldU32("minimum_count")
+		d.FieldU32("channel")
+		d.FieldU32("remaining_bytes")
+		d.FieldU16("read_channel_info_offset")
+		d.FieldU16("read_channel_info_length")
+		return
+	}
+
+	dataOffset := d.FieldU8("data_offset")
+	d.FieldU8("reserved")
+	dataLength := d.FieldU32("data_length")
+	d.FieldU32("data_remaining")
+	d.FieldU32("flags", scalar.ActualHex)
+	fieldBuffer(d, headerPos, dataOffset, dataLength, rawBuffer("data"))
+}
+
+func smb2DecodeWrite(d *decode.D, headerPos int64, isResponse bool) {
+	d.FieldU16("structure_size")
+	if !isResponse {
+		dataOffset := d.FieldU16("data_offset")
+		length := d.FieldU32("length")
+		d.FieldU64("offset")
+		fieldFileID(d)
+		d.FieldU32("channel")
+		d.FieldU32("remaining_bytes")
+		d.FieldU16("write_channel_info_offset")
+		d.FieldU16("write_channel_info_length")
+		d.FieldU32("flags", scalar.ActualHex)
+		fieldBuffer(d, headerPos, dataOffset, length, rawBuffer("data"))
+		return
+	}
+
+	d.FieldU16("reserved")
+	d.FieldU32("count")
+	d.FieldU32("remaining")
+	d.FieldU16("write_channel_info_offset")
+	d.FieldU16("write_channel_info_length")
+}
+
+func smb2DecodeError(d *decode.D) {
+	d.FieldU16("structure_size")
+	d.FieldU8("error_context_count")
+	d.FieldU8("reserved")
+	byteCount := d.FieldU32("byte_count")
+	if byteCount > 0 {
+		d.FieldRawLen("error_data", int64(byteCount)*8)
+	}
+}
+
+func smb2DecodeBody(d *decode.D, headerPos int64, h smb2Header) {
+	// error responses have their own 9 byte structure, session setup response is also 9 bytes
+	// and is a normal response with more_processing_required
+	isError := h.isResponse && h.status&0xc000_0000 == 0xc000_0000 &&
+		!(h.command == smb2CommandSessionSetup && h.status == ntStatusMoreProcessingRequired)
+	if isError && d.BitsLeft() >= 16 && binary.LittleEndian.Uint16(d.PeekBytes(2)) == 9 {
+		smb2DecodeError(d)
+		return
+	}
+
+	switch h.command {
+	case smb2CommandNegotiate:
+		smb2DecodeNegotiate(d, headerPos, h.isResponse)
+	case smb2CommandSessionSetup:
+		smb2DecodeSessionSetup(d, headerPos, h.isResponse)
+	case smb2CommandTreeConnect:
+		smb2DecodeTreeConnect(d, headerPos, h.isResponse)
+	case smb2CommandCreate:
+		smb2DecodeCreate(d, headerPos, h.isResponse)
+	case smb2CommandClose:
+		smb2DecodeClose(d, h.isResponse)
+	case smb2CommandRead:
+		smb2DecodeRead(d, headerPos, h.isResponse)
+	case smb2CommandWrite:
+		smb2DecodeWrite(d, headerPos, h.isResponse)
+	}
+}
+
+func smb2DecodeMessages(d *decode.D) {
+	// compounded messages are chained using next command offsets relative to start of each header
+	d.FieldArray("messages", func(d *decode.D) {
+		for !d.End() {
+			var nextCommand uint64
+			d.FieldStruct("message", func(d *decode.D) {
+				headerPos := d.Pos()
+				var h smb2Header
+				d.FieldStruct("header", func(d *decode.D) { h = smb2DecodeHeader(d) })
+				nextCommand = h.nextCommand
+
+				bodyLen := d.BitsLeft()
+				if nextCommand != 0 {
+					if nextCommand < smb2HeaderSize || headerPos+int64(nextCommand)*8 > d.Len() {
+						d.Fatalf("invalid next command offset %d", nextCommand)
+					}
+					bodyLen = headerPos + int64(nextCommand)*8 - d.Pos()
+				}
+				d.FramedFn(bodyLen, func(d *decode.D) {
+					d.FieldStruct("body", func(d *decode.D) {
+						smb2DecodeBody(d, headerPos, h)
+						if d.BitsLeft() > 0 {
+							d.FieldRawLen("buffer", d.BitsLeft())
+						}
+					})
+				})
+			})
+			if nextCommand == 0 {
+				break
+			}
+		}
+	})
+}
+
+func smb2DecodeTransform(d *decode.D) {
+	d.FieldU32BE("protocol_id", protocolIDMap, scalar.ActualHex)
+	d.FieldRawLen("signature", 16*8)
+	d.FieldRawLen("nonce", 16*8)
+	d.FieldU32("original_message_size")
+	d.FieldU16("reserved")
+	d.FieldU16("flags", scalar.ActualHex)
+	d.FieldU64("session_id", scalar.ActualHex)
+	d.FieldRawLen("encrypted_message", d.BitsLeft())
+}
+
+func smbDecodeSessionMessage(d *decode.D) {
+	if d.BitsLeft() < 32 {
+		d.FieldRawLen("data", d.BitsLeft())
+		return
+	}
+
+	switch binary.BigEndian.Uint32(d.PeekBytes(4)) {
+	case smb2ProtocolID:
+		smb2DecodeMessages(d)
+	case smb2TransformProtocolID:
+		d.FieldStruct("transform", smb2DecodeTransform)
+	case smb1ProtocolID:
+		d.FieldStruct("smb1", func(d *decode.D) {
+			d.FieldU32BE("protocol_id", protocolIDMap, scalar.ActualHex)
+			d.FieldRawLen("data", d.BitsLeft())
+		})
+	default:
+		d.FieldRawLen("data", d.BitsLeft())
+	}
+}
+
+func smb2Decode(d *decode.D, in any) any {
+	if tsi, ok := in.(format.TCPStreamIn); ok {
+		tsi.MustIsPort(d.Fatalf, format.TCPPortMicrosoftDS, format.TCPPortNetBIOSSSN)
+	}
+
+	d.Endian = decode.LittleEndian
+
+	d.FieldArray("packets", func(d *decode.D) {
+		for !d.End() {
+			d.FieldStruct("packet", func(d *decode.D) {
+				typ := d.FieldU8("type", netbiosMessageTypeMap, scalar.ActualHex)
+				length := d.FieldU24BE("length")
+				d.FramedFn(int64(length)*8, func(d *decode.D) {
+					if typ == netbiosSessionMessage {
+						smbDecodeSessionMessage(d)
+					} else if d.BitsLeft() > 0 {
+						d.FieldRawLen("data", d.BitsLeft())
+					}
+				})
+			})
+		}
+	})
+
+	return nil
+}
@@ -0,0 +1,74 @@
+package text
+
+import (
+	"fmt"
+	"mime"
+	"strings"
+
+	"github.com/wader/fq/internal/gojqextra"
+	"github.com/wader/fq/pkg/interp"
+)
+
+func init() {
+	// mime.ParseMediaType handles rfc2231 extended and continued parameters and prefers
+	// extended values, ex: filename* over filename
+	fromParameters := func(params map[string]string) map[string]any {
+		pm := map[string]any{}
+		for k, v := range params {
+			pm[k] = v
+		}
+		return pm
+	}
+
+	interp.RegisterFunc0("frommimetype", func(_ *interp.Interp, c string) any {
+		mediaType, params, err := mime.ParseMediaType(c)
+		if err != nil {
+			return err
+		}
+		typ, subtype, ok := strings.Cut(mediaType, "/")
+		if !ok {
+			return fmt.Errorf("%s: mime type has no subtype", mediaType)
+		}
+		return map[string]any{
+			"type":       typ,
+			"subtype":    subtype,
+			"parameters": fromParameters(params),
+		}
+	})
+	interp.RegisterFunc0("fromcontentdisposition", func(_ *interp.Interp, c string) any {
+		disposition, params, err := mime.ParseMediaType(c)
+		if err != nil {
+			return err
+		}
+		return map[string]any{
+			"type":       disposition,
+			"parameters": fromParameters(params),
+		}
+	})
+	interp.RegisterFunc0("tomimetype", func(_ *interp.Interp, c map[string]any) any {
+		// TODO: nicer
+		c, ok := gojqextra.NormalizeToStrings(c).(map[string]any)
+		if !ok {
+			panic("not map")
+		}
+
+		str := func(v any) string { s, _ := gojqextra.Cast[string](v); return s }
+		mediaType := str(c["type"])
+		if subtype := str(c["subtype"]); subtype != "" {
+			mediaType += "/" + subtype
+		}
+		params := map[string]string{}
+		if pm, ok := gojqextra.Cast[map[string]any](c["parameters"]); ok {
+			for k, v := range pm {
+				params[k] = str(v)
+			}
+		}
+
+		// quotes values with special characters and uses rfc2231 encoding for non-ascii values
+		s := mime.FormatMediaType(mediaType, params)
+		if s == "" {
+			return fmt.Errorf("%s: invalid mime type or parameter", mediaType)
+		}
+		return s
+	})
+}
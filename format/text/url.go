@@ -1,7 +1,9 @@
 package text
 
 import (
+	"errors"
 	"net/url"
+	"strings"
 
 	"github.com/wader/fq/internal/gojqextra"
 	"github.com/wader/fq/pkg/interp"
@@ -30,28 +32,12 @@ func init() {
 		return url.PathEscape(c)
 	})
 
-	fromURLValues := func(q url.Values) any {
-		qm := map[string]any{}
-		for k, v := range q {
-			if len(v) > 1 {
-				vm := []any{}
-				for _, v := range v {
-					vm = append(vm, v)
-				}
-				qm[k] = vm
-			} else {
-				qm[k] = v[0]
-			}
-		}
-
-		return qm
-	}
 	interp.RegisterFunc0("fromurlquery", func(_ *interp.Interp, c string) any {
-		q, err := url.ParseQuery(c)
+		q, err := parseQuery(c)
 		if err != nil {
 			return err
 		}
-		return fromURLValues(q)
+		return q
 	})
 	toURLValues := func(c map[string]any) url.Values {
 		qv := url.Values{}
@@ -70,13 +56,40 @@ func init() {
 		}
 		return qv
 	}
-	interp.RegisterFunc0("tourlquery", func(_ *interp.Interp, c map[string]any) any {
+	// copy as normalize modifies the map and jq values should not be modified
+	normalizeToStrings := func(c map[string]any) map[string]any {
+		cc := make(map[string]any, len(c))
+		for k, v := range c {
+			cc[k] = gojqextra.NormalizeToStrings(v)
+		}
+		return cc
+	}
+	// encodeQuery is like url.Values.Encode but keeps key order if query is an ordered object
+	encodeQuery := func(q any, qv url.Values) string {
+		o, ok := q.(*gojqextra.OrderedObject)
+		if !ok {
+			return qv.Encode()
+		}
+		var sb strings.Builder
+		for _, k := range o.Keys() {
+			for _, v := range qv[k] {
+				if sb.Len() > 0 {
+					sb.WriteByte('&')
+				}
+				sb.WriteString(url.QueryEscape(k))
+				sb.WriteByte('=')
+				sb.WriteString(url.QueryEscape(v))
+			}
+		}
+		return sb.String()
+	}
+	interp.RegisterFunc0("tourlquery", func(_ *interp.Interp, c any) any {
 		// TODO: nicer
-		c, ok := gojqextra.NormalizeToStrings(c).(map[string]any)
+		m, ok := gojqextra.Cast[map[string]any](c)
 		if !ok {
-			panic("not map")
+			return gojqextra.FuncTypeError{Name: "tourlquery", V: c}
 		}
-		return toURLValues(c).Encode()
+		return encodeQuery(c, toURLValues(normalizeToStrings(m)))
 	})
 
 	interp.RegisterFunc0("fromurl", func(_ *interp.Interp, c string) any {
@@ -109,7 +122,9 @@ func init() {
 		}
 		if u.RawQuery != "" {
 			m["rawquery"] = u.RawQuery
-			m["query"] = fromURLValues(u.Query())
+			// invalid pairs are skipped like url.URL.Query does
+			q, _ := parseQuery(u.RawQuery)
+			m["query"] = q
 		}
 		if u.Fragment != "" {
 			m["fragment"] = u.Fragment
@@ -117,11 +132,10 @@ func init() {
 		return m
 	})
 	interp.RegisterFunc0("tourl", func(_ *interp.Interp, c map[string]any) any {
+		// normalize replaces query with a map, get it before to keep key order
+		q := c["query"]
 		// TODO: nicer
-		c, ok := gojqextra.NormalizeToStrings(c).(map[string]any)
-		if !ok {
-			panic("not map")
-		}
+		c = normalizeToStrings(c)
 
 		str := func(v any) string { s, _ := gojqextra.Cast[string](v); return s }
 		u := url.URL{
@@ -145,9 +159,54 @@ func init() {
 			u.RawQuery = s
 		}
 		if qm, ok := gojqextra.Cast[map[string]any](c["query"]); ok {
-			u.RawQuery = toURLValues(qm).Encode()
+			u.RawQuery = encodeQuery(q, toURLValues(qm))
 		}
 
 		return u.String()
 	})
 }
+
+// parseQuery is like url.ParseQuery but keeps order of keys, values of a repeated key
+// are an array. Parses all pairs and returns first error if any.
+func parseQuery(s string) (*gojqextra.OrderedObject, error) {
+	q := gojqextra.NewOrderedObject()
+	var firstErr error
+	for s != "" {
+		var kv string
+		kv, s, _ = strings.Cut(s, "&")
+		if strings.Contains(kv, ";") {
+			if firstErr == nil {
+				firstErr = errors.New("invalid semicolon separator in query")
+			}
+			continue
+		}
+		if kv == "" {
+			continue
+		}
+		k, v, _ := strings.Cut(kv, "=")
+		k, err := url.QueryUnescape(k)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		v, err = url.QueryUnescape(v)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if e, ok := q.Get(k); ok {
+			if ea, ok := e.([]any); ok {
+				q.Set(k, append(ea, v))
+			} else {
+				q.Set(k, []any{e, v})
+			}
+		} else {
+			q.Set(k, v)
+		}
+	}
+	return q, firstErr
+}
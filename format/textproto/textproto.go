@@ -0,0 +1,237 @@
+package textproto
+
+// https://www.rfc-editor.org/rfc/rfc5321 SMTP
+// https://www.rfc-editor.org/rfc/rfc959 FTP
+// https://www.rfc-editor.org/rfc/rfc1939 POP3
+// https://www.rfc-editor.org/rfc/rfc3501 IMAP
+// https://www.rfc-editor.org/rfc/rfc2812 IRC
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/wader/fq/format"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/interp"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+func init() {
+	interp.RegisterFormat(decode.Format{
+		Name:        format.TEXT_PROTOCOL,
+		Description: "Text line protocol (SMTP, FTP, POP3, IMAP, IRC)",
+		Groups: []string{
+			format.TCP_STREAM,
+		},
+		DecodeFn: textProtocolDecode,
+		DecodeInArg: format.TextProtocolIn{
+			Protocol: "smtp",
+		},
+	})
+}
+
+var portProtocols = map[int]string{
+	format.TCPPortFTP:  "ftp",
+	format.TCPPortSMTP: "smtp",
+	format.TCPPortPOP3: "pop3",
+	format.TCPPortIMAP: "imap",
+	format.TCPPortIRC:  "irc",
+}
+
+const (
+	typeCommand  = "command"
+	typeResponse = "response"
+	typeData     = "data"
+)
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// "250-a" -> "250", true, true
+func replyCode(line string) (code string, isReply bool, isContinuation bool) {
+	if len(line) < 3 || !isDigits(line[0:3]) || (len(line) > 3 && line[3] != ' ' && line[3] != '-') {
+		return "", false, false
+	}
+	return line[0:3], true, len(line) > 3 && line[3] == '-'
+}
+
+func firstWord(s string) (string, string) {
+	w, rest, _ := strings.Cut(s, " ")
+	return w, rest
+}
+
+type lineInfo struct {
+	typ          string
+	tag          string
+	prefix       string
+	verb         string
+	code         string
+	continuation bool
+}
+
+// classify line by protocol grammar, responses are recognized by grammar so
+// client and server streams can be decoded the same way
+func classify(protocol string, line string) lineInfo {
+	switch protocol {
+	case "smtp", "ftp":
+		if code, ok, cont := replyCode(line); ok {
+			return lineInfo{typ: typeResponse, code: code, continuation: cont}
+		}
+	case "pop3":
+		switch {
+		case strings.HasPrefix(line, "+OK"):
+			return lineInfo{typ: typeResponse, code: "+OK"}
+		case strings.HasPrefix(line, "-ERR"):
+			return lineInfo{typ: typeResponse, code: "-ERR"}
+		case line == "+" || strings.HasPrefix(line, "+ "):
+			return lineInfo{typ: typeResponse, code: "+"}
+		}
+	case "imap":
+		tag, rest := firstWord(line)
+		word, rest := firstWord(rest)
+		switch {
+		case tag == "*":
+			// "* 3 EXISTS" has the status after the number
+			if isDigits(word) {
+				word, _ = firstWord(rest)
+			}
+			return lineInfo{typ: typeResponse, tag: tag, code: strings.ToUpper(word)}
+		case tag == "+":
+			return lineInfo{typ: typeResponse, tag: tag, code: "+"}
+		}
+		switch strings.ToUpper(word) {
+		case "OK", "NO", "BAD", "PREAUTH", "BYE":
+			return lineInfo{typ: typeResponse, tag: tag, code: strings.ToUpper(word)}
+		}
+		return lineInfo{typ: typeCommand, tag: tag, verb: strings.ToUpper(word)}
+	case "irc":
+		var prefix string
+		rest := line
+		if strings.HasPrefix(rest, ":") {
+			prefix, rest = firstWord(rest)
+			prefix = prefix[1:]
+		}
+		word, _ := firstWord(rest)
+		if len(word) == 3 && isDigits(word) {
+			return lineInfo{typ: typeResponse, prefix: prefix, code: word}
+		}
+		return lineInfo{typ: typeCommand, prefix: prefix, verb: strings.ToUpper(word)}
+	}
+
+	verb, _ := firstWord(line)
+	return lineInfo{typ: typeCommand, verb: strings.ToUpper(verb)}
+}
+
+// peekLine returns next line including line ending and its length in bytes
+func peekLine(d *decode.D) (string, int64) {
+	n, _, err := d.TryPeekFind(8, 8, -1, func(v uint64) bool { return v == '\n' })
+	l := d.BitsLeft() / 8
+	if err == nil && n/8+1 <= l {
+		l = n/8 + 1
+	}
+	b := d.PeekBytes(int(l))
+	if !utf8.Valid(b) {
+		d.Fatalf("invalid UTF-8 line")
+	}
+	for _, c := range b {
+		if c < 0x20 && c != '\t' && c != '\r' && c != '\n' {
+			d.Fatalf("invalid control character 0x%.2x in line", c)
+		}
+	}
+
+	return strings.TrimRight(string(b), "\r\n"), l
+}
+
+func fieldLine(d *decode.D) string {
+	line, l := peekLine(d)
+	d.FieldUTF8("line", int(l), scalar.ActualTrim("\r\n"))
+	return line
+}
+
+func textProtocolDecode(d *decode.D, in any) any {
+	var protocol string
+	switch in := in.(type) {
+	case format.TCPStreamIn:
+		for port, p := range portProtocols {
+			if in.IsPort(port) {
+				protocol = p
+			}
+		}
+		if protocol == "" {
+			d.Fatalf("not a text protocol port client %t src:%d dst:%d", in.IsClient, in.SourcePort, in.DestinationPort)
+		}
+	case format.TextProtocolIn:
+		protocol = in.Protocol
+	}
+
+	switch protocol {
+	case "smtp", "ftp", "pop3", "imap", "irc":
+	default:
+		d.Fatalf("unknown protocol %q", protocol)
+	}
+	d.FieldValueStr("protocol", protocol)
+
+	// smtp mail content after DATA command ends with a "." line
+	inData := false
+	d.FieldArray("messages", func(d *decode.D) {
+		for !d.End() {
+			line, _ := peekLine(d)
+			li := classify(protocol, line)
+
+			d.FieldStruct("message", func(d *decode.D) {
+				if inData {
+					inData = false
+					d.FieldValueStr("type", typeData)
+					d.FieldArray("lines", func(d *decode.D) {
+						for !d.End() {
+							if fieldLine(d) == "." {
+								break
+							}
+						}
+					})
+					return
+				}
+
+				d.FieldValueStr("type", li.typ)
+				if li.tag != "" {
+					d.FieldValueStr("tag", li.tag)
+				}
+				if li.prefix != "" {
+					d.FieldValueStr("prefix", li.prefix)
+				}
+				switch li.typ {
+				case typeCommand:
+					d.FieldValueStr("verb", li.verb)
+					inData = protocol == "smtp" && li.verb == "DATA"
+				case typeResponse:
+					d.FieldValueStr("code", li.code)
+				}
+
+				d.FieldArray("lines", func(d *decode.D) {
+					fieldLine(d)
+					// multi-line reply "250-a" ... "250 b", ftp allows lines without code in between
+					if !li.continuation {
+						return
+					}
+					for !d.End() {
+						line := fieldLine(d)
+						if code, ok, cont := replyCode(line); ok && code == li.code && !cont {
+							break
+						}
+					}
+				})
+			})
+		}
+	})
+
+	return nil
+}
@@ -41,7 +41,7 @@ func commentDecode(d *decode.D, _ any) any {
 			strings.HasPrefix(userComment, metadataBlockPicturePrefixLower) {
 
 			base64Offset := int64(len(metadataBlockPicturePrefix)) * 8
-			base64Len := int64(len(userComment))*8 - base64Offset
+			base64Len := int64(userCommentLength)*8 - base64Offset
 			_, base64Br, dv, _, _ := d.TryFieldReaderRangeFormat(
 				"picture",
 				userCommentStart+base64Offset, base64Len,
@@ -76,7 +76,7 @@ func vorbisDecode(d *decode.D, _ any) any {
 		// 8   8) [blocksize_1] = 2 exponent (read 4 bits as unsigned integer)
 		// 9   9) [framing_flag] = read one bit
 		d.FieldU32("vorbis_version", d.ValidateU(0))
-		d.FieldU8("audio_channels")
+		audioChannels := d.FieldU8("audio_channels", format.VorbisChannelLayouts)
 		d.FieldU32("audio_sample_rate")
 		d.FieldU32("bitrate_maximum")
 		d.FieldU32("bitrate_nominal")
@@ -88,30 +88,10 @@ func vorbisDecode(d *decode.D, _ any) any {
 		// TODO: warning if not 64-8192
 		d.FieldRawLen("padding0", 7, d.BitBufIsZero())
 		d.FieldU1("framing_flag", d.ValidateU(1))
+		format.VorbisChannelLayouts.FieldChannelLayout(d, audioChannels)
 	case packetTypeSetup:
-		d.FieldUFn("vorbis_codebook_count", func(d *decode.D) uint64 { return d.U8() + 1 })
-		d.FieldU24("codecooke_sync", d.ValidateU(0x564342), scalar.ActualHex)
-		d.FieldU16("codebook_dimensions")
-		d.FieldU24("codebook_entries")
-
-		// d.SeekRel(7)
-		// ordered := d.FieldBool("ordered")
-
-		// if ordered {
-
-		// } else {
-		// 	d.SeekRel(-2)
-		// 	sparse := d.FieldBool("sparse")
-		// 	d.SeekRel(1)
-
-		// 	if sparse {
-
-		// 	} else {
-		// 		d.SeekRel(-7)
-		// 		d.FieldU5("length")
-
-		// 	}
-		// }
+		codebookCount := d.FieldUFn("vorbis_codebook_count", func(d *decode.D) uint64 { return d.U8() + 1 })
+		codebooksDecode(d, codebookCount)
 
 	case packetTypeComment:
 		d.FieldFormat("comment", vorbisComment, nil)
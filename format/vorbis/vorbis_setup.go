@@ -0,0 +1,151 @@
+package vorbis
+
+// https://xiph.org/vorbis/doc/Vorbis_I_spec.html#x1-590003.2.1
+
+import (
+	"math"
+
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+const codebookSync = 0x564342
+
+var codebookLookupTypeNames = scalar.UToSymStr{
+	0: "none",
+	1: "implicit",
+	2: "explicit",
+}
+
+// vorbis packs bits LSB first into bytes so bits can't be read directly using decode.D
+// which reads MSB first, only byte aligned fields like the first codebook sync would work
+type lsbBitReader struct {
+	buf []byte
+	pos int64
+	err bool
+}
+
+func (r *lsbBitReader) u(nBits int) uint64 {
+	var v uint64
+	for i := 0; i < nBits; i++ {
+		bytePos := r.pos / 8
+		if bytePos >= int64(len(r.buf)) {
+			r.err = true
+			return 0
+		}
+		v |= uint64((r.buf[bytePos]>>(r.pos%8))&1) << i
+		r.pos++
+	}
+	return v
+}
+
+func (r *lsbBitReader) bool() bool { return r.u(1) == 1 }
+
+// 9.2.1. ilog
+func ilog(x uint64) int {
+	n := 0
+	for x > 0 {
+		n++
+		x >>= 1
+	}
+	return n
+}
+
+// 9.2.3. lookup1_values
+func lookup1Values(entries uint64, dimensions uint64) uint64 {
+	if dimensions == 0 {
+		return 0
+	}
+	r := uint64(math.Floor(math.Pow(float64(entries), 1/float64(dimensions))))
+	// adjust for floating point rounding
+	pow := func(b uint64) uint64 {
+		v := uint64(1)
+		for i := uint64(0); i < dimensions; i++ {
+			v *= b
+		}
+		return v
+	}
+	for pow(r+1) <= entries {
+		r++
+	}
+	for r > 0 && pow(r) > entries {
+		r--
+	}
+	return r
+}
+
+// 9.2.2. float32_unpack
+func float32Unpack(x uint64) float64 {
+	mantissa := float64(x & 0x1fffff)
+	if x&0x80000000 != 0 {
+		mantissa = -mantissa
+	}
+	exponent := int((x & 0x7fe00000) >> 21)
+	return math.Ldexp(mantissa, exponent-788)
+}
+
+// codebooksDecode reads codebook headers, codeword lengths and lookup tables are
+// skipped but not decoded
+// TODO: codeword lengths and vector lookup tables
+func codebooksDecode(d *decode.D, count uint64) {
+	r := &lsbBitReader{buf: d.PeekBytes(int(d.BitsLeft() / 8))}
+
+	d.FieldArray("codebooks", func(d *decode.D) {
+		for i := uint64(0); i < count; i++ {
+			d.FieldStruct("codebook", func(d *decode.D) {
+				d.FieldValueU("sync", r.u(24), d.ValidateU(codebookSync), scalar.ActualHex)
+				dimensions := r.u(16)
+				d.FieldValueU("dimensions", dimensions)
+				entries := r.u(24)
+				d.FieldValueU("entries", entries)
+
+				ordered := r.bool()
+				d.FieldValueBool("ordered", ordered)
+				if !ordered {
+					sparse := r.bool()
+					d.FieldValueBool("sparse", sparse)
+					for j := uint64(0); j < entries; j++ {
+						if !sparse || r.bool() {
+							r.u(5)
+						}
+					}
+				} else {
+					currentEntry := uint64(0)
+					r.u(5)
+					for currentEntry < entries && !r.err {
+						currentEntry += r.u(ilog(entries - currentEntry))
+					}
+					if currentEntry > entries {
+						d.Fatalf("codebook %d: ordered lengths more than %d entries", i, entries)
+					}
+				}
+
+				lookupType := r.u(4)
+				d.FieldValueU("lookup_type", lookupType, codebookLookupTypeNames)
+				switch lookupType {
+				case 0:
+				case 1, 2:
+					d.FieldValueFloat("minimum_value", float32Unpack(r.u(32)))
+					d.FieldValueFloat("delta_value", float32Unpack(r.u(32)))
+					valueBits := r.u(4) + 1
+					d.FieldValueU("value_bits", valueBits)
+					d.FieldValueBool("sequence_p", r.bool())
+					var lookupValues uint64
+					if lookupType == 1 {
+						lookupValues = lookup1Values(entries, dimensions)
+					} else {
+						lookupValues = entries * dimensions
+					}
+					d.FieldValueU("lookup_values", lookupValues)
+					r.pos += int64(lookupValues * valueBits)
+				default:
+					d.Fatalf("codebook %d: unknown lookup type %d", i, lookupType)
+				}
+
+				if r.err || r.pos > int64(len(r.buf))*8 {
+					d.Fatalf("codebook %d: outside packet", i)
+				}
+			})
+		}
+	})
+}
@@ -1,15 +1,19 @@
 package xml
 
 import (
+	"bytes"
 	"embed"
+	"io"
 	"strings"
 
 	"github.com/wader/fq/format"
+	"github.com/wader/fq/internal/gojqextra"
 	"github.com/wader/fq/pkg/bitio"
 	"github.com/wader/fq/pkg/decode"
 	"github.com/wader/fq/pkg/interp"
 	"github.com/wader/fq/pkg/scalar"
 	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
 )
 
 //go:embed html.jq
@@ -21,10 +25,12 @@ func init() {
 		Description: "HyperText Markup Language",
 		DecodeFn:    decodeHTML,
 		DecodeInArg: format.HTMLIn{
-			Seq:   false,
-			Array: false,
+			Seq:       false,
+			Array:     false,
+			HeadOnly:  false,
+			Truncated: false,
 		},
-		Functions: []string{"_todisplay"},
+		Functions: []string{"_todisplay", "_help"},
 	})
 	interp.RegisterFS(htmlFS)
 }
@@ -32,12 +38,12 @@ func init() {
 func fromHTMLObject(n *html.Node, hi format.HTMLIn) any {
 	var f func(n *html.Node, seq int) any
 	f = func(n *html.Node, seq int) any {
-		attrs := map[string]any{}
+		attrs := gojqextra.NewOrderedObject()
 
 		switch n.Type {
 		case html.ElementNode:
 			for _, a := range n.Attr {
-				attrs["-"+a.Key] = a.Val
+				attrs.Set("-"+a.Key, a.Val)
 			}
 		default:
 			// skip
@@ -60,14 +66,14 @@ func fromHTMLObject(n *html.Node, hi format.HTMLIn) any {
 		for c := n.FirstChild; c != nil; c = c.NextSibling {
 			switch c.Type {
 			case html.ElementNode:
-				if e, ok := attrs[c.Data]; ok {
+				if e, ok := attrs.Get(c.Data); ok {
 					if ea, ok := e.([]any); ok {
-						attrs[c.Data] = append(ea, f(c, nSeq))
+						attrs.Set(c.Data, append(ea, f(c, nSeq)))
 					} else {
-						attrs[c.Data] = []any{e, f(c, nSeq)}
+						attrs.Set(c.Data, []any{e, f(c, nSeq)})
 					}
 				} else {
-					attrs[c.Data] = f(c, nSeq)
+					attrs.Set(c.Data, f(c, nSeq))
 				}
 				if nNodes > 1 {
 					nSeq++
@@ -91,21 +97,21 @@ func fromHTMLObject(n *html.Node, hi format.HTMLIn) any {
 			}
 
 			if textSb != nil {
-				attrs["#text"] = strings.TrimSpace(textSb.String())
+				attrs.Set("#text", strings.TrimSpace(textSb.String()))
 			}
 			if commentSb != nil {
-				attrs["#comment"] = strings.TrimSpace(commentSb.String())
+				attrs.Set("#comment", strings.TrimSpace(commentSb.String()))
 			}
 		}
 
 		if hi.Seq && seq != -1 {
-			attrs["#seq"] = seq
+			attrs.Set("#seq", seq)
 		}
 
-		if len(attrs) == 0 {
+		if attrs.Len() == 0 {
 			return ""
-		} else if len(attrs) == 1 && attrs["#text"] != nil {
-			return attrs["#text"]
+		} else if text, ok := attrs.Get("#text"); ok && attrs.Len() == 1 {
+			return text
 		}
 
 		return attrs
@@ -117,12 +123,12 @@ func fromHTMLObject(n *html.Node, hi format.HTMLIn) any {
 func fromHTMLArray(n *html.Node) any {
 	var f func(n *html.Node) any
 	f = func(n *html.Node) any {
-		attrs := map[string]any{}
+		attrs := gojqextra.NewOrderedObject()
 
 		switch n.Type {
 		case html.ElementNode:
 			for _, a := range n.Attr {
-				attrs[a.Key] = a.Val
+				attrs.Set(a.Key, a.Val)
 			}
 		default:
 			// skip
@@ -156,14 +162,14 @@ func fromHTMLArray(n *html.Node) any {
 		}
 
 		if textSb != nil {
-			attrs["#text"] = strings.TrimSpace(textSb.String())
+			attrs.Set("#text", strings.TrimSpace(textSb.String()))
 		}
 		if commentSb != nil {
-			attrs["#comment"] = strings.TrimSpace(commentSb.String())
+			attrs.Set("#comment", strings.TrimSpace(commentSb.String()))
 		}
 
 		elm := []any{n.Data}
-		if len(attrs) > 0 {
+		if attrs.Len() > 0 {
 			elm = append(elm, attrs)
 		}
 		if len(nodes) > 0 {
@@ -176,14 +182,101 @@ func fromHTMLArray(n *html.Node) any {
 	return f(n.FirstChild)
 }
 
+// elements that can appear in head, any other start tag implicitly ends head
+var htmlHeadElements = map[atom.Atom]bool{
+	atom.Html:     true,
+	atom.Head:     true,
+	atom.Base:     true,
+	atom.Basefont: true,
+	atom.Bgsound:  true,
+	atom.Link:     true,
+	atom.Meta:     true,
+	atom.Noscript: true,
+	atom.Script:   true,
+	atom.Style:    true,
+	atom.Template: true,
+	atom.Title:    true,
+}
+
+// elements where the tokenizer reads raw text until the end tag
+var htmlRawTextElements = map[atom.Atom]bool{
+	atom.Iframe:    true,
+	atom.Noembed:   true,
+	atom.Noframes:  true,
+	atom.Plaintext: true,
+	atom.Script:    true,
+	atom.Style:     true,
+	atom.Textarea:  true,
+	atom.Title:     true,
+	atom.Xmp:       true,
+}
+
+// htmlScan tokenizes r until EOF, or if headOnly until end of head. Returns bytes to parse and
+// byte offset of a tag, comment, doctype or raw text element that was unfinished at EOF, -1 if
+// input ended cleanly or head ended.
+func htmlScan(r io.Reader, headOnly bool) ([]byte, int64, error) {
+	buf := &bytes.Buffer{}
+	z := html.NewTokenizer(io.TeeReader(r, buf))
+	var offset int64
+	rawTextOffset := int64(-1)
+	for {
+		tokenOffset := offset
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			if z.Err() != io.EOF {
+				return nil, -1, z.Err()
+			}
+			break
+		}
+		raw := z.Raw()
+		offset += int64(len(raw))
+
+		switch tt {
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, _ := z.TagName()
+			a := atom.Lookup(name)
+			if headOnly && !htmlHeadElements[a] {
+				// not part of head, parse up to start of tag
+				return buf.Bytes()[0:tokenOffset], -1, nil
+			}
+			if tt == html.StartTagToken && htmlRawTextElements[a] {
+				rawTextOffset = tokenOffset
+			}
+		case html.EndTagToken:
+			rawTextOffset = -1
+			name, _ := z.TagName()
+			if headOnly && atom.Lookup(name) == atom.Head {
+				return buf.Bytes()[0:offset], -1, nil
+			}
+		case html.CommentToken, html.DoctypeToken:
+			if !bytes.HasSuffix(raw, []byte(">")) {
+				return buf.Bytes(), tokenOffset, nil
+			}
+		}
+	}
+
+	switch {
+	case offset < int64(buf.Len()):
+		// EOF inside a tag, tokenizer does not return a token for it
+		return buf.Bytes(), offset, nil
+	case rawTextOffset != -1:
+		return buf.Bytes(), rawTextOffset, nil
+	default:
+		return buf.Bytes(), -1, nil
+	}
+}
+
 func decodeHTML(d *decode.D, in any) any {
 	hi, _ := in.(format.HTMLIn)
 
 	br := d.RawLen(d.Len())
 	var r any
-	var err error
+	bs, truncatedOffset, err := htmlScan(bitio.NewIOReader(br), hi.HeadOnly)
+	if err != nil {
+		d.Fatalf("%s", err)
+	}
 	// disabled scripting means parse noscript tags etc
-	n, err := html.ParseWithOptions(bitio.NewIOReader(br), html.ParseOptionEnableScripting(false))
+	n, err := html.ParseWithOptions(bytes.NewReader(bs), html.ParseOptionEnableScripting(false))
 	if err != nil {
 		d.Fatalf("%s", err)
 	}
@@ -193,8 +286,31 @@ func decodeHTML(d *decode.D, in any) any {
 	} else {
 		r = fromHTMLObject(n, hi)
 	}
-	if err != nil {
-		d.Fatalf("%s", err)
+
+	// known truncation is only relevant if whole input was scanned
+	if hi.Truncated && truncatedOffset == -1 && int64(len(bs))*8 == d.Len() {
+		truncatedOffset = int64(len(bs))
+	}
+	if truncatedOffset != -1 {
+		// annotate html element, root for array and only key for object
+		var attrs *gojqextra.OrderedObject
+		switch rv := r.(type) {
+		case []any:
+			if len(rv) > 1 {
+				attrs, _ = rv[1].(*gojqextra.OrderedObject)
+			}
+			if attrs == nil {
+				attrs = gojqextra.NewOrderedObject()
+				r = append(rv[0:1], append([]any{attrs}, rv[1:]...)...)
+			}
+		case *gojqextra.OrderedObject:
+			e, _ := rv.Get("html")
+			attrs, _ = e.(*gojqextra.OrderedObject)
+		}
+		if attrs != nil {
+			attrs.Set("#truncated", true)
+			attrs.Set("#truncated_offset", int(truncatedOffset))
+		}
 	}
 	var s scalar.S
 	s.Actual = r
@@ -0,0 +1,250 @@
+package xml
+
+// Simplified readability style main content extraction
+// https://github.com/mozilla/readability
+
+import (
+	"math"
+	"regexp"
+	"strings"
+
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/interp"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+func init() {
+	interp.RegisterFunc0("_html_main_text", htmlMainText)
+}
+
+var (
+	mainTextPositiveRE = regexp.MustCompile(`(?i)article|body|content|entry|main|page|post|text|blog|story`)
+	mainTextNegativeRE = regexp.MustCompile(`(?i)comment|meta|footer|footnote|sidebar|sponsor|promo|related|share|social|nav|menu|banner|widget|ad-`)
+	whitespaceRunRE    = regexp.MustCompile(`\s+`)
+)
+
+// elements never part of main content
+var mainTextSkip = map[atom.Atom]bool{
+	atom.Script:   true,
+	atom.Style:    true,
+	atom.Noscript: true,
+	atom.Nav:      true,
+	atom.Header:   true,
+	atom.Footer:   true,
+	atom.Aside:    true,
+	atom.Form:     true,
+	atom.Iframe:   true,
+	atom.Svg:      true,
+	atom.Button:   true,
+	atom.Select:   true,
+	atom.Template: true,
+}
+
+// elements that start a new paragraph in extracted text
+var mainTextBlocks = map[atom.Atom]bool{
+	atom.P:          true,
+	atom.Div:        true,
+	atom.Section:    true,
+	atom.Article:    true,
+	atom.Main:       true,
+	atom.H1:         true,
+	atom.H2:         true,
+	atom.H3:         true,
+	atom.H4:         true,
+	atom.H5:         true,
+	atom.H6:         true,
+	atom.Li:         true,
+	atom.Pre:        true,
+	atom.Blockquote: true,
+	atom.Td:         true,
+	atom.Th:         true,
+	atom.Dd:         true,
+	atom.Dt:         true,
+	atom.Figcaption: true,
+	atom.Br:         true,
+}
+
+func mainTextTagScore(n *html.Node) float64 {
+	switch n.DataAtom {
+	case atom.Article, atom.Main:
+		return 10
+	case atom.Div:
+		return 5
+	case atom.Pre, atom.Td, atom.Blockquote:
+		return 3
+	case atom.Address, atom.Ol, atom.Ul, atom.Dl, atom.Dd, atom.Dt, atom.Li:
+		return -3
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6, atom.Th:
+		return -5
+	}
+	return 0
+}
+
+func mainTextClassScore(n *html.Node) float64 {
+	var score float64
+	for _, a := range n.Attr {
+		if a.Key != "class" && a.Key != "id" {
+			continue
+		}
+		if mainTextNegativeRE.MatchString(a.Val) {
+			score -= 25
+		}
+		if mainTextPositiveRE.MatchString(a.Val) {
+			score += 25
+		}
+	}
+	return score
+}
+
+func mainTextSkipped(n *html.Node) bool {
+	return n.Type == html.ElementNode && (mainTextSkip[n.DataAtom] || mainTextClassScore(n) < 0 && n.DataAtom != atom.Body)
+}
+
+// text and length of link text of subtree excluding skipped elements
+func mainTextLength(n *html.Node) (textLen int, linkLen int) {
+	var f func(n *html.Node, inLink bool)
+	f = func(n *html.Node, inLink bool) {
+		if mainTextSkipped(n) {
+			return
+		}
+		if n.Type == html.TextNode {
+			l := len(strings.TrimSpace(whitespaceRunRE.ReplaceAllString(n.Data, " ")))
+			textLen += l
+			if inLink {
+				linkLen += l
+			}
+			return
+		}
+		inLink = inLink || n.DataAtom == atom.A
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			f(c, inLink)
+		}
+	}
+	f(n, false)
+	return textLen, linkLen
+}
+
+// mainTextCandidate scores paragraph like elements and adds the score to the parent and
+// half to the grandparent. Candidate with highest score adjusted by link density wins.
+func mainTextCandidate(root *html.Node) *html.Node {
+	scores := map[*html.Node]float64{}
+	// in document order to pick first candidate on equal score
+	var candidates []*html.Node
+	addScore := func(n *html.Node, s float64) {
+		if n == nil || n.Type != html.ElementNode {
+			return
+		}
+		if _, ok := scores[n]; !ok {
+			scores[n] = mainTextTagScore(n) + mainTextClassScore(n)
+			candidates = append(candidates, n)
+		}
+		scores[n] += s
+	}
+
+	var f func(n *html.Node)
+	f = func(n *html.Node) {
+		if mainTextSkipped(n) {
+			return
+		}
+		switch n.DataAtom {
+		case atom.P, atom.Pre, atom.Td, atom.Blockquote:
+			textLen, _ := mainTextLength(n)
+			if textLen >= 25 {
+				var text strings.Builder
+				mainTextCollect(n, &text)
+				s := 1 + float64(strings.Count(text.String(), ",")) + math.Min(float64(textLen/100), 3)
+				addScore(n.Parent, s)
+				if n.Parent != nil {
+					addScore(n.Parent.Parent, s/2)
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			f(c)
+		}
+	}
+	f(root)
+
+	var best *html.Node
+	var bestScore float64
+	for _, n := range candidates {
+		textLen, linkLen := mainTextLength(n)
+		linkDensity := 0.0
+		if textLen > 0 {
+			linkDensity = float64(linkLen) / float64(textLen)
+		}
+		s := scores[n] * (1 - linkDensity)
+		if best == nil || s > bestScore {
+			best = n
+			bestScore = s
+		}
+	}
+
+	return best
+}
+
+// mainTextCollect writes text of subtree with a newline at block element boundaries
+func mainTextCollect(n *html.Node, sb *strings.Builder) {
+	if mainTextSkipped(n) {
+		return
+	}
+	if n.Type == html.TextNode {
+		sb.WriteString(whitespaceRunRE.ReplaceAllString(n.Data, " "))
+		return
+	}
+	block := n.Type == html.ElementNode && mainTextBlocks[n.DataAtom]
+	if block {
+		sb.WriteString("\n")
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		mainTextCollect(c, sb)
+	}
+	if block {
+		sb.WriteString("\n")
+	}
+}
+
+func findBody(n *html.Node) *html.Node {
+	if n.DataAtom == atom.Body {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if b := findBody(c); b != nil {
+			return b
+		}
+	}
+	return nil
+}
+
+// htmlMainText returns paragraphs of text of the element most likely to be the main content
+func htmlMainText(_ *interp.Interp, c any) any {
+	br, err := interp.ToBitReader(c)
+	if err != nil {
+		return err
+	}
+	n, err := html.ParseWithOptions(bitio.NewIOReader(br), html.ParseOptionEnableScripting(false))
+	if err != nil {
+		return err
+	}
+
+	best := mainTextCandidate(n)
+	if best == nil {
+		best = findBody(n)
+	}
+	paragraphs := []any{}
+	if best == nil {
+		return paragraphs
+	}
+
+	var sb strings.Builder
+	mainTextCollect(best, &sb)
+	for _, l := range strings.Split(sb.String(), "\n") {
+		l = strings.TrimSpace(l)
+		if l != "" {
+			paragraphs = append(paragraphs, l)
+		}
+	}
+
+	return paragraphs
+}
@@ -93,7 +93,7 @@ func (nss xmlNNStack) push(name string, url string) xmlNNStack {
 func fromXMLArray(n xmlNode) any {
 	var f func(n xmlNode, nss xmlNNStack) []any
 	f = func(n xmlNode, nss xmlNNStack) []any {
-		attrs := map[string]any{}
+		attrs := gojqextra.NewOrderedObject()
 		for _, a := range n.Attrs {
 			local, space := a.Name.Local, a.Name.Space
 			name := local
@@ -105,13 +105,13 @@ func fromXMLArray(n xmlNode) any {
 				}
 				name = space + ":" + local
 			}
-			attrs[name] = a.Value
+			attrs.Set(name, a.Value)
 		}
-		if attrs["#text"] == nil && !whitespaceRE.Match(n.Chardata) {
-			attrs["#text"] = strings.TrimSpace(string(n.Chardata))
+		if _, ok := attrs.Get("#text"); !ok && !whitespaceRE.Match(n.Chardata) {
+			attrs.Set("#text", strings.TrimSpace(string(n.Chardata)))
 		}
-		if attrs["#comment"] == nil && !whitespaceRE.Match(n.Comment) {
-			attrs["#comment"] = strings.TrimSpace(string(n.Comment))
+		if _, ok := attrs.Get("#comment"); !ok && !whitespaceRE.Match(n.Comment) {
+			attrs.Set("#comment", strings.TrimSpace(string(n.Comment)))
 		}
 
 		nodes := []any{}
@@ -128,7 +128,7 @@ func fromXMLArray(n xmlNode) any {
 			name = space + ":" + name
 		}
 		elm := []any{name}
-		if len(attrs) > 0 {
+		if attrs.Len() > 0 {
 			elm = append(elm, attrs)
 		}
 		if len(nodes) > 0 {
@@ -144,7 +144,7 @@ func fromXMLArray(n xmlNode) any {
 func fromXMLObject(n xmlNode, xi format.XMLIn) any {
 	var f func(n xmlNode, seq int, nss xmlNNStack) any
 	f = func(n xmlNode, seq int, nss xmlNNStack) any {
-		attrs := map[string]any{}
+		attrs := gojqextra.NewOrderedObject()
 
 		for _, a := range n.Attrs {
 			local, space := a.Name.Local, a.Name.Space
@@ -157,7 +157,7 @@ func fromXMLObject(n xmlNode, xi format.XMLIn) any {
 				}
 				name = space + ":" + local
 			}
-			attrs["-"+name] = a.Value
+			attrs.Set("-"+name, a.Value)
 		}
 
 		for i, nn := range n.Nodes {
@@ -174,39 +174,39 @@ func fromXMLObject(n xmlNode, xi format.XMLIn) any {
 			if space != "" {
 				name = space + ":" + name
 			}
-			if e, ok := attrs[name]; ok {
+			if e, ok := attrs.Get(name); ok {
 				if ea, ok := e.([]any); ok {
-					attrs[name] = append(ea, f(nn, nSeq, nss))
+					attrs.Set(name, append(ea, f(nn, nSeq, nss)))
 				} else {
-					attrs[name] = []any{e, f(nn, nSeq, nss)}
+					attrs.Set(name, []any{e, f(nn, nSeq, nss)})
 				}
 			} else {
-				attrs[name] = f(nn, nSeq, nss)
+				attrs.Set(name, f(nn, nSeq, nss))
 			}
 		}
 
 		if xi.Seq && seq != -1 {
-			attrs["#seq"] = seq
+			attrs.Set("#seq", seq)
 		}
-		if attrs["#text"] == nil && !whitespaceRE.Match(n.Chardata) {
-			attrs["#text"] = strings.TrimSpace(string(n.Chardata))
+		if _, ok := attrs.Get("#text"); !ok && !whitespaceRE.Match(n.Chardata) {
+			attrs.Set("#text", strings.TrimSpace(string(n.Chardata)))
 		}
-		if attrs["#comment"] == nil && !whitespaceRE.Match(n.Comment) {
-			attrs["#comment"] = strings.TrimSpace(string(n.Comment))
+		if _, ok := attrs.Get("#comment"); !ok && !whitespaceRE.Match(n.Comment) {
+			attrs.Set("#comment", strings.TrimSpace(string(n.Comment)))
 		}
 
-		if len(attrs) == 0 {
+		if attrs.Len() == 0 {
 			return ""
-		} else if len(attrs) == 1 && attrs["#text"] != nil {
-			return attrs["#text"]
+		} else if text, ok := attrs.Get("#text"); ok && attrs.Len() == 1 {
+			return text
 		}
 
 		return attrs
 	}
 
-	return map[string]any{
-		n.XMLName.Local: f(n, -1, nil),
-	}
+	root := gojqextra.NewOrderedObject()
+	root.Set(n.XMLName.Local, f(n, -1, nil))
+	return root
 }
 
 var wsRE *regexp.Regexp
@@ -237,7 +237,7 @@ func decodeXML(d *decode.D, in any) any {
 	s.Actual = r
 
 	switch s.Actual.(type) {
-	case map[string]any,
+	case *gojqextra.OrderedObject,
 		[]any:
 	default:
 		d.Fatalf("root not object or array")
@@ -104,6 +104,8 @@ func (e *Encoder) encode(v any) {
 		e.encodeArray(v)
 	case map[string]any:
 		e.encodeMap(v)
+	case OrderedMap:
+		e.encodeOrderedMap(v)
 	default:
 		if e.valueFn != nil {
 			v = e.valueFn(v)
@@ -224,13 +226,18 @@ func (e *Encoder) encodeArray(vs []any) {
 	e.writeByte(']', e.colors.Array)
 }
 
+type keyVal struct {
+	key string
+	val any
+}
+
+// OrderedMap is a map that is encoded in its own key order instead of sorted by key
+type OrderedMap interface {
+	Keys() []string
+	Get(key string) (any, bool)
+}
+
 func (e *Encoder) encodeMap(vs map[string]any) {
-	e.writeByte('{', e.colors.Object)
-	e.depth += e.indent
-	type keyVal struct {
-		key string
-		val any
-	}
 	kvs := make([]keyVal, len(vs))
 	var i int
 	for k, v := range vs {
@@ -240,6 +247,22 @@ func (e *Encoder) encodeMap(vs map[string]any) {
 	sort.Slice(kvs, func(i, j int) bool {
 		return kvs[i].key < kvs[j].key
 	})
+	e.encodeKeyVals(kvs)
+}
+
+func (e *Encoder) encodeOrderedMap(vs OrderedMap) {
+	ks := vs.Keys()
+	kvs := make([]keyVal, len(ks))
+	for i, k := range ks {
+		v, _ := vs.Get(k)
+		kvs[i] = keyVal{k, v}
+	}
+	e.encodeKeyVals(kvs)
+}
+
+func (e *Encoder) encodeKeyVals(kvs []keyVal) {
+	e.writeByte('{', e.colors.Object)
+	e.depth += e.indent
 	for i, kv := range kvs {
 		if e.wErr != nil {
 			return
@@ -259,7 +282,7 @@ func (e *Encoder) encodeMap(vs map[string]any) {
 		e.encode(kv.val)
 	}
 	e.depth -= e.indent
-	if len(vs) > 0 && e.indent != 0 {
+	if len(kvs) > 0 && e.indent != 0 {
 		e.writeIndent()
 	}
 	e.writeByte('}', e.colors.Object)
@@ -8,6 +8,7 @@ import (
 	"math"
 	"math/big"
 	"reflect"
+	"sort"
 	"strconv"
 
 	"github.com/wader/fq/internal/colorjson"
@@ -289,21 +290,29 @@ func (v Object) JQValueSlice(start int, end int) any {
 	return ExpectedArrayError{Typ: gojq.JQTypeObject}
 }
 func (v Object) JQValueKey(name string) any { return v[name] }
+
+// sortedKeys returns keys in jq key order so that iteration does not depend on map order
+func (v Object) sortedKeys() []string {
+	ks := make([]string, 0, len(v))
+	for k := range v {
+		ks = append(ks, k)
+	}
+	sort.Strings(ks)
+	return ks
+}
 func (v Object) JQValueEach() any {
-	vs := make([]gojq.PathValue, len(v))
-	i := 0
-	for k, v := range v {
-		vs[i] = gojq.PathValue{Path: k, Value: v}
-		i++
+	ks := v.sortedKeys()
+	vs := make([]gojq.PathValue, len(ks))
+	for i, k := range ks {
+		vs[i] = gojq.PathValue{Path: k, Value: v[k]}
 	}
 	return vs
 }
 func (v Object) JQValueKeys() any {
-	vs := make([]any, len(v))
-	i := 0
-	for k := range v {
+	ks := v.sortedKeys()
+	vs := make([]any, len(ks))
+	for i, k := range ks {
 		vs[i] = k
-		i++
 	}
 	return vs
 }
@@ -324,6 +333,78 @@ func (v Object) JQValueToString() any {
 }
 func (v Object) JQValueToGoJQ() any { return map[string]any(v) }
 
+// ordered object
+
+var _ gojq.JQValue = (*OrderedObject)(nil)
+
+// OrderedObject is an object that keeps insertion order of keys when iterated and
+// encoded, used for values where order is meaningful like attributes in a document
+type OrderedObject struct {
+	keys []string
+	m    map[string]any
+}
+
+func NewOrderedObject() *OrderedObject {
+	return &OrderedObject{m: map[string]any{}}
+}
+
+// Set sets value for key, a new key is added last
+func (v *OrderedObject) Set(key string, value any) {
+	if _, ok := v.m[key]; !ok {
+		v.keys = append(v.keys, key)
+	}
+	v.m[key] = value
+}
+func (v *OrderedObject) Get(key string) (any, bool) {
+	e, ok := v.m[key]
+	return e, ok
+}
+func (v *OrderedObject) Keys() []string { return v.keys }
+func (v *OrderedObject) Len() int       { return len(v.keys) }
+
+func (v *OrderedObject) JQValueLength() any   { return len(v.keys) }
+func (v *OrderedObject) JQValueSliceLen() any { return ExpectedArrayError{Typ: gojq.JQTypeObject} }
+func (v *OrderedObject) JQValueIndex(index int) any {
+	return ExpectedArrayError{Typ: gojq.JQTypeObject}
+}
+func (v *OrderedObject) JQValueSlice(start int, end int) any {
+	return ExpectedArrayError{Typ: gojq.JQTypeObject}
+}
+func (v *OrderedObject) JQValueKey(name string) any { return v.m[name] }
+func (v *OrderedObject) JQValueEach() any {
+	vs := make([]gojq.PathValue, len(v.keys))
+	for i, k := range v.keys {
+		vs[i] = gojq.PathValue{Path: k, Value: v.m[k]}
+	}
+	return vs
+}
+// JQValueKeys is sorted as keys in jq is always sorted, use to_entries for document order
+func (v *OrderedObject) JQValueKeys() any {
+	ks := append([]string{}, v.keys...)
+	sort.Strings(ks)
+	vs := make([]any, len(ks))
+	for i, k := range ks {
+		vs[i] = k
+	}
+	return vs
+}
+func (v *OrderedObject) JQValueHas(key any) any {
+	stringKey, ok := key.(string)
+	if !ok {
+		return HasKeyTypeError{L: gojq.JQTypeObject, R: fmt.Sprintf("%v", key)}
+	}
+	_, ok = v.m[stringKey]
+	return ok
+}
+func (v *OrderedObject) JQValueType() string { return gojq.JQTypeObject }
+func (v *OrderedObject) JQValueToNumber() any {
+	return FuncTypeNameError{Name: "tonumber", Typ: gojq.JQTypeObject}
+}
+func (v *OrderedObject) JQValueToString() any {
+	return FuncTypeNameError{Name: "tostring", Typ: gojq.JQTypeObject}
+}
+func (v *OrderedObject) JQValueToGoJQ() any { return v.m }
+
 // number
 
 var _ gojq.JQValue = Number{}
@@ -97,6 +97,8 @@ type CaseRun struct {
 	ReadlinesPos     int
 	ReadlineEnv      []string
 	WasRun           bool
+	// files written by run, kept in memory to not modify testdata
+	writtenFiles map[string]*bytes.Buffer
 }
 
 func (cr *CaseRun) Line() int { return cr.LineNr }
@@ -186,7 +188,35 @@ func (cr *CaseRun) Args() []string { return cr.args }
 
 func (cr *CaseRun) ConfigDir() (string, error) { return "/config", nil }
 
-func (cr *CaseRun) FS() fs.FS { return cr.Case }
+func (cr *CaseRun) FS() fs.FS { return cr }
+
+type caseRunWriteCloser struct{ *bytes.Buffer }
+
+func (caseRunWriteCloser) Close() error { return nil }
+
+func (cr *CaseRun) Create(name string) (io.WriteCloser, error) {
+	testAbsPath, _ := cr.Case.paths(name)
+	if cr.writtenFiles == nil {
+		cr.writtenFiles = map[string]*bytes.Buffer{}
+	}
+	b := &bytes.Buffer{}
+	cr.writtenFiles[filepath.ToSlash(testAbsPath)] = b
+	return caseRunWriteCloser{Buffer: b}, nil
+}
+
+func (cr *CaseRun) Open(name string) (fs.File, error) {
+	testAbsPath, _ := cr.Case.paths(name)
+	if b, ok := cr.writtenFiles[filepath.ToSlash(testAbsPath)]; ok {
+		return interp.FileReader{
+			R: io.NewSectionReader(bytes.NewReader(b.Bytes()), 0, int64(b.Len())),
+			FileInfo: interp.FixedFileInfo{
+				FName: filepath.Base(name),
+				FSize: int64(b.Len()),
+			},
+		}, nil
+	}
+	return cr.Case.Open(name)
+}
 
 func (cr *CaseRun) Readline(opts interp.ReadlineOpts) (string, error) {
 	cr.ActualStdoutBuf.WriteString(opts.Prompt)
@@ -340,14 +370,20 @@ func normalizeOSError(err error) error {
 	return err
 }
 
-func (c *Case) Open(name string) (fs.File, error) {
+// paths relative to testdata root and filesystem
+func (c *Case) paths(name string) (testAbsPath string, fsPath string) {
 	const testData = "testdata"
 	testDataIndex := strings.Index(c.Path, testData)
 	// cwd is directory where current script file is
 	testRoot := c.Path[0 : testDataIndex+len(testData)]
 	testCwd := filepath.Dir(c.Path[testDataIndex+len(testData):])
-	testAbsPath := filepath.Join(testCwd, name)
-	fsPath := filepath.Join(testRoot, testAbsPath)
+	testAbsPath = filepath.Join(testCwd, name)
+	fsPath = filepath.Join(testRoot, testAbsPath)
+	return testAbsPath, fsPath
+}
+
+func (c *Case) Open(name string) (fs.File, error) {
+	testAbsPath, fsPath := c.paths(name)
 
 	for _, p := range c.Parts {
 		f, ok := p.(*caseFile)
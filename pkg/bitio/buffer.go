@@ -30,6 +30,11 @@ func (b *Buffer) Bits() ([]byte, int64) {
 }
 
 func (b *Buffer) WriteBits(p []byte, nBits int64) (n int64, err error) {
+	// reuse buffer if all has been read, makes a buffer used as a read/write pipe not grow
+	if b.empty() {
+		b.Reset()
+	}
+
 	tBytes := BitsByteCount(b.bufBits + nBits)
 
 	if tBytes > int64(len(b.buf)) {
@@ -155,6 +155,8 @@ type stdOSFS struct{}
 
 func (stdOSFS) Open(name string) (fs.File, error) { return os.Open(name) }
 
+func (stdOSFS) Create(name string) (io.WriteCloser, error) { return os.Create(name) }
+
 func (*stdOS) FS() fs.FS { return stdOSFS{} }
 
 func (o *stdOS) Readline(opts interp.ReadlineOpts) (string, error) {
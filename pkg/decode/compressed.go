@@ -0,0 +1,223 @@
+package decode
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+
+	"github.com/wader/fq/pkg/bitio"
+)
+
+// DefaultMaxDecompressedSize is used if Options.MaxDecompressedSize is zero
+const DefaultMaxDecompressedSize = 256 * 1024 * 1024
+
+// Compression is a codec used by FieldCompressedLen
+type Compression int
+
+const (
+	CompressionDeflate Compression = iota
+	CompressionZlib
+	CompressionGzip
+)
+
+// CompressionNames maps codec names to compression, note that HTTP Content-Encoding deflate is zlib
+var CompressionNames = map[string]Compression{
+	"deflate": CompressionDeflate,
+	"zlib":    CompressionZlib,
+	"gzip":    CompressionGzip,
+}
+
+func (c Compression) String() string {
+	switch c {
+	case CompressionDeflate:
+		return "deflate"
+	case CompressionZlib:
+		return "zlib"
+	case CompressionGzip:
+		return "gzip"
+	default:
+		return fmt.Sprintf("compression(%d)", int(c))
+	}
+}
+
+// DecompressedSizeError is returned when decompressed data is larger than max decompressed size
+type DecompressedSizeError struct {
+	Compression Compression
+	MaxSize     int64
+}
+
+func (e DecompressedSizeError) Error() string {
+	return fmt.Sprintf("%s: decompressed size larger than max %d bytes", e.Compression, e.MaxSize)
+}
+
+func (c Compression) reader(r io.Reader) (io.Reader, error) {
+	switch c {
+	case CompressionDeflate:
+		return flate.NewReader(r), nil
+	case CompressionZlib:
+		return zlib.NewReader(r)
+	case CompressionGzip:
+		return gzip.NewReader(r)
+	default:
+		return nil, fmt.Errorf("unknown compression %d", int(c))
+	}
+}
+
+func (d *D) maxDecompressedSize() int64 {
+	if d.Options.MaxDecompressedSize > 0 {
+		return d.Options.MaxDecompressedSize
+	}
+	return DefaultMaxDecompressedSize
+}
+
+// decompressReadSeeker is a io.ReadSeeker of decompressed data of known size, data is
+// decompressed on demand and only data up to the furthest read position is kept
+type decompressReadSeeker struct {
+	newReader func() (io.Reader, error)
+	r         io.Reader
+	buf       []byte
+	size      int64
+	pos       int64
+}
+
+// decompress at least this much at a time to not do many small reads
+const decompressReadAhead = 64 * 1024
+
+func (rs *decompressReadSeeker) fill(end int64) error {
+	if end <= int64(len(rs.buf)) {
+		return nil
+	}
+	if rs.r == nil {
+		r, err := rs.newReader()
+		if err != nil {
+			return err
+		}
+		rs.r = r
+	}
+	n := len(rs.buf)
+	if end < int64(n)+decompressReadAhead {
+		end = int64(n) + decompressReadAhead
+	}
+	if end > rs.size {
+		end = rs.size
+	}
+	rs.buf = append(rs.buf, make([]byte, end-int64(n))...)
+	if _, err := io.ReadFull(rs.r, rs.buf[n:]); err != nil {
+		rs.buf = rs.buf[0:n]
+		return err
+	}
+	return nil
+}
+
+func (rs *decompressReadSeeker) Read(p []byte) (int, error) {
+	if rs.pos >= rs.size {
+		return 0, io.EOF
+	}
+	end := rs.pos + int64(len(p))
+	if end > rs.size {
+		end = rs.size
+	}
+	if err := rs.fill(end); err != nil {
+		return 0, err
+	}
+	n := copy(p, rs.buf[rs.pos:end])
+	rs.pos += int64(n)
+	return n, nil
+}
+
+func (rs *decompressReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	pos := rs.pos
+	switch whence {
+	case io.SeekStart:
+		pos = offset
+	case io.SeekCurrent:
+		pos += offset
+	case io.SeekEnd:
+		pos = rs.size + offset
+	default:
+		return 0, fmt.Errorf("invalid whence %d", whence)
+	}
+	if pos < 0 {
+		return 0, fmt.Errorf("negative seek position %d", pos)
+	}
+	rs.pos = pos
+	return pos, nil
+}
+
+// TryDecompressLen decompresses nBits at current position without moving the position. The data
+// is first decompressed as a stream to check that it is valid and to know its size, the returned
+// reader then decompresses on demand so data that is never read is never kept.
+func (d *D) TryDecompressLen(nBits int64, c Compression) (bitio.ReaderAtSeeker, error) {
+	br, err := d.TryBitBufRange(d.Pos(), nBits)
+	if err != nil {
+		return nil, err
+	}
+	newReader := func() (io.Reader, error) {
+		cbr, err := bitio.CloneReadSeeker(br)
+		if err != nil {
+			return nil, err
+		}
+		r, err := c.reader(bitio.NewIOReader(cbr))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", c, err)
+		}
+		return r, nil
+	}
+
+	r, err := newReader()
+	if err != nil {
+		return nil, err
+	}
+	maxSize := d.maxDecompressedSize()
+	// read one more byte than max to know if the limit was hit
+	n, err := io.Copy(io.Discard, io.LimitReader(r, maxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", c, err)
+	}
+	if n > maxSize {
+		return nil, DecompressedSizeError{Compression: c, MaxSize: maxSize}
+	}
+
+	return bitio.NewIOBitReadSeeker(&decompressReadSeeker{newReader: newReader, size: n}), nil
+}
+
+// TryFieldCompressedLen decompresses nBits at current position and adds the decompressed data as
+// a root field decoded using group, or as raw bits if group is nil. Ranges of fields inside are
+// relative to the decompressed data and the field itself starts at the compressed data.
+// Decompressed size is limited by Options.MaxDecompressedSize. On error nothing is added and
+// position is not moved.
+func (d *D) TryFieldCompressedLen(name string, nBits int64, c Compression, group Group, inArg any) (*Value, any, error) {
+	startPos := d.Pos()
+	dbr, err := d.TryDecompressLen(nBits, c)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var dv *Value
+	var v any
+	if group != nil {
+		dv, v, err = d.TryFieldFormatBitBuf(name, dbr, group, inArg)
+		if dv == nil {
+			return nil, nil, err
+		}
+	} else {
+		dv = d.FieldRootBitBuf(name, dbr)
+	}
+	dv.Range.Start = startPos
+
+	if _, err := d.bitBuf.SeekBits(nBits, io.SeekCurrent); err != nil {
+		d.IOPanic(err, "TryFieldCompressedLen: SeekRel")
+	}
+
+	return dv, v, nil
+}
+
+func (d *D) FieldCompressedLen(name string, nBits int64, c Compression, group Group, inArg any) (*Value, any) {
+	dv, v, err := d.TryFieldCompressedLen(name, nBits, c, group, inArg)
+	if dv == nil {
+		d.IOPanic(err, "FieldCompressedLen: TryFieldCompressedLen")
+	}
+	return dv, v
+}
@@ -0,0 +1,162 @@
+package decode_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+var textGroup = decode.Group{{
+	Name: "text",
+	DecodeFn: func(d *decode.D, _ any) any {
+		d.FieldUTF8("text", int(d.BitsLeft()/8))
+		return nil
+	},
+}}
+
+func gzipBytes(t *testing.T, bs []byte) []byte {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	w, err := gzip.NewWriterLevel(buf, gzip.BestCompression)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(bs); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// decodes 2 bytes prefix, compressed body using group and 2 bytes suffix and returns compressed body error
+func decodeCompressed(t *testing.T, body []byte, group decode.Group, maxSize int64) error {
+	t.Helper()
+	bs := append(append([]byte("ab"), body...), "cd"...)
+	var compressedErr error
+	_, _, err := decode.Decode(context.Background(), bitio.NewBitReader(bs, -1), decode.Group{{
+		Name: "outer",
+		DecodeFn: func(d *decode.D, _ any) any {
+			d.FieldUTF8("prefix", 2)
+			if _, _, err := d.TryFieldCompressedLen("body", int64(len(body))*8, decode.CompressionGzip, group, nil); err != nil {
+				compressedErr = err
+				d.FieldRawLen("body", int64(len(body))*8)
+			}
+			d.FieldUTF8("suffix", 2)
+			return nil
+		},
+	}}, decode.Options{IsRoot: true, MaxDecompressedSize: maxSize})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return compressedErr
+}
+
+func TestFieldCompressedLen(t *testing.T) {
+	t.Run("gzip", func(t *testing.T) {
+		body := gzipBytes(t, []byte("hello compressed world"))
+		bs := append(append([]byte("ab"), body...), "cd"...)
+		dv, _, err := decode.Decode(context.Background(), bitio.NewBitReader(bs, -1), decode.Group{{
+			Name: "outer",
+			DecodeFn: func(d *decode.D, _ any) any {
+				d.FieldUTF8("prefix", 2)
+				d.FieldCompressedLen("body", int64(len(body))*8, decode.CompressionGzip, textGroup, nil)
+				d.FieldUTF8("suffix", 2)
+				return nil
+			},
+		}}, decode.Options{IsRoot: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		c := dv.V.(*decode.Compound)
+		bodyV := c.Children[1]
+		// starts at compressed data, length is decompressed size
+		if bodyV.Name != "body" || !bodyV.IsRoot || bodyV.Range.Start != 2*8 || bodyV.Range.Len != 22*8 {
+			t.Errorf("unexpected body %s root %v range %s", bodyV.Name, bodyV.IsRoot, bodyV.Range)
+		}
+		textV := bodyV.V.(*decode.Compound).Children[0]
+		if textV.Range.Start != 0 || textV.Range.Len != 22*8 {
+			t.Errorf("unexpected text range %s", textV.Range)
+		}
+		if s, ok := textV.V.(*scalar.S); !ok || s.Actual != "hello compressed world" {
+			t.Errorf("unexpected text %v", textV.V)
+		}
+		suffixV := c.Children[2]
+		if suffixV.Range.Start != int64(2+len(body))*8 {
+			t.Errorf("unexpected suffix range %s", suffixV.Range)
+		}
+	})
+
+	t.Run("read at offset", func(t *testing.T) {
+		// larger than read ahead so decompressed data is read in more than one chunk
+		data := append(bytes.Repeat([]byte("a"), 200*1024), "tail"...)
+		body := gzipBytes(t, data)
+		var tail string
+		_, _, err := decode.Decode(context.Background(), bitio.NewBitReader(body, -1), decode.Group{{
+			Name: "outer",
+			DecodeFn: func(d *decode.D, _ any) any {
+				d.FieldCompressedLen("body", int64(len(body))*8, decode.CompressionGzip, decode.Group{{
+					Name: "tail",
+					DecodeFn: func(d *decode.D, _ any) any {
+						d.SeekAbs(d.Len() - 4*8)
+						tail = d.FieldUTF8("tail", 4)
+						return nil
+					},
+				}}, nil)
+				return nil
+			},
+		}}, decode.Options{IsRoot: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tail != "tail" {
+			t.Errorf("expected tail got %q", tail)
+		}
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		body := gzipBytes(t, []byte("hello compressed world"))
+		if err := decodeCompressed(t, body[0:len(body)/2], textGroup, 0); err == nil {
+			t.Error("expected error")
+		}
+	})
+
+	t.Run("bomb", func(t *testing.T) {
+		// deflate can't do much better than about 1000:1 so compress twice to get above 10000:1,
+		// outer data decompresses fine and the nested decode of it hits the limit
+		const size = 10 * 1024 * 1024
+		body := gzipBytes(t, gzipBytes(t, make([]byte, size)))
+		if ratio := size / len(body); ratio < 10000 {
+			t.Fatalf("expected compression ratio of at least 10000 got %d", ratio)
+		}
+		const maxSize = 1024 * 1024
+		var innerErr error
+		gzipGroup := decode.Group{{
+			Name: "gzip",
+			DecodeFn: func(d *decode.D, _ any) any {
+				if _, _, innerErr = d.TryFieldCompressedLen("inner", d.BitsLeft(), decode.CompressionGzip, textGroup, nil); innerErr != nil {
+					d.FieldRawLen("inner", d.BitsLeft())
+				}
+				return nil
+			},
+		}}
+		if err := decodeCompressed(t, body, gzipGroup, maxSize); err != nil {
+			t.Fatalf("expected outer body to decompress got %v", err)
+		}
+		var sizeErr decode.DecompressedSizeError
+		if !errors.As(innerErr, &sizeErr) {
+			t.Fatalf("expected DecompressedSizeError got %v", innerErr)
+		}
+		if sizeErr.MaxSize != maxSize {
+			t.Errorf("expected max size %d got %d", maxSize, sizeErr.MaxSize)
+		}
+	})
+}
@@ -8,6 +8,7 @@ import (
 	"io/ioutil"
 	"math/big"
 	"regexp"
+	"time"
 
 	"github.com/wader/fq/internal/bitioextra"
 	"github.com/wader/fq/internal/ioextra"
@@ -28,6 +29,24 @@ const (
 	LittleEndian
 )
 
+// UTF8Policy decides how invalid UTF-8 in UTF-8 text fields is handled
+type UTF8Policy int
+
+const (
+	// UTF8Replace replaces invalid bytes with U+FFFD and marks the value as invalid UTF-8
+	UTF8Replace UTF8Policy = iota
+	// UTF8Strict fails reading text with invalid UTF-8
+	UTF8Strict
+	// UTF8Raw keeps invalid bytes as is and marks the value as invalid UTF-8
+	UTF8Raw
+)
+
+var UTF8PolicyNames = map[string]UTF8Policy{
+	"replace": UTF8Replace,
+	"strict":  UTF8Strict,
+	"raw":     UTF8Raw,
+}
+
 type Options struct {
 	Name          string
 	Description   string
@@ -37,7 +56,20 @@ type Options struct {
 	Range         ranges.Range // if zero use whole buffer
 	FormatInArg   any
 	FormatInArgFn func(f Format) (any, error)
+	ProbeStrings  []StringProbe
+	Stats         *Stats // nil to disable
+	UTF8Policy    UTF8Policy
+	Shared        map[string]any // state shared by all nested decodes of one root decode, nil to create
 	ReadBuf       *[]byte
+	// max size in bytes of decompressed data, zero for DefaultMaxDecompressedSize
+	MaxDecompressedSize int64
+}
+
+// StringProbe is used to try decode string field values as a format
+type StringProbe struct {
+	Name    string
+	Group   Group
+	MatchFn func(s string) bool // cheap check before trying to decode
 }
 
 // Decode try decode group and return first success and all other decoder errors
@@ -60,6 +92,10 @@ func decode(ctx context.Context, br bitio.ReaderAtSeeker, group Group, opts Opti
 		panic("group is nil, failed to register format?")
 	}
 
+	if opts.Shared == nil {
+		opts.Shared = map[string]any{}
+	}
+
 	formatsErr := FormatsError{}
 
 	for _, f := range group {
@@ -85,9 +121,16 @@ func decode(ctx context.Context, br bitio.ReaderAtSeeker, group Group, opts Opti
 		d := newDecoder(ctx, f, cBR, opts)
 
 		var decodeV any
+		var statsStart time.Time
+		if opts.Stats != nil {
+			statsStart = opts.Stats.begin()
+		}
 		r, rOk := recoverfn.Run(func() {
 			decodeV = f.DecodeFn(d, formatInArg)
 		})
+		if opts.Stats != nil {
+			opts.Stats.end(f.Name, statsStart, !rOk)
+		}
 
 		if ctx != nil && ctx.Err() != nil {
 			return nil, nil, ctx.Err()
@@ -134,6 +177,9 @@ func decode(ctx context.Context, br bitio.ReaderAtSeeker, group Group, opts Opti
 		}
 
 		d.Value.Range = ranges.Range{Start: decodeRange.Start, Len: minMaxRange.Len}
+		if opts.Stats != nil && rOk {
+			opts.Stats.addBits(f.Name, minMaxRange.Len)
+		}
 
 		if opts.IsRoot {
 			d.Value.postProcess()
@@ -154,10 +200,15 @@ type D struct {
 	Endian  Endian
 	Value   *Value
 	Options Options
+	// UTF8Policy for UTF-8 text read by this decoder, defaults to Options.UTF8Policy
+	// and can be changed to override for some fields
+	UTF8Policy UTF8Policy
 
 	bitBuf bitio.ReaderAtSeeker
 
 	readBuf *[]byte
+	// set by text reads if invalid UTF-8 was found, used to mark field value
+	invalidUTF8 bool
 }
 
 // TODO: new struct decoder?
@@ -185,7 +236,8 @@ func newDecoder(ctx context.Context, format Format, br bitio.ReaderAtSeeker, opt
 			IsRoot:     opts.IsRoot,
 			Format:     &format,
 		},
-		Options: opts,
+		Options:    opts,
+		UTF8Policy: opts.UTF8Policy,
 
 		bitBuf:  br,
 		readBuf: opts.ReadBuf,
@@ -202,7 +254,8 @@ func (d *D) fieldDecoder(name string, bitBuf bitio.ReaderAtSeeker, v any) *D {
 			Range:      ranges.Range{Start: d.Pos(), Len: 0},
 			RootReader: bitBuf,
 		},
-		Options: d.Options,
+		Options:    d.Options,
+		UTF8Policy: d.UTF8Policy,
 
 		bitBuf:  bitBuf,
 		readBuf: d.readBuf,
@@ -278,6 +331,19 @@ func (d *D) SharedReadBuf(n int) []byte {
 	return *d.readBuf
 }
 
+// SharedState returns state shared by all nested decodes of the root decode, for example to keep
+// track of things between packets. Created using newFn on first use, key should be prefixed with format name.
+func (d *D) SharedState(key string, newFn func() any) any {
+	if v, ok := d.Options.Shared[key]; ok {
+		return v
+	}
+	v := newFn()
+	if d.Options.Shared != nil {
+		d.Options.Shared[key] = v
+	}
+	return v
+}
+
 func (d *D) FillGaps(r ranges.Range, namePrefix string) {
 	makeWalkFn := func(fn func(iv *Value)) func(iv *Value, rootV *Value, depth int, rootDepth int) error {
 		return func(iv *Value, _ *Value, _ int, _ int) error {
@@ -776,6 +842,15 @@ func (d *D) FieldStruct(name string, fn func(d *D)) *D {
 	return cd
 }
 
+// SetValueChild makes current struct be converted to a jq value as the value of child name
+func (d *D) SetValueChild(name string) {
+	c, ok := d.Value.V.(*Compound)
+	if !ok || c.IsArray {
+		panic(fmt.Sprintf("%s is not a struct", d.Value.Name))
+	}
+	c.ValueChild = name
+}
+
 // FieldStructValue decode array of fields. Will be range sorted.
 func (d *D) FieldStructValue(name string) *D {
 	return d.FieldStruct(name, func(d *D) {})
@@ -854,6 +929,18 @@ func (d *D) FieldValueStr(name string, a string, sms ...scalar.Mapper) {
 	d.FieldScalarFn(name, func(_ scalar.S) (scalar.S, error) { return scalar.S{Actual: a}, nil }, sms...)
 }
 
+// FieldRef adds a field referencing another value of the same format, path is a path
+// expression relative to the format root, ex: ".subframes[1]". Target does not need to be
+// decoded yet.
+func (d *D) FieldRef(name string, path string, sms ...scalar.Mapper) {
+	d.FieldScalarFn(name, func(_ scalar.S) (scalar.S, error) { return scalar.S{Actual: path, Ref: true}, nil }, sms...)
+}
+
+// FieldRefValue adds a field referencing an already decoded value of the same format
+func (d *D) FieldRefValue(name string, v *Value, sms ...scalar.Mapper) {
+	d.FieldRef(name, v.FormatPathExpr(), sms...)
+}
+
 func (d *D) FieldValueNil(name string, sms ...scalar.Mapper) {
 	d.FieldScalarFn(name, func(_ scalar.S) (scalar.S, error) { return scalar.S{Actual: nil}, nil }, sms...)
 }
@@ -906,15 +993,23 @@ func (d *D) RangeFn(firstBit int64, nBits int64, fn func(d *D)) int64 {
 	return endPos - startPos
 }
 
+// childOptions returns options for a nested decode, options of the parent are copied so
+// they reach all nested decodes and only per decode options are reset
+func (d *D) childOptions(name string, fillGaps bool, isRoot bool, r ranges.Range, inArg any) Options {
+	opts := d.Options
+	opts.Name = name
+	opts.Description = ""
+	opts.FillGaps = fillGaps
+	opts.IsRoot = isRoot
+	opts.Range = r
+	opts.FormatInArg = inArg
+	opts.FormatInArgFn = nil
+	opts.ReadBuf = d.readBuf
+	return opts
+}
+
 func (d *D) Format(group Group, inArg any) any {
-	dv, v, err := decode(d.Ctx, d.bitBuf, group, Options{
-		Force:       d.Options.Force,
-		FillGaps:    false,
-		IsRoot:      false,
-		Range:       ranges.Range{Start: d.Pos(), Len: d.BitsLeft()},
-		FormatInArg: inArg,
-		ReadBuf:     d.readBuf,
-	})
+	dv, v, err := decode(d.Ctx, d.bitBuf, group, d.childOptions("", false, false, ranges.Range{Start: d.Pos(), Len: d.BitsLeft()}, inArg))
 	if dv == nil || dv.Errors() != nil {
 		d.IOPanic(err, "Format: decode")
 	}
@@ -936,15 +1031,7 @@ func (d *D) Format(group Group, inArg any) any {
 }
 
 func (d *D) TryFieldFormat(name string, group Group, inArg any) (*Value, any, error) {
-	dv, v, err := decode(d.Ctx, d.bitBuf, group, Options{
-		Name:        name,
-		Force:       d.Options.Force,
-		FillGaps:    false,
-		IsRoot:      false,
-		Range:       ranges.Range{Start: d.Pos(), Len: d.BitsLeft()},
-		FormatInArg: inArg,
-		ReadBuf:     d.readBuf,
-	})
+	dv, v, err := decode(d.Ctx, d.bitBuf, group, d.childOptions(name, false, false, ranges.Range{Start: d.Pos(), Len: d.BitsLeft()}, inArg))
 	if dv == nil || dv.Errors() != nil {
 		return nil, nil, err
 	}
@@ -974,15 +1061,7 @@ func (d *D) FieldFormatOrRaw(name string, group Group, inArg any) (*Value, any)
 }
 
 func (d *D) TryFieldFormatLen(name string, nBits int64, group Group, inArg any) (*Value, any, error) {
-	dv, v, err := decode(d.Ctx, d.bitBuf, group, Options{
-		Name:        name,
-		Force:       d.Options.Force,
-		FillGaps:    true,
-		IsRoot:      false,
-		Range:       ranges.Range{Start: d.Pos(), Len: nBits},
-		FormatInArg: inArg,
-		ReadBuf:     d.readBuf,
-	})
+	dv, v, err := decode(d.Ctx, d.bitBuf, group, d.childOptions(name, true, false, ranges.Range{Start: d.Pos(), Len: nBits}, inArg))
 	if dv == nil || dv.Errors() != nil {
 		return nil, nil, err
 	}
@@ -1013,15 +1092,7 @@ func (d *D) FieldFormatOrRawLen(name string, nBits int64, group Group, inArg any
 
 // TODO: return decooder?
 func (d *D) TryFieldFormatRange(name string, firstBit int64, nBits int64, group Group, inArg any) (*Value, any, error) {
-	dv, v, err := decode(d.Ctx, d.bitBuf, group, Options{
-		Name:        name,
-		Force:       d.Options.Force,
-		FillGaps:    true,
-		IsRoot:      false,
-		Range:       ranges.Range{Start: firstBit, Len: nBits},
-		FormatInArg: inArg,
-		ReadBuf:     d.readBuf,
-	})
+	dv, v, err := decode(d.Ctx, d.bitBuf, group, d.childOptions(name, true, false, ranges.Range{Start: firstBit, Len: nBits}, inArg))
 	if dv == nil || dv.Errors() != nil {
 		return nil, nil, err
 	}
@@ -1041,14 +1112,7 @@ func (d *D) FieldFormatRange(name string, firstBit int64, nBits int64, group Gro
 }
 
 func (d *D) TryFieldFormatBitBuf(name string, br bitio.ReaderAtSeeker, group Group, inArg any) (*Value, any, error) {
-	dv, v, err := decode(d.Ctx, br, group, Options{
-		Name:        name,
-		Force:       d.Options.Force,
-		FillGaps:    true,
-		IsRoot:      true,
-		FormatInArg: inArg,
-		ReadBuf:     d.readBuf,
-	})
+	dv, v, err := decode(d.Ctx, br, group, d.childOptions(name, true, true, ranges.Range{}, inArg))
 	if dv == nil || dv.Errors() != nil {
 		return nil, nil, err
 	}
@@ -1197,7 +1261,12 @@ func (d *D) FieldValue(name string, fn func() *Value) *Value {
 // looks a bit weird to force at least one ScalarFn arg
 func (d *D) TryFieldScalarFn(name string, sfn scalar.Fn, sms ...scalar.Mapper) (*scalar.S, error) {
 	v, err := d.TryFieldValue(name, func() (*Value, error) {
+		d.invalidUTF8 = false
 		s, err := sfn(scalar.S{})
+		if d.invalidUTF8 {
+			d.invalidUTF8 = false
+			s.InvalidUTF8 = true
+		}
 		if err != nil {
 			return &Value{V: &s}, err
 		}
@@ -1216,9 +1285,48 @@ func (d *D) TryFieldScalarFn(name string, sfn scalar.Fn, sms ...scalar.Mapper) (
 	if !ok {
 		panic("not a scalar value")
 	}
+	if len(d.Options.ProbeStrings) > 0 {
+		if str, ok := sr.Actual.(string); ok {
+			d.probeString(v, str)
+		}
+	}
 	return sr, nil
 }
 
+// probeString tries to decode string value v as one of the probe formats and on success
+// makes v a struct with the string as child "value" and the decoded value as child named
+// as the format. Value child is used so that v is still the string when used as jq value.
+func (d *D) probeString(v *Value, s string) {
+	for _, p := range d.Options.ProbeStrings {
+		if !p.MatchFn(s) {
+			continue
+		}
+		// probe strings are not probed again
+		opts := d.childOptions(p.Name, true, true, ranges.Range{}, nil)
+		opts.Force = false
+		opts.ProbeStrings = nil
+		dv, _, _ := decode(d.Ctx, bitio.NewBitReader([]byte(s), -1), p.Group, opts)
+		if dv == nil || dv.Errors() != nil {
+			continue
+		}
+
+		sv := &Value{
+			Parent:     v,
+			Name:       "value",
+			V:          v.V,
+			Range:      v.Range,
+			RootReader: v.RootReader,
+		}
+		dv.Parent = v
+		dv.Range.Start = v.Range.Start
+		v.V = &Compound{
+			Children:   []*Value{sv, dv},
+			ValueChild: sv.Name,
+		}
+		return
+	}
+}
+
 func (d *D) FieldScalarFn(name string, sfn scalar.Fn, sms ...scalar.Mapper) *scalar.S {
 	v, err := d.TryFieldScalarFn(name, sfn, sms...)
 	if err != nil {
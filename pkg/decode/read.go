@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"math"
 	"math/big"
+	"unicode/utf8"
 
 	"github.com/wader/fq/internal/mathextra"
 	"github.com/wader/fq/pkg/bitio"
@@ -126,6 +127,23 @@ var UTF16BOM = unicode.UTF16(unicode.LittleEndian, unicode.UseBOM)
 var UTF16BE = unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM)
 var UTF16LE = unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM)
 
+// decodeText decodes bytes to a string, invalid UTF-8 is handled according to UTF8Policy
+func (d *D) decodeText(e encoding.Encoding, bs []byte) (string, error) {
+	if e != UTF8BOM || utf8.Valid(bs) {
+		return e.NewDecoder().String(string(bs))
+	}
+
+	d.invalidUTF8 = true
+	switch d.UTF8Policy {
+	case UTF8Strict:
+		return "", fmt.Errorf("invalid UTF-8")
+	case UTF8Raw:
+		return string(bytes.TrimPrefix(bs, []byte("\xef\xbb\xbf"))), nil
+	default:
+		return e.NewDecoder().String(string(bs))
+	}
+}
+
 func (d *D) tryText(nBytes int, e encoding.Encoding) (string, error) {
 	if nBytes < 0 {
 		return "", fmt.Errorf("tryText nBytes must be >= 0 (%d)", nBytes)
@@ -139,7 +157,7 @@ func (d *D) tryText(nBytes int, e encoding.Encoding) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	return e.NewDecoder().String(string(bs))
+	return d.decodeText(e, bs)
 }
 
 // read length prefixed text (ex pascal short string)
@@ -150,8 +168,9 @@ func (d *D) tryTextLenPrefixed(lenBits int, fixedBytes int, e encoding.Encoding)
 	if lenBits < 0 {
 		return "", fmt.Errorf("tryTextLenPrefixed lenBits must be >= 0 (%d)", lenBits)
 	}
-	if fixedBytes < 0 {
-		return "", fmt.Errorf("tryTextLenPrefixed fixedBytes must be >= 0 (%d)", fixedBytes)
+	// -1 means no fixed length
+	if fixedBytes < -1 {
+		return "", fmt.Errorf("tryTextLenPrefixed fixedBytes must be >= -1 (%d)", fixedBytes)
 	}
 	bytesLeft := d.BitsLeft() / 8
 	if int64(fixedBytes) > bytesLeft {
@@ -178,7 +197,7 @@ func (d *D) tryTextLenPrefixed(lenBits int, fixedBytes int, e encoding.Encoding)
 		d.SeekAbs(p)
 		return "", err
 	}
-	return e.NewDecoder().String(string(bs[0:l]))
+	return d.decodeText(e, bs[0:l])
 }
 
 func (d *D) tryTextNull(nullBytes int, e encoding.Encoding) (string, error) {
@@ -198,7 +217,7 @@ func (d *D) tryTextNull(nullBytes int, e encoding.Encoding) (string, error) {
 		return "", err
 	}
 
-	return e.NewDecoder().String(string(bs[0 : n-nullBytes]))
+	return d.decodeText(e, bs[0:n-nullBytes])
 }
 
 func (d *D) tryTextNullLen(fixedBytes int, e encoding.Encoding) (string, error) {
@@ -219,7 +238,7 @@ func (d *D) tryTextNullLen(fixedBytes int, e encoding.Encoding) (string, error)
 		bs = bs[:nullIndex]
 	}
 
-	return e.NewDecoder().String(string(bs))
+	return d.decodeText(e, bs)
 }
 
 // ov is what to treat as 1
@@ -0,0 +1,80 @@
+package decode
+
+import (
+	"sort"
+	"time"
+)
+
+// FormatStats is statistics for decodes using one format
+type FormatStats struct {
+	Name   string
+	Count  int64 // number of decodes, includes failed probes
+	Errors int64 // number of failed decodes
+	Bits   int64 // bits decoded by successful decodes, includes nested formats
+	// Duration is wall time including nested formats, SelfDuration excludes nested formats
+	// so self durations of all formats sum up to the total decode time
+	Duration     time.Duration
+	SelfDuration time.Duration
+}
+
+// Stats collects per format decode statistics. Set Options.Stats to enable.
+// Not safe for concurrent use.
+type Stats struct {
+	formats map[string]*FormatStats
+	// durations of nested decodes for each decode in progress
+	nested []time.Duration
+}
+
+func NewStats() *Stats {
+	return &Stats{formats: map[string]*FormatStats{}}
+}
+
+func (s *Stats) begin() time.Time {
+	s.nested = append(s.nested, 0)
+	return time.Now()
+}
+
+func (s *Stats) format(name string) *FormatStats {
+	fs, ok := s.formats[name]
+	if !ok {
+		fs = &FormatStats{Name: name}
+		s.formats[name] = fs
+	}
+	return fs
+}
+
+func (s *Stats) end(name string, start time.Time, failed bool) {
+	d := time.Since(start)
+	nested := s.nested[len(s.nested)-1]
+	s.nested = s.nested[:len(s.nested)-1]
+	if len(s.nested) > 0 {
+		s.nested[len(s.nested)-1] += d
+	}
+
+	fs := s.format(name)
+	fs.Count++
+	if failed {
+		fs.Errors++
+	}
+	fs.Duration += d
+	fs.SelfDuration += d - nested
+}
+
+func (s *Stats) addBits(name string, bits int64) {
+	s.format(name).Bits += bits
+}
+
+// Formats returns statistics sorted by self duration, longest first
+func (s *Stats) Formats() []FormatStats {
+	var fss []FormatStats
+	for _, fs := range s.formats {
+		fss = append(fss, *fs)
+	}
+	sort.Slice(fss, func(i, j int) bool {
+		if fss[i].SelfDuration != fss[j].SelfDuration {
+			return fss[i].SelfDuration > fss[j].SelfDuration
+		}
+		return fss[i].Name < fss[j].Name
+	})
+	return fss
+}
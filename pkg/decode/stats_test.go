@@ -0,0 +1,83 @@
+package decode_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/decode"
+)
+
+var benchInnerGroup = decode.Group{{
+	Name: "inner",
+	DecodeFn: func(d *decode.D, _ any) any {
+		d.FieldU8("a")
+		d.FieldU8("b")
+		return nil
+	},
+}}
+
+var benchOuterGroup = decode.Group{{
+	Name: "outer",
+	DecodeFn: func(d *decode.D, _ any) any {
+		d.FieldArray("inners", func(d *decode.D) {
+			for !d.End() {
+				d.FieldFormatLen("inner", 16, benchInnerGroup, nil)
+			}
+		})
+		return nil
+	},
+}}
+
+func benchmarkDecode(b *testing.B, stats *decode.Stats) {
+	bs := make([]byte, 1024)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _, err := decode.Decode(context.Background(), bitio.NewBitReader(bs, -1), benchOuterGroup, decode.Options{
+			IsRoot: true,
+			Stats:  stats,
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// compare with stats disabled to make sure it has near zero overhead
+func BenchmarkDecode(b *testing.B) {
+	b.Run("stats_disabled", func(b *testing.B) { benchmarkDecode(b, nil) })
+	b.Run("stats_enabled", func(b *testing.B) { benchmarkDecode(b, decode.NewStats()) })
+}
+
+func TestStats(t *testing.T) {
+	stats := decode.NewStats()
+	bs := make([]byte, 8)
+	if _, _, err := decode.Decode(context.Background(), bitio.NewBitReader(bs, -1), benchOuterGroup, decode.Options{
+		IsRoot: true,
+		Stats:  stats,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	fss := map[string]decode.FormatStats{}
+	var selfSum int64
+	for _, fs := range stats.Formats() {
+		fss[fs.Name] = fs
+		selfSum += int64(fs.SelfDuration)
+	}
+	if c := fss["outer"].Count; c != 1 {
+		t.Errorf("outer count %d, expected 1", c)
+	}
+	if c := fss["inner"].Count; c != 4 {
+		t.Errorf("inner count %d, expected 4", c)
+	}
+	if b := fss["inner"].Bits; b != 4*16 {
+		t.Errorf("inner bits %d, expected %d", b, 4*16)
+	}
+	if b := fss["outer"].Bits; b != 8*8 {
+		t.Errorf("outer bits %d, expected %d", b, 8*8)
+	}
+	if d := int64(fss["outer"].Duration); selfSum != d {
+		t.Errorf("self durations sum %d, expected outer duration %d", selfSum, d)
+	}
+}
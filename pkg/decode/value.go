@@ -3,6 +3,8 @@ package decode
 import (
 	"errors"
 	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/wader/fq/pkg/bitio"
 	"github.com/wader/fq/pkg/ranges"
@@ -14,6 +16,9 @@ type Compound struct {
 	RangeSorted bool
 	Children    []*Value
 	Description string
+	// ValueChild is name of child used as the value of a struct when converted to a jq value,
+	// children are still available when used as a decode value
+	ValueChild string
 }
 
 // TODO: Encoding, u16le, varint etc, encode?
@@ -238,3 +243,114 @@ func (v *Value) TryScalarFn(sms ...scalar.Mapper) error {
 	v.V = &s
 	return err
 }
+
+// FormatPathExpr returns path from format root to value as a path expression, ex: .a.b[1]
+// Works during decode as array index is position among siblings.
+func (v *Value) FormatPathExpr() string {
+	var parts []string
+	for ; v.Parent != nil && !v.IsRoot && v.Format == nil; v = v.Parent {
+		pc, ok := v.Parent.V.(*Compound)
+		if !ok {
+			break
+		}
+		if pc.IsArray {
+			for i, c := range pc.Children {
+				if c == v {
+					parts = append(parts, "["+strconv.Itoa(i)+"]")
+					break
+				}
+			}
+		} else if isPathIdent(v.Name) {
+			parts = append(parts, "."+v.Name)
+		} else {
+			parts = append(parts, "."+strconv.Quote(v.Name))
+		}
+	}
+
+	var sb strings.Builder
+	for i := len(parts) - 1; i >= 0; i-- {
+		sb.WriteString(parts[i])
+	}
+	if sb.Len() == 0 {
+		return "."
+	}
+	return sb.String()
+}
+
+// LookupFormatPathExpr returns value at path expression relative to format root of v, nil
+// if not found or path is invalid.
+func (v *Value) LookupFormatPathExpr(path string) *Value {
+	cv := v.FormatRoot()
+	for path != "" && path != "." {
+		c, ok := cv.V.(*Compound)
+		if !ok {
+			return nil
+		}
+		switch {
+		case strings.HasPrefix(path, "["):
+			end := strings.IndexByte(path, ']')
+			if end == -1 {
+				return nil
+			}
+			i, err := strconv.Atoi(path[1:end])
+			if err != nil || !c.IsArray || i < 0 || i >= len(c.Children) {
+				return nil
+			}
+			cv = c.Children[i]
+			path = path[end+1:]
+		case strings.HasPrefix(path, "."):
+			var name string
+			path = path[1:]
+			if strings.HasPrefix(path, `"`) {
+				q, err := strconv.QuotedPrefix(path)
+				if err != nil {
+					return nil
+				}
+				name, _ = strconv.Unquote(q)
+				path = path[len(q):]
+			} else {
+				end := strings.IndexAny(path, ".[")
+				if end == -1 {
+					end = len(path)
+				}
+				name = path[0:end]
+				path = path[end:]
+			}
+			if c.IsArray {
+				return nil
+			}
+			var found *Value
+			for _, f := range c.Children {
+				if f.Name == name {
+					found = f
+					break
+				}
+			}
+			if found == nil {
+				return nil
+			}
+			cv = found
+		default:
+			return nil
+		}
+	}
+
+	return cv
+}
+
+func isPathIdent(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, r := range s {
+		switch {
+		case r == '_',
+			r >= 'a' && r <= 'z',
+			r >= 'A' && r <= 'Z',
+			i > 0 && r >= '0' && r <= '9':
+		default:
+			return false
+		}
+	}
+	return true
+}
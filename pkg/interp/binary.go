@@ -8,6 +8,8 @@ import (
 	"io/fs"
 	"io/ioutil"
 	"math/big"
+	"path/filepath"
+	"strings"
 
 	"github.com/wader/fq/internal/aheadreadseeker"
 	"github.com/wader/fq/internal/bitioextra"
@@ -23,6 +25,7 @@ import (
 func init() {
 	RegisterFunc1("_tobits", (*Interp)._toBits)
 	RegisterFunc0("open", (*Interp)._open)
+	RegisterFunc1("_tofile", (*Interp)._toFile)
 }
 
 type ToBinary interface {
@@ -145,6 +148,68 @@ func (i *Interp) _toBits(c any, opts toBitsOpts) any {
 	return bb
 }
 
+// isOutsideDir returns true if path is absolute or relative path escapes current directory
+func isOutsideDir(path string) bool {
+	p := filepath.Clean(path)
+	return filepath.IsAbs(p) ||
+		filepath.VolumeName(p) != "" ||
+		p == ".." ||
+		strings.HasPrefix(p, ".."+string(filepath.Separator))
+}
+
+// copyBinary copies bytes of binary to w without reading the whole range into memory
+func copyBinary(w io.Writer, bv Binary) (int64, error) {
+	br, err := bv.toReader()
+	if err != nil {
+		return 0, err
+	}
+	return bitioextra.CopyBits(w, br)
+}
+
+// writes bytes of a binary or value that can be a binary to a file
+func (i *Interp) _toFile(c any, path string) any {
+	if !i.writeAccess.AllowWrite {
+		return fmt.Errorf("%s: writing files is not allowed, use --allow-write", path)
+	}
+	if isOutsideDir(path) && !i.writeAccess.AllowWriteOutside {
+		return fmt.Errorf("%s: writing outside current directory is not allowed, use --allow-write-outside", path)
+	}
+
+	bv, err := toBinary(c)
+	if err != nil {
+		return err
+	}
+
+	if i.EvalInstance.IsCompleting {
+		return nil
+	}
+
+	cfs, ok := i.OS.FS().(CreateFS)
+	if !ok {
+		return fmt.Errorf("%s: writing files is not supported", path)
+	}
+	f, err := cfs.Create(path)
+	if err != nil {
+		var pe *fs.PathError
+		if errors.As(err, &pe) {
+			return fmt.Errorf("%s: %w", path, pe.Err)
+		}
+		return err
+	}
+	n, err := copyBinary(f, bv)
+	if cErr := f.Close(); err == nil {
+		err = cErr
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	return gojqextra.Normalize(map[string]any{
+		"path":          path,
+		"bytes_written": n,
+	})
+}
+
 type openFile struct {
 	Binary
 	filename   string
@@ -0,0 +1,46 @@
+package interp
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/wader/fq/internal/bitioextra"
+	"github.com/wader/fq/pkg/bitio"
+)
+
+type countWriter struct{ n int64 }
+
+func (cw *countWriter) Write(p []byte) (int, error) {
+	cw.n += int64(len(p))
+	return len(p), nil
+}
+
+func TestCopyBinaryMemoryBounded(t *testing.T) {
+	const size = 256 * 1024 * 1024
+	const maxAlloc = 1024 * 1024
+
+	br, err := bitio.NewMultiReader(bitioextra.NewZeroAtSeeker(size * 8))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bv, err := NewBinaryFromBitReader(br, 8, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	cw := &countWriter{}
+	n, err := copyBinary(cw, bv)
+	runtime.ReadMemStats(&after)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != size || cw.n != size {
+		t.Errorf("expected %d bytes got %d written %d", size, n, cw.n)
+	}
+	if alloc := after.TotalAlloc - before.TotalAlloc; alloc > maxAlloc {
+		t.Errorf("expected at most %d bytes allocated got %d", maxAlloc, alloc)
+	}
+}
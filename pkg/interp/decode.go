@@ -27,6 +27,7 @@ func init() {
 	RegisterFunc0("_registry", (*Interp)._registry)
 	RegisterFunc1("_tovalue", (*Interp)._toValue)
 	RegisterFunc2("_decode", (*Interp)._decode)
+	RegisterFunc0("_decode_stats", (*Interp)._decodeStats)
 }
 
 type expectedExtkeyError struct {
@@ -165,17 +166,76 @@ func (i *Interp) _registry(c any) any {
 }
 
 func (i *Interp) _toValue(c any, opts map[string]any) any {
-	v, _ := toValue(
-		func() Options { return OptionsFromValue(opts) },
-		c,
-	)
+	// nested values only need to be converted if options change how binaries are converted,
+	// otherwise use options lazily as they are often not needed
+	if bitsFormat, _ := opts["bits_format"].(string); opts["raw_values"] == nil &&
+		(bitsFormat == "" || bitsFormat == "snippet") {
+		v, _ := toValue(
+			func() Options { return OptionsFromValue(opts) },
+			c,
+		)
+		return v
+	}
+
+	o := OptionsFromValue(opts)
+	v, _ := toValueDeep(func() Options { return o }, c)
 	return v
 }
 
 type decodeOpts struct {
-	Force    bool
-	Progress string
-	Remain   map[string]any `mapstruct:",remain"`
+	Force           bool
+	Progress        string
+	ProbeStrings    []string
+	Stats           bool
+	UTF8            string
+	DecompressLimit int64
+	Remain          map[string]any `mapstruct:",remain"`
+}
+
+const (
+	probeStringMinLen = 8
+	probeStringMaxLen = 16 * 1024 * 1024
+)
+
+func isXMLNameStartChar(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == '_' || c == ':' || c >= 0x80
+}
+
+// start characters that make a string plausible for a probe format, used to
+// not try to decode each and every string
+var probeStringMatchFns = map[string]func(s string) bool{
+	"xml": func(s string) bool {
+		// element, <?xml ...?> declaration, <!DOCTYPE or comment
+		return len(s) >= 2 && s[0] == '<' && (isXMLNameStartChar(s[1]) || s[1] == '?' || s[1] == '!')
+	},
+	"json": func(s string) bool {
+		return len(s) >= 1 && (s[0] == '{' || s[0] == '[')
+	},
+}
+
+func (i *Interp) probeStrings(names []string) ([]decode.StringProbe, error) {
+	var probes []decode.StringProbe
+	for _, name := range names {
+		matchFn, ok := probeStringMatchFns[name]
+		if !ok {
+			return nil, fmt.Errorf("probe_strings: unsupported format %q", name)
+		}
+		group, err := i.Registry.FormatGroup(name)
+		if err != nil {
+			return nil, err
+		}
+		probes = append(probes, decode.StringProbe{
+			Name:  name,
+			Group: group,
+			MatchFn: func(s string) bool {
+				if len(s) < probeStringMinLen || len(s) > probeStringMaxLen {
+					return false
+				}
+				return matchFn(strings.TrimLeft(s, " \t\r\n\ufeff"))
+			},
+		})
+	}
+	return probes, nil
 }
 
 func (i *Interp) _decode(c any, format string, opts decodeOpts) any {
@@ -235,14 +295,35 @@ func (i *Interp) _decode(c any, format string, opts decodeOpts) any {
 	if err != nil {
 		return err
 	}
+	probeStrings, err := i.probeStrings(opts.ProbeStrings)
+	if err != nil {
+		return err
+	}
+
+	var stats *decode.Stats
+	if opts.Stats {
+		stats = i.decodeStats
+	}
+	utf8Policy := decode.UTF8Replace
+	if opts.UTF8 != "" {
+		var ok bool
+		utf8Policy, ok = decode.UTF8PolicyNames[opts.UTF8]
+		if !ok {
+			return fmt.Errorf("utf8: unknown policy %q, should be replace, strict or raw", opts.UTF8)
+		}
+	}
 
 	dv, formatOut, err := decode.Decode(i.EvalInstance.Ctx, bv.br, decodeFormat,
 		decode.Options{
-			IsRoot:      true,
-			FillGaps:    true,
-			Force:       opts.Force,
-			Range:       bv.r,
-			Description: filename,
+			IsRoot:              true,
+			FillGaps:            true,
+			Force:               opts.Force,
+			Range:               bv.r,
+			Description:         filename,
+			ProbeStrings:        probeStrings,
+			Stats:               stats,
+			UTF8Policy:          utf8Policy,
+			MaxDecompressedSize: opts.DecompressLimit,
 			FormatInArgFn: func(f decode.Format) (any, error) {
 				inArg := f.DecodeInArg
 				if inArg == nil {
@@ -293,6 +374,22 @@ func (i *Interp) _decode(c any, format string, opts decodeOpts) any {
 	return makeDecodeValueOut(dv, formatOutMap)
 }
 
+// _decodeStats returns decode statistics collected so far, durations are in nanoseconds
+func (i *Interp) _decodeStats(c any) any {
+	vs := []any{}
+	for _, fs := range i.decodeStats.Formats() {
+		vs = append(vs, map[string]any{
+			"format":           fs.Name,
+			"count":            fs.Count,
+			"errors":           fs.Errors,
+			"bytes":            fs.Bits / 8,
+			"duration_ns":      fs.Duration.Nanoseconds(),
+			"self_duration_ns": fs.SelfDuration.Nanoseconds(),
+		})
+	}
+	return gojqextra.Normalize(vs)
+}
+
 func valueKey(name string, a, b func(name string) any) any {
 	if strings.HasPrefix(name, "_") {
 		return a(name)
@@ -312,7 +409,15 @@ func valueHas(key any, a func(name string) any, b func(key any) any) any {
 
 // optsFn is a function as toValue is used by tovalue/0 so needs to be fast
 func toValue(optsFn func() Options, v any) (any, bool) {
+	// ordered object is already a plain value, converting to a map would lose key order
+	if dv, ok := v.(decodeValue); ok {
+		if o, ok := dv.JQValue.(*gojqextra.OrderedObject); ok {
+			return o, true
+		}
+	}
 	switch v := v.(type) {
+	case *gojqextra.OrderedObject:
+		return v, true
 	case JQValueEx:
 		if optsFn == nil {
 			return v.JQValueToGoJQ(), true
@@ -327,6 +432,50 @@ func toValue(optsFn func() Options, v any) (any, bool) {
 	}
 }
 
+// toValueDeep is like toValue but also converts nested values so that options like
+// bits_format are used for the whole tree and not only the top value
+func toValueDeep(optsFn func() Options, v any) (any, bool) {
+	v, ok := toValue(optsFn, v)
+	if !ok {
+		return nil, false
+	}
+	// copy as jq values should not be modified
+	switch vv := v.(type) {
+	case *gojqextra.OrderedObject:
+		vo := gojqextra.NewOrderedObject()
+		for _, k := range vv.Keys() {
+			e, _ := vv.Get(k)
+			if ev, ok := toValueDeep(optsFn, e); ok {
+				vo.Set(k, ev)
+			} else {
+				vo.Set(k, e)
+			}
+		}
+		return vo, true
+	case map[string]any:
+		vm := make(map[string]any, len(vv))
+		for k, e := range vv {
+			if ev, ok := toValueDeep(optsFn, e); ok {
+				vm[k] = ev
+			} else {
+				vm[k] = e
+			}
+		}
+		return vm, true
+	case []any:
+		vs := make([]any, len(vv))
+		for i, e := range vv {
+			if ev, ok := toValueDeep(optsFn, e); ok {
+				vs[i] = ev
+			} else {
+				vs[i] = e
+			}
+		}
+		return vs, true
+	}
+	return v, true
+}
+
 func makeDecodeValue(dv *decode.Value) any {
 	return makeDecodeValueOut(dv, nil)
 }
@@ -403,6 +552,11 @@ func makeDecodeValueOut(dv *decode.Value, out any) any {
 				JQValue:         gojqextra.Object(vv),
 				decodeValueBase: decodeValueBase{dv: dv},
 			}
+		case *gojqextra.OrderedObject:
+			return decodeValue{
+				JQValue:         vv,
+				decodeValueBase: decodeValueBase{dv: dv},
+			}
 		case nil:
 			return decodeValue{
 				JQValue:         gojqextra.Null{},
@@ -452,6 +606,8 @@ func (dvb decodeValueBase) ExtKeys() []string {
 		"_bits",
 		"_bytes",
 		"_unknown",
+		"_valid_utf8",
+		"_ref",
 		"_index", // TODO: only if parent is array?
 	}
 
@@ -566,6 +722,30 @@ func (dvb decodeValueBase) JQValueKey(name string) any {
 		default:
 			return false
 		}
+	case "_valid_utf8":
+		switch vv := dv.V.(type) {
+		case *scalar.S:
+			if _, ok := vv.Actual.(string); ok {
+				return !vv.InvalidUTF8
+			}
+			return nil
+		default:
+			return nil
+		}
+	case "_ref":
+		switch vv := dv.V.(type) {
+		case *scalar.S:
+			if !vv.Ref {
+				return nil
+			}
+			rv := dv.LookupFormatPathExpr(vv.ActualStr())
+			if rv == nil {
+				return nil
+			}
+			return makeDecodeValue(rv)
+		default:
+			return nil
+		}
 	case "_index":
 		if dv.Index != -1 {
 			return dv.Index
@@ -751,6 +931,17 @@ func (v StructDecodeValue) JQValueHas(key any) any {
 	)
 }
 func (v StructDecodeValue) JQValueToGoJQ() any {
+	if v.Compound.ValueChild != "" {
+		for _, f := range v.Compound.Children {
+			if f.Name == v.Compound.ValueChild {
+				if fv, ok := toValue(nil, makeDecodeValue(f)); ok {
+					return fv
+				}
+			}
+		}
+		return nil
+	}
+
 	vm := make(map[string]any, len(v.Compound.Children))
 	for _, f := range v.Compound.Children {
 		vm[f.Name] = makeDecodeValue(f)
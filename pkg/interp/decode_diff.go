@@ -0,0 +1,426 @@
+package interp
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"reflect"
+
+	"github.com/wader/fq/internal/bitioextra"
+	"github.com/wader/fq/internal/gojqextra"
+	"github.com/wader/fq/pkg/bitio"
+	"github.com/wader/fq/pkg/decode"
+	"github.com/wader/fq/pkg/scalar"
+)
+
+func init() {
+	RegisterFunc2("_decode_diff", (*Interp)._decodeDiff)
+}
+
+const (
+	decodeDiffDefaultMaxDiffs = 1000
+	// max number of element pairs to compare when aligning arrays, larger arrays are
+	// aligned by index after trimming common prefix and suffix
+	decodeDiffMaxAlignCells = 1 << 20
+)
+
+type decodeDiffOpts struct {
+	MaxDiffs int
+	Remain   map[string]any `mapstruct:",remain"`
+}
+
+var errDecodeDiffTruncated = errors.New("truncated")
+
+type decodeDiffer struct {
+	opts     Options
+	maxDiffs int
+	diffs    []any
+}
+
+// _decodeDiff compares two decode values and returns an array of differences. Fields are
+// matched by name in structs and by content alignment in arrays. Ranges are in bits.
+func (i *Interp) _decodeDiff(c any, other any, opts decodeDiffOpts) any {
+	a, ok := c.(DecodeValue)
+	if !ok {
+		return gojqextra.FuncTypeError{Name: "decode_diff", V: c}
+	}
+	b, ok := other.(DecodeValue)
+	if !ok {
+		return gojqextra.FuncArgTypeError{Name: "decode_diff", ArgName: "first", V: other}
+	}
+	adv := a.DecodeValue()
+	bdv := b.DecodeValue()
+
+	af := adv.FormatRoot().Format
+	bf := bdv.FormatRoot().Format
+	if af != nil && bf != nil && af.Name != bf.Name {
+		return fmt.Errorf("can't diff different formats: %s and %s", af.Name, bf.Name)
+	}
+
+	maxDiffs := opts.MaxDiffs
+	if maxDiffs <= 0 {
+		maxDiffs = decodeDiffDefaultMaxDiffs
+	}
+	dd := &decodeDiffer{
+		opts:     OptionsFromValue(opts.Remain),
+		maxDiffs: maxDiffs,
+		diffs:    []any{},
+	}
+
+	if err := dd.diff(adv, bdv, []any{}, []any{}); err != nil {
+		if !errors.Is(err, errDecodeDiffTruncated) {
+			return err
+		}
+		dd.diffs = append(dd.diffs, map[string]any{"kind": "truncated"})
+	}
+
+	return gojqextra.Normalize(dd.diffs)
+}
+
+func (dd *decodeDiffer) side(dv *decode.Value, path []any, withValue bool) map[string]any {
+	s := map[string]any{
+		"path":  path,
+		"start": dv.Range.Start,
+		"len":   dv.Range.Len,
+	}
+	if withValue {
+		if _, ok := dv.V.(*scalar.S); ok {
+			v, _ := toValue(func() Options { return dd.opts }, makeDecodeValue(dv))
+			s["value"] = v
+		}
+	}
+	return s
+}
+
+func (dd *decodeDiffer) add(kind string, a *decode.Value, aPath []any, b *decode.Value, bPath []any, withValue bool) error {
+	if len(dd.diffs) >= dd.maxDiffs {
+		return errDecodeDiffTruncated
+	}
+	d := map[string]any{"kind": kind}
+	if a != nil {
+		d["path"] = aPath
+		d["a"] = dd.side(a, aPath, withValue)
+	} else {
+		d["path"] = bPath
+	}
+	if b != nil {
+		d["b"] = dd.side(b, bPath, withValue)
+	}
+	dd.diffs = append(dd.diffs, d)
+	return nil
+}
+
+func appendPath(path []any, p any) []any {
+	np := make([]any, len(path), len(path)+1)
+	copy(np, path)
+	return append(np, p)
+}
+
+func (dd *decodeDiffer) diff(a, b *decode.Value, aPath, bPath []any) error {
+	switch av := a.V.(type) {
+	case *decode.Compound:
+		bv, ok := b.V.(*decode.Compound)
+		if !ok || av.IsArray != bv.IsArray {
+			return dd.add("changed", a, aPath, b, bPath, true)
+		}
+		if av.IsArray {
+			return dd.diffArray(a, av, b, bv, aPath, bPath)
+		}
+		return dd.diffStruct(a, av, b, bv, aPath, bPath)
+	case *scalar.S:
+		bv, ok := b.V.(*scalar.S)
+		if !ok {
+			return dd.add("changed", a, aPath, b, bPath, true)
+		}
+		equal, err := scalarEqual(av, bv)
+		if err != nil {
+			return err
+		}
+		if !equal {
+			return dd.add("changed", a, aPath, b, bPath, true)
+		}
+		if a.Range.Len != b.Range.Len {
+			return dd.add("resized", a, aPath, b, bPath, false)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unreachable value %#+v", a.V)
+	}
+}
+
+type decodeDiffPair struct {
+	a, b int // -1 if missing on one side
+}
+
+// diffChildren diffs aligned children and reports shifts that are not explained by
+// differences of previous siblings, that is when both the offset in parent and the gap
+// to previous siblings differs, or when the trailing gap to end of parent differs.
+func (dd *decodeDiffer) diffChildren(a *decode.Value, ac *decode.Compound, b *decode.Value, bc *decode.Compound, aPath, bPath []any, pairs []decodeDiffPair) error {
+	// children ranges might overlap or be unsorted so use max stop of previous siblings
+	prevStops := func(dv *decode.Value, c *decode.Compound) []int64 {
+		stops := make([]int64, len(c.Children)+1)
+		stops[0] = dv.InnerRange().Start
+		for i, cv := range c.Children {
+			stops[i+1] = stops[i]
+			if s := cv.Range.Stop(); s > stops[i] {
+				stops[i+1] = s
+			}
+		}
+		return stops
+	}
+	aStops := prevStops(a, ac)
+	bStops := prevStops(b, bc)
+	childPath := func(path []any, c *decode.Compound, i int) []any {
+		if c.IsArray {
+			return appendPath(path, i)
+		}
+		return appendPath(path, c.Children[i].Name)
+	}
+
+	for _, p := range pairs {
+		switch {
+		case p.b == -1:
+			if err := dd.add("removed", ac.Children[p.a], childPath(aPath, ac, p.a), nil, nil, true); err != nil {
+				return err
+			}
+		case p.a == -1:
+			if err := dd.add("added", nil, nil, bc.Children[p.b], childPath(bPath, bc, p.b), true); err != nil {
+				return err
+			}
+		default:
+			acv := ac.Children[p.a]
+			bcv := bc.Children[p.b]
+			acPath := childPath(aPath, ac, p.a)
+			bcPath := childPath(bPath, bc, p.b)
+			if acv.Range.Start-a.InnerRange().Start != bcv.Range.Start-b.InnerRange().Start &&
+				acv.Range.Start-aStops[p.a] != bcv.Range.Start-bStops[p.b] {
+				if err := dd.add("moved", acv, acPath, bcv, bcPath, false); err != nil {
+					return err
+				}
+			}
+			if err := dd.diff(acv, bcv, acPath, bcPath); err != nil {
+				return err
+			}
+		}
+	}
+
+	aTrail := a.InnerRange().Stop() - aStops[len(ac.Children)]
+	bTrail := b.InnerRange().Stop() - bStops[len(bc.Children)]
+	if aTrail != bTrail {
+		return dd.add("resized", a, aPath, b, bPath, false)
+	}
+
+	return nil
+}
+
+func (dd *decodeDiffer) diffStruct(a *decode.Value, ac *decode.Compound, b *decode.Value, bc *decode.Compound, aPath, bPath []any) error {
+	// match by name and occurrence in case of duplicate names
+	type nameKey struct {
+		name string
+		n    int
+	}
+	bIndex := map[nameKey]int{}
+	bSeen := map[string]int{}
+	for i, c := range bc.Children {
+		bIndex[nameKey{c.Name, bSeen[c.Name]}] = i
+		bSeen[c.Name]++
+	}
+
+	aToB := make([]int, len(ac.Children))
+	bMatched := make([]bool, len(bc.Children))
+	aSeen := map[string]int{}
+	for i, c := range ac.Children {
+		j, ok := bIndex[nameKey{c.Name, aSeen[c.Name]}]
+		aSeen[c.Name]++
+		if !ok {
+			aToB[i] = -1
+			continue
+		}
+		aToB[i] = j
+		bMatched[j] = true
+	}
+
+	// keep fields only in b close to where they are in b
+	var pairs []decodeDiffPair
+	nextB := 0
+	for i, j := range aToB {
+		if j == -1 {
+			pairs = append(pairs, decodeDiffPair{a: i, b: -1})
+			continue
+		}
+		for ; nextB < j; nextB++ {
+			if !bMatched[nextB] {
+				pairs = append(pairs, decodeDiffPair{a: -1, b: nextB})
+			}
+		}
+		pairs = append(pairs, decodeDiffPair{a: i, b: j})
+	}
+	for ; nextB < len(bc.Children); nextB++ {
+		if !bMatched[nextB] {
+			pairs = append(pairs, decodeDiffPair{a: -1, b: nextB})
+		}
+	}
+
+	return dd.diffChildren(a, ac, b, bc, aPath, bPath, pairs)
+}
+
+func (dd *decodeDiffer) diffArray(a *decode.Value, ac *decode.Compound, b *decode.Value, bc *decode.Compound, aPath, bPath []any) error {
+	n, m := len(ac.Children), len(bc.Children)
+	var pairs []decodeDiffPair
+
+	if n == m {
+		for i := 0; i < n; i++ {
+			pairs = append(pairs, decodeDiffPair{a: i, b: i})
+		}
+		return dd.diffChildren(a, ac, b, bc, aPath, bPath, pairs)
+	}
+
+	ah := make([]uint64, n)
+	bh := make([]uint64, m)
+	for i, c := range ac.Children {
+		h, err := valueHash(c)
+		if err != nil {
+			return err
+		}
+		ah[i] = h
+	}
+	for i, c := range bc.Children {
+		h, err := valueHash(c)
+		if err != nil {
+			return err
+		}
+		bh[i] = h
+	}
+
+	prefix := 0
+	for prefix < n && prefix < m && ah[prefix] == bh[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < n-prefix && suffix < m-prefix && ah[n-1-suffix] == bh[m-1-suffix] {
+		suffix++
+	}
+
+	for i := 0; i < prefix; i++ {
+		pairs = append(pairs, decodeDiffPair{a: i, b: i})
+	}
+	pairs = append(pairs, alignHashes(ah[prefix:n-suffix], bh[prefix:m-suffix], prefix, prefix)...)
+	for i := 0; i < suffix; i++ {
+		pairs = append(pairs, decodeDiffPair{a: n - suffix + i, b: m - suffix + i})
+	}
+
+	return dd.diffChildren(a, ac, b, bc, aPath, bPath, pairs)
+}
+
+// alignHashes aligns elements using longest common subsequence of content hashes.
+// Unmatched elements between matches are paired by index and the rest are
+// added or removed.
+func alignHashes(ah, bh []uint64, aOff, bOff int) []decodeDiffPair {
+	n, m := len(ah), len(bh)
+
+	var anchors []decodeDiffPair
+	if n > 0 && m > 0 && n*m <= decodeDiffMaxAlignCells {
+		lcs := make([][]int32, n+1)
+		for i := range lcs {
+			lcs[i] = make([]int32, m+1)
+		}
+		for i := n - 1; i >= 0; i-- {
+			for j := m - 1; j >= 0; j-- {
+				if ah[i] == bh[j] {
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				} else if lcs[i+1][j] >= lcs[i][j+1] {
+					lcs[i][j] = lcs[i+1][j]
+				} else {
+					lcs[i][j] = lcs[i][j+1]
+				}
+			}
+		}
+		for i, j := 0, 0; i < n && j < m; {
+			switch {
+			case ah[i] == bh[j]:
+				anchors = append(anchors, decodeDiffPair{a: i, b: j})
+				i++
+				j++
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				i++
+			default:
+				j++
+			}
+		}
+	}
+	anchors = append(anchors, decodeDiffPair{a: n, b: m})
+
+	var pairs []decodeDiffPair
+	ai, bi := 0, 0
+	for _, an := range anchors {
+		for ; ai < an.a && bi < an.b; ai, bi = ai+1, bi+1 {
+			pairs = append(pairs, decodeDiffPair{a: aOff + ai, b: bOff + bi})
+		}
+		for ; ai < an.a; ai++ {
+			pairs = append(pairs, decodeDiffPair{a: aOff + ai, b: -1})
+		}
+		for ; bi < an.b; bi++ {
+			pairs = append(pairs, decodeDiffPair{a: -1, b: bOff + bi})
+		}
+		if an.a < n {
+			pairs = append(pairs, decodeDiffPair{a: aOff + an.a, b: bOff + an.b})
+			ai, bi = an.a+1, an.b+1
+		}
+	}
+
+	return pairs
+}
+
+func valueHash(dv *decode.Value) (uint64, error) {
+	r := dv.InnerRange()
+	br, err := bitioextra.Range(dv.RootReader, r.Start, r.Len)
+	if err != nil {
+		return 0, err
+	}
+	h := fnv.New64a()
+	if _, err := bitioextra.CopyBits(h, br); err != nil {
+		return 0, err
+	}
+	// include length as copy pads last byte
+	return h.Sum64() ^ uint64(r.Len), nil
+}
+
+func scalarEqual(a, b *scalar.S) (bool, error) {
+	if !reflect.DeepEqual(a.Sym, b.Sym) {
+		return false, nil
+	}
+	abr, aOk := a.Actual.(bitio.ReaderAtSeeker)
+	bbr, bOk := b.Actual.(bitio.ReaderAtSeeker)
+	if aOk != bOk {
+		return false, nil
+	}
+	if !aOk {
+		return reflect.DeepEqual(a.Actual, b.Actual), nil
+	}
+
+	ah, err := readerHash(abr)
+	if err != nil {
+		return false, err
+	}
+	bh, err := readerHash(bbr)
+	if err != nil {
+		return false, err
+	}
+	return ah == bh, nil
+}
+
+func readerHash(br bitio.ReaderAtSeeker) (uint64, error) {
+	brC, err := bitio.CloneReaderAtSeeker(br)
+	if err != nil {
+		return 0, err
+	}
+	l, err := bitioextra.Len(brC)
+	if err != nil {
+		return 0, err
+	}
+	h := fnv.New64a()
+	if _, err := bitioextra.CopyBits(h, brC); err != nil {
+		return 0, err
+	}
+	return h.Sum64() ^ uint64(l), nil
+}
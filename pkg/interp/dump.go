@@ -11,6 +11,7 @@ import (
 	"github.com/wader/fq/internal/asciiwriter"
 	"github.com/wader/fq/internal/bitioextra"
 	"github.com/wader/fq/internal/columnwriter"
+	"github.com/wader/fq/internal/gojqextra"
 	"github.com/wader/fq/internal/hexpairwriter"
 	"github.com/wader/fq/internal/mathextra"
 	"github.com/wader/fq/pkg/bitio"
@@ -44,6 +45,7 @@ func isCompound(v *decode.Value) bool {
 
 type dumpCtx struct {
 	opts        Options
+	displayBase []displayBasePattern
 	buf         []byte
 	cw          *columnwriter.Writer
 	hexHeader   string
@@ -143,19 +145,34 @@ func dumpEx(v *decode.Value, ctx *dumpCtx, depth int, rootV *decode.Value, rootD
 			cfmt(colField, " %s", deco.Value.F(vv.Description))
 		}
 	case *scalar.S:
+		actualDisplay := vv.ActualDisplay
+		if len(ctx.displayBase) > 0 {
+			path := valuePathExprDecorated(v, PlainDecorator)
+			for _, p := range ctx.displayBase {
+				if globMatch(p.pattern, path) {
+					actualDisplay = p.df
+					break
+				}
+			}
+		}
+
 		switch av := vv.Actual.(type) {
-		case map[string]any:
+		case map[string]any, *gojqextra.OrderedObject:
 			cfmt(colField, ": %s", deco.Object.F("{}"))
 		case []any:
 			// TODO: format?
 			cfmt(colField, ": %s%s:%s%s", deco.Index.F("["), deco.Number.F("0"), deco.Number.F(strconv.Itoa(len(av))), deco.Index.F("]"))
 		default:
 			cprint(colField, ":")
-			if vv.Sym == nil {
-				cfmt(colField, " %s", deco.ValueColor(vv.Actual).F(previewValue(vv.Actual, vv.ActualDisplay)))
-			} else {
+			switch {
+			case vv.Ref:
+				// path expression to referenced value, not quoted as a string
+				cfmt(colField, " %s", deco.Value.F(vv.ActualStr()))
+			case vv.Sym == nil:
+				cfmt(colField, " %s", deco.ValueColor(vv.Actual).F(previewValue(vv.Actual, actualDisplay)))
+			default:
 				cfmt(colField, " %s", deco.ValueColor(vv.Sym).F(previewValue(vv.Sym, vv.SymDisplay)))
-				cfmt(colField, " (%s)", deco.ValueColor(vv.Actual).F(previewValue(vv.Actual, vv.ActualDisplay)))
+				cfmt(colField, " (%s)", deco.ValueColor(vv.Actual).F(previewValue(vv.Actual, actualDisplay)))
 			}
 		}
 
@@ -165,6 +182,12 @@ func dumpEx(v *decode.Value, ctx *dumpCtx, depth int, rootV *decode.Value, rootD
 		if vv.Description != "" {
 			cfmt(colField, " (%s)", deco.Value.F(vv.Description))
 		}
+		if vv.Ref {
+			cfmt(colField, " (%s)", deco.Value.F("ref"))
+		}
+		if vv.InvalidUTF8 {
+			cfmt(colField, " (%s)", deco.Error.F("invalid UTF-8"))
+		}
 	default:
 		panic(fmt.Sprintf("unreachable vv %#+v", vv))
 	}
@@ -388,8 +411,14 @@ func dump(v *decode.Value, w io.Writer, opts Options) error {
 		asciiHeader += s[len(s)-1:]
 	}
 
+	displayBase, err := displayBasePatterns(opts.DisplayBase)
+	if err != nil {
+		return err
+	}
+
 	ctx := &dumpCtx{
 		opts:        opts,
+		displayBase: displayBase,
 		buf:         buf,
 		cw:          cw,
 		hexHeader:   hexHeader,
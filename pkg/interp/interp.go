@@ -161,6 +161,11 @@ type OS interface {
 	History() ([]string, error)
 }
 
+// CreateFS is optionally implemented by the fs.FS returned by OS.FS() to support writing files
+type CreateFS interface {
+	Create(name string) (io.WriteCloser, error)
+}
+
 type FixedFileInfo struct {
 	FName    string
 	FSize    int64
@@ -338,6 +343,10 @@ type Interp struct {
 	interruptStack *ctxstack.Stack
 	// global state, is ref as Interp is cloned per eval
 	state *any
+	// decode statistics collected when stats option is enabled
+	decodeStats *decode.Stats
+	// set from cli args in Main, not from jq so that queries can't enable writing
+	writeAccess writeAccess
 
 	// new for each eval, other values are copied by value
 	EvalInstance EvalInstance
@@ -366,6 +375,7 @@ func New(os OS, registry *Registry) (*Interp, error) {
 		}
 	})
 	i.state = new(any)
+	i.decodeStats = decode.NewStats()
 
 	return i, nil
 }
@@ -375,11 +385,35 @@ func (i *Interp) Stop() {
 	i.interruptStack.Stop()
 }
 
+type writeAccess struct {
+	AllowWrite        bool
+	AllowWriteOutside bool
+}
+
+// writeAccessFromArgs looks for --allow-write and --allow-write-outside before end of options
+func writeAccessFromArgs(args []string) writeAccess {
+	var wa writeAccess
+	for _, a := range args {
+		switch a {
+		case "--":
+			return wa
+		case "--allow-write":
+			wa.AllowWrite = true
+		case "--allow-write-outside":
+			wa.AllowWriteOutside = true
+		}
+	}
+	return wa
+}
+
 func (i *Interp) Main(ctx context.Context, output Output, versionStr string) error {
 	var args []any
 	for _, a := range i.OS.Args() {
 		args = append(args, a)
 	}
+	if len(i.OS.Args()) > 0 {
+		i.writeAccess = writeAccessFromArgs(i.OS.Args()[1:])
+	}
 
 	platform := i.OS.Platform()
 	input := map[string]any{
@@ -1002,6 +1036,8 @@ type Options struct {
 	JoinString   string
 	Compact      bool
 	BitsFormat   string
+	RawValues    *RawValuesOptions
+	DisplayBase  map[string]int
 	LineBytes    int
 	DisplayBytes int
 	Addrbase     int
@@ -1011,6 +1047,12 @@ type Options struct {
 	BitsFormatFn func(br bitio.ReaderAtSeeker) (any, error)
 }
 
+// RawValuesOptions inlines the full content of small raw fields as value
+type RawValuesOptions struct {
+	MaxBytes int
+	Encoding string
+}
+
 func OptionsFromValue(v any) Options {
 	var opts Options
 	_ = mapstruct.ToStruct(v, &opts)
@@ -1020,6 +1062,14 @@ func OptionsFromValue(v any) Options {
 	opts.Sizebase = mathextra.ClampInt(2, 36, opts.Sizebase)
 	opts.LineBytes = mathextra.MaxInt(0, opts.LineBytes)
 	opts.DisplayBytes = mathextra.MaxInt(0, opts.DisplayBytes)
+	if opts.RawValues != nil {
+		if opts.RawValues.MaxBytes <= 0 {
+			opts.RawValues.MaxBytes = 64
+		}
+		if opts.RawValues.Encoding == "" {
+			opts.RawValues.Encoding = "hex"
+		}
+	}
 	opts.Decorator = decoratorFromOptions(opts)
 	opts.BitsFormatFn = bitsFormatFnFromOptions(opts)
 
@@ -1027,6 +1077,39 @@ func OptionsFromValue(v any) Options {
 }
 
 func bitsFormatFnFromOptions(opts Options) func(br bitio.ReaderAtSeeker) (any, error) {
+	fn := bitsFormatFnFromName(opts)
+	if opts.RawValues == nil {
+		return fn
+	}
+
+	maxBits := int64(opts.RawValues.MaxBytes) * 8
+	encoding := opts.RawValues.Encoding
+	return func(br bitio.ReaderAtSeeker) (any, error) {
+		brLen, err := bitioextra.Len(br)
+		if err != nil {
+			return nil, err
+		}
+		// only whole bytes can be round-tripped
+		if brLen > maxBits || brLen%8 != 0 {
+			return fn(br)
+		}
+
+		b := &bytes.Buffer{}
+		if _, err := bitioextra.CopyBits(b, br); err != nil {
+			return "", err
+		}
+		switch encoding {
+		case "base64":
+			return base64.StdEncoding.EncodeToString(b.Bytes()), nil
+		case "hex":
+			return hex.EncodeToString(b.Bytes()), nil
+		default:
+			return nil, fmt.Errorf("unknown raw_values encoding %q", encoding)
+		}
+	}
+}
+
+func bitsFormatFnFromName(opts Options) func(br bitio.ReaderAtSeeker) (any, error) {
 	switch opts.BitsFormat {
 	case "md5":
 		return func(br bitio.ReaderAtSeeker) (any, error) {
@@ -2,14 +2,21 @@ package interp
 
 import (
 	"fmt"
+	"math"
 	"math/big"
+	"sort"
 	"strconv"
 
+	"github.com/wader/fq/internal/gojqextra"
 	"github.com/wader/fq/internal/mathextra"
 	"github.com/wader/fq/pkg/bitio"
 	"github.com/wader/fq/pkg/scalar"
 )
 
+func init() {
+	RegisterFunc1("withbase", (*Interp).withBase)
+}
+
 func previewValue(v any, df scalar.DisplayFormat) string {
 	switch vv := v.(type) {
 	case bool:
@@ -43,3 +50,98 @@ func previewValue(v any, df scalar.DisplayFormat) string {
 		panic("unreachable")
 	}
 }
+
+func displayFormatFromBase(base int) (scalar.DisplayFormat, bool) {
+	switch base {
+	case 2:
+		return scalar.NumberBinary, true
+	case 8:
+		return scalar.NumberOctal, true
+	case 10:
+		return scalar.NumberDecimal, true
+	case 16:
+		return scalar.NumberHex, true
+	default:
+		return 0, false
+	}
+}
+
+// globMatch matches s against pattern where * matches zero or more of any character
+// including path separators and ? matches one character
+func globMatch(pattern string, s string) bool {
+	p, i := 0, 0
+	starP, starI := -1, 0
+	for i < len(s) {
+		switch {
+		case p < len(pattern) && (pattern[p] == '?' || pattern[p] == s[i]):
+			p++
+			i++
+		case p < len(pattern) && pattern[p] == '*':
+			starP, starI = p, i
+			p++
+		case starP != -1:
+			// backtrack and let last * consume one more character
+			p = starP + 1
+			starI++
+			i = starI
+		default:
+			return false
+		}
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+type displayBasePattern struct {
+	pattern string
+	df      scalar.DisplayFormat
+}
+
+// displayBasePatterns sorts patterns so that longest, most specific, pattern is tried first
+func displayBasePatterns(m map[string]int) ([]displayBasePattern, error) {
+	var ps []displayBasePattern
+	for pattern, base := range m {
+		df, ok := displayFormatFromBase(base)
+		if !ok {
+			return nil, fmt.Errorf("display_base: %q: base %d not 2, 8, 10 or 16", pattern, base)
+		}
+		ps = append(ps, displayBasePattern{pattern: pattern, df: df})
+	}
+	sort.Slice(ps, func(i, j int) bool {
+		if len(ps[i].pattern) != len(ps[j].pattern) {
+			return len(ps[i].pattern) > len(ps[j].pattern)
+		}
+		return ps[i].pattern < ps[j].pattern
+	})
+	return ps, nil
+}
+
+func (i *Interp) withBase(c any, base int) any {
+	df, ok := displayFormatFromBase(base)
+	if !ok {
+		return fmt.Errorf("withbase: base %d not 2, 8, 10 or 16", base)
+	}
+
+	v := c
+	if dv, ok := c.(DecodeValue); ok {
+		s, ok := dv.DecodeValue().V.(*scalar.S)
+		if !ok {
+			return fmt.Errorf("withbase: not a scalar value")
+		}
+		v = s.Actual
+	}
+
+	switch vv := v.(type) {
+	case int, int64, uint64, *big.Int:
+		return previewValue(vv, df)
+	case float64:
+		if vv != math.Trunc(vv) {
+			return fmt.Errorf("withbase: %v is not an integer", vv)
+		}
+		return previewValue(int64(vv), df)
+	default:
+		return &gojqextra.FuncTypeError{Name: "withbase", V: c}
+	}
+}
@@ -110,3 +110,30 @@ func Gaps(total Range, ranges []Range) []Range {
 
 	return gaps
 }
+
+// Union of ranges, overlapping and adjacent ranges are merged and result is sorted by start
+func Union(ranges []Range) []Range {
+	sorted := make([]Range, 0, len(ranges))
+	for _, r := range ranges {
+		if r.Len > 0 {
+			sorted = append(sorted, r)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Start < sorted[j].Start
+	})
+
+	merged := []Range{}
+	for _, r := range sorted {
+		if len(merged) > 0 {
+			l := &merged[len(merged)-1]
+			if r.Start <= l.Stop() {
+				l.Len = max(l.Stop(), r.Stop()) - l.Start
+				continue
+			}
+		}
+		merged = append(merged, r)
+	}
+
+	return merged
+}
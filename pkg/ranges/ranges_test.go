@@ -37,3 +37,30 @@ func TestRangeGaps(t *testing.T) {
 		})
 	}
 }
+
+func TestRangeUnion(t *testing.T) {
+	testCases := []struct {
+		ranges   string
+		expected string
+	}{
+		{"", ""},
+		{"0:0", ""},
+		{"0:10", "0:10"},
+
+		{"0:5 5:5", "0:10"},
+		{"0:5 6:4", "0:5 6:4"},
+		{"6:4 0:5", "0:5 6:4"},
+
+		{"0:10 2:3", "0:10"},
+		{"0:4 2:4 8:2 9:3", "0:6 8:4"},
+		{"10:2 0:1 3:0 1:1", "0:2 10:2"},
+	}
+	for _, tC := range testCases {
+		t.Run(fmt.Sprintf("%v_%v", tC.ranges, tC.expected), func(t *testing.T) {
+			actual := ranges.Union(ranges.SliceFromString(tC.ranges))
+			if !reflect.DeepEqual(ranges.SliceFromString(tC.expected), actual) {
+				t.Errorf("expected %v, got %v", tC.expected, actual)
+			}
+		})
+	}
+}
@@ -49,6 +49,8 @@ type S struct {
 	SymDisplay    DisplayFormat
 	Description   string
 	Unknown       bool
+	InvalidUTF8   bool // string actual was decoded from invalid UTF-8
+	Ref           bool // string actual is a path expression to a value relative to format root
 }
 
 func (s S) Value() any {
@@ -255,6 +257,10 @@ func DescriptionActualUTime(epoch time.Time, format string) Mapper {
 
 func DescriptionSymUTime(epoch time.Time, format string) Mapper {
 	return Fn(func(s S) (S, error) {
+		// sym is not set if for example parsing failed
+		if s.Sym == nil {
+			return s, nil
+		}
 		s.Description = epoch.Add(time.Second * time.Duration(s.SymU())).Format(format)
 		return s, nil
 	})
@@ -279,3 +285,22 @@ func DescriptionSymSTime(epoch time.Time, format string) Mapper {
 
 var DescriptionActualSUnixTime = DescriptionActualSTime(unixTimeEpochDate, time.RFC3339)
 var DescriptionSymSUnixTime = DescriptionSymSTime(unixTimeEpochDate, time.RFC3339)
+
+func SymActualUTime(epoch time.Time, format string) Mapper {
+	return Fn(func(s S) (S, error) {
+		s.Sym = epoch.Add(time.Second * time.Duration(s.ActualU())).Format(format)
+		return s, nil
+	})
+}
+
+var SymActualUUnixTime = SymActualUTime(unixTimeEpochDate, time.RFC3339)
+
+// fractional seconds, float64 has about microsecond precision for current unix times so round to that
+func DescriptionActualFTime(epoch time.Time, format string) Mapper {
+	return Fn(func(s S) (S, error) {
+		s.Description = epoch.Add(time.Duration(s.ActualF() * float64(time.Second))).Round(time.Microsecond).Format(format)
+		return s, nil
+	})
+}
+
+var DescriptionActualFUnixTime = DescriptionActualFTime(unixTimeEpochDate, time.RFC3339Nano)